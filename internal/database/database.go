@@ -21,6 +21,8 @@ type Database struct {
 	UserCommandRepo    *UserCommandRepository
 	CommandHistoryRepo *CommandHistoryRepository
 	AISessionRepo      AISessionRepository
+	TunnelRepo         *TunnelRepository
+	TransferRepo       *TransferRepository
 }
 
 // NewDatabase 创建数据库实例
@@ -58,6 +60,8 @@ func (d *Database) Initialize() error {
 	d.UserCommandRepo = NewUserCommandRepository(d.db)
 	d.CommandHistoryRepo = NewCommandHistoryRepository(d.db)
 	d.AISessionRepo = NewSQLiteAISessionRepository(d.db)
+	d.TunnelRepo = NewTunnelRepository(d.db)
+	d.TransferRepo = NewTransferRepository(d.db)
 
 	return nil
 }
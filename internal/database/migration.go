@@ -19,6 +19,15 @@ var migrations = []Migration{
 	{Version: 1, Name: "init schema", Up: migrateInitSchema},
 	{Version: 2, Name: "add proxy_jump_id", Up: migrateAddProxyJumpID},
 	{Version: 3, Name: "add ai sessions", Up: migrateAddAISessions},
+	{Version: 4, Name: "add bookmark tunnels", Up: migrateAddBookmarkTunnels},
+	{Version: 5, Name: "add bookmark tunnel options", Up: migrateAddTunnelOptions},
+	{Version: 6, Name: "add transfer jobs", Up: migrateAddTransferJobs},
+	{Version: 7, Name: "add transfer job options", Up: migrateAddTransferJobOptions},
+	{Version: 8, Name: "add transfer job verify", Up: migrateAddTransferJobVerify},
+	{Version: 9, Name: "add transfer history", Up: migrateAddTransferHistory},
+	{Version: 10, Name: "add transfer job rate limit", Up: migrateAddTransferJobRateLimit},
+	{Version: 11, Name: "add transfer job host", Up: migrateAddTransferJobHost},
+	{Version: 12, Name: "add transfer job owned targets", Up: migrateAddTransferJobOwned},
 }
 
 // migrateInitSchema 初始化数据库表结构（幂等）
@@ -149,6 +158,206 @@ func migrateAddAISessions(db *sql.DB) error {
 	return nil
 }
 
+// migrateAddBookmarkTunnels 添加书签隧道定义表（幂等）
+func migrateAddBookmarkTunnels(db *sql.DB) error {
+	createTunnelsTable := `
+	CREATE TABLE IF NOT EXISTS bookmark_tunnels (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		tunnel_id TEXT UNIQUE NOT NULL,
+		bookmark_id TEXT NOT NULL,
+		name TEXT NOT NULL,
+		tunnel_type TEXT NOT NULL,
+		local_addr TEXT DEFAULT '',
+		remote_addr TEXT DEFAULT '',
+		auto_start INTEGER NOT NULL DEFAULT 0,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	);`
+
+	createIndexes := `
+	CREATE INDEX IF NOT EXISTS idx_bookmark_tunnels_bookmark_id ON bookmark_tunnels(bookmark_id);
+	`
+
+	for _, sql := range []string{createTunnelsTable, createIndexes} {
+		if _, err := db.Exec(sql); err != nil {
+			return fmt.Errorf("exec sql failed: %w", err)
+		}
+	}
+
+	Logger.Debug("migration: added bookmark_tunnels table")
+	return nil
+}
+
+// migrateAddTunnelOptions 添加隧道附加选项列（JSON），用于动态转发的认证和访问控制（幂等）
+func migrateAddTunnelOptions(db *sql.DB) error {
+	var columnName string
+	err := db.QueryRow(`SELECT name FROM pragma_table_info('bookmark_tunnels') WHERE name = 'options'`).Scan(&columnName)
+	if err == sql.ErrNoRows {
+		_, err := db.Exec(`ALTER TABLE bookmark_tunnels ADD COLUMN options TEXT DEFAULT ''`)
+		if err != nil {
+			return fmt.Errorf("add column options failed: %w", err)
+		}
+		Logger.Debug("migration: added bookmark_tunnels options column")
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("check column options failed: %w", err)
+	}
+	return nil
+}
+
+// migrateAddTransferJobs 添加传输队列表（幂等）
+func migrateAddTransferJobs(db *sql.DB) error {
+	createJobsTable := `
+	CREATE TABLE IF NOT EXISTS transfer_jobs (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		job_id TEXT UNIQUE NOT NULL,
+		session_id TEXT DEFAULT '',
+		transfer_type TEXT NOT NULL,
+		is_dir INTEGER NOT NULL DEFAULT 0,
+		local_path TEXT NOT NULL,
+		remote_path TEXT NOT NULL,
+		status TEXT NOT NULL,
+		priority INTEGER NOT NULL DEFAULT 0,
+		total_size INTEGER NOT NULL DEFAULT 0,
+		transferred INTEGER NOT NULL DEFAULT 0,
+		error TEXT DEFAULT '',
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	);`
+
+	if _, err := db.Exec(createJobsTable); err != nil {
+		return fmt.Errorf("exec sql failed: %w", err)
+	}
+
+	Logger.Debug("migration: added transfer_jobs table")
+	return nil
+}
+
+// migrateAddTransferJobOptions 为 transfer_jobs 表添加 options 字段（幂等）
+func migrateAddTransferJobOptions(db *sql.DB) error {
+	var columnName string
+	err := db.QueryRow(`SELECT name FROM pragma_table_info('transfer_jobs') WHERE name = 'options'`).Scan(&columnName)
+	if err == sql.ErrNoRows {
+		_, err := db.Exec(`ALTER TABLE transfer_jobs ADD COLUMN options TEXT DEFAULT ''`)
+		if err != nil {
+			return fmt.Errorf("add column options failed: %w", err)
+		}
+		Logger.Debug("migration: added transfer_jobs options column")
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("check column options failed: %w", err)
+	}
+	return nil
+}
+
+// migrateAddTransferJobVerify 为 transfer_jobs 表添加 verify 字段（幂等）
+func migrateAddTransferJobVerify(db *sql.DB) error {
+	var columnName string
+	err := db.QueryRow(`SELECT name FROM pragma_table_info('transfer_jobs') WHERE name = 'verify'`).Scan(&columnName)
+	if err == sql.ErrNoRows {
+		_, err := db.Exec(`ALTER TABLE transfer_jobs ADD COLUMN verify TEXT DEFAULT ''`)
+		if err != nil {
+			return fmt.Errorf("add column verify failed: %w", err)
+		}
+		Logger.Debug("migration: added transfer_jobs verify column")
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("check column verify failed: %w", err)
+	}
+	return nil
+}
+
+// migrateAddTransferHistory 添加传输历史表（幂等）
+func migrateAddTransferHistory(db *sql.DB) error {
+	createHistoryTable := `
+	CREATE TABLE IF NOT EXISTS transfer_history (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		job_id TEXT NOT NULL,
+		session_id TEXT DEFAULT '',
+		bookmark_id TEXT DEFAULT '',
+		host TEXT DEFAULT '',
+		transfer_type TEXT NOT NULL,
+		is_dir INTEGER NOT NULL DEFAULT 0,
+		local_path TEXT NOT NULL,
+		remote_path TEXT NOT NULL,
+		total_size INTEGER NOT NULL DEFAULT 0,
+		transferred INTEGER NOT NULL DEFAULT 0,
+		duration_ms INTEGER NOT NULL DEFAULT 0,
+		avg_speed REAL NOT NULL DEFAULT 0,
+		status TEXT NOT NULL,
+		error TEXT DEFAULT '',
+		verify TEXT DEFAULT '',
+		options TEXT DEFAULT '',
+		started_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		finished_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	);
+	CREATE INDEX IF NOT EXISTS idx_transfer_history_finished_at ON transfer_history(finished_at);`
+
+	if _, err := db.Exec(createHistoryTable); err != nil {
+		return fmt.Errorf("exec sql failed: %w", err)
+	}
+
+	Logger.Debug("migration: added transfer_history table")
+	return nil
+}
+
+// migrateAddTransferJobRateLimit 为 transfer_jobs 表添加 rate_limit 字段（幂等）
+func migrateAddTransferJobRateLimit(db *sql.DB) error {
+	var columnName string
+	err := db.QueryRow(`SELECT name FROM pragma_table_info('transfer_jobs') WHERE name = 'rate_limit'`).Scan(&columnName)
+	if err == sql.ErrNoRows {
+		_, err := db.Exec(`ALTER TABLE transfer_jobs ADD COLUMN rate_limit INTEGER DEFAULT 0`)
+		if err != nil {
+			return fmt.Errorf("add column rate_limit failed: %w", err)
+		}
+		Logger.Debug("migration: added transfer_jobs rate_limit column")
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("check column rate_limit failed: %w", err)
+	}
+	return nil
+}
+
+// migrateAddTransferJobHost 为 transfer_jobs 表添加 host 字段（幂等）
+func migrateAddTransferJobHost(db *sql.DB) error {
+	var columnName string
+	err := db.QueryRow(`SELECT name FROM pragma_table_info('transfer_jobs') WHERE name = 'host'`).Scan(&columnName)
+	if err == sql.ErrNoRows {
+		_, err := db.Exec(`ALTER TABLE transfer_jobs ADD COLUMN host TEXT DEFAULT ''`)
+		if err != nil {
+			return fmt.Errorf("add column host failed: %w", err)
+		}
+		Logger.Debug("migration: added transfer_jobs host column")
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("check column host failed: %w", err)
+	}
+	return nil
+}
+
+// migrateAddTransferJobOwned 为 transfer_jobs 表添加 owned 字段，保存任务创建的目标文件（幂等）
+func migrateAddTransferJobOwned(db *sql.DB) error {
+	var columnName string
+	err := db.QueryRow(`SELECT name FROM pragma_table_info('transfer_jobs') WHERE name = 'owned'`).Scan(&columnName)
+	if err == sql.ErrNoRows {
+		_, err := db.Exec(`ALTER TABLE transfer_jobs ADD COLUMN owned TEXT DEFAULT ''`)
+		if err != nil {
+			return fmt.Errorf("add column owned failed: %w", err)
+		}
+		Logger.Debug("migration: added transfer_jobs owned column")
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("check column owned failed: %w", err)
+	}
+	return nil
+}
+
 // createSchemaMigrationsTable 创建迁移记录表
 func createSchemaMigrationsTable(db *sql.DB) error {
 	_, err := db.Exec(`
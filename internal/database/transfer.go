@@ -0,0 +1,277 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+const tableNameTransferJobs = "transfer jobs"
+
+// TransferJobDB 传输队列任务数据库模型
+type TransferJobDB struct {
+	AutoID       int       `json:"auto_id"` // 数据库自增主键
+	ID           string    `json:"id"`      // 字符串业务 ID，与传输 ID 一致
+	SessionID    string    `json:"session_id"`
+	Host         string    `json:"host"` // 入队时会话的 user@host:port，换会话继续时校验
+	TransferType string    `json:"transfer_type"`
+	IsDir        bool      `json:"is_dir"`
+	LocalPath    string    `json:"local_path"`
+	RemotePath   string    `json:"remote_path"`
+	Status       string    `json:"status"`
+	Priority     int       `json:"priority"`
+	RateLimit    int64     `json:"rate_limit"` // 单个传输的限速，字节/秒，0 表示不限速
+	TotalSize    int64     `json:"total_size"`
+	Transferred  int64     `json:"transferred"`
+	Error        string    `json:"error"`
+	Options      string    `json:"options"` // 附加选项 JSON，例如目录同步选项
+	Owned        string    `json:"owned"`   // 本任务创建的目标文件路径 JSON 数组，续传时只有这些文件不视为冲突
+	Verify       string    `json:"verify"`  // 传输后校验结果
+	CreatedAt    time.Time `json:"created_at"`
+	UpdatedAt    time.Time `json:"updated_at"`
+}
+
+// TransferRepository 传输队列数据访问接口
+type TransferRepository struct {
+	db *sql.DB
+}
+
+// NewTransferRepository 创建传输队列数据访问实例
+func NewTransferRepository(db *sql.DB) *TransferRepository {
+	return &TransferRepository{db: db}
+}
+
+// GetAllJobs 获取所有传输任务，按创建顺序排列
+func (r *TransferRepository) GetAllJobs() ([]*TransferJobDB, error) {
+	rows, err := r.db.Query(`SELECT id, job_id, session_id, COALESCE(host, ''), transfer_type, is_dir, local_path, remote_path, status, priority,
+		COALESCE(rate_limit, 0), total_size, transferred, error, COALESCE(options, ''), COALESCE(owned, ''), COALESCE(verify, ''),
+		created_at, updated_at FROM transfer_jobs ORDER BY id`)
+	if err != nil {
+		return nil, fmt.Errorf(errQuery, tableNameTransferJobs, err)
+	}
+	defer rows.Close()
+
+	jobs := make([]*TransferJobDB, 0)
+	for rows.Next() {
+		var j TransferJobDB
+		err := rows.Scan(&j.AutoID, &j.ID, &j.SessionID, &j.Host, &j.TransferType, &j.IsDir, &j.LocalPath, &j.RemotePath,
+			&j.Status, &j.Priority, &j.RateLimit, &j.TotalSize, &j.Transferred, &j.Error, &j.Options, &j.Owned, &j.Verify, &j.CreatedAt, &j.UpdatedAt)
+		if err != nil {
+			Logger.Error("scan transfer job failed", zap.Error(err))
+			continue
+		}
+		jobs = append(jobs, &j)
+	}
+	return jobs, nil
+}
+
+// InsertJob 插入传输任务
+func (r *TransferRepository) InsertJob(j *TransferJobDB) error {
+	query := `INSERT INTO transfer_jobs (job_id, session_id, host, transfer_type, is_dir, local_path, remote_path, status, priority,
+			  rate_limit, total_size, transferred, error, options, owned, verify, created_at, updated_at)
+			  VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
+	_, err := r.db.Exec(query,
+		j.ID, j.SessionID, j.Host, j.TransferType, j.IsDir, j.LocalPath, j.RemotePath, j.Status, j.Priority,
+		j.RateLimit, j.TotalSize, j.Transferred, j.Error, j.Options, j.Owned, j.Verify, j.CreatedAt, j.UpdatedAt)
+	if err != nil {
+		return fmt.Errorf(errInsertQuery, "transfer job", err)
+	}
+	return nil
+}
+
+// UpdateJob 更新传输任务的会话、主机、状态、优先级、限速、进度、校验结果、附加选项和创建的目标文件（根据字符串 ID）
+func (r *TransferRepository) UpdateJob(j *TransferJobDB) error {
+	query := `UPDATE transfer_jobs
+			  SET session_id = ?, host = ?, status = ?, priority = ?, rate_limit = ?, total_size = ?, transferred = ?, error = ?, verify = ?, options = ?, owned = ?, updated_at = ?
+			  WHERE job_id = ?`
+	_, err := r.db.Exec(query,
+		j.SessionID, j.Host, j.Status, j.Priority, j.RateLimit, j.TotalSize, j.Transferred, j.Error, j.Verify, j.Options, j.Owned, j.UpdatedAt, j.ID)
+	if err != nil {
+		return fmt.Errorf(errInsertQuery, "update transfer job", err)
+	}
+	return nil
+}
+
+// DeleteJob 删除传输任务（根据字符串 ID）
+func (r *TransferRepository) DeleteJob(id string) error {
+	_, err := r.db.Exec(`DELETE FROM transfer_jobs WHERE job_id = ?`, id)
+	if err != nil {
+		return fmt.Errorf(errDeleteQuery, "transfer job", err)
+	}
+	return nil
+}
+
+const tableNameTransferHistory = "transfer history"
+
+// TransferHistoryDB 传输历史数据库模型，每个结束（完成、失败、取消）的传输一条记录
+type TransferHistoryDB struct {
+	ID           int       `json:"id"`
+	JobID        string    `json:"job_id"`
+	SessionID    string    `json:"session_id"`
+	BookmarkID   string    `json:"bookmark_id"`
+	Host         string    `json:"host"` // user@host:port
+	TransferType string    `json:"transfer_type"`
+	IsDir        bool      `json:"is_dir"`
+	LocalPath    string    `json:"local_path"`
+	RemotePath   string    `json:"remote_path"`
+	TotalSize    int64     `json:"total_size"`
+	Transferred  int64     `json:"transferred"`
+	DurationMs   int64     `json:"duration_ms"`
+	AvgSpeed     float64   `json:"avg_speed"` // 字节/秒
+	Status       string    `json:"status"`
+	Error        string    `json:"error"`
+	Verify       string    `json:"verify"`
+	Options      string    `json:"options"`
+	StartedAt    time.Time `json:"started_at"`
+	FinishedAt   time.Time `json:"finished_at"`
+}
+
+// TransferHistoryFilter 传输历史查询条件，字段为空时不限制
+type TransferHistoryFilter struct {
+	Keyword      string // 匹配本地路径、远程路径、主机和错误信息
+	Status       string
+	TransferType string
+	BookmarkID   string
+	Since        time.Time
+	Until        time.Time
+	Limit        int
+	Offset       int
+}
+
+const transferHistoryColumns = `id, job_id, session_id, bookmark_id, host, transfer_type, is_dir, local_path, remote_path,
+	total_size, transferred, duration_ms, avg_speed, status, COALESCE(error, ''), COALESCE(verify, ''), COALESCE(options, ''),
+	started_at, finished_at`
+
+func scanTransferHistory(rows *sql.Rows) (*TransferHistoryDB, error) {
+	var h TransferHistoryDB
+	err := rows.Scan(&h.ID, &h.JobID, &h.SessionID, &h.BookmarkID, &h.Host, &h.TransferType, &h.IsDir, &h.LocalPath,
+		&h.RemotePath, &h.TotalSize, &h.Transferred, &h.DurationMs, &h.AvgSpeed, &h.Status, &h.Error, &h.Verify,
+		&h.Options, &h.StartedAt, &h.FinishedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &h, nil
+}
+
+// InsertHistory 插入传输历史
+func (r *TransferRepository) InsertHistory(h *TransferHistoryDB) (int64, error) {
+	query := `INSERT INTO transfer_history (job_id, session_id, bookmark_id, host, transfer_type, is_dir, local_path, remote_path,
+			  total_size, transferred, duration_ms, avg_speed, status, error, verify, options, started_at, finished_at)
+			  VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
+	result, err := r.db.Exec(query,
+		h.JobID, h.SessionID, h.BookmarkID, h.Host, h.TransferType, h.IsDir, h.LocalPath, h.RemotePath,
+		h.TotalSize, h.Transferred, h.DurationMs, h.AvgSpeed, h.Status, h.Error, h.Verify, h.Options, h.StartedAt.UTC(), h.FinishedAt.UTC())
+	if err != nil {
+		return 0, fmt.Errorf(errInsertQuery, tableNameTransferHistory, err)
+	}
+	return result.LastInsertId()
+}
+
+// ListHistory 按结束时间倒序查询传输历史，返回当前页和符合条件的总数。
+// 时间统一以 UTC 保存，按时间范围比较时结果与文本顺序一致
+func (r *TransferRepository) ListHistory(f TransferHistoryFilter) ([]*TransferHistoryDB, int, error) {
+	where := []string{"1 = 1"}
+	args := make([]any, 0)
+	if f.Keyword != "" {
+		like := "%" + strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(f.Keyword) + "%"
+		where = append(where, `(local_path LIKE ? ESCAPE '\' OR remote_path LIKE ? ESCAPE '\' OR host LIKE ? ESCAPE '\' OR error LIKE ? ESCAPE '\')`)
+		args = append(args, like, like, like, like)
+	}
+	if f.Status != "" {
+		where = append(where, "status = ?")
+		args = append(args, f.Status)
+	}
+	if f.TransferType != "" {
+		where = append(where, "transfer_type = ?")
+		args = append(args, f.TransferType)
+	}
+	if f.BookmarkID != "" {
+		where = append(where, "bookmark_id = ?")
+		args = append(args, f.BookmarkID)
+	}
+	if !f.Since.IsZero() {
+		where = append(where, "finished_at >= ?")
+		args = append(args, f.Since.UTC())
+	}
+	if !f.Until.IsZero() {
+		where = append(where, "finished_at < ?")
+		args = append(args, f.Until.UTC())
+	}
+	cond := strings.Join(where, " AND ")
+
+	var total int
+	if err := r.db.QueryRow(`SELECT COUNT(*) FROM transfer_history WHERE `+cond, args...).Scan(&total); err != nil {
+		return nil, 0, fmt.Errorf(errQuery, tableNameTransferHistory, err)
+	}
+
+	limit := f.Limit
+	if limit <= 0 {
+		limit = 100
+	}
+	rows, err := r.db.Query(`SELECT `+transferHistoryColumns+` FROM transfer_history WHERE `+cond+
+		` ORDER BY finished_at DESC, id DESC LIMIT ? OFFSET ?`, append(args, limit, max(f.Offset, 0))...)
+	if err != nil {
+		return nil, 0, fmt.Errorf(errQuery, tableNameTransferHistory, err)
+	}
+	defer rows.Close()
+
+	history := make([]*TransferHistoryDB, 0)
+	for rows.Next() {
+		h, err := scanTransferHistory(rows)
+		if err != nil {
+			Logger.Error("scan transfer history failed", zap.Error(err))
+			continue
+		}
+		history = append(history, h)
+	}
+	return history, total, nil
+}
+
+// GetHistory 根据 ID 获取传输历史
+func (r *TransferRepository) GetHistory(id int) (*TransferHistoryDB, error) {
+	rows, err := r.db.Query(`SELECT `+transferHistoryColumns+` FROM transfer_history WHERE id = ?`, id)
+	if err != nil {
+		return nil, fmt.Errorf(errQuery, tableNameTransferHistory, err)
+	}
+	defer rows.Close()
+	if !rows.Next() {
+		return nil, fmt.Errorf("transfer history %d not found", id)
+	}
+	return scanTransferHistory(rows)
+}
+
+// DeleteHistory 删除一条传输历史
+func (r *TransferRepository) DeleteHistory(id int) error {
+	_, err := r.db.Exec(`DELETE FROM transfer_history WHERE id = ?`, id)
+	if err != nil {
+		return fmt.Errorf(errDeleteQuery, tableNameTransferHistory, err)
+	}
+	return nil
+}
+
+// ClearHistory 删除 before 之前结束的传输历史，before 为零值时清空全部
+func (r *TransferRepository) ClearHistory(before time.Time) error {
+	var err error
+	if before.IsZero() {
+		_, err = r.db.Exec(`DELETE FROM transfer_history`)
+	} else {
+		_, err = r.db.Exec(`DELETE FROM transfer_history WHERE finished_at < ?`, before.UTC())
+	}
+	if err != nil {
+		return fmt.Errorf(errDeleteQuery, tableNameTransferHistory, err)
+	}
+	return nil
+}
+
+// PruneHistory 删除 before 之前结束的传输历史，并只保留最近结束的 keep 条
+func (r *TransferRepository) PruneHistory(before time.Time, keep int) error {
+	_, err := r.db.Exec(`DELETE FROM transfer_history WHERE finished_at < ? OR id NOT IN
+		(SELECT id FROM transfer_history ORDER BY finished_at DESC, id DESC LIMIT ?)`, before.UTC(), keep)
+	if err != nil {
+		return fmt.Errorf(errDeleteQuery, tableNameTransferHistory, err)
+	}
+	return nil
+}
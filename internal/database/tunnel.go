@@ -0,0 +1,141 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+const tableNameBookmarkTunnels = "bookmark tunnels"
+
+// BookmarkTunnelDB 书签隧道定义数据库模型
+type BookmarkTunnelDB struct {
+	AutoID     int       `json:"auto_id"` // 数据库自增主键
+	ID         string    `json:"id"`      // 字符串业务 ID
+	BookmarkID string    `json:"bookmark_id"`
+	Name       string    `json:"name"`
+	TunnelType string    `json:"tunnel_type"`
+	LocalAddr  string    `json:"local_addr"`
+	RemoteAddr string    `json:"remote_addr"`
+	AutoStart  bool      `json:"auto_start"`
+	Options    string    `json:"options"` // 附加选项 JSON，例如动态转发的认证和访问控制
+	CreatedAt  time.Time `json:"created_at"`
+	UpdatedAt  time.Time `json:"updated_at"`
+}
+
+// TunnelRepository 书签隧道定义数据访问接口
+type TunnelRepository struct {
+	db *sql.DB
+}
+
+// NewTunnelRepository 创建隧道定义数据访问实例
+func NewTunnelRepository(db *sql.DB) *TunnelRepository {
+	return &TunnelRepository{db: db}
+}
+
+const selectTunnelColumns = `SELECT id, tunnel_id, bookmark_id, name, tunnel_type, local_addr, remote_addr, auto_start, options, created_at, updated_at FROM bookmark_tunnels`
+
+func scanTunnel(scanner interface{ Scan(...any) error }) (*BookmarkTunnelDB, error) {
+	var t BookmarkTunnelDB
+	err := scanner.Scan(&t.AutoID, &t.ID, &t.BookmarkID, &t.Name, &t.TunnelType,
+		&t.LocalAddr, &t.RemoteAddr, &t.AutoStart, &t.Options, &t.CreatedAt, &t.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
+func (r *TunnelRepository) queryTunnels(query string, args ...any) ([]*BookmarkTunnelDB, error) {
+	rows, err := r.db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf(errQuery, tableNameBookmarkTunnels, err)
+	}
+	defer rows.Close()
+
+	tunnels := make([]*BookmarkTunnelDB, 0)
+	for rows.Next() {
+		t, err := scanTunnel(rows)
+		if err != nil {
+			Logger.Error("scan bookmark tunnel failed", zap.Error(err))
+			continue
+		}
+		tunnels = append(tunnels, t)
+	}
+	return tunnels, nil
+}
+
+// GetAllTunnels 获取所有隧道定义
+func (r *TunnelRepository) GetAllTunnels() ([]*BookmarkTunnelDB, error) {
+	return r.queryTunnels(selectTunnelColumns + ` ORDER BY id`)
+}
+
+// GetTunnelsByBookmarkID 按书签 ID 查询隧道定义
+func (r *TunnelRepository) GetTunnelsByBookmarkID(bookmarkID string) ([]*BookmarkTunnelDB, error) {
+	return r.queryTunnels(selectTunnelColumns+` WHERE bookmark_id = ? ORDER BY id`, bookmarkID)
+}
+
+// GetTunnelByID 按字符串 ID 查询隧道定义
+func (r *TunnelRepository) GetTunnelByID(id string) (*BookmarkTunnelDB, error) {
+	t, err := scanTunnel(r.db.QueryRow(selectTunnelColumns+` WHERE tunnel_id = ?`, id))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("tunnel not found")
+		}
+		return nil, fmt.Errorf(errQuery, "bookmark tunnel by id", err)
+	}
+	return t, nil
+}
+
+// InsertTunnel 插入隧道定义
+func (r *TunnelRepository) InsertTunnel(t *BookmarkTunnelDB) error {
+	query := `INSERT INTO bookmark_tunnels (tunnel_id, bookmark_id, name, tunnel_type, local_addr, remote_addr, auto_start, options, created_at, updated_at)
+			  VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
+	_, err := r.db.Exec(query,
+		t.ID, t.BookmarkID, t.Name, t.TunnelType, t.LocalAddr, t.RemoteAddr, t.AutoStart, t.Options,
+		t.CreatedAt, t.UpdatedAt)
+	if err != nil {
+		return fmt.Errorf(errInsertQuery, "bookmark tunnel", err)
+	}
+
+	Logger.Debug("bookmark tunnel inserted", zap.String("id", t.ID))
+	return nil
+}
+
+// UpdateTunnel 更新隧道定义（根据字符串 ID）
+func (r *TunnelRepository) UpdateTunnel(t *BookmarkTunnelDB) error {
+	query := `UPDATE bookmark_tunnels
+			  SET name = ?, tunnel_type = ?, local_addr = ?, remote_addr = ?, auto_start = ?, options = ?, updated_at = ?
+			  WHERE tunnel_id = ?`
+	_, err := r.db.Exec(query,
+		t.Name, t.TunnelType, t.LocalAddr, t.RemoteAddr, t.AutoStart, t.Options, t.UpdatedAt, t.ID)
+	if err != nil {
+		return fmt.Errorf(errInsertQuery, "update bookmark tunnel", err)
+	}
+
+	Logger.Debug("bookmark tunnel updated", zap.String("id", t.ID))
+	return nil
+}
+
+// DeleteTunnel 删除隧道定义（根据字符串 ID）
+func (r *TunnelRepository) DeleteTunnel(id string) error {
+	_, err := r.db.Exec(`DELETE FROM bookmark_tunnels WHERE tunnel_id = ?`, id)
+	if err != nil {
+		return fmt.Errorf(errDeleteQuery, "bookmark tunnel", err)
+	}
+
+	Logger.Debug("bookmark tunnel deleted", zap.String("id", id))
+	return nil
+}
+
+// DeleteTunnelsByBookmarkID 删除书签下的所有隧道定义
+func (r *TunnelRepository) DeleteTunnelsByBookmarkID(bookmarkID string) error {
+	_, err := r.db.Exec(`DELETE FROM bookmark_tunnels WHERE bookmark_id = ?`, bookmarkID)
+	if err != nil {
+		return fmt.Errorf(errDeleteQuery, "bookmark tunnels by bookmark id", err)
+	}
+
+	Logger.Debug("bookmark tunnels deleted", zap.String("bookmarkID", bookmarkID))
+	return nil
+}
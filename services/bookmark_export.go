@@ -0,0 +1,101 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+const bookmarkExportVersion = 1
+
+// BookmarkExport 书签导出文件结构
+type BookmarkExport struct {
+	Version    int                   `json:"version"`
+	ExportedAt int64                 `json:"exported_at"`
+	Groups     []BookmarkExportGroup `json:"groups"`
+}
+
+// BookmarkExportGroup 导出的书签分组
+type BookmarkExportGroup struct {
+	Name      string               `json:"name"`
+	Bookmarks []BookmarkExportItem `json:"bookmarks"`
+}
+
+// BookmarkExportItem 导出的书签，包含书签下的隧道定义
+type BookmarkExportItem struct {
+	SSHBookmark
+	Tunnels []SavedTunnel `json:"tunnels"`
+}
+
+// buildBookmarkExport 组装导出数据，不包含任何密码
+func (bs *BookmarkService) buildBookmarkExport() (*BookmarkExport, error) {
+	groups, err := bs.ListBookmarks()
+	if err != nil {
+		return nil, err
+	}
+	dbTunnels, err := bs.db.TunnelRepo.GetAllTunnels()
+	if err != nil {
+		return nil, err
+	}
+	tunnelsByBookmark := make(map[string][]SavedTunnel)
+	for _, dt := range dbTunnels {
+		st := savedTunnelFromDB(dt)
+		if st.Dynamic != nil {
+			st.Dynamic.Password = ""
+		}
+		tunnelsByBookmark[dt.BookmarkID] = append(tunnelsByBookmark[dt.BookmarkID], st)
+	}
+
+	export := &BookmarkExport{
+		Version:    bookmarkExportVersion,
+		ExportedAt: time.Now().Unix(),
+		Groups:     make([]BookmarkExportGroup, 0, len(groups)),
+	}
+	for _, g := range groups {
+		eg := BookmarkExportGroup{Name: g.Name, Bookmarks: make([]BookmarkExportItem, 0, len(g.Bookmarks))}
+		for _, b := range g.Bookmarks {
+			b.Password = ""
+			b.PrivateKeyPassword = ""
+			tunnels := tunnelsByBookmark[b.ID]
+			if tunnels == nil {
+				tunnels = []SavedTunnel{}
+			}
+			eg.Bookmarks = append(eg.Bookmarks, BookmarkExportItem{SSHBookmark: b, Tunnels: tunnels})
+		}
+		export.Groups = append(export.Groups, eg)
+	}
+	return export, nil
+}
+
+// ExportBookmarks 导出书签（含隧道定义，不含密码）到用户选择的 JSON 文件，返回文件路径
+func (bs *BookmarkService) ExportBookmarks() (string, error) {
+	filePath, err := app.Dialog.SaveFile().
+		SetMessage("导出书签").
+		SetFilename(fmt.Sprintf("vexo-bookmarks-%s.json", time.Now().Format("20060102"))).
+		CanCreateDirectories(true).
+		PromptForSingleSelection()
+	if err != nil {
+		return "", err
+	}
+	if filePath == "" {
+		return "", nil
+	}
+
+	export, err := bs.buildBookmarkExport()
+	if err != nil {
+		return "", err
+	}
+	data, err := json.MarshalIndent(export, "", "  ")
+	if err != nil {
+		return "", fmt.Errorf("marshal bookmarks failed: %w", err)
+	}
+	if err := os.WriteFile(filePath, data, 0600); err != nil {
+		return "", fmt.Errorf("write export file failed: %w", err)
+	}
+
+	Logger.Debug("bookmarks exported", zap.String("file", filePath))
+	return filePath, nil
+}
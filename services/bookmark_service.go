@@ -79,12 +79,23 @@ func (bs *BookmarkService) ConnectBookmark(bookmarkID string) {
 
 // ConnectBookmarkByID 连接书签，通过书签ID获取连接信息并连接
 func (bs *BookmarkService) ConnectBookmarkByID(bookmarkID string) (string, error) {
+	sessionID, err := bs.connectBookmark(bookmarkID, false)
+	if err != nil {
+		return "", err
+	}
+	// 启动书签下配置为自动启动的隧道
+	sshTunnelService.startAutoTunnels(sessionID, bookmarkID)
+	return sessionID, nil
+}
+
+// connectBookmark 使用书签信息建立连接并记录书签 ID，headless 为 true 时作为隧道连接，返回会话 ID
+func (bs *BookmarkService) connectBookmark(bookmarkID string, headless bool) (string, error) {
 	bookmark, err := bs.getDecryptedBookmarkByID(bookmarkID)
 	if err != nil {
 		return "", err
 	}
 
-	return bs.sshService.Connect(
+	return bs.sshService.connect(
 		bookmark.Host,
 		bookmark.Port,
 		bookmark.User,
@@ -92,6 +103,13 @@ func (bs *BookmarkService) ConnectBookmarkByID(bookmarkID string) (string, error
 		bookmark.PrivateKey,
 		bookmark.PrivateKeyPassword,
 		bookmark.ProxyJumpID,
+		func(sc *SSHConnect) {
+			sc.bookmarkID = bookmarkID
+			if headless {
+				sc.headless = true
+				sc.headlessDone = make(chan struct{})
+			}
+		},
 	)
 }
 
@@ -473,6 +491,9 @@ func (bs *BookmarkService) DeleteBookmark(bookmarkID string) error {
 	if err != nil {
 		return err
 	}
+	if err := bs.db.TunnelRepo.DeleteTunnelsByBookmarkID(bookmarkID); err != nil {
+		Logger.Warn("delete bookmark tunnels failed", zap.String("id", bookmarkID), zap.Error(err))
+	}
 
 	app.Event.Emit(EventBookmarkUpdate, BookmarkUpdateMsg)
 	Logger.Debug("bookmark deleted", zap.String("id", bookmarkID))
@@ -67,6 +67,7 @@ type Config struct {
 	Terminal TerminalConfig          `toml:"terminal"`
 	Sync     internalsync.SyncConfig `toml:"sync"`
 	AI       AIConfig                `toml:"ai"`
+	Transfer TransferConfig          `toml:"transfer"`
 }
 
 type GeneralConfig struct {
@@ -80,6 +81,21 @@ type TerminalConfig struct {
 	LineHeight float64 `toml:"line_height" json:"lineHeight"`
 }
 
+// TransferConfig 文件传输配置，0 表示使用默认值
+type TransferConfig struct {
+	MaxConcurrent  int    `toml:"max_concurrent" json:"maxConcurrent"`   // 全局同时进行的传输数
+	MaxPerSession  int    `toml:"max_per_session" json:"maxPerSession"`  // 每个会话同时进行的传输数
+	Editor         string `toml:"editor" json:"editor"`                  // 编辑远程文件使用的本地编辑器命令，为空使用系统默认程序
+	Verify         bool   `toml:"verify" json:"verify"`                  // 上传和下载完成后比对本地与远程文件的 SHA-256
+	RateLimit      int64  `toml:"rate_limit" json:"rateLimit"`           // 所有传输的总限速，字节/秒，0 表示不限速
+	ConflictPolicy string `toml:"conflict_policy" json:"conflictPolicy"` // 上传和下载目标文件已存在时的默认处理方式，为空时覆盖
+	PreserveMode   bool   `toml:"preserve_mode" json:"preserveMode"`     // 上传和下载时保留权限位
+	PreserveMtime  bool   `toml:"preserve_mtime" json:"preserveMtime"`   // 上传和下载时保留修改时间
+	Symlinks       string `toml:"symlinks" json:"symlinks"`              // 目录传输中符号链接的处理方式：follow/copy/skip，为空时按链接复制
+	WatchInterval  int    `toml:"watch_interval" json:"watchInterval"`   // 监视远程目录的轮询间隔，秒，远程主机有 inotifywait 时不轮询
+	HistoryDays    int    `toml:"history_days" json:"historyDays"`       // 传输历史保留的天数，默认 90 天
+}
+
 // AppConfig 应用配置
 type AppConfig struct {
 	General GeneralConfig `toml:"general"`
@@ -323,6 +339,34 @@ func (cs *ConfigService) SaveTerminalConfig(terminalConfig TerminalConfig) error
 	return cs.saveToFile()
 }
 
+// SaveTransferConfig 保存文件传输配置，并发限制和限速立即生效
+func (cs *ConfigService) SaveTransferConfig(transferConfig TransferConfig) error {
+	if transferConfig.MaxConcurrent < 0 || transferConfig.MaxPerSession < 0 {
+		return fmt.Errorf("并发数不能为负数")
+	}
+	if transferConfig.RateLimit < 0 {
+		return fmt.Errorf("限速不能为负数")
+	}
+	if transferConfig.WatchInterval < 0 {
+		return fmt.Errorf("轮询间隔不能为负数")
+	}
+	if transferConfig.HistoryDays < 0 {
+		return fmt.Errorf("历史保留天数不能为负数")
+	}
+	if err := validConflictPolicy(transferConfig.ConflictPolicy, true); err != nil {
+		return err
+	}
+	if err := validSymlinkPolicy(transferConfig.Symlinks); err != nil {
+		return err
+	}
+	cs.Config.Transfer = transferConfig
+	Logger.Debug("save transfer config", zap.Any("transferConfig", transferConfig))
+	if transferQueue != nil {
+		transferQueue.setLimits(transferConfig)
+	}
+	return cs.saveToFile()
+}
+
 // SetUserPassword 设置用户密码用于加密/解密
 func (cs *ConfigService) SetUserPassword(password string) {
 	Logger.Debug("set user password")
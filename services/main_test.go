@@ -0,0 +1,34 @@
+package services
+
+import (
+	"net"
+	"os"
+	"testing"
+
+	"github.com/pkg/sftp"
+	"go.uber.org/zap"
+)
+
+func TestMain(m *testing.M) {
+	Logger = zap.NewNop()
+	os.Exit(m.Run())
+}
+
+// newMemSftpClient 返回连接到内存 SFTP 服务器的客户端，测试结束时关闭
+func newMemSftpClient(t *testing.T) *sftp.Client {
+	t.Helper()
+	serverConn, clientConn := net.Pipe()
+	server := sftp.NewRequestServer(serverConn, sftp.InMemHandler())
+	go func() {
+		_ = server.Serve()
+	}()
+	client, err := sftp.NewClientPipe(clientConn, clientConn)
+	if err != nil {
+		t.Fatalf("sftp client: %v", err)
+	}
+	t.Cleanup(func() {
+		client.Close()
+		server.Close()
+	})
+	return client
+}
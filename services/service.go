@@ -42,9 +42,10 @@ func RegisterServices(a *application.App, mainWindow *application.WebviewWindow)
 
 	sshService := NewSSHService()
 	sftpService := NewSftpService()
+	initTransferQueue(sftpService, db, configService.Config.Transfer)
 	bookmarkService := NewBookmarkService(db, sshService, configService)
 	sshService.setBookmarkService(bookmarkService)
-	sshTunnelService := NewSSHTunnelService(sshService)
+	sshTunnelService := NewSSHTunnelService(sshService, db)
 	commandService := NewCommandService(sshService, db)
 	syncService := NewSyncService(configService)
 	toolService := NewToolService()
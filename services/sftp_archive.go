@@ -0,0 +1,516 @@
+package services
+
+import (
+	"archive/tar"
+	"bufio"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/sftp"
+	"go.uber.org/zap"
+)
+
+// 远程压缩包操作：通过 exec 通道执行 tar/zip 压缩和解压，目录以 tar.gz 流式下载
+
+const (
+	ArchiveFormatTarGz = "tar.gz"
+	ArchiveFormatTar   = "tar"
+	ArchiveFormatZip   = "zip"
+)
+
+// ArchiveOptions 压缩包任务选项
+type ArchiveOptions struct {
+	Format  string   `json:"format"`  // tar.gz/tar/zip
+	Sources []string `json:"sources"` // 压缩：要压缩的文件和目录，必须位于同一目录下
+	Target  string   `json:"target"`  // 解压：远程目标目录
+	Extract bool     `json:"extract"` // tar 流式下载：在本地解压，否则保存为 .tar.gz 文件
+}
+
+// archiveFormatOf 根据文件名判断压缩包格式
+func archiveFormatOf(name string) (string, error) {
+	lower := strings.ToLower(name)
+	switch {
+	case strings.HasSuffix(lower, ".tar.gz"), strings.HasSuffix(lower, ".tgz"):
+		return ArchiveFormatTarGz, nil
+	case strings.HasSuffix(lower, ".tar"):
+		return ArchiveFormatTar, nil
+	case strings.HasSuffix(lower, ".zip"):
+		return ArchiveFormatZip, nil
+	}
+	return "", fmt.Errorf("不支持的压缩格式: %s", path.Base(name))
+}
+
+// tarFlag 返回 tar 的压缩参数
+func tarFlag(format string) string {
+	if format == ArchiveFormatTarGz {
+		return "z"
+	}
+	return ""
+}
+
+// archiveProgress 根据 tar/zip/unzip 逐行输出的文件名累计已处理的字节数
+type archiveProgress struct {
+	sizes   map[string]int64 // 相对路径到文件大小
+	prefix  string           // 输出中需要去掉的前缀，例如 unzip 的目标目录
+	tracker *transferTracker
+	last    string // 最后一行无法匹配的输出，命令失败时作为错误信息
+}
+
+func (p *archiveProgress) line(line string) {
+	line = strings.TrimSpace(line)
+	raw := line
+	for _, verb := range []string{"adding:", "inflating:", "extracting:", "creating:", "updating:"} {
+		if rest, ok := strings.CutPrefix(line, verb); ok {
+			line = strings.TrimSpace(rest)
+			break
+		}
+	}
+	// zip 输出形如 "dir/file (deflated 50%)"
+	if i := strings.LastIndex(line, " ("); i > 0 && strings.HasSuffix(line, ")") {
+		line = line[:i]
+	}
+	line = strings.TrimPrefix(line, p.prefix)
+	line = strings.TrimPrefix(strings.TrimSuffix(line, "/"), "./")
+	if size, ok := p.sizes[line]; ok {
+		p.tracker.update(size)
+		delete(p.sizes, line)
+	} else if raw != "" {
+		p.last = raw
+	}
+}
+
+// runArchiveCommand 执行压缩或解压命令，并根据输出更新进度
+func (sft *SftpService) runArchiveCommand(sessionID, command string, progress *archiveProgress) error {
+	client, err := sft.getSSHClient(sessionID)
+	if err != nil {
+		return err
+	}
+	Logger.Debug("archive command", zap.String("id", progress.tracker.id), zap.String("command", command))
+	rc, err := startRemoteCommand(progress.tracker.ctx, client, command)
+	if err != nil {
+		return fmt.Errorf("服务器不允许执行命令: %w", err)
+	}
+	scanner := bufio.NewScanner(rc.Stdout)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		progress.line(scanner.Text())
+	}
+	err = rc.Wait()
+	if progress.tracker.ctx.Err() != nil {
+		return errors.New("user cancelled")
+	}
+	if err != nil && progress.last != "" {
+		return fmt.Errorf("%w: %s", err, progress.last)
+	}
+	return err
+}
+
+// remoteTreeSizes 统计 parent 下各个 names 的文件大小，键为相对 parent 的路径
+func remoteTreeSizes(ftpClient *sftp.Client, parent string, names []string) (map[string]int64, int64, error) {
+	sizes := make(map[string]int64)
+	var total int64
+	prefix := strings.TrimSuffix(parent, "/") + "/"
+	for _, name := range names {
+		walker := ftpClient.Walk(joinRemotePath(parent, name))
+		for walker.Step() {
+			if err := walker.Err(); err != nil {
+				return nil, 0, err
+			}
+			rel := strings.TrimPrefix(walker.Path(), prefix)
+			stat := walker.Stat()
+			if stat.Mode().IsRegular() {
+				sizes[rel] = stat.Size()
+				total += stat.Size()
+			}
+		}
+	}
+	return sizes, total, nil
+}
+
+// CompressRemote 在远程服务器上将 sources 压缩为 archivePath，格式由 archivePath 扩展名决定（.tar.gz/.tgz/.tar/.zip），
+// 返回传输 ID，进度通过 EventProgress 推送，可用 CancelTransfer 取消
+func (sft *SftpService) CompressRemote(sessionID string, sources []string, archivePath string) (string, error) {
+	Logger.Debug("CompressRemote", zap.String("sessionID", sessionID), zap.Strings("sources", sources), zap.String("archivePath", archivePath))
+	if len(sources) == 0 {
+		return "", fmt.Errorf("请选择要压缩的文件")
+	}
+	format, err := archiveFormatOf(archivePath)
+	if err != nil {
+		return "", err
+	}
+	parent := path.Dir(path.Clean(sources[0]))
+	for _, src := range sources {
+		if path.Dir(path.Clean(src)) != parent {
+			return "", fmt.Errorf("要压缩的文件必须位于同一目录下")
+		}
+	}
+	ftpClient, err := sft.getSftpClient(sessionID)
+	if err != nil {
+		return "", err
+	}
+	if _, err := ftpClient.Stat(archivePath); err == nil {
+		return "", fmt.Errorf("%s exists", archivePath)
+	}
+	spec := transferSpec{
+		sessionID:    sessionID,
+		transferType: TransferTypeCompress,
+		remotePath:   path.Clean(archivePath),
+		options:      transferOptions{Archive: &ArchiveOptions{Format: format, Sources: sources}},
+	}
+	return transferQueue.enqueue(spec, 0), nil
+}
+
+// compressRemote 执行远程压缩，失败或取消时删除未完成的压缩包
+func (sft *SftpService) compressRemote(spec transferSpec, tracker *transferTracker) error {
+	opts := spec.options.Archive
+	ftpClient, err := sft.getSftpClient(spec.sessionID)
+	if err != nil {
+		return err
+	}
+	parent := path.Dir(path.Clean(opts.Sources[0]))
+	names := make([]string, 0, len(opts.Sources))
+	quoted := make([]string, 0, len(opts.Sources))
+	for _, src := range opts.Sources {
+		name := path.Base(path.Clean(src))
+		names = append(names, name)
+		quoted = append(quoted, shellQuote(name))
+	}
+	sizes, total, err := remoteTreeSizes(ftpClient, parent, names)
+	if err != nil {
+		return err
+	}
+	tracker.setTotal(total)
+
+	var command string
+	if opts.Format == ArchiveFormatZip {
+		command = fmt.Sprintf("cd %s && zip -r -y %s %s", shellQuote(parent), shellQuote(spec.remotePath), strings.Join(quoted, " "))
+	} else {
+		command = fmt.Sprintf("cd %s && tar -c%svf %s -- %s", shellQuote(parent), tarFlag(opts.Format), shellQuote(spec.remotePath), strings.Join(quoted, " "))
+	}
+	// GNU tar 在 -f 指定文件时把文件列表输出到 stdout，部分实现输出到 stderr，这里合并
+	err = sft.runArchiveCommand(spec.sessionID, command+" 2>&1", &archiveProgress{sizes: sizes, tracker: tracker})
+	if err != nil {
+		if rmErr := ftpClient.Remove(spec.remotePath); rmErr != nil && !os.IsNotExist(rmErr) {
+			Logger.Warn("remove incomplete archive failed", zap.String("path", spec.remotePath), zap.Error(rmErr))
+		}
+		return err
+	}
+	tracker.setTransferred(total)
+	return nil
+}
+
+// ExtractRemote 在远程服务器上将 archivePath 解压到 targetDir，格式由扩展名决定，已存在的文件会被覆盖。
+// 返回传输 ID，进度通过 EventProgress 推送，可用 CancelTransfer 取消
+func (sft *SftpService) ExtractRemote(sessionID string, archivePath string, targetDir string) (string, error) {
+	Logger.Debug("ExtractRemote", zap.String("sessionID", sessionID), zap.String("archivePath", archivePath), zap.String("targetDir", targetDir))
+	format, err := archiveFormatOf(archivePath)
+	if err != nil {
+		return "", err
+	}
+	if targetDir == "" {
+		targetDir = path.Dir(archivePath)
+	}
+	ftpClient, err := sft.getSftpClient(sessionID)
+	if err != nil {
+		return "", err
+	}
+	if _, err := ftpClient.Stat(archivePath); err != nil {
+		return "", err
+	}
+	spec := transferSpec{
+		sessionID:    sessionID,
+		transferType: TransferTypeExtract,
+		remotePath:   path.Clean(archivePath),
+		options:      transferOptions{Archive: &ArchiveOptions{Format: format, Target: path.Clean(targetDir)}},
+	}
+	return transferQueue.enqueue(spec, 0), nil
+}
+
+// listArchiveSizes 列出压缩包内容，返回相对路径到文件大小的映射
+func (sft *SftpService) listArchiveSizes(spec transferSpec, tracker *transferTracker) (map[string]int64, int64, error) {
+	client, err := sft.getSSHClient(spec.sessionID)
+	if err != nil {
+		return nil, 0, err
+	}
+	opts := spec.options.Archive
+	command := fmt.Sprintf("LC_ALL=C tar -t%svf %s", tarFlag(opts.Format), shellQuote(spec.remotePath))
+	if opts.Format == ArchiveFormatZip {
+		command = fmt.Sprintf("LC_ALL=C unzip -l %s", shellQuote(spec.remotePath))
+	}
+	out, err := runRemoteOutput(tracker.ctx, client, command)
+	if err != nil {
+		return nil, 0, fmt.Errorf("读取压缩包失败: %w", err)
+	}
+	sizes := make(map[string]int64)
+	var total int64
+	for _, line := range strings.Split(string(out), "\n") {
+		name, size, ok := parseArchiveListLine(line, opts.Format)
+		if !ok {
+			continue
+		}
+		sizes[name] = size
+		total += size
+	}
+	return sizes, total, nil
+}
+
+// parseArchiveListLine 解析 tar -tv 或 unzip -l 的一行：
+// tar: "-rw-r--r-- user/group 1234 2024-01-01 12:00 path"；unzip: "  1234  2024-01-01 12:00   path"
+func parseArchiveListLine(line string, format string) (string, int64, bool) {
+	fields := strings.Fields(line)
+	sizeIdx, nameIdx := 2, 5
+	if format == ArchiveFormatZip {
+		sizeIdx, nameIdx = 0, 3
+	}
+	if len(fields) <= nameIdx {
+		return "", 0, false
+	}
+	size, err := strconv.ParseInt(fields[sizeIdx], 10, 64)
+	if err != nil {
+		return "", 0, false
+	}
+	// 部分 tar 实现的时间包含秒，多占一列不影响，名称取时间之后的部分
+	name := strings.Join(fields[nameIdx:], " ")
+	if target := strings.Index(name, " -> "); target > 0 {
+		name = name[:target]
+	}
+	name = strings.TrimPrefix(strings.TrimSuffix(name, "/"), "./")
+	if strings.HasSuffix(line, "/") {
+		return name, 0, true
+	}
+	return name, size, true
+}
+
+// extractRemote 执行远程解压
+func (sft *SftpService) extractRemote(spec transferSpec, tracker *transferTracker) error {
+	opts := spec.options.Archive
+	sizes, total, err := sft.listArchiveSizes(spec, tracker)
+	if err != nil {
+		return err
+	}
+	tracker.setTotal(total)
+
+	target := shellQuote(opts.Target)
+	progress := &archiveProgress{sizes: sizes, tracker: tracker}
+	var command string
+	if opts.Format == ArchiveFormatZip {
+		progress.prefix = strings.TrimSuffix(opts.Target, "/") + "/"
+		command = fmt.Sprintf("mkdir -p %s && unzip -o %s -d %s", target, shellQuote(spec.remotePath), target)
+	} else {
+		command = fmt.Sprintf("mkdir -p %s && tar -x%svf %s -C %s", target, tarFlag(opts.Format), shellQuote(spec.remotePath), target)
+	}
+	if err := sft.runArchiveCommand(spec.sessionID, command+" 2>&1", progress); err != nil {
+		return err
+	}
+	tracker.setTransferred(total)
+	return nil
+}
+
+// DownloadDirectoryArchiveDialog 选择本地目录后以 tar.gz 流下载远程目录：远程执行 tar czf - 通过 exec 通道传输，
+// 适合包含大量小文件的目录。extract 为 true 时在本地解压，否则保存为 <目录名>.tar.gz
+func (sft *SftpService) DownloadDirectoryArchiveDialog(sessionID, remotePath string, extract bool) error {
+	localPath, err := app.Dialog.OpenFile().SetTitle("选择目录").
+		CanChooseDirectories(true).
+		CanChooseFiles(false).
+		PromptForSingleSelection()
+	if err != nil {
+		return err
+	}
+	if localPath == "" {
+		return nil
+	}
+	if _, err := sft.getSSHClient(sessionID); err != nil {
+		return err
+	}
+	spec := transferSpec{
+		sessionID:    sessionID,
+		transferType: TransferTypeDownload,
+		isDir:        true,
+		localPath:    localPath,
+		remotePath:   path.Clean(remotePath),
+		options:      transferOptions{Archive: &ArchiveOptions{Format: ArchiveFormatTarGz, Extract: extract}},
+	}
+	transferQueue.enqueue(spec, 0)
+	return nil
+}
+
+// downloadDirectoryTar 以 tar.gz 流下载远程目录。进度按解压后的数据量计算，与目录总大小对应；
+// 数据流无法从中间继续，续传时从头下载
+func (sft *SftpService) downloadDirectoryTar(spec transferSpec, tracker *transferTracker) error {
+	client, err := sft.getSSHClient(spec.sessionID)
+	if err != nil {
+		return err
+	}
+	parent, base := path.Dir(spec.remotePath), path.Base(spec.remotePath)
+	command := fmt.Sprintf("tar -C %s -czf - -- %s", shellQuote(parent), shellQuote(base))
+	ctx, cancel := context.WithCancel(tracker.ctx)
+	defer cancel()
+	rc, err := startRemoteCommand(ctx, client, command)
+	if err != nil {
+		return fmt.Errorf("服务器不允许执行命令: %w", err)
+	}
+
+	// 按网络上的压缩数据限速，进度按解压后的大小统计
+	stream := &throttledReader{reader: rc.Stdout, tracker: tracker}
+	if spec.options.Archive.Extract {
+		err = extractTarGz(stream, spec.localPath, tracker)
+	} else {
+		err = saveTarGz(stream, filepath.Join(spec.localPath, base+".tar.gz"), tracker)
+	}
+	if err != nil {
+		// 读取失败时关闭通道让远程命令结束，优先返回远程命令的错误信息
+		cancel()
+		if waitErr := rc.Wait(); waitErr != nil && tracker.ctx.Err() == nil {
+			return waitErr
+		}
+		return err
+	}
+	return rc.Wait()
+}
+
+// saveTarGz 保存 tar.gz 数据流，同时解压计数以计算进度
+func saveTarGz(r io.Reader, localFile string, tracker *transferTracker) error {
+	f, err := os.Create(localFile)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	gz, err := gzip.NewReader(io.TeeReader(r, f))
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(&progressWriter{writer: io.Discard, tracker: tracker, noThrottle: true}, gz); err != nil {
+		return err
+	}
+	return f.Close()
+}
+
+// extractTarGz 在本地解压 tar.gz 数据流。所有文件操作都通过以 destDir 为根的 os.Root 完成，
+// 经由符号链接访问目标目录之外的路径会失败；路径经过符号链接的条目直接跳过，
+// 符号链接和硬链接只在目标按字面位于解压目录内时创建
+func extractTarGz(r io.Reader, destDir string, tracker *transferTracker) error {
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(destDir, 0755); err != nil {
+		return err
+	}
+	root, err := os.OpenRoot(destDir)
+	if err != nil {
+		return err
+	}
+	defer root.Close()
+
+	tr := tar.NewReader(gz)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		name, ok := archiveEntryPath(header.Name)
+		if !ok || name == "." || throughSymlink(root, name) {
+			Logger.Warn("skip archive entry outside destination", zap.String("name", header.Name))
+			continue
+		}
+		switch header.Typeflag {
+		case tar.TypeDir:
+			err = root.MkdirAll(name, 0755)
+		case tar.TypeReg:
+			err = extractTarFile(tr, root, name, header, tracker)
+		case tar.TypeSymlink:
+			linkname := filepath.FromSlash(header.Linkname)
+			if filepath.IsAbs(linkname) || !filepath.IsLocal(filepath.Join(filepath.Dir(name), linkname)) {
+				Logger.Debug("skip symlink outside destination", zap.String("name", header.Name))
+				continue
+			}
+			if err = root.MkdirAll(filepath.Dir(name), 0755); err != nil {
+				return err
+			}
+			_ = root.Remove(name)
+			if err = root.Symlink(linkname, name); err != nil {
+				Logger.Debug("create symlink failed", zap.String("name", header.Name), zap.Error(err))
+				err = nil
+			}
+		case tar.TypeLink:
+			oldname, ok := archiveEntryPath(header.Linkname)
+			if !ok || throughSymlink(root, oldname) {
+				continue
+			}
+			if err = root.MkdirAll(filepath.Dir(name), 0755); err != nil {
+				return err
+			}
+			_ = root.Remove(name)
+			err = root.Link(oldname, name)
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// archiveEntryPath 把压缩包中的条目名称转换为解压目录内的相对路径，与 tar 一样去掉开头的 /，
+// 包含 .. 等会离开解压目录的名称返回 false
+func archiveEntryPath(name string) (string, bool) {
+	p := filepath.FromSlash(path.Clean(strings.TrimLeft(name, "/")))
+	if !filepath.IsLocal(p) {
+		return "", false
+	}
+	return p, true
+}
+
+// throughSymlink 判断路径的上级目录中是否有符号链接，这类条目可能借助链接写到其他位置
+func throughSymlink(root *os.Root, name string) bool {
+	dir := filepath.Dir(name)
+	if dir == "." {
+		return false
+	}
+	current := ""
+	for _, part := range strings.Split(dir, string(filepath.Separator)) {
+		current = filepath.Join(current, part)
+		info, err := root.Lstat(current)
+		if err != nil {
+			// 不存在的目录会在解压时创建
+			return false
+		}
+		if info.Mode()&os.ModeSymlink != 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// extractTarFile 解压一个普通文件，目标位置原有的符号链接先被删除，不会写到链接指向的文件
+func extractTarFile(tr *tar.Reader, root *os.Root, name string, header *tar.Header, tracker *transferTracker) error {
+	if err := root.MkdirAll(filepath.Dir(name), 0755); err != nil {
+		return err
+	}
+	if info, err := root.Lstat(name); err == nil && info.Mode()&os.ModeSymlink != 0 {
+		if err := root.Remove(name); err != nil {
+			return err
+		}
+	}
+	f, err := root.OpenFile(name, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, os.FileMode(header.Mode).Perm()|0200)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(&progressWriter{writer: f, tracker: tracker, noThrottle: true}, tr); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return root.Chtimes(name, header.ModTime, header.ModTime)
+}
@@ -0,0 +1,191 @@
+package services
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+func TestParseArchiveListLine(t *testing.T) {
+	tests := []struct {
+		line   string
+		format string
+		name   string
+		size   int64
+		ok     bool
+	}{
+		{"-rw-r--r-- user/group 1234 2024-01-01 12:00 dir/a.txt", ArchiveFormatTarGz, "dir/a.txt", 1234, true},
+		{"-rw-r--r-- user/group 1234 2024-01-01 12:00 ./my file.txt", ArchiveFormatTar, "my file.txt", 1234, true},
+		{"drwxr-xr-x user/group 0 2024-01-01 12:00 dir/", ArchiveFormatTarGz, "dir", 0, true},
+		{"lrwxrwxrwx user/group 0 2024-01-01 12:00 link -> target", ArchiveFormatTarGz, "link", 0, true},
+		{"     5678  2024-01-01 12:00   docs/b.md", ArchiveFormatZip, "docs/b.md", 5678, true},
+		{"        0  2024-01-01 12:00   docs/", ArchiveFormatZip, "docs", 0, true},
+		{"  Length      Date    Time    Name", ArchiveFormatZip, "", 0, false},
+		{"---------                     -------", ArchiveFormatZip, "", 0, false},
+		{"", ArchiveFormatTarGz, "", 0, false},
+	}
+	for _, tt := range tests {
+		name, size, ok := parseArchiveListLine(tt.line, tt.format)
+		if ok != tt.ok || name != tt.name || size != tt.size {
+			t.Errorf("parseArchiveListLine(%q): got %q %d %v, want %q %d %v", tt.line, name, size, ok, tt.name, tt.size, tt.ok)
+		}
+	}
+}
+
+// tarEntry 测试用的压缩包条目，link 非空时为符号链接，hard 为 true 时为硬链接
+type tarEntry struct {
+	name    string
+	content string
+	link    string
+	hard    bool
+	dir     bool
+}
+
+func buildTarGz(t *testing.T, entries []tarEntry) *bytes.Buffer {
+	t.Helper()
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+	for _, e := range entries {
+		header := &tar.Header{Name: e.name, Mode: 0644}
+		switch {
+		case e.dir:
+			header.Typeflag, header.Mode = tar.TypeDir, 0755
+		case e.hard:
+			header.Typeflag, header.Linkname = tar.TypeLink, e.link
+		case e.link != "":
+			header.Typeflag, header.Linkname = tar.TypeSymlink, e.link
+		default:
+			header.Typeflag, header.Size = tar.TypeReg, int64(len(e.content))
+		}
+		if err := tw.WriteHeader(header); err != nil {
+			t.Fatalf("write header %s: %v", e.name, err)
+		}
+		if header.Typeflag == tar.TypeReg {
+			if _, err := tw.Write([]byte(e.content)); err != nil {
+				t.Fatalf("write %s: %v", e.name, err)
+			}
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := gz.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return &buf
+}
+
+func extractForTest(t *testing.T, entries []tarEntry) (string, string) {
+	t.Helper()
+	base := t.TempDir()
+	dest := filepath.Join(base, "dest")
+	tracker := newTransferTracker(transferSpec{}, 0)
+	t.Cleanup(func() { activeTransfers.Delete(tracker.id) })
+	if err := extractTarGz(buildTarGz(t, entries), dest, tracker); err != nil {
+		t.Fatalf("extractTarGz: %v", err)
+	}
+	return base, dest
+}
+
+func readFileString(t *testing.T, p string) string {
+	t.Helper()
+	data, err := os.ReadFile(p)
+	if err != nil {
+		t.Fatalf("read %s: %v", p, err)
+	}
+	return string(data)
+}
+
+func TestExtractTarGz(t *testing.T) {
+	base, dest := extractForTest(t, []tarEntry{
+		{name: "dir/", dir: true},
+		{name: "dir/a.txt", content: "a"},
+		{name: "/abs.txt", content: "abs"},
+		{name: "../evil.txt", content: "evil"},
+		{name: "dir/../../evil2.txt", content: "evil"},
+		{name: "nested/deep/b.txt", content: "b"},
+	})
+	if got := readFileString(t, filepath.Join(dest, "dir", "a.txt")); got != "a" {
+		t.Errorf("dir/a.txt: got %q", got)
+	}
+	if got := readFileString(t, filepath.Join(dest, "abs.txt")); got != "abs" {
+		t.Errorf("abs.txt: got %q", got)
+	}
+	if got := readFileString(t, filepath.Join(dest, "nested", "deep", "b.txt")); got != "b" {
+		t.Errorf("nested/deep/b.txt: got %q", got)
+	}
+	for _, name := range []string{"evil.txt", "evil2.txt"} {
+		if _, err := os.Lstat(filepath.Join(base, name)); err == nil {
+			t.Errorf("%s extracted outside destination", name)
+		}
+	}
+}
+
+func TestExtractTarGzSymlinkEscape(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("symlinks need extra privileges on windows")
+	}
+	outside := t.TempDir()
+	victim := filepath.Join(outside, "victim.txt")
+	if err := os.WriteFile(victim, []byte("keep"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	base, dest := extractForTest(t, []tarEntry{
+		// 链接 sub 指向自身所在目录，字面上 sub/sub/sub/x 的 ../../../evil 仍在解压目录内
+		{name: "sub", link: "."},
+		{name: "sub/sub/sub/x", link: "../../../evil"},
+		{name: "x", content: "through link"},
+		{name: "sub/sub/sub/y", content: "through link"},
+		// 直接指向外部的链接不创建，之后写入同名路径的条目不会写到外部
+		{name: "out", link: victim},
+		{name: "out", content: "overwrite"},
+		{name: "up", link: "../../"},
+		{name: "up/victim.txt", content: "overwrite"},
+		// 目录内的链接正常创建
+		{name: "real.txt", content: "real"},
+		{name: "ok", link: "real.txt"},
+		{name: "hard", link: "real.txt", hard: true},
+		{name: "hard-escape", link: "../victim.txt", hard: true},
+	})
+
+	if got := readFileString(t, victim); got != "keep" {
+		t.Errorf("victim overwritten: %q", got)
+	}
+	if _, err := os.Lstat(filepath.Join(base, "evil")); err == nil {
+		t.Errorf("evil created outside destination")
+	}
+	if target, err := os.Readlink(filepath.Join(dest, "sub")); err != nil || target != "." {
+		t.Errorf("sub: got %q, %v", target, err)
+	}
+	// 经过符号链接的条目被跳过
+	if _, err := os.Lstat(filepath.Join(dest, "y")); err == nil {
+		t.Errorf("sub/sub/sub/y written through symlink")
+	}
+	if got := readFileString(t, filepath.Join(dest, "x")); got != "through link" {
+		t.Errorf("x: got %q", got)
+	}
+	if info, err := os.Lstat(filepath.Join(dest, "x")); err != nil || info.Mode()&os.ModeSymlink != 0 {
+		t.Errorf("x should be a regular file: %v", err)
+	}
+	if got := readFileString(t, filepath.Join(dest, "out")); got != "overwrite" {
+		t.Errorf("out: got %q", got)
+	}
+	if info, err := os.Lstat(filepath.Join(dest, "up")); err != nil || info.Mode()&os.ModeSymlink != 0 {
+		t.Errorf("up: should be a directory created for up/victim.txt: %v", err)
+	}
+	if got := readFileString(t, filepath.Join(dest, "ok")); got != "real" {
+		t.Errorf("ok: got %q", got)
+	}
+	if got := readFileString(t, filepath.Join(dest, "hard")); got != "real" {
+		t.Errorf("hard: got %q", got)
+	}
+	if _, err := os.Lstat(filepath.Join(dest, "hard-escape")); err == nil {
+		t.Errorf("hard-escape created")
+	}
+}
@@ -0,0 +1,314 @@
+package services
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ilaziness/vexo/internal/system"
+	"github.com/pkg/sftp"
+	"go.uber.org/zap"
+)
+
+// 文件属性：所有者名称解析、符号链接解析、权限/所有者修改、链接创建和修改时间
+
+// remoteIDNamesTTL 远程用户和组名称缓存时间
+const remoteIDNamesTTL = 5 * time.Minute
+
+// resolveLinkWorkers 并发解析符号链接的最大请求数，SFTP 请求在同一连接上流水线执行
+const resolveLinkWorkers = 8
+
+var remoteIDNamesCache = new(sync.Map) // map[sessionID]*remoteIDNames
+
+// remoteIDNames 远程主机的 uid/gid 到名称映射，来自 /etc/passwd 和 /etc/group
+type remoteIDNames struct {
+	users    map[uint32]string
+	groups   map[uint32]string
+	loadedAt time.Time
+}
+
+// RemoteOwner 远程用户或组
+type RemoteOwner struct {
+	ID   uint32 `json:"id"`
+	Name string `json:"name"`
+}
+
+// RemoteOwners 远程主机的用户和组列表，用于修改所有者
+type RemoteOwners struct {
+	Users  []RemoteOwner `json:"users"`
+	Groups []RemoteOwner `json:"groups"`
+}
+
+// parseIDNames 解析 passwd/group 格式的文件：name:x:id:...
+func parseIDNames(r io.Reader) map[uint32]string {
+	names := make(map[uint32]string)
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.SplitN(line, ":", 4)
+		if len(fields) < 3 {
+			continue
+		}
+		id, err := strconv.ParseUint(fields[2], 10, 32)
+		if err != nil {
+			continue
+		}
+		if _, ok := names[uint32(id)]; !ok {
+			names[uint32(id)] = fields[0]
+		}
+	}
+	return names
+}
+
+func readRemoteIDNames(ftpClient *sftp.Client, path string) map[uint32]string {
+	f, err := ftpClient.Open(path)
+	if err != nil {
+		Logger.Debug("read remote id names failed", zap.String("path", path), zap.Error(err))
+		return map[uint32]string{}
+	}
+	defer f.Close()
+	return parseIDNames(f)
+}
+
+// loadRemoteIDNames 获取会话对应主机的用户和组名称，结果按会话缓存。
+// 非 Unix 服务器或没有读取权限时返回空映射，名称显示为空
+func loadRemoteIDNames(sessionID string, ftpClient *sftp.Client) *remoteIDNames {
+	if cached, ok := remoteIDNamesCache.Load(sessionID); ok {
+		names := cached.(*remoteIDNames)
+		if time.Since(names.loadedAt) < remoteIDNamesTTL {
+			return names
+		}
+	}
+	names := &remoteIDNames{
+		users:    readRemoteIDNames(ftpClient, "/etc/passwd"),
+		groups:   readRemoteIDNames(ftpClient, "/etc/group"),
+		loadedAt: time.Now(),
+	}
+	remoteIDNamesCache.Store(sessionID, names)
+	return names
+}
+
+// resolveLink 读取符号链接目标，并判断是否指向目录
+func resolveLink(ftpClient *sftp.Client, fullPath string, info *FileInfo) {
+	if !info.IsLink {
+		return
+	}
+	target, err := ftpClient.ReadLink(fullPath)
+	if err != nil {
+		Logger.Debug("read link failed", zap.String("path", fullPath), zap.Error(err))
+		return
+	}
+	info.LinkTarget = target
+	targetInfo, err := ftpClient.Stat(fullPath)
+	if err != nil {
+		info.LinkBroken = true
+		return
+	}
+	info.LinkIsDir = targetInfo.IsDir()
+	info.IsDir = info.LinkIsDir
+}
+
+// resolveFileInfos 补充目录列表中文件的所有者名称和符号链接信息。
+// 每个符号链接需要 ReadLink 和 Stat 两次往返，链接较多时并发解析，最多 resolveLinkWorkers 个同时进行
+func (sft *SftpService) resolveFileInfos(sessionID string, ftpClient *sftp.Client, dir string, infos []FileInfo) {
+	names := loadRemoteIDNames(sessionID, ftpClient)
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, resolveLinkWorkers)
+	for i := range infos {
+		infos[i].Owner = names.users[infos[i].UID]
+		infos[i].Group = names.groups[infos[i].GID]
+		if !infos[i].IsLink {
+			continue
+		}
+		sem <- struct{}{}
+		wg.Add(1)
+		system.SafeGo(func() {
+			defer wg.Done()
+			defer func() { <-sem }()
+			resolveLink(ftpClient, joinRemotePath(dir, infos[i].Name), &infos[i])
+		})
+	}
+	wg.Wait()
+}
+
+// resolveFileInfo 补充单个文件的所有者名称和符号链接信息
+func (sft *SftpService) resolveFileInfo(sessionID string, ftpClient *sftp.Client, fullPath string, info *FileInfo) {
+	names := loadRemoteIDNames(sessionID, ftpClient)
+	info.Owner = names.users[info.UID]
+	info.Group = names.groups[info.GID]
+	resolveLink(ftpClient, fullPath, info)
+}
+
+// walkRemote 依次对 root 及其下所有条目调用 fn，不跟随符号链接
+func walkRemote(ftpClient *sftp.Client, root string, recursive bool, fn func(path string, info os.FileInfo) error) error {
+	if !recursive {
+		info, err := ftpClient.Lstat(root)
+		if err != nil {
+			return err
+		}
+		return fn(root, info)
+	}
+	walker := ftpClient.Walk(root)
+	for walker.Step() {
+		if err := walker.Err(); err != nil {
+			return err
+		}
+		if err := fn(walker.Path(), walker.Stat()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// toFileMode 将包含 setuid/setgid/sticky 的权限位转换为 os.FileMode
+func toFileMode(perm uint32) os.FileMode {
+	mode := os.FileMode(perm & 0777)
+	if perm&04000 != 0 {
+		mode |= os.ModeSetuid
+	}
+	if perm&02000 != 0 {
+		mode |= os.ModeSetgid
+	}
+	if perm&01000 != 0 {
+		mode |= os.ModeSticky
+	}
+	return mode
+}
+
+// Chmod 修改权限，perm 为数字权限（例如 0755，可包含 setuid/setgid/sticky 位）。
+// recursive 为 true 时同时修改目录下的所有文件和子目录，符号链接本身不修改
+func (sft *SftpService) Chmod(sessionID string, path string, perm uint32, recursive bool) error {
+	Logger.Debug("Chmod", zap.String("sessionID", sessionID), zap.String("path", path),
+		zap.String("perm", strconv.FormatUint(uint64(perm), 8)), zap.Bool("recursive", recursive))
+	if perm > 07777 {
+		return fmt.Errorf("无效的权限: %o", perm)
+	}
+	ftpClient, err := sft.getSftpClient(sessionID)
+	if err != nil {
+		return err
+	}
+	mode := toFileMode(perm)
+	defer invalidateListings(sessionID, path)
+	return walkRemote(ftpClient, path, recursive, func(p string, info os.FileInfo) error {
+		if info.Mode()&os.ModeSymlink != 0 {
+			return nil
+		}
+		if err := ftpClient.Chmod(p, mode); err != nil {
+			return fmt.Errorf("%s: %w", p, err)
+		}
+		return nil
+	})
+}
+
+// Chown 修改所有者，uid 或 gid 为 -1 时保持不变。
+// recursive 为 true 时同时修改目录下的所有文件和子目录，符号链接本身不修改
+func (sft *SftpService) Chown(sessionID string, path string, uid, gid int, recursive bool) error {
+	Logger.Debug("Chown", zap.String("sessionID", sessionID), zap.String("path", path),
+		zap.Int("uid", uid), zap.Int("gid", gid), zap.Bool("recursive", recursive))
+	if uid < -1 || gid < -1 {
+		return fmt.Errorf("无效的 uid 或 gid")
+	}
+	ftpClient, err := sft.getSftpClient(sessionID)
+	if err != nil {
+		return err
+	}
+	defer invalidateListings(sessionID, path)
+	return walkRemote(ftpClient, path, recursive, func(p string, info os.FileInfo) error {
+		if info.Mode()&os.ModeSymlink != 0 {
+			return nil
+		}
+		newUID, newGID := uid, gid
+		if stat, ok := info.Sys().(*sftp.FileStat); ok {
+			if newUID == -1 {
+				newUID = int(stat.UID)
+			}
+			if newGID == -1 {
+				newGID = int(stat.GID)
+			}
+		} else if newUID == -1 || newGID == -1 {
+			return fmt.Errorf("%s: 无法获取当前所有者", p)
+		}
+		if err := ftpClient.Chown(p, newUID, newGID); err != nil {
+			return fmt.Errorf("%s: %w", p, err)
+		}
+		return nil
+	})
+}
+
+// GetRemoteOwners 返回远程主机的用户和组列表，按 ID 排序
+func (sft *SftpService) GetRemoteOwners(sessionID string) (RemoteOwners, error) {
+	ftpClient, err := sft.getSftpClient(sessionID)
+	if err != nil {
+		return RemoteOwners{}, err
+	}
+	remoteIDNamesCache.Delete(sessionID)
+	names := loadRemoteIDNames(sessionID, ftpClient)
+	toList := func(m map[uint32]string) []RemoteOwner {
+		list := make([]RemoteOwner, 0, len(m))
+		for id, name := range m {
+			list = append(list, RemoteOwner{ID: id, Name: name})
+		}
+		sort.Slice(list, func(i, j int) bool { return list[i].ID < list[j].ID })
+		return list
+	}
+	return RemoteOwners{Users: toList(names.users), Groups: toList(names.groups)}, nil
+}
+
+// CreateSymlink 创建符号链接 linkPath，指向 target（可以是相对路径）
+func (sft *SftpService) CreateSymlink(sessionID string, target, linkPath string) error {
+	Logger.Debug("CreateSymlink", zap.String("sessionID", sessionID), zap.String("target", target), zap.String("linkPath", linkPath))
+	ftpClient, err := sft.getSftpClient(sessionID)
+	if err != nil {
+		return err
+	}
+	if _, err := ftpClient.Lstat(linkPath); err == nil {
+		return fmt.Errorf("%s exists", linkPath)
+	}
+	defer invalidateListings(sessionID, linkPath)
+	return ftpClient.Symlink(target, linkPath)
+}
+
+// CreateHardLink 创建硬链接 linkPath，指向已存在的文件 target，需要服务器支持 hardlink@openssh.com 扩展
+func (sft *SftpService) CreateHardLink(sessionID string, target, linkPath string) error {
+	Logger.Debug("CreateHardLink", zap.String("sessionID", sessionID), zap.String("target", target), zap.String("linkPath", linkPath))
+	ftpClient, err := sft.getSftpClient(sessionID)
+	if err != nil {
+		return err
+	}
+	if _, ok := ftpClient.HasExtension("hardlink@openssh.com"); !ok {
+		return fmt.Errorf("服务器不支持创建硬链接")
+	}
+	if _, err := ftpClient.Lstat(linkPath); err == nil {
+		return fmt.Errorf("%s exists", linkPath)
+	}
+	defer invalidateListings(sessionID, linkPath)
+	return ftpClient.Link(target, linkPath)
+}
+
+// SetModTime 设置修改时间（unix 秒），访问时间保持不变
+func (sft *SftpService) SetModTime(sessionID string, path string, mtime int64) error {
+	Logger.Debug("SetModTime", zap.String("sessionID", sessionID), zap.String("path", path), zap.Int64("mtime", mtime))
+	ftpClient, err := sft.getSftpClient(sessionID)
+	if err != nil {
+		return err
+	}
+	info, err := ftpClient.Stat(path)
+	if err != nil {
+		return err
+	}
+	atime := time.Now()
+	if stat, ok := info.Sys().(*sftp.FileStat); ok {
+		atime = time.Unix(int64(stat.Atime), 0)
+	}
+	defer invalidateListings(sessionID, path)
+	return ftpClient.Chtimes(path, atime, time.Unix(mtime, 0))
+}
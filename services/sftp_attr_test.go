@@ -0,0 +1,59 @@
+package services
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestResolveFileInfos(t *testing.T) {
+	client := newMemSftpClient(t)
+	if err := client.MkdirAll("/d/sub"); err != nil {
+		t.Fatalf("mkdir: %v", err)
+	}
+	f, err := client.Create("/d/file")
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	f.Close()
+	// 链接数超过并发上限，确认每个链接都被解析
+	for i := range resolveLinkWorkers * 3 {
+		target := "/d/file"
+		if i%2 == 1 {
+			target = "/d/sub"
+		}
+		if err := client.Symlink(target, fmt.Sprintf("/d/link%02d", i)); err != nil {
+			t.Fatalf("symlink: %v", err)
+		}
+	}
+	if err := client.Symlink("/d/missing", "/d/broken"); err != nil {
+		t.Fatalf("symlink: %v", err)
+	}
+
+	entries, err := client.ReadDir("/d")
+	if err != nil {
+		t.Fatalf("readdir: %v", err)
+	}
+	infos := convertFileInfos(entries)
+	const sessionID = "resolve-file-infos-test"
+	defer remoteIDNamesCache.Delete(sessionID)
+	(&SftpService{}).resolveFileInfos(sessionID, client, "/d", infos)
+
+	links := 0
+	for _, info := range infos {
+		switch {
+		case info.Name == "broken":
+			if !info.LinkBroken || info.LinkTarget != "/d/missing" {
+				t.Errorf("broken link: got %+v", info)
+			}
+		case info.IsLink:
+			links++
+			want := info.LinkTarget == "/d/sub"
+			if info.LinkTarget == "" || info.LinkBroken || info.IsDir != want {
+				t.Errorf("%s: got %+v", info.Name, info)
+			}
+		}
+	}
+	if links != resolveLinkWorkers*3 {
+		t.Errorf("links: got %d, want %d", links, resolveLinkWorkers*3)
+	}
+}
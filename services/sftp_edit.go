@@ -0,0 +1,629 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ilaziness/vexo/internal/system"
+	"github.com/ilaziness/vexo/internal/utils"
+	"github.com/pkg/sftp"
+	"github.com/wailsapp/wails/v3/pkg/application"
+	"go.uber.org/zap"
+)
+
+// 远程文件编辑：下载到本地临时工作区，用本地编辑器打开，保存后自动上传
+
+const (
+	EventRemoteEdit = "eventRemoteEdit"
+
+	RemoteEditStatusOpened   = "opened"
+	RemoteEditStatusUploaded = "uploaded"
+	RemoteEditStatusConflict = "conflict" // 远程文件在编辑期间被修改，暂停自动上传
+	RemoteEditStatusError    = "error"
+	RemoteEditStatusClosed   = "closed"
+
+	remoteEditPollInterval = time.Second
+	// remoteEditMaxSize 可编辑文件的大小上限
+	remoteEditMaxSize = 50 << 20
+)
+
+func init() {
+	application.RegisterEvent[RemoteEditEvent](EventRemoteEdit)
+}
+
+var remoteEdits = new(sync.Map) // map[editID]*remoteEdit
+
+// RemoteEditEvent 远程编辑状态变化
+type RemoteEditEvent struct {
+	ID         string `json:"id"`
+	SessionID  string `json:"sessionID"`
+	RemotePath string `json:"remotePath"`
+	LocalPath  string `json:"localPath"`
+	Status     string `json:"status"`
+	Error      string `json:"error"`
+}
+
+// RemoteEditInfo 正在编辑的远程文件
+type RemoteEditInfo struct {
+	ID         string `json:"id"`
+	SessionID  string `json:"sessionID"`
+	RemotePath string `json:"remotePath"`
+	LocalPath  string `json:"localPath"`
+	Conflict   bool   `json:"conflict"`
+	Uploads    int    `json:"uploads"`
+}
+
+// fileStamp 用于判断文件是否被修改
+type fileStamp struct {
+	size    int64
+	modTime time.Time
+}
+
+func stampOf(info os.FileInfo) fileStamp {
+	return fileStamp{size: info.Size(), modTime: info.ModTime()}
+}
+
+func (s fileStamp) equal(o fileStamp) bool {
+	return s.size == o.size && s.modTime.Equal(o.modTime)
+}
+
+type remoteEdit struct {
+	id         string
+	sessionID  string
+	remotePath string
+	localPath  string
+	workDir    string
+
+	uploadMu sync.Mutex // 串行化自动上传和手动保存
+	mu       sync.Mutex
+	remote   fileStamp // 最近一次下载或上传后的远程文件状态
+	local    fileStamp // 最近一次下载或上传时的本地文件状态
+	conflict bool
+	uploads  int
+
+	stopCh    chan struct{}
+	watchDone chan struct{} // watch 退出后关闭
+	stopOnce  sync.Once
+}
+
+// remoteEditRoot 临时工作区根目录
+func remoteEditRoot() string {
+	return filepath.Join(os.TempDir(), "vexo-edit")
+}
+
+// EditRemoteFile 下载远程文件到临时工作区并用本地编辑器打开，返回编辑 ID。
+// 编辑器使用传输配置中的 editor 命令，未配置时使用系统默认程序；
+// 本地文件每次保存后自动上传（先写临时文件再重命名），远程文件在编辑期间被修改时暂停上传并通知前端。
+// 同一文件已在编辑时重新打开编辑器。
+func (sft *SftpService) EditRemoteFile(sessionID string, remotePath string) (string, error) {
+	Logger.Debug("EditRemoteFile", zap.String("sessionID", sessionID), zap.String("remotePath", remotePath))
+	var existing *remoteEdit
+	remoteEdits.Range(func(_, value any) bool {
+		edit := value.(*remoteEdit)
+		if edit.sessionID == sessionID && edit.remotePath == remotePath {
+			existing = edit
+			return false
+		}
+		return true
+	})
+	if existing != nil {
+		return existing.id, openInEditor(existing.localPath)
+	}
+
+	ftpClient, err := sft.getSftpClient(sessionID)
+	if err != nil {
+		return "", err
+	}
+	info, err := ftpClient.Stat(remotePath)
+	if err != nil {
+		return "", err
+	}
+	if !info.Mode().IsRegular() {
+		return "", fmt.Errorf("只能编辑普通文件")
+	}
+	if info.Size() > remoteEditMaxSize {
+		return "", fmt.Errorf("文件超过 %d MB，不支持在线编辑", remoteEditMaxSize>>20)
+	}
+
+	if err := os.MkdirAll(remoteEditRoot(), 0700); err != nil {
+		return "", err
+	}
+	workDir, err := os.MkdirTemp(remoteEditRoot(), "edit-")
+	if err != nil {
+		return "", err
+	}
+	edit := &remoteEdit{
+		id:         utils.GenerateRandomID(),
+		sessionID:  sessionID,
+		remotePath: remotePath,
+		localPath:  filepath.Join(workDir, path.Base(remotePath)),
+		workDir:    workDir,
+		stopCh:     make(chan struct{}),
+		watchDone:  make(chan struct{}),
+	}
+	if err := edit.download(ftpClient); err != nil {
+		os.RemoveAll(workDir)
+		return "", err
+	}
+	if err := openInEditor(edit.localPath); err != nil {
+		os.RemoveAll(workDir)
+		return "", err
+	}
+
+	remoteEdits.Store(edit.id, edit)
+	system.SafeGo(func() {
+		edit.watch(sft)
+	})
+	edit.emit(RemoteEditStatusOpened, nil)
+	return edit.id, nil
+}
+
+// download 下载远程文件覆盖本地工作区文件，并记录两端状态
+func (e *remoteEdit) download(ftpClient *sftp.Client) error {
+	remoteFile, err := ftpClient.Open(e.remotePath)
+	if err != nil {
+		return err
+	}
+	defer remoteFile.Close()
+	remoteInfo, err := remoteFile.Stat()
+	if err != nil {
+		return err
+	}
+	localFile, err := os.OpenFile(e.localPath, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(localFile, remoteFile); err != nil {
+		localFile.Close()
+		return err
+	}
+	if err := localFile.Close(); err != nil {
+		return err
+	}
+	localInfo, err := os.Stat(e.localPath)
+	if err != nil {
+		return err
+	}
+
+	e.mu.Lock()
+	e.remote = stampOf(remoteInfo)
+	e.local = stampOf(localInfo)
+	e.conflict = false
+	e.mu.Unlock()
+	return nil
+}
+
+// watch 轮询本地文件，文件变化且在一个轮询周期内保持不变（编辑器写入完成）后上传
+func (e *remoteEdit) watch(sft *SftpService) {
+	defer close(e.watchDone)
+	ticker := time.NewTicker(remoteEditPollInterval)
+	defer ticker.Stop()
+	var pending *fileStamp
+	for {
+		select {
+		case <-e.stopCh:
+			return
+		case <-ticker.C:
+		}
+		info, err := os.Stat(e.localPath)
+		if err != nil {
+			// 部分编辑器保存时先删除再重建文件
+			continue
+		}
+		current := stampOf(info)
+		e.mu.Lock()
+		unchanged := current.equal(e.local)
+		e.mu.Unlock()
+		if unchanged {
+			pending = nil
+			continue
+		}
+		if pending == nil || !pending.equal(current) {
+			pending = &current
+			continue
+		}
+		pending = nil
+		if err := e.upload(sft, false); err != nil && !errors.Is(err, errRemoteEditConflict) {
+			Logger.Warn("remote edit upload failed", zap.String("remotePath", e.remotePath), zap.Error(err))
+		}
+	}
+}
+
+var errRemoteEditConflict = errors.New("远程文件已被修改")
+
+// upload 将本地文件上传回远程。force 为 false 时检查远程文件是否在编辑期间被修改，
+// 先写入同目录的临时文件再重命名覆盖，避免上传中断时远程文件被截断
+func (e *remoteEdit) upload(sft *SftpService, force bool) error {
+	e.uploadMu.Lock()
+	defer e.uploadMu.Unlock()
+	ftpClient, err := sft.getSftpClient(e.sessionID)
+	if err != nil {
+		return err
+	}
+	e.mu.Lock()
+	conflict := e.conflict
+	baseline := e.remote
+	e.mu.Unlock()
+	if conflict && !force {
+		return errRemoteEditConflict
+	}
+
+	remoteInfo, err := ftpClient.Stat(e.remotePath)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if !force && (remoteInfo == nil || !stampOf(remoteInfo).equal(baseline)) {
+		e.mu.Lock()
+		e.conflict = true
+		e.mu.Unlock()
+		e.emit(RemoteEditStatusConflict, errRemoteEditConflict)
+		return errRemoteEditConflict
+	}
+
+	localInfo, err := os.Stat(e.localPath)
+	if err != nil {
+		return err
+	}
+	// 目标是符号链接时替换链接指向的文件；文件有多个硬链接时原地写入，使所有链接都指向新内容
+	target, err := resolveEditTarget(ftpClient, e.remotePath)
+	if err != nil {
+		return err
+	}
+	if remoteInfo != nil && remoteLinkCount(sft, e.sessionID, target) > 1 {
+		err = writeInPlace(ftpClient, e.localPath, target)
+	} else {
+		err = atomicUpload(ftpClient, e.localPath, target, remoteInfo)
+	}
+	if err != nil {
+		e.emit(RemoteEditStatusError, err)
+		return err
+	}
+	invalidateListings(e.sessionID, e.remotePath, target)
+	remoteInfo, err = ftpClient.Stat(e.remotePath)
+	if err != nil {
+		return err
+	}
+
+	e.mu.Lock()
+	e.remote = stampOf(remoteInfo)
+	e.local = stampOf(localInfo)
+	e.conflict = false
+	e.uploads++
+	e.mu.Unlock()
+	Logger.Debug("remote edit uploaded", zap.String("remotePath", e.remotePath))
+	e.emit(RemoteEditStatusUploaded, nil)
+	return nil
+}
+
+// atomicUpload 上传到目标同目录的临时文件，复制原文件的权限和属主后重命名覆盖目标。
+// remoteInfo 为原文件信息，目标不存在时为 nil。
+// 服务器支持 posix-rename 扩展时直接覆盖，否则由 renameReplace 借助备份替换
+func atomicUpload(ftpClient *sftp.Client, localPath, remotePath string, remoteInfo os.FileInfo) error {
+	localFile, err := os.Open(localPath)
+	if err != nil {
+		return err
+	}
+	defer localFile.Close()
+
+	tmpPath := joinRemotePath(path.Dir(remotePath), fmt.Sprintf(".%s.vexo-%s.tmp", path.Base(remotePath), utils.GenerateRandomID()))
+	tmpFile, err := ftpClient.OpenFile(tmpPath, os.O_CREATE|os.O_WRONLY|os.O_EXCL)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(tmpFile, localFile)
+	if closeErr := tmpFile.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = copyRemoteOwnership(ftpClient, tmpPath, remoteInfo)
+	}
+	keepTmp := false
+	if err == nil {
+		if _, ok := ftpClient.HasExtension("posix-rename@openssh.com"); ok {
+			err = ftpClient.PosixRename(tmpPath, remotePath)
+		} else {
+			keepTmp, err = renameReplace(ftpClient, tmpPath, remotePath)
+		}
+	}
+	if err != nil && !keepTmp {
+		_ = ftpClient.Remove(tmpPath)
+	}
+	return err
+}
+
+// maxEditSymlinks 解析编辑目标时最多跟随的符号链接层数
+const maxEditSymlinks = 40
+
+// resolveEditTarget 逐层解析 remotePath 上的符号链接，返回实际要替换的文件路径，
+// 避免重命名覆盖时用普通文件替换了链接本身。链接指向的文件不存在时返回该路径
+func resolveEditTarget(ftpClient *sftp.Client, remotePath string) (string, error) {
+	target := remotePath
+	for range maxEditSymlinks {
+		info, err := ftpClient.Lstat(target)
+		if os.IsNotExist(err) {
+			return target, nil
+		}
+		if err != nil {
+			return "", err
+		}
+		if info.Mode()&os.ModeSymlink == 0 {
+			return target, nil
+		}
+		link, err := ftpClient.ReadLink(target)
+		if err != nil {
+			return "", err
+		}
+		if !path.IsAbs(link) {
+			link = path.Join(path.Dir(target), link)
+		}
+		target = link
+	}
+	return "", fmt.Errorf("符号链接层级过多: %s", remotePath)
+}
+
+// remoteLinkCount 通过 ls 获取远程文件的硬链接数。SFTP v3 的文件属性不含链接数，
+// 无法执行命令（仅允许 SFTP 或通过 sudo 运行）时返回 0，调用方按没有其他硬链接处理
+func remoteLinkCount(sft *SftpService, sessionID, remotePath string) int {
+	client, err := sft.getSSHClient(sessionID)
+	if err != nil {
+		return 0
+	}
+	info, err := scpStat(client)(remotePath)
+	if err != nil {
+		Logger.Debug("get remote link count failed", zap.String("remotePath", remotePath), zap.Error(err))
+		return 0
+	}
+	return info.(*lsFileInfo).nlink
+}
+
+// writeInPlace 截断远程文件后直接写入新内容，权限、属主和硬链接保持不变。
+// 写入不是原子的，中断时远程文件内容不完整，只用于重命名替换会断开硬链接的情况
+func writeInPlace(ftpClient *sftp.Client, localPath, remotePath string) error {
+	localFile, err := os.Open(localPath)
+	if err != nil {
+		return err
+	}
+	defer localFile.Close()
+
+	remoteFile, err := ftpClient.OpenFile(remotePath, os.O_WRONLY|os.O_TRUNC)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(remoteFile, localFile)
+	if closeErr := remoteFile.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// copyRemoteOwnership 把原文件的权限和属主复制到临时文件，原文件不存在时权限为 0644。
+// 非 root 用户通常无法修改属主，失败时只记录日志，文件属主变为登录用户
+func copyRemoteOwnership(ftpClient *sftp.Client, tmpPath string, remoteInfo os.FileInfo) error {
+	if remoteInfo == nil {
+		return ftpClient.Chmod(tmpPath, 0644)
+	}
+	if err := ftpClient.Chmod(tmpPath, remoteInfo.Mode().Perm()); err != nil {
+		return err
+	}
+	stat, ok := remoteInfo.Sys().(*sftp.FileStat)
+	if !ok {
+		return nil
+	}
+	tmpInfo, err := ftpClient.Stat(tmpPath)
+	if err != nil {
+		return err
+	}
+	if tmpStat, ok := tmpInfo.Sys().(*sftp.FileStat); ok && tmpStat.UID == stat.UID && tmpStat.GID == stat.GID {
+		return nil
+	}
+	if err := ftpClient.Chown(tmpPath, int(stat.UID), int(stat.GID)); err != nil {
+		Logger.Warn("copy remote file owner failed", zap.String("path", tmpPath), zap.Uint32("uid", stat.UID),
+			zap.Uint32("gid", stat.GID), zap.Error(err))
+	}
+	return nil
+}
+
+// renameReplace 在不支持 posix-rename 的服务器上用 tmpPath 替换 remotePath：先把原文件改名为备份，
+// 再把临时文件改名为目标，失败时恢复备份，成功后删除备份，任何时候原文件和新内容至少保留一份。
+// 备份无法恢复时返回 keepTmp 为 true，调用方不能删除临时文件，错误中给出两个文件的位置
+func renameReplace(ftpClient *sftp.Client, tmpPath, remotePath string) (keepTmp bool, err error) {
+	backup := joinRemotePath(path.Dir(remotePath), fmt.Sprintf(".%s.vexo-%s.bak", path.Base(remotePath), utils.GenerateRandomID()))
+	if err := ftpClient.Rename(remotePath, backup); err != nil {
+		if !os.IsNotExist(err) {
+			return false, err
+		}
+		return false, ftpClient.Rename(tmpPath, remotePath)
+	}
+	if err := ftpClient.Rename(tmpPath, remotePath); err != nil {
+		if restoreErr := ftpClient.Rename(backup, remotePath); restoreErr != nil {
+			return true, fmt.Errorf("%w，恢复原文件失败: %v，原文件保存在 %s，新内容保存在 %s", err, restoreErr, backup, tmpPath)
+		}
+		return false, err
+	}
+	if err := ftpClient.Remove(backup); err != nil {
+		Logger.Warn("remove remote edit backup failed", zap.String("path", backup), zap.Error(err))
+	}
+	return false, nil
+}
+
+// flushPending 上传还未上传的本地修改，例如保存后仍在等待编辑器写入完成的修改
+func (e *remoteEdit) flushPending(sft *SftpService) error {
+	info, err := os.Stat(e.localPath)
+	if err != nil {
+		return nil
+	}
+	e.mu.Lock()
+	unchanged := stampOf(info).equal(e.local)
+	e.mu.Unlock()
+	if unchanged {
+		return nil
+	}
+	if sft == nil {
+		return errSftpUnavailable
+	}
+	return e.upload(sft, false)
+}
+
+// close 停止监视，上传未上传的修改后删除工作区。上传失败时保留工作区，避免修改丢失
+func (e *remoteEdit) close(sft *SftpService) {
+	e.stopOnce.Do(func() {
+		close(e.stopCh)
+		<-e.watchDone
+		remoteEdits.Delete(e.id)
+		if err := e.flushPending(sft); err != nil {
+			Logger.Warn("remote edit has changes not uploaded, keep workspace", zap.String("localPath", e.localPath), zap.Error(err))
+			e.emit(RemoteEditStatusError, fmt.Errorf("关闭前上传修改失败，修改保存在 %s: %w", e.localPath, err))
+		} else if err := os.RemoveAll(e.workDir); err != nil {
+			Logger.Warn("remove remote edit workspace failed", zap.String("dir", e.workDir), zap.Error(err))
+		}
+		e.emit(RemoteEditStatusClosed, nil)
+	})
+}
+
+func (e *remoteEdit) emit(status string, err error) {
+	if app == nil {
+		return
+	}
+	event := RemoteEditEvent{
+		ID:         e.id,
+		SessionID:  e.sessionID,
+		RemotePath: e.remotePath,
+		LocalPath:  e.localPath,
+		Status:     status,
+	}
+	if err != nil {
+		event.Error = err.Error()
+	}
+	app.Event.Emit(EventRemoteEdit, event)
+}
+
+func (e *remoteEdit) info() RemoteEditInfo {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return RemoteEditInfo{
+		ID:         e.id,
+		SessionID:  e.sessionID,
+		RemotePath: e.remotePath,
+		LocalPath:  e.localPath,
+		Conflict:   e.conflict,
+		Uploads:    e.uploads,
+	}
+}
+
+// closeRemoteEditsBySession 会话关闭时结束该会话的所有远程编辑，需要在关闭 SFTP 连接之前调用，
+// 以便上传还在等待中的修改
+func closeRemoteEditsBySession(sessionID string, sft *SftpService) {
+	remoteEdits.Range(func(_, value any) bool {
+		edit := value.(*remoteEdit)
+		if edit.sessionID == sessionID {
+			edit.close(sft)
+		}
+		return true
+	})
+}
+
+func getRemoteEdit(editID string) (*remoteEdit, error) {
+	value, ok := remoteEdits.Load(editID)
+	if !ok {
+		return nil, fmt.Errorf("remote edit with ID %s not found", editID)
+	}
+	return value.(*remoteEdit), nil
+}
+
+// openInEditor 用配置的编辑器打开文件，未配置时使用系统默认程序
+func openInEditor(localPath string) error {
+	editor := ""
+	if ConfigSvc != nil {
+		editor = strings.TrimSpace(ConfigSvc.Config.Transfer.Editor)
+	}
+	args := splitCommandLine(editor)
+	if len(args) == 0 {
+		return app.Browser.OpenFile(localPath)
+	}
+	cmd := exec.Command(args[0], append(args[1:], localPath)...)
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("启动编辑器失败: %w", err)
+	}
+	system.SafeGo(func() {
+		_ = cmd.Wait()
+	})
+	return nil
+}
+
+// splitCommandLine 按空白拆分命令行，双引号内的空白不拆分，例如 "C:\Program Files\Vim\gvim.exe" -p
+func splitCommandLine(s string) []string {
+	var args []string
+	var current strings.Builder
+	inQuote := false
+	for _, r := range s {
+		switch {
+		case r == '"':
+			inQuote = !inQuote
+		case (r == ' ' || r == '\t') && !inQuote:
+			if current.Len() > 0 {
+				args = append(args, current.String())
+				current.Reset()
+			}
+		default:
+			current.WriteRune(r)
+		}
+	}
+	if current.Len() > 0 {
+		args = append(args, current.String())
+	}
+	return args
+}
+
+// SaveRemoteEdit 立即上传本地文件。force 为 true 时忽略远程文件的修改直接覆盖，用于解决冲突
+func (sft *SftpService) SaveRemoteEdit(editID string, force bool) error {
+	edit, err := getRemoteEdit(editID)
+	if err != nil {
+		return err
+	}
+	return edit.upload(sft, force)
+}
+
+// ReloadRemoteEdit 放弃本地修改，重新下载远程文件，用于解决冲突
+func (sft *SftpService) ReloadRemoteEdit(editID string) error {
+	edit, err := getRemoteEdit(editID)
+	if err != nil {
+		return err
+	}
+	ftpClient, err := sft.getSftpClient(edit.sessionID)
+	if err != nil {
+		return err
+	}
+	if err := edit.download(ftpClient); err != nil {
+		return err
+	}
+	edit.emit(RemoteEditStatusOpened, nil)
+	return nil
+}
+
+// CloseRemoteEdit 结束远程编辑，上传未上传的修改后删除本地临时文件
+func (sft *SftpService) CloseRemoteEdit(editID string) error {
+	edit, err := getRemoteEdit(editID)
+	if err != nil {
+		return err
+	}
+	edit.close(sft)
+	return nil
+}
+
+// ListRemoteEdits 列出正在编辑的远程文件
+func (sft *SftpService) ListRemoteEdits() []RemoteEditInfo {
+	result := make([]RemoteEditInfo, 0)
+	remoteEdits.Range(func(_, value any) bool {
+		result = append(result, value.(*remoteEdit).info())
+		return true
+	})
+	return result
+}
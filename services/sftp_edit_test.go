@@ -0,0 +1,156 @@
+package services
+
+import (
+	"io"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestRenameReplace(t *testing.T) {
+	client := newMemSftpClient(t)
+	write := func(p, content string) {
+		t.Helper()
+		f, err := client.Create(p)
+		if err != nil {
+			t.Fatalf("create %s: %v", p, err)
+		}
+		if _, err := f.Write([]byte(content)); err != nil {
+			t.Fatalf("write %s: %v", p, err)
+		}
+		f.Close()
+	}
+	read := func(p string) string {
+		t.Helper()
+		f, err := client.Open(p)
+		if err != nil {
+			t.Fatalf("open %s: %v", p, err)
+		}
+		defer f.Close()
+		data, err := io.ReadAll(f)
+		if err != nil {
+			t.Fatalf("read %s: %v", p, err)
+		}
+		return string(data)
+	}
+	names := func() []string {
+		t.Helper()
+		infos, err := client.ReadDir("/")
+		if err != nil {
+			t.Fatalf("readdir: %v", err)
+		}
+		var out []string
+		for _, info := range infos {
+			out = append(out, info.Name())
+		}
+		return out
+	}
+
+	write("/a.txt", "old")
+	write("/.a.txt.tmp", "new")
+	keep, err := renameReplace(client, "/.a.txt.tmp", "/a.txt")
+	if err != nil || keep {
+		t.Fatalf("replace: keep %v, err %v", keep, err)
+	}
+	if got := read("/a.txt"); got != "new" {
+		t.Errorf("replace: got %q", got)
+	}
+	if got := names(); len(got) != 1 {
+		t.Errorf("replace: backup or tmp left behind: %q", got)
+	}
+
+	// 目标不存在时直接重命名
+	write("/.b.txt.tmp", "b")
+	if keep, err := renameReplace(client, "/.b.txt.tmp", "/b.txt"); err != nil || keep {
+		t.Fatalf("missing target: keep %v, err %v", keep, err)
+	}
+	if got := read("/b.txt"); got != "b" {
+		t.Errorf("missing target: got %q", got)
+	}
+
+	// 临时文件不存在，重命名失败后原文件被恢复
+	keep, err = renameReplace(client, "/.missing.tmp", "/a.txt")
+	if err == nil || keep {
+		t.Fatalf("failed rename: keep %v, err %v", keep, err)
+	}
+	if got := read("/a.txt"); got != "new" {
+		t.Errorf("failed rename: original not restored, got %q", got)
+	}
+	for _, name := range names() {
+		if strings.HasSuffix(name, ".bak") {
+			t.Errorf("failed rename: backup left behind: %s", name)
+		}
+	}
+	if _, err := client.Stat("/a.txt"); os.IsNotExist(err) {
+		t.Errorf("failed rename: original missing")
+	}
+}
+
+func TestResolveEditTarget(t *testing.T) {
+	client := newMemSftpClient(t)
+	if err := client.MkdirAll("/etc/conf"); err != nil {
+		t.Fatalf("mkdir: %v", err)
+	}
+	f, err := client.Create("/etc/conf/real.conf")
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	f.Close()
+	links := [][2]string{
+		{"real.conf", "/etc/conf/rel"},
+		{"/etc/conf/rel", "/etc/abs"},
+		{"/etc/missing", "/etc/dangling"},
+		{"/etc/loop2", "/etc/loop1"},
+		{"/etc/loop1", "/etc/loop2"},
+	}
+	for _, link := range links {
+		if err := client.Symlink(link[0], link[1]); err != nil {
+			t.Fatalf("symlink %s: %v", link[1], err)
+		}
+	}
+
+	tests := []struct {
+		path string
+		want string
+	}{
+		{"/etc/conf/real.conf", "/etc/conf/real.conf"},
+		{"/etc/conf/rel", "/etc/conf/real.conf"},
+		{"/etc/abs", "/etc/conf/real.conf"},
+		{"/etc/dangling", "/etc/missing"},
+		{"/etc/new.conf", "/etc/new.conf"},
+	}
+	for _, tt := range tests {
+		if got, err := resolveEditTarget(client, tt.path); err != nil || got != tt.want {
+			t.Errorf("resolveEditTarget(%q): got %q, %v, want %q", tt.path, got, err, tt.want)
+		}
+	}
+	if _, err := resolveEditTarget(client, "/etc/loop1"); err == nil {
+		t.Errorf("symlink loop: expected error")
+	}
+}
+
+func TestWriteInPlace(t *testing.T) {
+	client := newMemSftpClient(t)
+	f, err := client.Create("/a.txt")
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	f.Write([]byte("old content that is longer"))
+	f.Close()
+
+	local := t.TempDir() + "/a.txt"
+	if err := os.WriteFile(local, []byte("new"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := writeInPlace(client, local, "/a.txt"); err != nil {
+		t.Fatalf("writeInPlace: %v", err)
+	}
+	remote, err := client.Open("/a.txt")
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	defer remote.Close()
+	if data, _ := io.ReadAll(remote); string(data) != "new" {
+		t.Errorf("writeInPlace: got %q", data)
+	}
+}
@@ -0,0 +1,112 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"strings"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// 通过 SFTP 所在的 SSH 连接执行远程命令，用于远程 find 等加速路径。
+// 服务器可能只允许 SFTP（ForceCommand internal-sftp），调用方需要在执行失败时回退到纯 SFTP 实现
+
+// getSSHClient 通过 sessionID 获取 SFTP 所在的 SSH 连接。SFTP 通过 sudo 运行时返回 errSudoExec，
+// 避免以登录用户执行的命令与以 root 身份进行的文件操作混在一起
+func (sft *SftpService) getSSHClient(sessionID string) (*ssh.Client, error) {
+	connVal, ok := sftpClient.Load(sessionID)
+	if !ok {
+		return nil, fmt.Errorf("SSH session with ID %s not found", sessionID)
+	}
+	service := connVal.(*SftpService)
+	if service.sshClient == nil {
+		return nil, fmt.Errorf("SSH session with ID %s not found", sessionID)
+	}
+	if service.sudoSession != nil {
+		return nil, errSudoExec
+	}
+	return service.sshClient, nil
+}
+
+// shellQuote 使用单引号转义参数，用于拼接 POSIX shell 命令
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// remoteCommand 正在执行的远程命令
+type remoteCommand struct {
+	session *ssh.Session
+	Stdout  io.Reader
+	stderr  bytes.Buffer
+	stop    func() bool
+}
+
+// startRemoteCommand 在新的 exec 通道上启动命令，ctx 取消时关闭通道终止命令
+func startRemoteCommand(ctx context.Context, client *ssh.Client, command string) (*remoteCommand, error) {
+	session, err := client.NewSession()
+	if err != nil {
+		return nil, err
+	}
+	rc := &remoteCommand{session: session}
+	stdout, err := session.StdoutPipe()
+	if err != nil {
+		session.Close()
+		return nil, err
+	}
+	rc.Stdout = stdout
+	session.Stderr = &limitedBuffer{buf: &rc.stderr, limit: 4096}
+	if err := session.Start(command); err != nil {
+		session.Close()
+		return nil, err
+	}
+	rc.stop = context.AfterFunc(ctx, func() {
+		_ = session.Signal(ssh.SIGKILL)
+		_ = session.Close()
+	})
+	return rc, nil
+}
+
+// Wait 等待命令结束并关闭通道，返回的错误包含 stderr 的内容
+func (rc *remoteCommand) Wait() error {
+	err := rc.session.Wait()
+	rc.stop()
+	_ = rc.session.Close()
+	if err != nil {
+		if msg := strings.TrimSpace(rc.stderr.String()); msg != "" {
+			return fmt.Errorf("%w: %s", err, msg)
+		}
+	}
+	return err
+}
+
+// runRemoteOutput 执行命令并返回标准输出
+func runRemoteOutput(ctx context.Context, client *ssh.Client, command string) ([]byte, error) {
+	rc, err := startRemoteCommand(ctx, client, command)
+	if err != nil {
+		return nil, err
+	}
+	out, readErr := io.ReadAll(rc.Stdout)
+	if err := rc.Wait(); err != nil {
+		return out, err
+	}
+	return out, readErr
+}
+
+// limitedBuffer 只保留前 limit 字节的输出
+type limitedBuffer struct {
+	buf   *bytes.Buffer
+	limit int
+}
+
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	if remain := b.limit - b.buf.Len(); remain > 0 {
+		if len(p) > remain {
+			b.buf.Write(p[:remain])
+		} else {
+			b.buf.Write(p)
+		}
+	}
+	return len(p), nil
+}
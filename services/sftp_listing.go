@@ -0,0 +1,377 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// 大目录的分页列表：目录只读取一次，按会话和路径缓存，排序和过滤在服务端完成，前端按游标逐页获取。
+// 本程序修改远程文件后使相关目录的缓存失效，其他程序的修改在缓存过期或刷新后可见
+
+const (
+	ListSortName  = "name"
+	ListSortSize  = "size"
+	ListSortMtime = "mtime"
+	ListSortType  = "type" // 按扩展名
+
+	listPageDefault     = 500
+	listPageMax         = 5000
+	listingCacheTTL     = 30 * time.Second
+	listingCacheMaxDirs = 16 // 每个会话最多缓存的目录数
+	listingReadTimeout  = 120 * time.Second
+)
+
+var (
+	dirListings       = new(sync.Map) // map[sessionID]*sessionListings
+	listingGen        atomic.Uint64
+	errListingChanged = errors.New("目录内容已变化，请重新加载")
+)
+
+// DirListQuery 分页列出目录的参数
+type DirListQuery struct {
+	Path       string `json:"path"`
+	ShowHidden bool   `json:"showHidden"`
+	SortBy     string `json:"sortBy"` // name/size/mtime/type，为空时按名称，目录始终排在文件前面
+	Desc       bool   `json:"desc"`
+	// Filter 名称过滤，不区分大小写。包含 * 或 ? 时按通配符匹配整个名称，否则按子串匹配
+	Filter string `json:"filter"`
+	Cursor string `json:"cursor"` // 上一页返回的 NextCursor，为空时从第一页开始
+	Limit  int    `json:"limit"`  // 每页数量，默认 500，最大 5000
+	// Refresh 忽略缓存重新读取目录，只在获取第一页时有效
+	Refresh bool `json:"refresh"`
+}
+
+// DirListPage 分页列出目录的结果
+type DirListPage struct {
+	Items      []FileInfo `json:"items"`
+	NextCursor string     `json:"nextCursor"` // 为空表示没有下一页
+	Total      int        `json:"total"`      // 过滤后的条目总数
+	LoadedAt   int64      `json:"loadedAt"`   // 读取目录的时间，unix 毫秒
+}
+
+type listingEntry struct {
+	info  FileInfo
+	lower string // 小写名称，用于排序和过滤
+	ext   string // 小写扩展名，目录为空
+	mtime int64
+}
+
+type listingView struct {
+	sortBy     string
+	desc       bool
+	showHidden bool
+	filter     string
+}
+
+// dirListing 缓存的目录内容，gen 每次读取目录时递增，用于识别过期的游标
+type dirListing struct {
+	gen      uint64
+	loadedAt time.Time
+	entries  []listingEntry
+
+	mu    sync.Mutex
+	view  listingView // 最近一次排序和过滤的参数，翻页时复用结果
+	order []int
+}
+
+type sessionListings struct {
+	mu    sync.Mutex
+	dirs  map[string]*dirListing
+	epoch uint64 // 每次失效时递增，读取期间发生失效的结果不写入缓存
+}
+
+func sessionListingsOf(sessionID string) *sessionListings {
+	value, _ := dirListings.LoadOrStore(sessionID, &sessionListings{dirs: make(map[string]*dirListing)})
+	return value.(*sessionListings)
+}
+
+// invalidateListings 使 paths 所在目录、paths 本身及其下所有目录的缓存失效
+func invalidateListings(sessionID string, paths ...string) {
+	value, ok := dirListings.Load(sessionID)
+	if !ok {
+		return
+	}
+	sl := value.(*sessionListings)
+	sl.mu.Lock()
+	defer sl.mu.Unlock()
+	sl.epoch++
+	for _, p := range paths {
+		if p == "" {
+			continue
+		}
+		p = path.Clean(p)
+		parent := path.Dir(p)
+		prefix := strings.TrimSuffix(p, "/") + "/"
+		for dir := range sl.dirs {
+			if dir == p || dir == parent || strings.HasPrefix(dir, prefix) {
+				delete(sl.dirs, dir)
+			}
+		}
+	}
+}
+
+// invalidateTransferListings 传输任务结束后使远程目标目录的缓存失效
+func invalidateTransferListings(spec transferSpec) {
+	switch spec.transferType {
+	case TransferTypeUpload, TransferTypeSync, TransferTypeCompress:
+		invalidateListings(spec.sessionID, spec.remotePath)
+	case TransferTypeExtract:
+		if spec.options.Archive != nil {
+			invalidateListings(spec.sessionID, spec.options.Archive.Target)
+		}
+	case TransferTypeRemote:
+		if spec.options.Remote != nil {
+			invalidateListings(spec.options.Remote.TargetSessionID, spec.localPath)
+		}
+	}
+}
+
+// getListing 返回目录的缓存内容，cursorGen 不为 0 时必须是同一次读取的结果
+func (sft *SftpService) getListing(sessionID, dir string, cursorGen uint64, refresh bool) (*dirListing, error) {
+	sl := sessionListingsOf(sessionID)
+	sl.mu.Lock()
+	cached := sl.dirs[dir]
+	epoch := sl.epoch
+	sl.mu.Unlock()
+	if cursorGen != 0 {
+		if cached == nil || cached.gen != cursorGen {
+			return nil, errListingChanged
+		}
+		return cached, nil
+	}
+	if cached != nil && !refresh && time.Since(cached.loadedAt) < listingCacheTTL {
+		return cached, nil
+	}
+
+	listing, err := sft.loadListing(sessionID, dir)
+	if err != nil {
+		return nil, err
+	}
+	sl.mu.Lock()
+	defer sl.mu.Unlock()
+	if sl.epoch != epoch {
+		return listing, nil
+	}
+	if _, ok := sl.dirs[dir]; !ok && len(sl.dirs) >= listingCacheMaxDirs {
+		oldest := ""
+		for d, l := range sl.dirs {
+			if oldest == "" || l.loadedAt.Before(sl.dirs[oldest].loadedAt) {
+				oldest = d
+			}
+		}
+		delete(sl.dirs, oldest)
+	}
+	sl.dirs[dir] = listing
+	return listing, nil
+}
+
+// readDirInfos 读取整个目录（包含隐藏文件），补充所有者名称和符号链接信息
+func (sft *SftpService) readDirInfos(sessionID, dir string) ([]FileInfo, error) {
+	if client, ok := scpClient(sessionID); ok {
+		return scpListFiles(client, dir, true)
+	}
+	ftpClient, err := sft.getSftpClient(sessionID)
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), listingReadTimeout)
+	defer cancel()
+	entries, err := ftpClient.ReadDirContext(ctx, dir)
+	if err != nil {
+		return nil, err
+	}
+	infos := convertFileInfos(entries)
+	sft.resolveFileInfos(sessionID, ftpClient, dir, infos)
+	return infos, nil
+}
+
+// loadListing 读取整个目录并生成排序使用的字段
+func (sft *SftpService) loadListing(sessionID, dir string) (*dirListing, error) {
+	infos, err := sft.readDirInfos(sessionID, dir)
+	if err != nil {
+		return nil, err
+	}
+	listing := &dirListing{gen: listingGen.Add(1), loadedAt: time.Now(), entries: make([]listingEntry, len(infos))}
+	for i, info := range infos {
+		entry := listingEntry{info: info, lower: strings.ToLower(info.Name)}
+		if mtime, err := time.Parse(time.RFC3339, info.ModTime); err == nil {
+			entry.mtime = mtime.Unix()
+		}
+		if !info.IsDir {
+			_, ext := splitExt(entry.lower)
+			entry.ext = ext
+		}
+		listing.entries[i] = entry
+	}
+	Logger.Debug("directory listing loaded", zap.String("sessionID", sessionID), zap.String("dir", dir), zap.Int("entries", len(infos)))
+	return listing, nil
+}
+
+// sorted 返回过滤和排序后的条目下标，参数与上一次相同时直接返回上一次的结果
+func (l *dirListing) sorted(view listingView) ([]int, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.order != nil && l.view == view {
+		return l.order, nil
+	}
+	match, err := listingMatcher(view.filter)
+	if err != nil {
+		return nil, err
+	}
+	order := make([]int, 0, len(l.entries))
+	for i := range l.entries {
+		name := l.entries[i].lower
+		if !view.showHidden && strings.HasPrefix(name, ".") {
+			continue
+		}
+		if match != nil && !match(name) {
+			continue
+		}
+		order = append(order, i)
+	}
+	less := listingLess(view.sortBy)
+	sort.Slice(order, func(a, b int) bool {
+		x, y := &l.entries[order[a]], &l.entries[order[b]]
+		if x.info.IsDir != y.info.IsDir {
+			return x.info.IsDir
+		}
+		if view.desc {
+			return less(y, x)
+		}
+		return less(x, y)
+	})
+	l.view, l.order = view, order
+	return order, nil
+}
+
+// listingLess 返回排序比较函数，值相同时按名称排序
+func listingLess(sortBy string) func(a, b *listingEntry) bool {
+	byName := func(a, b *listingEntry) bool {
+		if a.lower != b.lower {
+			return a.lower < b.lower
+		}
+		return a.info.Name < b.info.Name
+	}
+	switch sortBy {
+	case ListSortSize:
+		return func(a, b *listingEntry) bool {
+			if a.info.Size != b.info.Size {
+				return a.info.Size < b.info.Size
+			}
+			return byName(a, b)
+		}
+	case ListSortMtime:
+		return func(a, b *listingEntry) bool {
+			if a.mtime != b.mtime {
+				return a.mtime < b.mtime
+			}
+			return byName(a, b)
+		}
+	case ListSortType:
+		return func(a, b *listingEntry) bool {
+			if a.ext != b.ext {
+				return a.ext < b.ext
+			}
+			return byName(a, b)
+		}
+	}
+	return byName
+}
+
+// listingMatcher 返回名称过滤函数，参数为小写名称，filter 为空时返回 nil
+func listingMatcher(filter string) (func(string) bool, error) {
+	filter = strings.ToLower(strings.TrimSpace(filter))
+	if filter == "" {
+		return nil, nil
+	}
+	if !strings.ContainsAny(filter, "*?") {
+		return func(name string) bool { return strings.Contains(name, filter) }, nil
+	}
+	if _, err := path.Match(filter, ""); err != nil {
+		return nil, fmt.Errorf("无效的过滤条件: %s", filter)
+	}
+	return func(name string) bool {
+		ok, _ := path.Match(filter, name)
+		return ok
+	}, nil
+}
+
+func formatListCursor(gen uint64, offset int) string {
+	return strconv.FormatUint(gen, 36) + "." + strconv.Itoa(offset)
+}
+
+func parseListCursor(cursor string) (uint64, int, error) {
+	genStr, offsetStr, ok := strings.Cut(cursor, ".")
+	gen, err1 := strconv.ParseUint(genStr, 36, 64)
+	offset, err2 := strconv.Atoi(offsetStr)
+	if !ok || err1 != nil || err2 != nil || gen == 0 || offset < 0 {
+		return 0, 0, fmt.Errorf("无效的游标: %s", cursor)
+	}
+	return gen, offset, nil
+}
+
+// ListFilesPage 分页列出目录，排序和过滤在服务端完成。目录内容在两次读取之间缓存，
+// 缓存失效后使用旧游标翻页会返回错误，前端需要从第一页重新加载
+func (sft *SftpService) ListFilesPage(sessionID string, query DirListQuery) (DirListPage, error) {
+	Logger.Debug("ListFilesPage", zap.String("sessionID", sessionID), zap.Any("query", query))
+	switch query.SortBy {
+	case "", ListSortName, ListSortSize, ListSortMtime, ListSortType:
+	default:
+		return DirListPage{}, fmt.Errorf("无效的排序方式: %s", query.SortBy)
+	}
+	if query.Path == "" {
+		return DirListPage{}, fmt.Errorf("路径不能为空")
+	}
+	limit := query.Limit
+	if limit <= 0 {
+		limit = listPageDefault
+	}
+	limit = min(limit, listPageMax)
+	var gen uint64
+	offset := 0
+	if query.Cursor != "" {
+		var err error
+		if gen, offset, err = parseListCursor(query.Cursor); err != nil {
+			return DirListPage{}, err
+		}
+	}
+
+	listing, err := sft.getListing(sessionID, path.Clean(query.Path), gen, query.Refresh)
+	if err != nil {
+		return DirListPage{}, err
+	}
+	order, err := listing.sorted(listingView{
+		sortBy:     query.SortBy,
+		desc:       query.Desc,
+		showHidden: query.ShowHidden,
+		filter:     query.Filter,
+	})
+	if err != nil {
+		return DirListPage{}, err
+	}
+
+	offset = min(offset, len(order))
+	end := min(offset+limit, len(order))
+	page := DirListPage{
+		Items:    make([]FileInfo, 0, end-offset),
+		Total:    len(order),
+		LoadedAt: listing.loadedAt.UnixMilli(),
+	}
+	for _, i := range order[offset:end] {
+		page.Items = append(page.Items, listing.entries[i].info)
+	}
+	if end < len(order) {
+		page.NextCursor = formatListCursor(listing.gen, end)
+	}
+	return page, nil
+}
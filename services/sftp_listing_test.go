@@ -0,0 +1,52 @@
+package services
+
+import "testing"
+
+func TestParseListCursor(t *testing.T) {
+	for _, tt := range []struct {
+		gen    uint64
+		offset int
+	}{{1, 0}, {36, 200}, {1 << 40, 12345}} {
+		cursor := formatListCursor(tt.gen, tt.offset)
+		gen, offset, err := parseListCursor(cursor)
+		if err != nil || gen != tt.gen || offset != tt.offset {
+			t.Errorf("parseListCursor(%q): got %d %d %v", cursor, gen, offset, err)
+		}
+	}
+	for _, cursor := range []string{"", "abc", "0.10", "1.-1", "1.x", "!.1", "1.2.3"} {
+		if _, _, err := parseListCursor(cursor); err == nil {
+			t.Errorf("parseListCursor(%q): expected error", cursor)
+		}
+	}
+}
+
+func TestListingMatcher(t *testing.T) {
+	match, err := listingMatcher("")
+	if err != nil || match != nil {
+		t.Errorf("empty filter: got %v", err)
+	}
+	tests := []struct {
+		filter string
+		name   string
+		want   bool
+	}{
+		{"Log", "app.log", true},
+		{"log", "readme.md", false},
+		{"*.LOG", "app.log", true},
+		{"*.log", "app.log.1", false},
+		{"a?c", "abc", true},
+	}
+	for _, tt := range tests {
+		match, err := listingMatcher(tt.filter)
+		if err != nil {
+			t.Errorf("listingMatcher(%q): %v", tt.filter, err)
+			continue
+		}
+		if got := match(tt.name); got != tt.want {
+			t.Errorf("listingMatcher(%q)(%q): got %v, want %v", tt.filter, tt.name, got, tt.want)
+		}
+	}
+	if _, err := listingMatcher("*[a"); err == nil {
+		t.Errorf("invalid pattern: expected error")
+	}
+}
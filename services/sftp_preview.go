@@ -0,0 +1,806 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	_ "image/gif" // 注册 GIF 解码器
+	"image/jpeg"
+	"image/png"
+	"io"
+	"path"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/ilaziness/vexo/internal/system"
+	"github.com/ilaziness/vexo/internal/utils"
+	"github.com/pkg/sftp"
+	"github.com/wailsapp/wails/v3/pkg/application"
+	"go.uber.org/zap"
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/charmap"
+	"golang.org/x/text/encoding/simplifiedchinese"
+	"golang.org/x/text/encoding/unicode"
+	"golang.org/x/text/transform"
+)
+
+// 远程文件预览：按范围读取、头尾 N 行、编码识别、类似 tail -f 的追踪、十六进制和图片缩略图，
+// 只读取需要的部分，任意大小的文件都不需要完整下载
+
+const (
+	EventFileFollow = "eventFileFollow"
+
+	EncodingUTF8    = "utf-8"
+	EncodingUTF16LE = "utf-16le"
+	EncodingUTF16BE = "utf-16be"
+	EncodingGB18030 = "gb18030"
+	EncodingLatin1  = "iso-8859-1"
+	EncodingBinary  = "binary"
+
+	PreviewKindText   = "text"
+	PreviewKindBinary = "binary"
+	PreviewKindImage  = "image"
+
+	maxPreviewBytes      = 4 << 20  // 单次读取的最大字节数
+	encodingSampleSize   = 8 << 10  // 编码识别读取的文件开头字节数
+	previewBlockSize     = 64 << 10 // 按行读取时每次读取的块大小
+	defaultHexDumpLength = 4 << 10
+	maxThumbnailFileSize = 50 << 20 // 生成缩略图的最大文件大小
+	maxThumbnailPixels   = 50_000_000
+	maxRawImageSize      = 2 << 20 // 无法解码的图片格式（webp/svg 等）直接返回原文件的最大大小
+	defaultThumbnailSize = 256
+	followInterval       = time.Second
+	followMaxRead        = 1 << 20 // 追踪时每次推送的最大字节数
+)
+
+func init() {
+	application.RegisterEvent[FileFollowEvent](EventFileFollow)
+}
+
+var fileFollows = new(sync.Map) // map[followID]*fileFollow
+
+// FileChunk 远程文件的一段内容，下一段从 Offset+Length 开始读取
+type FileChunk struct {
+	Offset   int64  `json:"offset"`
+	Length   int    `json:"length"`   // 实际使用的原始字节数，末尾不完整的字符留到下一段
+	Size     int64  `json:"size"`     // 文件当前大小
+	EOF      bool   `json:"eof"`      // 已读取到文件末尾
+	Encoding string `json:"encoding"` // 文本编码，binary 表示二进制文件
+	Text     string `json:"text"`     // 解码后的文本，二进制文件为空
+}
+
+// HexDumpResult 十六进制内容，每行 16 字节：偏移  十六进制  |ASCII|
+type HexDumpResult struct {
+	Offset int64  `json:"offset"`
+	Length int    `json:"length"`
+	Size   int64  `json:"size"`
+	Dump   string `json:"dump"`
+}
+
+// FilePreview 文件预览，根据文件类型返回文本开头、十六进制或图片缩略图
+type FilePreview struct {
+	Kind      string         `json:"kind"` // text/binary/image
+	Info      FileInfo       `json:"info"`
+	Text      *FileChunk     `json:"text,omitempty"`
+	Hex       *HexDumpResult `json:"hex,omitempty"`
+	Thumbnail string         `json:"thumbnail,omitempty"` // data URL
+}
+
+// FileFollowEvent 追踪文件新增内容的事件
+type FileFollowEvent struct {
+	FollowID  string `json:"followID"`
+	SessionID string `json:"sessionID"`
+	Path      string `json:"path"`
+	Offset    int64  `json:"offset"` // 本次内容之后的偏移
+	Size      int64  `json:"size"`
+	Text      string `json:"text"`
+	Truncated bool   `json:"truncated"` // 文件被截断或轮转，从头重新读取
+	Done      bool   `json:"done"`
+	Error     string `json:"error"`
+}
+
+// detectEncoding 根据文件开头的内容识别编码
+func detectEncoding(sample []byte) string {
+	switch {
+	case bytes.HasPrefix(sample, []byte{0xEF, 0xBB, 0xBF}):
+		return EncodingUTF8
+	case bytes.HasPrefix(sample, []byte{0xFF, 0xFE}):
+		return EncodingUTF16LE
+	case bytes.HasPrefix(sample, []byte{0xFE, 0xFF}):
+		return EncodingUTF16BE
+	}
+	if len(sample) == 0 {
+		return EncodingUTF8
+	}
+	if bytes.IndexByte(sample, 0) >= 0 {
+		// 没有 BOM 的 UTF-16：ASCII 字符的高字节为 0，集中出现在奇数或偶数位置
+		var even, odd int
+		for i, b := range sample {
+			if b == 0 {
+				if i%2 == 0 {
+					even++
+				} else {
+					odd++
+				}
+			}
+		}
+		half := len(sample) / 2
+		switch {
+		case odd > half*3/10 && even == 0:
+			return EncodingUTF16LE
+		case even > half*3/10 && odd == 0:
+			return EncodingUTF16BE
+		}
+		return EncodingBinary
+	}
+	control := 0
+	for _, b := range sample {
+		if b < 0x20 && b != '\n' && b != '\r' && b != '\t' && b != '\f' && b != '\b' && b != 0x1B {
+			control++
+		}
+	}
+	if control*10 > len(sample) {
+		return EncodingBinary
+	}
+	if utf8.Valid(trimIncompleteUTF8(sample)) {
+		return EncodingUTF8
+	}
+	if decoded, err := simplifiedchinese.GB18030.NewDecoder().Bytes(sample); err == nil &&
+		bytes.Count(decoded, []byte("�"))*100 < len(sample) {
+		return EncodingGB18030
+	}
+	return EncodingLatin1
+}
+
+// trimIncompleteUTF8 去掉末尾被截断的 UTF-8 字符
+func trimIncompleteUTF8(b []byte) []byte {
+	for i := 1; i <= utf8.UTFMax && i <= len(b); i++ {
+		c := b[len(b)-i]
+		if c < 0x80 {
+			return b
+		}
+		if utf8.RuneStart(c) {
+			if !utf8.FullRune(b[len(b)-i:]) {
+				return b[:len(b)-i]
+			}
+			return b
+		}
+	}
+	return b
+}
+
+func textEncoding(name string) (encoding.Encoding, error) {
+	switch name {
+	case EncodingUTF16LE:
+		return unicode.UTF16(unicode.LittleEndian, unicode.IgnoreBOM), nil
+	case EncodingUTF16BE:
+		return unicode.UTF16(unicode.BigEndian, unicode.IgnoreBOM), nil
+	case EncodingGB18030:
+		return simplifiedchinese.GB18030, nil
+	case EncodingLatin1:
+		return charmap.ISO8859_1, nil
+	}
+	return nil, fmt.Errorf("不支持的编码: %s", name)
+}
+
+// decodeText 将原始字节解码为文本，atEOF 为 false 时末尾不完整的字符不解码，返回实际使用的字节数
+func decodeText(data []byte, enc string, atEOF bool) (string, int, error) {
+	switch enc {
+	case EncodingBinary:
+		return "", len(data), nil
+	case EncodingUTF8, "":
+		if !atEOF {
+			data = trimIncompleteUTF8(data)
+		}
+		return strings.ToValidUTF8(string(data), "�"), len(data), nil
+	}
+	e, err := textEncoding(enc)
+	if err != nil {
+		return "", 0, err
+	}
+	decoder := e.NewDecoder()
+	dst := make([]byte, len(data)*3+16)
+	nDst, nSrc, err := decoder.Transform(dst, data, atEOF)
+	if err != nil && !(errors.Is(err, transform.ErrShortSrc) && !atEOF) {
+		return "", 0, err
+	}
+	return string(dst[:nDst]), nSrc, nil
+}
+
+// newlineBytes 返回编码中的换行符
+func newlineBytes(enc string) []byte {
+	switch enc {
+	case EncodingUTF16LE:
+		return []byte{'\n', 0}
+	case EncodingUTF16BE:
+		return []byte{0, '\n'}
+	}
+	return []byte{'\n'}
+}
+
+// codeUnit 返回编码的最小单位字节数，读取偏移需要按此对齐
+func codeUnit(enc string) int64 {
+	if enc == EncodingUTF16LE || enc == EncodingUTF16BE {
+		return 2
+	}
+	return 1
+}
+
+// indexNewline 查找按编码单位对齐的换行符
+func indexNewline(b []byte, nl []byte, from int) int {
+	for i := from; i+len(nl) <= len(b); {
+		j := bytes.Index(b[i:], nl)
+		if j < 0 {
+			return -1
+		}
+		if (i+j)%len(nl) == 0 {
+			return i + j
+		}
+		i += j + 1
+	}
+	return -1
+}
+
+// lastIndexNewline 从 end 向前查找按编码单位对齐的换行符
+func lastIndexNewline(b []byte, nl []byte, end int) int {
+	for end > 0 {
+		j := bytes.LastIndex(b[:end], nl)
+		if j < 0 {
+			return -1
+		}
+		if j%len(nl) == 0 {
+			return j
+		}
+		end = j + len(nl) - 1
+	}
+	return -1
+}
+
+// openPreviewFile 打开远程文件并确定编码，enc 为空时根据文件开头识别
+func (sft *SftpService) openPreviewFile(sessionID, filePath, enc string) (*sftp.File, int64, string, error) {
+	ftpClient, err := sft.getSftpClient(sessionID)
+	if err != nil {
+		return nil, 0, "", err
+	}
+	f, err := ftpClient.Open(filePath)
+	if err != nil {
+		return nil, 0, "", err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, 0, "", err
+	}
+	if info.IsDir() {
+		f.Close()
+		return nil, 0, "", fmt.Errorf("%s is a directory", filePath)
+	}
+	if enc == "" {
+		sample := make([]byte, encodingSampleSize)
+		n, err := f.ReadAt(sample, 0)
+		if err != nil && err != io.EOF {
+			f.Close()
+			return nil, 0, "", err
+		}
+		enc = detectEncoding(sample[:n])
+	} else if enc != EncodingUTF8 && enc != EncodingBinary {
+		if _, err := textEncoding(enc); err != nil {
+			f.Close()
+			return nil, 0, "", err
+		}
+	}
+	return f, info.Size(), enc, nil
+}
+
+// readAtMost 从 offset 读取最多 n 字节
+func readAtMost(r io.ReaderAt, offset int64, n int) ([]byte, error) {
+	buf := make([]byte, n)
+	read, err := r.ReadAt(buf, offset)
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+	return buf[:read], nil
+}
+
+// buildChunk 解码 [offset, offset+len(data)) 的内容，开头的 BOM 不计入文本
+func buildChunk(data []byte, offset, size int64, enc string) (FileChunk, error) {
+	end := offset + int64(len(data))
+	atEOF := end >= size
+	body, skip := data, 0
+	if offset == 0 && enc != EncodingBinary {
+		for _, bom := range [][]byte{{0xEF, 0xBB, 0xBF}, {0xFF, 0xFE}, {0xFE, 0xFF}} {
+			if bytes.HasPrefix(data, bom) {
+				body, skip = data[len(bom):], len(bom)
+				break
+			}
+		}
+	}
+	text, used, err := decodeText(body, enc, atEOF)
+	if err != nil {
+		return FileChunk{}, err
+	}
+	used += skip
+	return FileChunk{
+		Offset:   offset,
+		Length:   used,
+		Size:     size,
+		EOF:      offset+int64(used) >= size,
+		Encoding: enc,
+		Text:     text,
+	}, nil
+}
+
+// DetectFileEncoding 根据文件开头识别编码：utf-8/utf-16le/utf-16be/gb18030/iso-8859-1/binary
+func (sft *SftpService) DetectFileEncoding(sessionID string, filePath string) (string, error) {
+	f, _, enc, err := sft.openPreviewFile(sessionID, filePath, "")
+	if err != nil {
+		return "", err
+	}
+	f.Close()
+	return enc, nil
+}
+
+// ReadFileRange 读取 [offset, offset+length) 的内容，length 最大 4MB。
+// charset 为空时自动识别编码，末尾不完整的字符不返回，下一段从 Offset+Length 开始
+func (sft *SftpService) ReadFileRange(sessionID string, filePath string, offset int64, length int, charset string) (FileChunk, error) {
+	Logger.Debug("ReadFileRange", zap.String("sessionID", sessionID), zap.String("path", filePath),
+		zap.Int64("offset", offset), zap.Int("length", length))
+	if offset < 0 || length <= 0 {
+		return FileChunk{}, fmt.Errorf("无效的读取范围")
+	}
+	length = min(length, maxPreviewBytes)
+	f, size, enc, err := sft.openPreviewFile(sessionID, filePath, charset)
+	if err != nil {
+		return FileChunk{}, err
+	}
+	defer f.Close()
+	offset -= offset % codeUnit(enc)
+	data, err := readAtMost(f, offset, length)
+	if err != nil {
+		return FileChunk{}, err
+	}
+	return buildChunk(data, offset, size, enc)
+}
+
+// ReadFileHead 读取文件开头的 lines 行，最多读取 4MB
+func (sft *SftpService) ReadFileHead(sessionID string, filePath string, lines int, charset string) (FileChunk, error) {
+	Logger.Debug("ReadFileHead", zap.String("sessionID", sessionID), zap.String("path", filePath), zap.Int("lines", lines))
+	if lines <= 0 {
+		return FileChunk{}, fmt.Errorf("行数必须大于 0")
+	}
+	f, size, enc, err := sft.openPreviewFile(sessionID, filePath, charset)
+	if err != nil {
+		return FileChunk{}, err
+	}
+	defer f.Close()
+
+	nl := newlineBytes(enc)
+	var data []byte
+	found, searchFrom := 0, 0
+	for int64(len(data)) < size && len(data) < maxPreviewBytes {
+		block, err := readAtMost(f, int64(len(data)), min(previewBlockSize, maxPreviewBytes-len(data)))
+		if err != nil {
+			return FileChunk{}, err
+		}
+		if len(block) == 0 {
+			break
+		}
+		data = append(data, block...)
+		for found < lines {
+			i := indexNewline(data, nl, searchFrom)
+			if i < 0 {
+				break
+			}
+			found++
+			searchFrom = i + len(nl)
+		}
+		if found == lines {
+			data = data[:searchFrom]
+			break
+		}
+	}
+	return buildChunk(data, 0, size, enc)
+}
+
+// ReadFileTail 读取文件末尾的 lines 行，最多读取 4MB
+func (sft *SftpService) ReadFileTail(sessionID string, filePath string, lines int, charset string) (FileChunk, error) {
+	Logger.Debug("ReadFileTail", zap.String("sessionID", sessionID), zap.String("path", filePath), zap.Int("lines", lines))
+	if lines <= 0 {
+		return FileChunk{}, fmt.Errorf("行数必须大于 0")
+	}
+	f, size, enc, err := sft.openPreviewFile(sessionID, filePath, charset)
+	if err != nil {
+		return FileChunk{}, err
+	}
+	defer f.Close()
+
+	nl := newlineBytes(enc)
+	unit := codeUnit(enc)
+	end := size - size%unit
+	start := end
+	var data []byte
+	for start > 0 && end-start < maxPreviewBytes {
+		blockStart := max(start-previewBlockSize, 0, end-maxPreviewBytes)
+		blockStart -= blockStart % unit
+		block, err := readAtMost(f, blockStart, int(start-blockStart))
+		if err != nil {
+			return FileChunk{}, err
+		}
+		data = append(block, data...)
+		start = blockStart
+
+		// 文件末尾的换行符不算作新的一行
+		searchEnd := len(data)
+		if bytes.HasSuffix(data, nl) {
+			searchEnd -= len(nl)
+		}
+		found := 0
+		for searchEnd > 0 {
+			i := lastIndexNewline(data, nl, searchEnd)
+			if i < 0 {
+				break
+			}
+			found++
+			if found == lines {
+				cut := i + len(nl)
+				return buildChunk(data[cut:], start+int64(cut), size, enc)
+			}
+			searchEnd = i
+		}
+	}
+	return buildChunk(data, start, size, enc)
+}
+
+// HexDump 以十六进制显示 [offset, offset+length) 的内容，offset 按 16 字节对齐，length 默认 4KB
+func (sft *SftpService) HexDump(sessionID string, filePath string, offset int64, length int) (HexDumpResult, error) {
+	if offset < 0 {
+		return HexDumpResult{}, fmt.Errorf("无效的读取范围")
+	}
+	if length <= 0 {
+		length = defaultHexDumpLength
+	}
+	length = min(length, maxPreviewBytes)
+	f, size, _, err := sft.openPreviewFile(sessionID, filePath, EncodingBinary)
+	if err != nil {
+		return HexDumpResult{}, err
+	}
+	defer f.Close()
+	offset -= offset % 16
+	data, err := readAtMost(f, offset, length)
+	if err != nil {
+		return HexDumpResult{}, err
+	}
+	return HexDumpResult{Offset: offset, Length: len(data), Size: size, Dump: formatHexDump(data, offset)}, nil
+}
+
+// formatHexDump 格式化为 hexdump -C 风格的文本，偏移从 offset 开始
+func formatHexDump(data []byte, offset int64) string {
+	var sb strings.Builder
+	for i := 0; i < len(data); i += 16 {
+		line := data[i:min(i+16, len(data))]
+		fmt.Fprintf(&sb, "%08x  ", offset+int64(i))
+		for j := 0; j < 16; j++ {
+			if j < len(line) {
+				fmt.Fprintf(&sb, "%02x ", line[j])
+			} else {
+				sb.WriteString("   ")
+			}
+			if j == 7 {
+				sb.WriteByte(' ')
+			}
+		}
+		sb.WriteString(" |")
+		for _, b := range line {
+			if b >= 0x20 && b < 0x7F {
+				sb.WriteByte(b)
+			} else {
+				sb.WriteByte('.')
+			}
+		}
+		sb.WriteString("|\n")
+	}
+	return sb.String()
+}
+
+// imageMIMEType 根据扩展名判断图片类型，非图片返回空字符串
+func imageMIMEType(name string) string {
+	switch strings.ToLower(path.Ext(name)) {
+	case ".jpg", ".jpeg":
+		return "image/jpeg"
+	case ".png":
+		return "image/png"
+	case ".gif":
+		return "image/gif"
+	case ".webp":
+		return "image/webp"
+	case ".bmp":
+		return "image/bmp"
+	case ".svg":
+		return "image/svg+xml"
+	case ".ico":
+		return "image/x-icon"
+	}
+	return ""
+}
+
+// GetImageThumbnail 生成图片缩略图，返回 data URL，maxSize 为最长边像素（默认 256）。
+// JPEG/PNG/GIF 在本地缩放，其他格式在 2MB 以内时直接返回原图由前端显示
+func (sft *SftpService) GetImageThumbnail(sessionID string, filePath string, maxSize int) (string, error) {
+	Logger.Debug("GetImageThumbnail", zap.String("sessionID", sessionID), zap.String("path", filePath), zap.Int("maxSize", maxSize))
+	if maxSize <= 0 {
+		maxSize = defaultThumbnailSize
+	}
+	mimeType := imageMIMEType(filePath)
+	if mimeType == "" {
+		return "", fmt.Errorf("不支持预览的图片格式")
+	}
+	f, size, _, err := sft.openPreviewFile(sessionID, filePath, EncodingBinary)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	switch mimeType {
+	case "image/jpeg", "image/png", "image/gif":
+	default:
+		if size > maxRawImageSize {
+			return "", fmt.Errorf("图片过大，无法预览")
+		}
+		data, err := readAtMost(f, 0, int(size))
+		if err != nil {
+			return "", err
+		}
+		return "data:" + mimeType + ";base64," + base64.StdEncoding.EncodeToString(data), nil
+	}
+
+	if size > maxThumbnailFileSize {
+		return "", fmt.Errorf("图片过大，无法预览")
+	}
+	data, err := readAtMost(f, 0, int(size))
+	if err != nil {
+		return "", err
+	}
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return "", fmt.Errorf("无法解析图片: %w", err)
+	}
+	if cfg.Width*cfg.Height > maxThumbnailPixels {
+		return "", fmt.Errorf("图片尺寸过大，无法预览")
+	}
+	img, format, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return "", fmt.Errorf("无法解析图片: %w", err)
+	}
+	thumb := resizeImage(img, maxSize)
+
+	var buf bytes.Buffer
+	if format == "jpeg" {
+		err = jpeg.Encode(&buf, thumb, &jpeg.Options{Quality: 85})
+		mimeType = "image/jpeg"
+	} else {
+		// PNG 和 GIF 可能包含透明像素
+		err = png.Encode(&buf, thumb)
+		mimeType = "image/png"
+	}
+	if err != nil {
+		return "", err
+	}
+	return "data:" + mimeType + ";base64," + base64.StdEncoding.EncodeToString(buf.Bytes()), nil
+}
+
+// resizeImage 等比缩放到最长边不超过 maxSize，每个目标像素取源区域内最多 4x4 个采样点的平均值
+func resizeImage(src image.Image, maxSize int) image.Image {
+	b := src.Bounds()
+	w, h := b.Dx(), b.Dy()
+	if w <= maxSize && h <= maxSize {
+		return src
+	}
+	dw, dh := maxSize, maxSize
+	if w > h {
+		dh = max(h*maxSize/w, 1)
+	} else {
+		dw = max(w*maxSize/h, 1)
+	}
+	dst := image.NewNRGBA(image.Rect(0, 0, dw, dh))
+	for y := 0; y < dh; y++ {
+		y0, y1 := b.Min.Y+y*h/dh, b.Min.Y+(y+1)*h/dh
+		for x := 0; x < dw; x++ {
+			x0, x1 := b.Min.X+x*w/dw, b.Min.X+(x+1)*w/dw
+			stepX, stepY := max((x1-x0)/4, 1), max((y1-y0)/4, 1)
+			var r, g, bl, a, n uint64
+			for sy := y0; sy < y1; sy += stepY {
+				for sx := x0; sx < x1; sx += stepX {
+					c := color.NRGBA64Model.Convert(src.At(sx, sy)).(color.NRGBA64)
+					r, g, bl, a = r+uint64(c.R), g+uint64(c.G), bl+uint64(c.B), a+uint64(c.A)
+					n++
+				}
+			}
+			if n == 0 {
+				continue
+			}
+			dst.SetNRGBA(x, y, color.NRGBA{R: uint8(r / n >> 8), G: uint8(g / n >> 8), B: uint8(bl / n >> 8), A: uint8(a / n >> 8)})
+		}
+	}
+	return dst
+}
+
+// PreviewFile 根据文件类型生成预览：图片返回缩略图，文本返回开头 64KB，二进制返回开头 4KB 的十六进制
+func (sft *SftpService) PreviewFile(sessionID string, filePath string) (FilePreview, error) {
+	Logger.Debug("PreviewFile", zap.String("sessionID", sessionID), zap.String("path", filePath))
+	info, err := sft.GetFileInfo(sessionID, filePath)
+	if err != nil {
+		return FilePreview{}, err
+	}
+	if info.IsDir {
+		return FilePreview{}, fmt.Errorf("%s is a directory", filePath)
+	}
+	preview := FilePreview{Info: info}
+	if imageMIMEType(filePath) != "" {
+		thumb, err := sft.GetImageThumbnail(sessionID, filePath, defaultThumbnailSize)
+		if err == nil {
+			preview.Kind = PreviewKindImage
+			preview.Thumbnail = thumb
+			return preview, nil
+		}
+		Logger.Debug("preview thumbnail failed, fallback", zap.String("path", filePath), zap.Error(err))
+	}
+	chunk, err := sft.ReadFileRange(sessionID, filePath, 0, previewBlockSize, "")
+	if err != nil {
+		return FilePreview{}, err
+	}
+	if chunk.Encoding != EncodingBinary {
+		preview.Kind = PreviewKindText
+		preview.Text = &chunk
+		return preview, nil
+	}
+	hexDump, err := sft.HexDump(sessionID, filePath, 0, defaultHexDumpLength)
+	if err != nil {
+		return FilePreview{}, err
+	}
+	preview.Kind = PreviewKindBinary
+	preview.Hex = &hexDump
+	return preview, nil
+}
+
+// fileFollow 一个正在追踪的文件
+type fileFollow struct {
+	id        string
+	sessionID string
+	path      string
+	encoding  string
+	offset    int64
+	pending   []byte // 上次末尾不完整的字符
+	cancel    context.CancelFunc
+}
+
+// FollowFile 类似 tail -f 追踪文件新增的内容，每秒检查一次，新内容通过 EventFileFollow 推送。
+// offset 为开始追踪的位置，小于 0 时从当前文件末尾开始；文件变小时视为截断或轮转，从头重新读取。
+// 返回追踪 ID，用 StopFollowFile 停止，会话关闭时自动停止
+func (sft *SftpService) FollowFile(sessionID string, filePath string, offset int64, charset string) (string, error) {
+	Logger.Debug("FollowFile", zap.String("sessionID", sessionID), zap.String("path", filePath), zap.Int64("offset", offset))
+	f, size, enc, err := sft.openPreviewFile(sessionID, filePath, charset)
+	if err != nil {
+		return "", err
+	}
+	f.Close()
+	if enc == EncodingBinary {
+		return "", fmt.Errorf("二进制文件不支持追踪")
+	}
+	if offset < 0 || offset > size {
+		offset = size
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	follow := &fileFollow{
+		id:        utils.GenerateRandomID(),
+		sessionID: sessionID,
+		path:      filePath,
+		encoding:  enc,
+		offset:    offset - offset%codeUnit(enc),
+		cancel:    cancel,
+	}
+	fileFollows.Store(follow.id, follow)
+	system.SafeGo(func() {
+		sft.runFollow(ctx, follow)
+	})
+	return follow.id, nil
+}
+
+// StopFollowFile 停止追踪文件
+func (sft *SftpService) StopFollowFile(followID string) error {
+	value, ok := fileFollows.Load(followID)
+	if !ok {
+		return fmt.Errorf("follow with ID %s not found", followID)
+	}
+	value.(*fileFollow).cancel()
+	return nil
+}
+
+func (sft *SftpService) runFollow(ctx context.Context, follow *fileFollow) {
+	defer fileFollows.Delete(follow.id)
+	ticker := time.NewTicker(followInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			follow.emit(FileFollowEvent{Done: true})
+			return
+		case <-ticker.C:
+		}
+		if err := sft.pollFollow(ctx, follow); err != nil {
+			Logger.Debug("follow file stopped", zap.String("path", follow.path), zap.Error(err))
+			follow.emit(FileFollowEvent{Done: true, Error: err.Error()})
+			return
+		}
+	}
+}
+
+// pollFollow 读取文件新增的内容并推送
+func (sft *SftpService) pollFollow(ctx context.Context, follow *fileFollow) error {
+	ftpClient, err := sft.getSftpClient(follow.sessionID)
+	if err != nil {
+		return err
+	}
+	f, err := ftpClient.Open(follow.path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	size := info.Size()
+	truncated := false
+	if size < follow.offset {
+		follow.offset, follow.pending, truncated = 0, nil, true
+	}
+	for follow.offset < size && ctx.Err() == nil {
+		data, err := readAtMost(f, follow.offset, int(min(size-follow.offset, followMaxRead)))
+		if err != nil {
+			return err
+		}
+		if len(data) == 0 {
+			break
+		}
+		follow.offset += int64(len(data))
+		data = append(follow.pending, data...)
+		text, used, err := decodeText(data, follow.encoding, false)
+		if err != nil {
+			return err
+		}
+		follow.pending = append([]byte(nil), data[used:]...)
+		follow.emit(FileFollowEvent{Offset: follow.offset - int64(len(follow.pending)), Size: size, Text: text, Truncated: truncated})
+		truncated = false
+	}
+	if truncated {
+		follow.emit(FileFollowEvent{Offset: 0, Size: size, Truncated: true})
+	}
+	return nil
+}
+
+func (follow *fileFollow) emit(event FileFollowEvent) {
+	if app == nil {
+		return
+	}
+	event.FollowID = follow.id
+	event.SessionID = follow.sessionID
+	event.Path = follow.path
+	app.Event.Emit(EventFileFollow, event)
+}
+
+// stopFileFollowsBySession 会话关闭时停止该会话的所有文件追踪
+func stopFileFollowsBySession(sessionID string) {
+	fileFollows.Range(func(_, value any) bool {
+		follow := value.(*fileFollow)
+		if follow.sessionID == sessionID {
+			follow.cancel()
+		}
+		return true
+	})
+}
@@ -0,0 +1,38 @@
+package services
+
+import (
+	"testing"
+
+	"golang.org/x/text/encoding/simplifiedchinese"
+)
+
+func TestDetectEncoding(t *testing.T) {
+	gbk, err := simplifiedchinese.GB18030.NewEncoder().Bytes([]byte("中文内容，用于测试编码识别"))
+	if err != nil {
+		t.Fatalf("encode gb18030: %v", err)
+	}
+	utf8Text := []byte("中文内容")
+	tests := []struct {
+		name   string
+		sample []byte
+		want   string
+	}{
+		{"empty", nil, EncodingUTF8},
+		{"ascii", []byte("hello\nworld\t\x1b[0m"), EncodingUTF8},
+		{"utf8 bom", []byte("\xEF\xBB\xBFabc"), EncodingUTF8},
+		{"utf16le bom", []byte("\xFF\xFEa\x00"), EncodingUTF16LE},
+		{"utf16be bom", []byte("\xFE\xFF\x00a"), EncodingUTF16BE},
+		{"utf16le no bom", []byte("h\x00e\x00l\x00l\x00o\x00"), EncodingUTF16LE},
+		{"utf16be no bom", []byte("\x00h\x00e\x00l\x00l\x00o"), EncodingUTF16BE},
+		{"utf8 truncated", utf8Text[:len(utf8Text)-1], EncodingUTF8},
+		{"gb18030", gbk, EncodingGB18030},
+		{"binary nul", []byte("\x7fELF\x02\x01\x01\x00\x00\x00\x00\x00\x00\x00\x00\x00\x02\x00"), EncodingBinary},
+		{"binary control", []byte("\x01\x02\x03\x04abc"), EncodingBinary},
+		{"latin1", []byte("caf\xe9 na\xefve"), EncodingLatin1},
+	}
+	for _, tt := range tests {
+		if got := detectEncoding(tt.sample); got != tt.want {
+			t.Errorf("%s: got %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,336 @@
+package services
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/pkg/sftp"
+	"go.uber.org/zap"
+)
+
+// 服务器间传输：在两个会话的 SFTP 客户端之间直接流式复制，数据不落地本机；
+// 可选在源服务器上执行 rsync/scp 直接传到目标服务器
+
+// RemoteCopyOptions 服务器间传输选项
+type RemoteCopyOptions struct {
+	TargetSessionID string `json:"targetSessionID"` // 目标会话
+	// FastPath 先尝试在源服务器上执行 rsync（不可用时 scp）直接传到目标服务器，
+	// 需要源服务器能直接访问目标服务器并已配置免密登录，失败时回退到经本机中转
+	FastPath bool `json:"fastPath"`
+	// TargetAddress 源服务器访问目标服务器使用的地址 user@host:port，为空时使用目标会话的用户和地址，
+	// 目标会话经跳板机连接时必须填写
+	TargetAddress string `json:"targetAddress"`
+	// AcceptNewHostKey 源服务器的 known_hosts 中没有目标服务器时自动信任并写入，
+	// 默认按源服务器的 known_hosts 校验，未知主机使快速传输失败并回退到经本机中转
+	AcceptNewHostKey bool `json:"acceptNewHostKey"`
+}
+
+// fastPathSafePath 快速路径只处理不需要远程 shell 二次转义的路径
+var fastPathSafePath = regexp.MustCompile(`^[A-Za-z0-9._/+@%=,:-]+$`)
+
+// StartRemoteCopy 将 sourcePath（文件或目录）从会话 sessionID 复制到目标会话的 targetDir 目录下，返回传输 ID
+func (sft *SftpService) StartRemoteCopy(sessionID, sourcePath, targetDir string, opts RemoteCopyOptions) (string, error) {
+	Logger.Debug("StartRemoteCopy", zap.String("sessionID", sessionID), zap.String("sourcePath", sourcePath),
+		zap.String("targetDir", targetDir), zap.Any("opts", opts))
+	if opts.TargetSessionID == "" || targetDir == "" {
+		return "", fmt.Errorf("目标会话和目录不能为空")
+	}
+	srcClient, err := sft.getSftpClient(sessionID)
+	if err != nil {
+		return "", err
+	}
+	if _, err := sft.getSftpClient(opts.TargetSessionID); err != nil {
+		return "", err
+	}
+	if opts.TargetAddress != "" {
+		if _, _, _, err := parseTargetAddress(opts.TargetAddress); err != nil {
+			return "", err
+		}
+	}
+	info, err := srcClient.Stat(sourcePath)
+	if err != nil {
+		return "", err
+	}
+	spec := transferSpec{
+		sessionID:    sessionID,
+		transferType: TransferTypeRemote,
+		isDir:        info.IsDir(),
+		localPath:    path.Clean(targetDir),
+		remotePath:   path.Clean(sourcePath),
+		options:      transferOptions{Remote: &opts},
+	}
+	var total int64
+	if !info.IsDir() {
+		total = info.Size()
+	}
+	return transferQueue.enqueue(spec, total), nil
+}
+
+// remoteCopy 执行服务器间传输
+func (sft *SftpService) remoteCopy(spec transferSpec, tracker *transferTracker) error {
+	opts := spec.options.Remote
+	if opts == nil {
+		return fmt.Errorf("缺少服务器间传输选项")
+	}
+	srcClient, err := sft.getSftpClient(spec.sessionID)
+	if err != nil {
+		return err
+	}
+	dstClient, err := sft.getSftpClient(opts.TargetSessionID)
+	if err != nil {
+		return errors.New("目标会话已关闭")
+	}
+	if err := sft.ensureRemoteDirExists(dstClient, spec.localPath); err != nil {
+		return err
+	}
+
+	if opts.FastPath {
+		err := sft.remoteCopyDirect(spec, opts, tracker)
+		if err == nil {
+			tracker.setTransferred(tracker.getTotal())
+			return nil
+		}
+		if tracker.ctx.Err() != nil {
+			return errors.New("user cancelled")
+		}
+		Logger.Info("remote copy fast path failed, fallback to sftp stream", zap.String("id", tracker.id), zap.Error(err))
+		tracker.setTransferred(0)
+	}
+
+	target := joinRemotePath(spec.localPath, path.Base(spec.remotePath))
+	if spec.isDir {
+		return copyRemoteDir(srcClient, dstClient, spec.remotePath, target, tracker)
+	}
+	return copyRemoteFile(srcClient, dstClient, spec.remotePath, target, tracker)
+}
+
+// copyRemoteFile 从源服务器读取文件写入目标服务器，续传规则与上传相同
+func copyRemoteFile(srcClient, dstClient *sftp.Client, srcPath, dstPath string, tracker *transferTracker) error {
+	srcFile, err := srcClient.Open(srcPath)
+	if err != nil {
+		return err
+	}
+	defer srcFile.Close()
+	srcInfo, err := srcFile.Stat()
+	if err != nil {
+		return err
+	}
+
+	dstFile, offset, err := openUploadTarget(dstClient, dstPath, srcFile, srcInfo.Size(), tracker, false)
+	if err != nil {
+		return err
+	}
+	defer dstFile.Close()
+
+	if offset > 0 {
+		tracker.skip(offset)
+		if offset == srcInfo.Size() {
+			return nil
+		}
+		if _, err := srcFile.Seek(offset, io.SeekStart); err != nil {
+			return err
+		}
+	}
+	if _, err := io.Copy(dstFile, &progressReader{reader: srcFile, tracker: tracker}); err != nil {
+		return err
+	}
+	return dstClient.Chmod(dstPath, srcInfo.Mode().Perm())
+}
+
+// copyRemoteDir 递归复制目录，指向文件的符号链接按文件复制，指向目录的符号链接跳过以避免循环
+func copyRemoteDir(srcClient, dstClient *sftp.Client, srcDir, dstDir string, tracker *transferTracker) error {
+	if err := dstClient.MkdirAll(dstDir); err != nil {
+		return err
+	}
+	entries, err := srcClient.ReadDir(srcDir)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		srcPath := joinRemotePath(srcDir, entry.Name())
+		dstPath := joinRemotePath(dstDir, entry.Name())
+		if entry.Mode()&os.ModeSymlink != 0 {
+			if entry, err = srcClient.Stat(srcPath); err != nil || entry.IsDir() {
+				Logger.Debug("remote copy skip symlink", zap.String("path", srcPath))
+				continue
+			}
+		}
+		switch {
+		case entry.IsDir():
+			err = copyRemoteDir(srcClient, dstClient, srcPath, dstPath, tracker)
+		case entry.Mode().IsRegular():
+			err = copyRemoteFile(srcClient, dstClient, srcPath, dstPath, tracker)
+		default:
+			continue
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// remoteCopySize 统计 copyRemoteDir 需要复制的字节数，符号链接的处理与 copyRemoteDir 相同
+func remoteCopySize(srcClient *sftp.Client, srcDir string) (int64, error) {
+	entries, err := srcClient.ReadDir(srcDir)
+	if err != nil {
+		return 0, err
+	}
+	var size int64
+	for _, entry := range entries {
+		srcPath := joinRemotePath(srcDir, entry.Name())
+		if entry.Mode()&os.ModeSymlink != 0 {
+			if entry, err = srcClient.Stat(srcPath); err != nil || entry.IsDir() {
+				continue
+			}
+		}
+		switch {
+		case entry.IsDir():
+			n, err := remoteCopySize(srcClient, srcPath)
+			if err != nil {
+				return 0, err
+			}
+			size += n
+		case entry.Mode().IsRegular():
+			size += entry.Size()
+		}
+	}
+	return size, nil
+}
+
+// parseTargetAddress 解析 user@host:port，端口默认为 22
+func parseTargetAddress(addr string) (string, string, int, error) {
+	user, hostPort, ok := strings.Cut(addr, "@")
+	if !ok || user == "" {
+		return "", "", 0, fmt.Errorf("目标地址格式应为 user@host:port")
+	}
+	host, portStr, err := net.SplitHostPort(hostPort)
+	port := 22
+	if err != nil {
+		host = strings.Trim(hostPort, "[]")
+	} else if port, err = strconv.Atoi(portStr); err != nil || port <= 0 || port > 65535 {
+		return "", "", 0, fmt.Errorf("无效的端口: %s", portStr)
+	}
+	if err := checkTargetUserHost(user, host); err != nil {
+		return "", "", 0, err
+	}
+	return user, host, port, nil
+}
+
+// checkTargetUserHost 与 fastPathSafePath 一样限制拼接到 rsync/scp 命令中的用户和主机：
+// 不能为空、以 - 开头或包含空白和控制字符，避免被当作命令选项或拆分成多个参数
+func checkTargetUserHost(user, host string) error {
+	for _, s := range []string{user, host} {
+		if s == "" || strings.HasPrefix(s, "-") || strings.ContainsFunc(s, func(r rune) bool {
+			return unicode.IsSpace(r) || unicode.IsControl(r)
+		}) {
+			return fmt.Errorf("目标地址中的用户或主机无效: %q", s)
+		}
+	}
+	return nil
+}
+
+// fastPathTarget 返回源服务器访问目标服务器使用的用户、主机和端口。
+// 未指定地址时使用目标会话连接时填写的主机和端口；经跳板机连接的目标通常无法从源服务器直接访问，需要指定地址
+func (sft *SftpService) fastPathTarget(opts *RemoteCopyOptions) (string, string, int, error) {
+	if opts.TargetAddress != "" {
+		return parseTargetAddress(opts.TargetAddress)
+	}
+	connVal, ok := sftpClient.Load(opts.TargetSessionID)
+	if !ok {
+		return "", "", 0, errors.New("目标会话已关闭")
+	}
+	target := connVal.(*SftpService)
+	if target.sshConnect == nil || target.sshClient == nil {
+		return "", "", 0, errors.New("目标会话已关闭")
+	}
+	if target.sshConnect.proxyJumpID != "" {
+		return "", "", 0, errors.New("目标会话经跳板机连接，请填写源服务器访问目标服务器的地址")
+	}
+	user, host := target.sshClient.User(), target.sshConnect.host
+	if err := checkTargetUserHost(user, host); err != nil {
+		return "", "", 0, err
+	}
+	return user, host, target.sshConnect.port, nil
+}
+
+// buildFastPathCommand 构造在源服务器上执行的复制命令：优先 rsync，不可用时使用 scp。
+// BatchMode 禁止交互式认证，源服务器无法免密登录目标服务器或不认识目标服务器的主机密钥时立即失败；
+// acceptNewHostKey 为 true 时自动信任未知的主机密钥
+func buildFastPathCommand(srcPath, user, host string, port int, targetDir string, acceptNewHostKey bool) string {
+	sshOpts := "-o BatchMode=yes -o ConnectTimeout=10"
+	if acceptNewHostKey {
+		sshOpts += " -o StrictHostKeyChecking=accept-new"
+	}
+	dest := shellQuote(user + "@" + host + ":" + targetDir + "/")
+	if strings.Contains(host, ":") {
+		dest = shellQuote(user + "@[" + host + "]:" + targetDir + "/")
+	}
+	rsync := fmt.Sprintf("rsync -a --partial --info=progress2 --no-inc-recursive -e %s %s %s",
+		shellQuote(fmt.Sprintf("ssh -p %d %s", port, sshOpts)), shellQuote(srcPath), dest)
+	scp := fmt.Sprintf("scp -r -p -q -P %d %s %s %s", port, sshOpts, shellQuote(srcPath), dest)
+	return fmt.Sprintf("if command -v rsync >/dev/null 2>&1; then %s; else %s; fi", rsync, scp)
+}
+
+// remoteCopyDirect 在源服务器上执行 rsync/scp 直接传到目标服务器，rsync 的进度输出用于更新传输进度
+func (sft *SftpService) remoteCopyDirect(spec transferSpec, opts *RemoteCopyOptions, tracker *transferTracker) error {
+	if !fastPathSafePath.MatchString(spec.remotePath) || !fastPathSafePath.MatchString(spec.localPath) {
+		return fmt.Errorf("路径包含特殊字符，不使用快速传输")
+	}
+	user, host, port, err := sft.fastPathTarget(opts)
+	if err != nil {
+		return err
+	}
+	client, err := sft.getSSHClient(spec.sessionID)
+	if err != nil {
+		return err
+	}
+	command := buildFastPathCommand(spec.remotePath, user, host, port, spec.localPath, opts.AcceptNewHostKey)
+	Logger.Debug("remote copy fast path", zap.String("id", tracker.id), zap.String("command", command))
+	rc, err := startRemoteCommand(tracker.ctx, client, command)
+	if err != nil {
+		return err
+	}
+	scanner := bufio.NewScanner(rc.Stdout)
+	scanner.Split(scanProgressLines)
+	for scanner.Scan() {
+		if n, ok := parseRsyncProgress(scanner.Text()); ok {
+			tracker.setTransferred(n)
+		}
+	}
+	return rc.Wait()
+}
+
+// scanProgressLines 按 \r 或 \n 分隔 rsync 的进度输出
+func scanProgressLines(data []byte, atEOF bool) (int, []byte, error) {
+	if i := bytes.IndexAny(data, "\r\n"); i >= 0 {
+		return i + 1, data[:i], nil
+	}
+	if atEOF && len(data) > 0 {
+		return len(data), data, nil
+	}
+	return 0, nil, nil
+}
+
+// parseRsyncProgress 解析 --info=progress2 输出行首的已传输字节数，例如 "  1,234,567  45%  1.20MB/s  0:00:01"
+func parseRsyncProgress(line string) (int64, bool) {
+	fields := strings.Fields(line)
+	if len(fields) < 2 || !strings.HasSuffix(fields[1], "%") {
+		return 0, false
+	}
+	n, err := strconv.ParseInt(strings.ReplaceAll(fields[0], ",", ""), 10, 64)
+	if err != nil {
+		return 0, false
+	}
+	return n, true
+}
@@ -0,0 +1,110 @@
+package services
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseRsyncProgress(t *testing.T) {
+	tests := []struct {
+		line string
+		want int64
+		ok   bool
+	}{
+		{"  1,234,567  45%  1.20MB/s    0:00:01", 1234567, true},
+		{"          0   0%    0.00kB/s    0:00:00", 0, true},
+		{"  52,428,800 100%   50.00MB/s    0:00:01 (xfr#1, to-chk=0/1)", 52428800, true},
+		{"sending incremental file list", 0, false},
+		{"dir/file.txt", 0, false},
+		{"  1,2x4  45%", 0, false},
+		{"", 0, false},
+	}
+	for _, tt := range tests {
+		got, ok := parseRsyncProgress(tt.line)
+		if ok != tt.ok || got != tt.want {
+			t.Errorf("parseRsyncProgress(%q): got %d %v, want %d %v", tt.line, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestParseTargetAddress(t *testing.T) {
+	tests := []struct {
+		addr    string
+		user    string
+		host    string
+		port    int
+		wantErr bool
+	}{
+		{"root@example.com:2222", "root", "example.com", 2222, false},
+		{"root@example.com", "root", "example.com", 22, false},
+		{"u@[::1]:22", "u", "::1", 22, false},
+		{"u@[::1]", "u", "::1", 22, false},
+		{"example.com:22", "", "", 0, true},
+		{"u@host:0", "", "", 0, true},
+		{"-oProxyCommand=x@host", "", "", 0, true},
+		{"u@-oProxyCommand=x", "", "", 0, true},
+		{"u@-host:22", "", "", 0, true},
+		{"u v@host", "", "", 0, true},
+		{"u@ho st:22", "", "", 0, true},
+		{"u@host\n", "", "", 0, true},
+		{"u@", "", "", 0, true},
+		{"u@:22", "", "", 0, true},
+	}
+	for _, tt := range tests {
+		user, host, port, err := parseTargetAddress(tt.addr)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("parseTargetAddress(%q): err %v, wantErr %v", tt.addr, err, tt.wantErr)
+			continue
+		}
+		if err == nil && (user != tt.user || host != tt.host || port != tt.port) {
+			t.Errorf("parseTargetAddress(%q): got %s %s %d", tt.addr, user, host, port)
+		}
+	}
+}
+
+func TestBuildFastPathCommandHostKey(t *testing.T) {
+	cmd := buildFastPathCommand("/src", "u", "h", 22, "/dst", false)
+	if strings.Contains(cmd, "StrictHostKeyChecking") {
+		t.Errorf("default command must keep host key checking: %s", cmd)
+	}
+	cmd = buildFastPathCommand("/src", "u", "h", 22, "/dst", true)
+	if !strings.Contains(cmd, "StrictHostKeyChecking=accept-new") {
+		t.Errorf("opt-in command must accept new host keys: %s", cmd)
+	}
+	cmd = buildFastPathCommand("/src", "u", "::1", 22, "/dst", false)
+	if !strings.Contains(cmd, "'u@[::1]:/dst/'") {
+		t.Errorf("IPv6 target must be bracketed: %s", cmd)
+	}
+}
+
+func TestRemoteCopySize(t *testing.T) {
+	client := newMemSftpClient(t)
+	files := map[string]string{"/src/a": "12345", "/src/sub/b": "678", "/other/c": "0000000000"}
+	for _, dir := range []string{"/src/sub", "/other"} {
+		if err := client.MkdirAll(dir); err != nil {
+			t.Fatalf("mkdir %s: %v", dir, err)
+		}
+	}
+	for p, content := range files {
+		f, err := client.Create(p)
+		if err != nil {
+			t.Fatalf("create %s: %v", p, err)
+		}
+		_, _ = f.Write([]byte(content))
+		f.Close()
+	}
+	// 指向文件的链接按文件计算，指向目录的链接跳过
+	if err := client.Symlink("/other/c", "/src/link"); err != nil {
+		t.Fatalf("symlink: %v", err)
+	}
+	if err := client.Symlink("/other", "/src/dirlink"); err != nil {
+		t.Fatalf("symlink: %v", err)
+	}
+	got, err := remoteCopySize(client, "/src")
+	if err != nil {
+		t.Fatalf("remoteCopySize: %v", err)
+	}
+	if got != 18 {
+		t.Errorf("remoteCopySize: got %d, want 18", got)
+	}
+}
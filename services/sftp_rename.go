@@ -0,0 +1,353 @@
+package services
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"regexp"
+	"strings"
+	"unicode"
+
+	"github.com/ilaziness/vexo/internal/utils"
+	"github.com/pkg/sftp"
+	"go.uber.org/zap"
+)
+
+// 批量重命名：按正则替换、大小写转换和编号规则生成新名称，先预览并检查冲突，
+// 执行时先把所有条目改为临时名称再改为新名称，因此名称互换和链式改名也能完成，中途失败时撤销已完成的重命名
+
+const (
+	RenameCaseLower = "lower"
+	RenameCaseUpper = "upper"
+	RenameCaseTitle = "title" // 每个单词首字母大写
+
+	renameMaxNumberPad = 20 // 编号最多补齐到的位数
+)
+
+// BatchRenameOptions 批量重命名规则，依次执行正则替换、大小写转换和模板
+type BatchRenameOptions struct {
+	Find       string `json:"find"`       // 正则表达式，为空时不替换
+	Replace    string `json:"replace"`    // 替换内容，可用 $1、${name} 引用分组
+	IgnoreCase bool   `json:"ignoreCase"` // 正则不区分大小写
+	IncludeExt bool   `json:"includeExt"` // 规则同时作用于扩展名，否则只处理文件名主体，目录始终处理整个名称
+	Case       string `json:"case"`       // lower/upper/title，为空时不转换
+	// Template 新名称模板，{name} 为替换和转换后的名称，{n} 为编号，例如 "{name}_{n}"；为空时相当于 {name}
+	Template    string `json:"template"`
+	NumberStart int    `json:"numberStart"` // 第一个条目的编号
+	NumberStep  int    `json:"numberStep"`  // 编号步长，0 表示 1
+	NumberPad   int    `json:"numberPad"`   // 编号最小位数，不足时补 0，最多 20 位
+}
+
+// BatchRenameItem 一个条目的重命名预览
+type BatchRenameItem struct {
+	Path     string `json:"path"`
+	OldName  string `json:"oldName"`
+	NewName  string `json:"newName"`
+	Changed  bool   `json:"changed"`
+	Conflict string `json:"conflict"` // 冲突原因，为空表示没有冲突
+}
+
+// BatchRenamePreview 批量重命名预览，条目顺序与选择的顺序相同
+type BatchRenamePreview struct {
+	Items     []BatchRenameItem `json:"items"`
+	Changed   int               `json:"changed"`   // 名称发生变化的条目数
+	Conflicts int               `json:"conflicts"` // 有冲突的条目数，大于 0 时不能执行
+}
+
+// renameStep 一次已完成的重命名，撤销时反向执行
+type renameStep struct {
+	from string
+	to   string
+}
+
+// compile 检查规则并编译正则表达式，Find 为空时返回 nil
+func (o BatchRenameOptions) compile() (*regexp.Regexp, error) {
+	switch o.Case {
+	case "", RenameCaseLower, RenameCaseUpper, RenameCaseTitle:
+	default:
+		return nil, fmt.Errorf("无效的大小写转换: %s", o.Case)
+	}
+	if o.Find == "" {
+		return nil, nil
+	}
+	expr := o.Find
+	if o.IgnoreCase {
+		expr = "(?i)" + expr
+	}
+	re, err := regexp.Compile(expr)
+	if err != nil {
+		return nil, fmt.Errorf("无效的正则表达式: %w", err)
+	}
+	return re, nil
+}
+
+// newName 按规则生成第 index 个条目的新名称
+func (o BatchRenameOptions) newName(name string, isDir bool, index int, re *regexp.Regexp) string {
+	stem, ext := name, ""
+	if !isDir && !o.IncludeExt {
+		stem, ext = splitExt(name)
+	}
+	if re != nil {
+		stem = re.ReplaceAllString(stem, o.Replace)
+	}
+	switch o.Case {
+	case RenameCaseLower:
+		stem = strings.ToLower(stem)
+	case RenameCaseUpper:
+		stem = strings.ToUpper(stem)
+	case RenameCaseTitle:
+		stem = titleCase(stem)
+	}
+	if o.Template != "" {
+		step := o.NumberStep
+		if step == 0 {
+			step = 1
+		}
+		number := fmt.Sprintf("%0*d", min(max(o.NumberPad, 0), renameMaxNumberPad), o.NumberStart+index*step)
+		stem = strings.ReplaceAll(strings.ReplaceAll(o.Template, "{n}", number), "{name}", stem)
+	}
+	return stem + ext
+}
+
+// titleCase 每个单词首字母大写，其余字母小写，字母和数字以外的字符分隔单词
+func titleCase(s string) string {
+	var b strings.Builder
+	start := true
+	for _, r := range s {
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+			b.WriteRune(r)
+			start = true
+			continue
+		}
+		if start {
+			b.WriteRune(unicode.ToUpper(r))
+		} else {
+			b.WriteRune(unicode.ToLower(r))
+		}
+		start = false
+	}
+	return b.String()
+}
+
+// validRenameName 检查新名称是否可以作为文件名
+func validRenameName(name string) error {
+	switch {
+	case name == "":
+		return fmt.Errorf("新名称为空")
+	case name == "." || name == "..":
+		return fmt.Errorf("新名称无效")
+	case strings.ContainsAny(name, "/\x00"):
+		return fmt.Errorf("新名称不能包含 /")
+	}
+	return nil
+}
+
+// sameRemoteFile 判断两次 Lstat 的结果是否为同一个文件。SFTP 不提供 inode，按类型、大小、时间和所有者比较，
+// 用于识别不区分大小写的服务器上只改变大小写的重命名
+func sameRemoteFile(a, b os.FileInfo) bool {
+	if a.Mode() != b.Mode() || a.Size() != b.Size() || !a.ModTime().Equal(b.ModTime()) {
+		return false
+	}
+	sa, okA := a.Sys().(*sftp.FileStat)
+	sb, okB := b.Sys().(*sftp.FileStat)
+	if okA && okB {
+		return sa.UID == sb.UID && sa.GID == sb.GID && sa.Atime == sb.Atime
+	}
+	return okA == okB
+}
+
+// renameFindsSelf 判断只改变大小写时找到的目标是否为条目自身（不区分大小写的服务器）。
+// 区分大小写的服务器上目录中会有名称完全相同的另一个条目
+func renameFindsSelf(ftpClient *sftp.Client, item *BatchRenameItem, info, targetInfo os.FileInfo) (bool, error) {
+	if !strings.EqualFold(item.NewName, item.OldName) || !sameRemoteFile(info, targetInfo) {
+		return false, nil
+	}
+	entries, err := ftpClient.ReadDir(path.Dir(item.Path))
+	if err != nil {
+		return false, fmt.Errorf("%s: %w", path.Dir(item.Path), err)
+	}
+	for _, entry := range entries {
+		if entry.Name() == item.NewName {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// nestedSelection 返回 p 的上级目录中同样被选择的一个，没有时返回空字符串
+func nestedSelection(p string, sources map[string]bool) string {
+	for dir := path.Dir(p); dir != p; p, dir = dir, path.Dir(dir) {
+		if sources[dir] {
+			return dir
+		}
+	}
+	return ""
+}
+
+// planBatchRename 生成新名称并检查冲突：新名称无效、多个条目改为同一名称、目标已存在且不在本次重命名的条目中。
+// 不能同时选择目录和其中的条目，目录改名后其中条目的路径会失效
+func planBatchRename(ftpClient *sftp.Client, paths []string, opts BatchRenameOptions) (BatchRenamePreview, error) {
+	var preview BatchRenamePreview
+	if len(paths) == 0 {
+		return preview, fmt.Errorf("请选择要重命名的文件")
+	}
+	re, err := opts.compile()
+	if err != nil {
+		return preview, err
+	}
+	sources := make(map[string]bool, len(paths))
+	for _, p := range paths {
+		p = path.Clean(p)
+		if sources[p] {
+			return preview, fmt.Errorf("%s 重复选择", p)
+		}
+		sources[p] = true
+	}
+	preview.Items = make([]BatchRenameItem, 0, len(paths))
+	infos := make([]os.FileInfo, 0, len(paths))
+	for i, p := range paths {
+		p = path.Clean(p)
+		if dir := nestedSelection(p, sources); dir != "" {
+			return preview, fmt.Errorf("%s 位于同时选择的目录 %s 中，请分别重命名", p, dir)
+		}
+		info, err := ftpClient.Lstat(p)
+		if err != nil {
+			return preview, fmt.Errorf("%s: %w", p, err)
+		}
+		name := path.Base(p)
+		newName := opts.newName(name, info.IsDir(), i, re)
+		preview.Items = append(preview.Items, BatchRenameItem{Path: p, OldName: name, NewName: newName, Changed: newName != name})
+		infos = append(infos, info)
+	}
+
+	targets := make(map[string]int, len(paths))
+	for i := range preview.Items {
+		item := &preview.Items[i]
+		if item.Changed {
+			preview.Changed++
+		}
+		if err := validRenameName(item.NewName); err != nil {
+			item.Conflict = err.Error()
+			continue
+		}
+		target := joinRemotePath(path.Dir(item.Path), item.NewName)
+		if j, ok := targets[target]; ok {
+			item.Conflict = fmt.Sprintf("与 %s 的新名称相同", preview.Items[j].OldName)
+			if preview.Items[j].Conflict == "" {
+				preview.Items[j].Conflict = fmt.Sprintf("与 %s 的新名称相同", item.OldName)
+			}
+			continue
+		}
+		targets[target] = i
+		// 目标是本次选择的其他条目时，它会先被改为临时名称
+		if !item.Changed || sources[target] {
+			continue
+		}
+		if targetInfo, err := ftpClient.Lstat(target); err == nil {
+			self, err := renameFindsSelf(ftpClient, item, infos[i], targetInfo)
+			if err != nil {
+				return preview, err
+			}
+			if !self {
+				item.Conflict = "目标已存在"
+			}
+		} else if !os.IsNotExist(err) {
+			return preview, fmt.Errorf("%s: %w", target, err)
+		}
+	}
+	for _, item := range preview.Items {
+		if item.Conflict != "" {
+			preview.Conflicts++
+		}
+	}
+	return preview, nil
+}
+
+// PreviewBatchRename 预览批量重命名的结果，paths 的顺序决定编号顺序
+func (sft *SftpService) PreviewBatchRename(sessionID string, paths []string, opts BatchRenameOptions) (BatchRenamePreview, error) {
+	Logger.Debug("PreviewBatchRename", zap.String("sessionID", sessionID), zap.Int("count", len(paths)), zap.Any("opts", opts))
+	ftpClient, err := sft.getSftpClient(sessionID)
+	if err != nil {
+		return BatchRenamePreview{}, err
+	}
+	return planBatchRename(ftpClient, paths, opts)
+}
+
+// BatchRename 按规则批量重命名，有冲突时不执行。任一重命名失败时撤销已完成的重命名，
+// 返回实际重命名的条目
+func (sft *SftpService) BatchRename(sessionID string, paths []string, opts BatchRenameOptions) ([]BatchRenameItem, error) {
+	Logger.Debug("BatchRename", zap.String("sessionID", sessionID), zap.Int("count", len(paths)), zap.Any("opts", opts))
+	ftpClient, err := sft.getSftpClient(sessionID)
+	if err != nil {
+		return nil, err
+	}
+	preview, err := planBatchRename(ftpClient, paths, opts)
+	if err != nil {
+		return nil, err
+	}
+	if preview.Conflicts > 0 {
+		return nil, fmt.Errorf("有 %d 个名称冲突，请修改规则后重试", preview.Conflicts)
+	}
+	var items []BatchRenameItem
+	for _, item := range preview.Items {
+		if item.Changed {
+			items = append(items, item)
+		}
+	}
+	if len(items) == 0 {
+		return nil, nil
+	}
+	changed := make([]string, 0, len(items))
+	for _, item := range items {
+		changed = append(changed, item.Path)
+	}
+	defer invalidateListings(sessionID, changed...)
+
+	var done []renameStep
+	rename := func(from, to, source string) error {
+		if err := ftpClient.Rename(from, to); err != nil {
+			return fmt.Errorf("重命名 %s 失败: %w", source, err)
+		}
+		done = append(done, renameStep{from: from, to: to})
+		return nil
+	}
+	token := utils.GenerateRandomID()[:8]
+	temps := make([]string, len(items))
+	for i, item := range items {
+		temps[i] = joinRemotePath(path.Dir(item.Path), fmt.Sprintf(".vexo-rename-%s-%d", token, i))
+		if err = rename(item.Path, temps[i], item.Path); err != nil {
+			break
+		}
+	}
+	if err == nil {
+		for i, item := range items {
+			if err = rename(temps[i], joinRemotePath(path.Dir(item.Path), item.NewName), item.Path); err != nil {
+				break
+			}
+		}
+	}
+	if err != nil {
+		Logger.Warn("batch rename failed, rolling back", zap.String("sessionID", sessionID), zap.Int("done", len(done)), zap.Error(err))
+		if rollbackErr := rollbackRenames(ftpClient, done); rollbackErr != nil {
+			return nil, fmt.Errorf("%w，撤销失败: %v", err, rollbackErr)
+		}
+		return nil, fmt.Errorf("%w，已撤销之前的重命名", err)
+	}
+	Logger.Info("batch rename done", zap.String("sessionID", sessionID), zap.Int("count", len(items)))
+	return items, nil
+}
+
+// rollbackRenames 按相反的顺序撤销已完成的重命名，继续撤销其余条目并返回第一个错误
+func rollbackRenames(ftpClient *sftp.Client, done []renameStep) error {
+	var firstErr error
+	for i := len(done) - 1; i >= 0; i-- {
+		step := done[i]
+		if err := ftpClient.Rename(step.to, step.from); err != nil {
+			Logger.Warn("rollback rename failed", zap.String("from", step.to), zap.String("to", step.from), zap.Error(err))
+			if firstErr == nil {
+				firstErr = fmt.Errorf("%s -> %s: %w", step.to, step.from, err)
+			}
+		}
+	}
+	return firstErr
+}
@@ -0,0 +1,109 @@
+package services
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestPlanBatchRename(t *testing.T) {
+	client := newMemSftpClient(t)
+	if err := client.MkdirAll("/r/dir"); err != nil {
+		t.Fatalf("mkdir: %v", err)
+	}
+	for _, name := range []string{"/r/a.txt", "/r/b.txt", "/r/c.log", "/r/taken.txt", "/r/dir/inner.txt"} {
+		f, err := client.Create(name)
+		if err != nil {
+			t.Fatalf("create %s: %v", name, err)
+		}
+		f.Close()
+	}
+
+	// 互换名称：目标是本次选择的其他条目，不算冲突
+	preview, err := planBatchRename(client, []string{"/r/a.txt", "/r/b.txt"}, BatchRenameOptions{Find: `^(a|b)$`, Replace: "${1}x"})
+	if err != nil {
+		t.Fatalf("planBatchRename: %v", err)
+	}
+	if preview.Changed != 2 || preview.Conflicts != 0 || preview.Items[0].NewName != "ax.txt" {
+		t.Errorf("rename: got %+v", preview)
+	}
+
+	preview, err = planBatchRename(client, []string{"/r/a.txt", "/r/b.txt"}, BatchRenameOptions{Find: `^a$`, Replace: "b"})
+	if err != nil {
+		t.Fatalf("planBatchRename: %v", err)
+	}
+	if preview.Conflicts != 2 {
+		t.Errorf("duplicate target: got %+v", preview)
+	}
+
+	preview, err = planBatchRename(client, []string{"/r/a.txt"}, BatchRenameOptions{Find: `^a$`, Replace: "taken"})
+	if err != nil {
+		t.Fatalf("planBatchRename: %v", err)
+	}
+	if preview.Conflicts != 1 || preview.Items[0].Conflict != "目标已存在" {
+		t.Errorf("existing target: got %+v", preview)
+	}
+
+	preview, err = planBatchRename(client, []string{"/r/a.txt"}, BatchRenameOptions{Find: `^a$`, Replace: "x/y"})
+	if err != nil || preview.Conflicts != 1 {
+		t.Errorf("invalid name: got %+v, %v", preview, err)
+	}
+
+	preview, err = planBatchRename(client, []string{"/r/a.txt", "/r/c.log"}, BatchRenameOptions{Template: "{name}_{n}", NumberStart: 1, NumberPad: 100})
+	if err != nil {
+		t.Fatalf("planBatchRename: %v", err)
+	}
+	if got := preview.Items[1].NewName; got != "c_"+strings.Repeat("0", renameMaxNumberPad-1)+"2.log" {
+		t.Errorf("number pad: got %q", got)
+	}
+
+	// 区分大小写的服务器上 A.txt 是另一个文件
+	f, err := client.Create("/r/A.txt")
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	f.Close()
+	preview, err = planBatchRename(client, []string{"/r/a.txt"}, BatchRenameOptions{Case: RenameCaseUpper})
+	if err != nil || preview.Conflicts != 1 {
+		t.Errorf("case-only rename onto another file: got %+v, %v", preview, err)
+	}
+
+	if _, err := planBatchRename(client, []string{"/r/dir", "/r/dir/inner.txt"}, BatchRenameOptions{Case: RenameCaseUpper}); err == nil {
+		t.Errorf("nested selection: expected error")
+	}
+	if _, err := planBatchRename(client, []string{"/r/a.txt", "/r/./a.txt"}, BatchRenameOptions{}); err == nil {
+		t.Errorf("duplicate selection: expected error")
+	}
+	if _, err := planBatchRename(client, []string{"/r/missing"}, BatchRenameOptions{}); err == nil {
+		t.Errorf("missing source: expected error")
+	}
+}
+
+func TestSameRemoteFile(t *testing.T) {
+	client := newMemSftpClient(t)
+	for _, name := range []string{"/one", "/three"} {
+		f, err := client.Create(name)
+		if err != nil {
+			t.Fatalf("create %s: %v", name, err)
+		}
+		f.Write([]byte(name + name))
+		f.Close()
+	}
+	one, err := client.Lstat("/one")
+	if err != nil {
+		t.Fatal(err)
+	}
+	again, err := client.Lstat("/one")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !sameRemoteFile(one, again) {
+		t.Errorf("same file: expected true")
+	}
+	other, err := client.Lstat("/three")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sameRemoteFile(one, other) {
+		t.Errorf("different files: expected false")
+	}
+}
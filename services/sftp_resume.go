@@ -0,0 +1,199 @@
+package services
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"io"
+	"os"
+
+	"github.com/pkg/sftp"
+	"go.uber.org/zap"
+)
+
+// 断点续传
+
+// resumeVerifySize 续传前校验的已传输部分末尾长度
+const resumeVerifySize = 1 << 20
+
+// resumeOffset 根据目标端已有的部分文件计算续传偏移，返回 0 表示需要从头传输。
+// 目标文件比源文件大时视为不同文件；verify 为 true 时比对重叠部分末尾的哈希。
+func resumeOffset(src io.ReaderAt, srcSize int64, dst io.ReaderAt, dstSize int64, verify bool) (int64, error) {
+	if dstSize <= 0 || dstSize > srcSize {
+		return 0, nil
+	}
+	if verify {
+		ok, err := tailMatches(src, dst, dstSize)
+		if err != nil {
+			return 0, err
+		}
+		if !ok {
+			Logger.Info("resume tail hash mismatch, restart from beginning", zap.Int64("offset", dstSize))
+			return 0, nil
+		}
+	}
+	return dstSize, nil
+}
+
+// tailMatches 比较两个文件在 [end-resumeVerifySize, end) 区间的 SHA-256
+func tailMatches(a, b io.ReaderAt, end int64) (bool, error) {
+	start := end - resumeVerifySize
+	if start < 0 {
+		start = 0
+	}
+	hashA, err := hashSection(a, start, end-start)
+	if err != nil {
+		return false, err
+	}
+	hashB, err := hashSection(b, start, end-start)
+	if err != nil {
+		return false, err
+	}
+	return bytes.Equal(hashA, hashB), nil
+}
+
+func hashSection(r io.ReaderAt, off, n int64) ([]byte, error) {
+	h := sha256.New()
+	if _, err := io.Copy(h, io.NewSectionReader(r, off, n)); err != nil {
+		return nil, err
+	}
+	return h.Sum(nil), nil
+}
+
+// openUploadTarget 打开上传的远程目标文件。非续传时直接创建（截断）；
+// 续传时复用已有的部分文件并定位到续传偏移，偏移等于源文件大小表示已传输完成。
+// fresh 为 true 表示冲突处理决定覆盖已有文件，续传时也从头写入
+func openUploadTarget(ftpClient *sftp.Client, remotePath string, local io.ReaderAt, localSize int64, tracker *transferTracker, fresh bool) (*sftp.File, int64, error) {
+	if !tracker.resume || fresh {
+		f, err := ftpClient.Create(remotePath)
+		return f, 0, err
+	}
+	info, err := ftpClient.Stat(remotePath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			f, err := ftpClient.Create(remotePath)
+			return f, 0, err
+		}
+		return nil, 0, err
+	}
+	f, err := ftpClient.OpenFile(remotePath, os.O_RDWR)
+	if err != nil {
+		return nil, 0, err
+	}
+	offset, err := resumeOffset(local, localSize, f, info.Size(), tracker.verifyTail)
+	if err == nil {
+		err = seekOrTruncate(f, offset)
+	}
+	if err != nil {
+		f.Close()
+		return nil, 0, err
+	}
+	Logger.Debug("upload resume", zap.String("file", remotePath), zap.Int64("offset", offset))
+	return f, offset, nil
+}
+
+// openDownloadTarget 打开下载的本地目标文件，规则同 openUploadTarget
+func openDownloadTarget(localPath string, remote io.ReaderAt, remoteSize int64, tracker *transferTracker, fresh bool) (*os.File, int64, error) {
+	if !tracker.resume || fresh {
+		f, err := os.Create(localPath)
+		return f, 0, err
+	}
+	info, err := os.Stat(localPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			f, err := os.Create(localPath)
+			return f, 0, err
+		}
+		return nil, 0, err
+	}
+	f, err := os.OpenFile(localPath, os.O_RDWR, 0)
+	if err != nil {
+		return nil, 0, err
+	}
+	offset, err := resumeOffset(remote, remoteSize, f, info.Size(), tracker.verifyTail)
+	if err == nil {
+		err = seekOrTruncate(f, offset)
+	}
+	if err != nil {
+		f.Close()
+		return nil, 0, err
+	}
+	Logger.Debug("download resume", zap.String("file", localPath), zap.Int64("offset", offset))
+	return f, offset, nil
+}
+
+// seekOrTruncate 偏移为 0 时清空文件从头写入，否则定位到偏移处
+func seekOrTruncate(f interface {
+	io.Seeker
+	Truncate(int64) error
+}, offset int64) error {
+	if offset == 0 {
+		return f.Truncate(0)
+	}
+	_, err := f.Seek(offset, io.SeekStart)
+	return err
+}
+
+// executeTransfer 按传输任务类型执行传输
+func (sft *SftpService) executeTransfer(spec transferSpec, tracker *transferTracker) error {
+	switch {
+	case spec.transferType == TransferTypeSync:
+		return sft.syncDirectories(spec, tracker)
+	case spec.transferType == TransferTypeRemote:
+		return sft.remoteCopy(spec, tracker)
+	case spec.transferType == TransferTypeCompress:
+		return sft.compressRemote(spec, tracker)
+	case spec.transferType == TransferTypeExtract:
+		return sft.extractRemote(spec, tracker)
+	case spec.options.Archive != nil:
+		return sft.downloadDirectoryTar(spec, tracker)
+	case spec.transferType == TransferTypeUpload && spec.isDir:
+		return sft.uploadDirectory(spec.sessionID, spec.localPath, spec.remotePath, tracker)
+	case spec.transferType == TransferTypeUpload:
+		return sft.uploadFile(spec.sessionID, spec.localPath, spec.remotePath, tracker)
+	case spec.isDir:
+		return sft.downloadDirectory(spec.sessionID, spec.localPath, spec.remotePath, tracker)
+	default:
+		return sft.downloadFile(spec.sessionID, spec.localPath, spec.remotePath, tracker)
+	}
+}
+
+// transferTotal 计算传输任务的总字节数
+func (sft *SftpService) transferTotal(spec transferSpec) (int64, error) {
+	// 同步任务需要先比较两端目录，总大小在生成同步计划后设置；压缩和解压在执行时统计
+	switch spec.transferType {
+	case TransferTypeSync, TransferTypeCompress, TransferTypeExtract:
+		return 0, nil
+	}
+	if spec.transferType == TransferTypeUpload {
+		if spec.isDir {
+			return sft.calcLocalDirSize(spec.localPath, spec.attrs().Symlinks)
+		}
+		info, err := os.Stat(spec.localPath)
+		if err != nil {
+			return 0, err
+		}
+		return info.Size(), nil
+	}
+	if spec.transferType == TransferTypeRemote && spec.isDir {
+		ftpClient, err := sft.getSftpClient(spec.sessionID)
+		if err != nil {
+			return 0, err
+		}
+		return remoteCopySize(ftpClient, spec.remotePath)
+	}
+	if client, ok := scpClient(spec.sessionID); ok {
+		return scpRemoteSize(client, spec.remotePath, spec.isDir)
+	}
+	if spec.isDir {
+		return sft.calcRemoteDirSize(spec.sessionID, spec.remotePath, spec.attrs().Symlinks)
+	}
+	ftpClient, err := sft.getSftpClient(spec.sessionID)
+	if err != nil {
+		return 0, err
+	}
+	info, err := ftpClient.Stat(spec.remotePath)
+	if err != nil {
+		return 0, err
+	}
+	return info.Size(), nil
+}
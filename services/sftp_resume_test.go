@@ -0,0 +1,40 @@
+package services
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestResumeOffset(t *testing.T) {
+	src := bytes.Repeat([]byte("0123456789"), resumeVerifySize/5)
+	corrupt := bytes.Clone(src[:resumeVerifySize+100])
+	corrupt[len(corrupt)-1] ^= 0xff
+	corruptHead := bytes.Clone(src[:resumeVerifySize+100])
+	corruptHead[0] ^= 0xff
+
+	tests := []struct {
+		name   string
+		dst    []byte
+		verify bool
+		want   int64
+	}{
+		{"empty target", nil, true, 0},
+		{"partial target", src[:1000], true, 1000},
+		{"complete target", src, true, int64(len(src))},
+		{"larger target", append(bytes.Clone(src), 'x'), true, 0},
+		{"tail mismatch", corrupt, true, 0},
+		{"tail mismatch without verify", corrupt, false, int64(len(corrupt))},
+		// 只比较末尾 resumeVerifySize 字节，之前的差异无法发现
+		{"head mismatch outside verify window", corruptHead, true, int64(len(corruptHead))},
+	}
+	for _, tt := range tests {
+		got, err := resumeOffset(bytes.NewReader(src), int64(len(src)), bytes.NewReader(tt.dst), int64(len(tt.dst)), tt.verify)
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("%s: got %d, want %d", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,746 @@
+package services
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+	"golang.org/x/crypto/ssh"
+)
+
+// SCP 回退：服务器没有 SFTP 子系统时，通过 exec 通道运行 scp -t/-f 上传和下载文件，
+// 解析 ls 输出列出目录。该模式不支持续传，符号链接由服务器端的 scp 跟随，其他文件管理功能不可用
+
+const scpListTimeout = 2 * time.Minute
+
+// lsCommand 以固定的语言和时区执行 ls，输出的时间为 UTC，与服务器的时区无关
+const lsCommand = "LC_ALL=C TZ=UTC ls "
+
+var errSftpUnavailable = errors.New("服务器未启用 SFTP，当前仅支持浏览目录、上传和下载")
+
+// scpClient 返回 SCP 回退模式的会话所在的 SSH 连接
+func scpClient(sessionID string) (*ssh.Client, bool) {
+	connVal, ok := sftpClient.Load(sessionID)
+	if !ok {
+		return nil, false
+	}
+	sft := connVal.(*SftpService)
+	return sft.sshClient, sft.scpOnly && sft.sshClient != nil
+}
+
+// connectSCP SFTP 子系统不可用时检查服务器是否有 scp，有则以 SCP 回退模式提供服务
+func (sft *SftpService) connectSCP(sshClient *ssh.Client) error {
+	ctx, cancel := context.WithTimeout(context.Background(), sudoDetectTimeout)
+	defer cancel()
+	if _, err := runRemoteOutput(ctx, sshClient, "command -v scp"); err != nil {
+		return fmt.Errorf("服务器既没有 SFTP 子系统也没有 scp: %w", err)
+	}
+	sft.sshClient = sshClient
+	sft.scpOnly = true
+	return nil
+}
+
+// lsFileInfo 从 ls -l 输出解析的文件信息
+type lsFileInfo struct {
+	name    string
+	size    int64
+	mode    os.FileMode
+	modTime time.Time
+	owner   string
+	group   string
+	link    string // 符号链接的目标
+	nlink   int    // 硬链接数
+}
+
+func (fi *lsFileInfo) Name() string       { return fi.name }
+func (fi *lsFileInfo) Size() int64        { return fi.size }
+func (fi *lsFileInfo) Mode() os.FileMode  { return fi.mode }
+func (fi *lsFileInfo) ModTime() time.Time { return fi.modTime }
+func (fi *lsFileInfo) IsDir() bool        { return fi.mode.IsDir() }
+func (fi *lsFileInfo) Sys() any           { return nil }
+
+var lsMonths = map[string]time.Month{
+	"Jan": time.January, "Feb": time.February, "Mar": time.March, "Apr": time.April,
+	"May": time.May, "Jun": time.June, "Jul": time.July, "Aug": time.August,
+	"Sep": time.September, "Oct": time.October, "Nov": time.November, "Dec": time.December,
+}
+
+// parseLsMode 解析 drwxr-xr-x 形式的类型和权限
+func parseLsMode(perms string) (os.FileMode, bool) {
+	if len(perms) < 10 {
+		return 0, false
+	}
+	var mode os.FileMode
+	switch perms[0] {
+	case '-':
+	case 'd':
+		mode = os.ModeDir
+	case 'l':
+		mode = os.ModeSymlink
+	case 'c':
+		mode = os.ModeDevice | os.ModeCharDevice
+	case 'b':
+		mode = os.ModeDevice
+	case 'p':
+		mode = os.ModeNamedPipe
+	case 's':
+		mode = os.ModeSocket
+	default:
+		return 0, false
+	}
+	for i, c := range perms[1:10] {
+		bit := os.FileMode(1) << (8 - i)
+		switch c {
+		case '-':
+		case 's', 't':
+			mode |= bit
+			fallthrough
+		case 'S', 'T':
+			switch i {
+			case 2:
+				mode |= os.ModeSetuid
+			case 5:
+				mode |= os.ModeSetgid
+			case 8:
+				mode |= os.ModeSticky
+			default:
+				return 0, false
+			}
+		default:
+			mode |= bit
+		}
+	}
+	return mode, true
+}
+
+// parseLsLine 解析 lsCommand -l 的一行：权限 链接数 所有者 组 大小 月 日 时间或年份 名称，
+// 设备文件的大小位置为 "主设备号, 次设备号"。时间按 UTC 解析；名称是时间之后隔一个空格的全部内容，
+// 可以以空格开头；符号链接的大小是目标路径的长度，据此拆分名称和目标，名称中的 " -> " 不影响结果
+func parseLsLine(line string, now time.Time) (*lsFileInfo, bool) {
+	line = strings.TrimRight(line, "\r")
+	var fields []string
+	var starts []int
+	for i := 0; i < len(line) && len(fields) < 10; {
+		for i < len(line) && line[i] == ' ' {
+			i++
+		}
+		if i >= len(line) {
+			break
+		}
+		start := i
+		for i < len(line) && line[i] != ' ' {
+			i++
+		}
+		fields = append(fields, line[start:i])
+		starts = append(starts, start)
+	}
+	if len(fields) < 9 {
+		return nil, false
+	}
+	mode, ok := parseLsMode(fields[0])
+	if !ok {
+		return nil, false
+	}
+	fi := &lsFileInfo{mode: mode, owner: fields[2], group: fields[3]}
+	fi.nlink, _ = strconv.Atoi(fields[1])
+	i := 4
+	if strings.HasSuffix(fields[4], ",") {
+		i = 5
+	} else if size, err := strconv.ParseInt(fields[4], 10, 64); err == nil {
+		fi.size = size
+	} else {
+		return nil, false
+	}
+	if len(fields) < i+5 {
+		return nil, false
+	}
+	now = now.UTC()
+	month, ok := lsMonths[fields[i+1]]
+	day, err := strconv.Atoi(fields[i+2])
+	if !ok || err != nil {
+		return nil, false
+	}
+	if hh, mm, found := strings.Cut(fields[i+3], ":"); found {
+		hour, _ := strconv.Atoi(hh)
+		minute, _ := strconv.Atoi(mm)
+		fi.modTime = time.Date(now.Year(), month, day, hour, minute, 0, 0, time.UTC)
+		// 只显示时间的是最近半年内的文件，日期在未来说明是去年
+		if fi.modTime.After(now.Add(24 * time.Hour)) {
+			fi.modTime = fi.modTime.AddDate(-1, 0, 0)
+		}
+	} else {
+		year, err := strconv.Atoi(fields[i+3])
+		if err != nil {
+			return nil, false
+		}
+		fi.modTime = time.Date(year, month, day, 0, 0, 0, 0, time.UTC)
+	}
+	fi.name = line[starts[i+3]+len(fields[i+3])+1:]
+	if mode&os.ModeSymlink != 0 {
+		n := int(fi.size)
+		if sep := len(fi.name) - n - len(" -> "); n > 0 && sep > 0 && fi.name[sep:sep+len(" -> ")] == " -> " {
+			fi.name, fi.link = fi.name[:sep], fi.name[sep+len(" -> "):]
+		} else {
+			fi.name, fi.link, _ = strings.Cut(fi.name, " -> ")
+		}
+	}
+	return fi, true
+}
+
+// lsNotExist 判断 ls 的错误输出是否表示路径不存在
+func lsNotExist(p string, err error) error {
+	if strings.Contains(err.Error(), "No such file") {
+		return &os.PathError{Op: "stat", Path: p, Err: os.ErrNotExist}
+	}
+	return err
+}
+
+// lsDir 解析 ls -la 的输出，follow 为 true 时使用 -L 显示符号链接指向的文件
+func lsDir(client *ssh.Client, dir string, follow bool) ([]*lsFileInfo, error) {
+	flags := "-la"
+	if follow {
+		flags = "-laL"
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), scpListTimeout)
+	defer cancel()
+	out, err := runRemoteOutput(ctx, client, lsCommand+flags+" -- "+shellQuote(dir))
+	if err != nil && len(out) == 0 {
+		return nil, lsNotExist(dir, err)
+	}
+	now := time.Now()
+	var infos []*lsFileInfo
+	for _, line := range strings.Split(string(out), "\n") {
+		fi, ok := parseLsLine(line, now)
+		if !ok || fi.name == "." || fi.name == ".." {
+			continue
+		}
+		infos = append(infos, fi)
+	}
+	return infos, nil
+}
+
+// scpStat 通过 ls -ldL 获取远程文件信息，跟随符号链接
+func scpStat(client *ssh.Client) func(string) (os.FileInfo, error) {
+	return func(p string) (os.FileInfo, error) {
+		ctx, cancel := context.WithTimeout(context.Background(), scpListTimeout)
+		defer cancel()
+		out, err := runRemoteOutput(ctx, client, lsCommand+"-ldL -- "+shellQuote(p))
+		if err != nil {
+			return nil, lsNotExist(p, err)
+		}
+		fi, ok := parseLsLine(strings.TrimSpace(string(out)), time.Now())
+		if !ok {
+			return nil, fmt.Errorf("无法解析 ls 输出: %s", strings.TrimSpace(string(out)))
+		}
+		fi.name = path.Base(p)
+		return fi, nil
+	}
+}
+
+// scpListFiles 通过 ls 列出目录，指向目录的符号链接通过 ls -L 判断
+func scpListFiles(client *ssh.Client, dir string, showHidden bool) ([]FileInfo, error) {
+	entries, err := lsDir(client, dir, false)
+	if err != nil {
+		return nil, err
+	}
+	var linkDirs map[string]bool
+	result := make([]FileInfo, 0, len(entries))
+	for _, entry := range entries {
+		if !showHidden && strings.HasPrefix(entry.name, ".") {
+			continue
+		}
+		info := convertFileInfo(entry)
+		info.Owner = entry.owner
+		info.Group = entry.group
+		if info.IsLink {
+			if linkDirs == nil {
+				linkDirs = make(map[string]bool)
+				if followed, err := lsDir(client, dir, true); err == nil {
+					for _, f := range followed {
+						linkDirs[f.name] = f.IsDir()
+					}
+				}
+			}
+			info.LinkTarget = entry.link
+			isDir, found := linkDirs[entry.name]
+			info.LinkBroken = !found
+			info.LinkIsDir = isDir
+			info.IsDir = isDir
+		}
+		result = append(result, info)
+	}
+	return result, nil
+}
+
+// scpRemoteSize 统计远程文件或目录中文件的总大小
+func scpRemoteSize(client *ssh.Client, remotePath string, isDir bool) (int64, error) {
+	if !isDir {
+		info, err := scpStat(client)(remotePath)
+		if err != nil {
+			return 0, err
+		}
+		return info.Size(), nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), scpListTimeout)
+	defer cancel()
+	out, err := runRemoteOutput(ctx, client, lsCommand+"-laR -- "+shellQuote(remotePath))
+	if err != nil && len(out) == 0 {
+		return 0, lsNotExist(remotePath, err)
+	}
+	var size int64
+	now := time.Now()
+	for _, line := range strings.Split(string(out), "\n") {
+		if fi, ok := parseLsLine(line, now); ok && fi.mode.IsRegular() {
+			size += fi.size
+		}
+	}
+	return size, nil
+}
+
+// scpConn 一个 scp -t/-f 进程，stdin/stdout 上运行 SCP 协议
+type scpConn struct {
+	session *ssh.Session
+	in      io.WriteCloser
+	out     *bufio.Reader
+	stderr  *limitedBuffer
+	stop    func() bool
+}
+
+// startSCP 启动远程 scp，tracker 取消时关闭通道
+func startSCP(tracker *transferTracker, client *ssh.Client, command string) (*scpConn, error) {
+	session, err := client.NewSession()
+	if err != nil {
+		return nil, err
+	}
+	in, err := session.StdinPipe()
+	if err != nil {
+		session.Close()
+		return nil, err
+	}
+	out, err := session.StdoutPipe()
+	if err != nil {
+		session.Close()
+		return nil, err
+	}
+	sc := &scpConn{session: session, in: in, out: bufio.NewReader(out), stderr: &limitedBuffer{buf: new(bytes.Buffer), limit: 4096}}
+	session.Stderr = sc.stderr
+	Logger.Debug("start scp", zap.String("command", command))
+	if err := session.Start(command); err != nil {
+		session.Close()
+		return nil, err
+	}
+	sc.stop = context.AfterFunc(tracker.ctx, func() {
+		_ = session.Close()
+	})
+	return sc, nil
+}
+
+// err 补充远程的错误输出，传输取消时返回取消错误
+func (sc *scpConn) err(tracker *transferTracker, err error) error {
+	if tracker.ctx.Err() != nil {
+		return errors.New("user cancelled")
+	}
+	if msg := strings.TrimSpace(sc.stderr.buf.String()); msg != "" && !strings.Contains(err.Error(), msg) {
+		return fmt.Errorf("%w: %s", err, msg)
+	}
+	return err
+}
+
+// readStatus 读取对方的应答：0 成功，1 警告，2 错误，后两者跟随一行错误信息
+func (sc *scpConn) readStatus() error {
+	b, err := sc.out.ReadByte()
+	if err != nil {
+		return err
+	}
+	if b == 0 {
+		return nil
+	}
+	msg, _ := sc.out.ReadString('\n')
+	msg = strings.TrimSpace(msg)
+	if b == 1 || b == 2 {
+		return fmt.Errorf("scp: %s", msg)
+	}
+	return fmt.Errorf("scp: 无效的应答 %q", string(b)+msg)
+}
+
+// send 发送一条控制消息并等待应答
+func (sc *scpConn) send(format string, args ...any) error {
+	if _, err := fmt.Fprintf(sc.in, format, args...); err != nil {
+		return err
+	}
+	return sc.readStatus()
+}
+
+func (sc *scpConn) ack() error {
+	_, err := sc.in.Write([]byte{0})
+	return err
+}
+
+// close 结束协议并等待远程进程退出
+func (sc *scpConn) close() error {
+	_ = sc.in.Close()
+	err := sc.session.Wait()
+	sc.stop()
+	_ = sc.session.Close()
+	return err
+}
+
+// scpFileMode SCP 消息中的权限位，保留权限未开启或从 Windows 上传时使用 0644/0755
+func scpFileMode(info os.FileInfo, attrs TransferAttrOptions) os.FileMode {
+	if attrs.PreserveMode && runtime.GOOS != "windows" {
+		return info.Mode() & preserveModeBits
+	}
+	if info.IsDir() {
+		return 0755
+	}
+	return 0644
+}
+
+// scpModeString SCP 消息中的四位八进制权限
+func scpModeString(mode os.FileMode) string {
+	perm := uint32(mode.Perm())
+	if mode&os.ModeSetuid != 0 {
+		perm |= 04000
+	}
+	if mode&os.ModeSetgid != 0 {
+		perm |= 02000
+	}
+	if mode&os.ModeSticky != 0 {
+		perm |= 01000
+	}
+	return fmt.Sprintf("%04o", perm)
+}
+
+// scpFlags 远程 scp 的参数。上传时 -p 使远程按消息中的权限设置已存在的文件，只在保留权限时使用，
+// 修改时间由 T 消息设置，不需要 -p；下载时 -p 使远程发送 T 消息，保留权限或修改时间时使用
+func scpFlags(mode string, recursive bool, attrs TransferAttrOptions) string {
+	flags := "-" + mode
+	if recursive {
+		flags += "r"
+	}
+	if attrs.PreserveMode || (mode == "f" && attrs.PreserveMtime) {
+		flags += "p"
+	}
+	return flags
+}
+
+// sendFile 发送一个文件：可选的 T 消息、C 消息、文件内容和结束标记
+func (sc *scpConn) sendFile(localPath, name string, tracker *transferTracker, attrs TransferAttrOptions) (hash.Hash, error) {
+	f, err := os.Open(localPath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	if attrs.PreserveMtime {
+		if err := sc.send("T%d 0 %d 0\n", info.ModTime().Unix(), info.ModTime().Unix()); err != nil {
+			return nil, err
+		}
+	}
+	if err := sc.send("C%s %d %s\n", scpModeString(scpFileMode(info, attrs)), info.Size(), name); err != nil {
+		return nil, err
+	}
+	verifyHash, err := tracker.newVerifyHash(f, 0)
+	if err != nil {
+		return nil, err
+	}
+	reader := &progressReader{reader: f, tracker: tracker, hash: verifyHash}
+	if _, err := io.CopyN(sc.in, reader, info.Size()); err != nil {
+		return nil, err
+	}
+	if err := sc.ack(); err != nil {
+		return nil, err
+	}
+	return verifyHash, sc.readStatus()
+}
+
+// scpUploadFile 通过 scp -t 上传单个文件，规则同 uploadFile（不支持续传）
+func (sft *SftpService) scpUploadFile(client *ssh.Client, sessionID, localPathFile, remoteDir string, tracker *transferTracker) error {
+	localInfo, err := os.Stat(localPathFile)
+	if err != nil {
+		return err
+	}
+	if _, err := runRemoteOutput(tracker.ctx, client, "mkdir -p -- "+shellQuote(remoteDir)); err != nil {
+		return err
+	}
+	remoteFilePath := joinRemotePath(remoteDir, filepath.Base(localPathFile))
+	conflict, err := tracker.checkConflict(localPathFile, localInfo, remoteFilePath, remoteConflictTarget(scpStat(client)))
+	if err != nil || conflict.skip {
+		return err
+	}
+	remoteFilePath = conflict.target
+
+	attrs := tracker.spec.attrs()
+	sc, err := startSCP(tracker, client, "scp "+scpFlags("t", false, attrs)+" -- "+shellQuote(remoteFilePath))
+	if err != nil {
+		return err
+	}
+	if err := sc.readStatus(); err != nil {
+		sc.close()
+		return sc.err(tracker, err)
+	}
+	verifyHash, err := sc.sendFile(localPathFile, path.Base(remoteFilePath), tracker, attrs)
+	if closeErr := sc.close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return sc.err(tracker, err)
+	}
+	return sft.verifyRemoteFile(sessionID, nil, remoteFilePath, verifyHash, tracker)
+}
+
+// scpUploadDirectory 通过 scp -rt 上传目录，目录和文件依次以 D/C/E 消息发送
+func (sft *SftpService) scpUploadDirectory(client *ssh.Client, sessionID, localPath, remotePath string, tracker *transferTracker) error {
+	if _, err := runRemoteOutput(tracker.ctx, client, "mkdir -p -- "+shellQuote(remotePath)); err != nil {
+		return err
+	}
+	attrs := tracker.spec.attrs()
+	symlinks := attrs.Symlinks
+	if symlinks != SymlinkFollow {
+		// SCP 协议不能传输符号链接本身，除非选择跟随，否则跳过链接，不传输目录之外的内容
+		symlinks = SymlinkSkip
+	}
+	sc, err := startSCP(tracker, client, "scp "+scpFlags("t", true, attrs)+" -- "+shellQuote(remotePath))
+	if err != nil {
+		return err
+	}
+	if err := sc.readStatus(); err != nil {
+		sc.close()
+		return sc.err(tracker, err)
+	}
+
+	remoteRoot := joinRemotePath(remotePath, filepath.Base(localPath))
+	type sentFile struct {
+		path string
+		hash hash.Hash
+	}
+	var sent []sentFile
+	err = walkTree(localTreeFS, localPath, symlinks, treeVisitor{
+		dir: func(_, rel string, info os.FileInfo) error {
+			if attrs.PreserveMtime {
+				if err := sc.send("T%d 0 %d 0\n", info.ModTime().Unix(), info.ModTime().Unix()); err != nil {
+					return err
+				}
+			}
+			return sc.send("D%s 0 %s\n", scpModeString(scpFileMode(info, attrs)), path.Base(joinRemotePath(remoteRoot, rel)))
+		},
+		dirDone: func(_, _ string, _ os.FileInfo) error {
+			return sc.send("E\n")
+		},
+		file: func(src, rel string, info os.FileInfo) error {
+			target := joinRemotePath(remoteRoot, rel)
+			conflict, err := tracker.checkConflict(src, info, target, remoteConflictTarget(scpStat(client)))
+			if err != nil || conflict.skip {
+				return err
+			}
+			verifyHash, err := sc.sendFile(src, path.Base(conflict.target), tracker, attrs)
+			if err == nil && verifyHash != nil {
+				sent = append(sent, sentFile{path: conflict.target, hash: verifyHash})
+			}
+			return err
+		},
+	})
+	if closeErr := sc.close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return sc.err(tracker, err)
+	}
+	for _, f := range sent {
+		if err := sft.verifyRemoteFile(sessionID, nil, f.path, f.hash, tracker); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// scpDownload 通过 scp -f 下载文件或目录。下载文件时 localPath 为目标文件，下载目录时为保存目录
+func (sft *SftpService) scpDownload(client *ssh.Client, sessionID, localPath, remotePath string, isDir bool, tracker *transferTracker) error {
+	attrs := tracker.spec.attrs()
+	sc, err := startSCP(tracker, client, "scp "+scpFlags("f", isDir, attrs)+" -- "+shellQuote(remotePath))
+	if err != nil {
+		return err
+	}
+	err = sft.scpSink(sc, sessionID, localPath, remotePath, isDir, tracker, attrs)
+	if closeErr := sc.close(); err == nil && closeErr != nil {
+		err = closeErr
+	}
+	if err != nil {
+		return sc.err(tracker, err)
+	}
+	return nil
+}
+
+// scpDirEntry 接收中的目录
+type scpDirEntry struct {
+	local  string
+	remote string
+	info   os.FileInfo
+}
+
+// scpSink 按 SCP 协议接收文件，处理 T（时间）、C（文件）、D（进入目录）、E（离开目录）消息
+func (sft *SftpService) scpSink(sc *scpConn, sessionID, localPath, remotePath string, isDir bool, tracker *transferTracker, attrs TransferAttrOptions) error {
+	var dirs []scpDirEntry
+	var mtime time.Time
+	if err := sc.ack(); err != nil {
+		return err
+	}
+	for {
+		b, err := sc.out.ReadByte()
+		if err == io.EOF {
+			if len(dirs) > 0 {
+				return io.ErrUnexpectedEOF
+			}
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		line, err := sc.out.ReadString('\n')
+		if err != nil {
+			return err
+		}
+		line = strings.TrimSuffix(line, "\n")
+		switch b {
+		case 1:
+			Logger.Warn("scp warning", zap.String("message", line))
+			continue
+		case 2:
+			return fmt.Errorf("scp: %s", line)
+		case 'T':
+			fields := strings.Fields(line)
+			if len(fields) != 4 {
+				return fmt.Errorf("scp: 无效的时间消息 %q", line)
+			}
+			sec, err := strconv.ParseInt(fields[0], 10, 64)
+			if err != nil {
+				return fmt.Errorf("scp: 无效的时间消息 %q", line)
+			}
+			mtime = time.Unix(sec, 0)
+		case 'E':
+			if len(dirs) == 0 {
+				return fmt.Errorf("scp: 多余的目录结束消息")
+			}
+			dir := dirs[len(dirs)-1]
+			dirs = dirs[:len(dirs)-1]
+			if err := applyLocalAttrs(dir.local, dir.info, attrs); err != nil {
+				return err
+			}
+		case 'C', 'D':
+			info, err := parseSCPHeader(b, line, mtime)
+			if err != nil {
+				return err
+			}
+			mtime = time.Time{}
+			local, remote := localPath, remotePath
+			if len(dirs) > 0 {
+				parent := dirs[len(dirs)-1]
+				local, remote = filepath.Join(parent.local, info.name), joinRemotePath(parent.remote, info.name)
+			} else if isDir {
+				local = filepath.Join(localPath, info.name)
+			}
+			if b == 'D' {
+				if err := os.MkdirAll(local, 0755); err != nil {
+					return err
+				}
+				dirs = append(dirs, scpDirEntry{local: local, remote: remote, info: info})
+				break
+			}
+			if err := sft.scpReceiveFile(sc, sessionID, local, remote, info, tracker, attrs); err != nil {
+				return err
+			}
+		default:
+			return fmt.Errorf("scp: 无效的消息 %q", string(b)+line)
+		}
+		if err := sc.ack(); err != nil {
+			return err
+		}
+	}
+}
+
+// parseSCPHeader 解析 C/D 消息：权限 大小 名称
+func parseSCPHeader(kind byte, line string, mtime time.Time) (*lsFileInfo, error) {
+	parts := strings.SplitN(line, " ", 3)
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("scp: 无效的消息 %q", string(kind)+line)
+	}
+	perm, err1 := strconv.ParseUint(parts[0], 8, 32)
+	size, err2 := strconv.ParseInt(parts[1], 10, 64)
+	name := parts[2]
+	if err1 != nil || err2 != nil || size < 0 || name == "" || name == "." || name == ".." || strings.ContainsAny(name, `/\`) {
+		return nil, fmt.Errorf("scp: 无效的消息 %q", string(kind)+line)
+	}
+	info := &lsFileInfo{name: name, size: size, mode: toFileMode(uint32(perm)), modTime: mtime}
+	if kind == 'D' {
+		info.mode |= os.ModeDir
+		info.size = 0
+	}
+	return info, nil
+}
+
+// scpReceiveFile 接收 C 消息之后的文件内容，冲突时跳过的文件内容被丢弃
+func (sft *SftpService) scpReceiveFile(sc *scpConn, sessionID, localFile, remoteFile string, info *lsFileInfo, tracker *transferTracker, attrs TransferAttrOptions) error {
+	conflict, err := tracker.checkConflict(remoteFile, info, localFile, localConflictTarget)
+	if err != nil {
+		return err
+	}
+	if err := sc.ack(); err != nil {
+		return err
+	}
+	var dst io.Writer = io.Discard
+	var f *os.File
+	if !conflict.skip {
+		if f, err = os.Create(conflict.target); err != nil {
+			return err
+		}
+		defer f.Close()
+		dst = f
+	}
+	verifyHash, err := tracker.newVerifyHash(nil, 0)
+	if err != nil {
+		return err
+	}
+	if conflict.skip {
+		verifyHash = nil
+		_, err = io.CopyN(dst, sc.out, info.size)
+	} else {
+		_, err = io.CopyN(&progressWriter{writer: dst, tracker: tracker, hash: verifyHash}, sc.out, info.size)
+	}
+	if err != nil {
+		return err
+	}
+	if err := sc.readStatus(); err != nil {
+		return err
+	}
+	if f == nil {
+		return nil
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	if err := applyLocalAttrs(conflict.target, info, attrs); err != nil {
+		return err
+	}
+	return sft.verifyRemoteFile(sessionID, nil, remoteFile, verifyHash, tracker)
+}
+
+// IsScpFallback 返回会话是否处于 SCP 回退模式，前端据此隐藏不可用的文件管理功能
+func (sft *SftpService) IsScpFallback(sessionID string) bool {
+	_, ok := scpClient(sessionID)
+	return ok
+}
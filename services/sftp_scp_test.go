@@ -0,0 +1,84 @@
+package services
+
+import (
+	"os"
+	"testing"
+	"time"
+)
+
+func TestParseLsLine(t *testing.T) {
+	now := time.Date(2024, time.March, 10, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		line    string
+		name    string
+		link    string
+		mode    os.FileMode
+		size    int64
+		modTime time.Time
+	}{
+		{"-rw-r--r-- 1 root root 1234 Mar  9 08:05 file.txt", "file.txt", "", 0644, 1234, time.Date(2024, time.March, 9, 8, 5, 0, 0, time.UTC)},
+		{"drwxr-xr-x 2 root root 4096 Dec 31  2022 my dir", "my dir", "", os.ModeDir | 0755, 4096, time.Date(2022, time.December, 31, 0, 0, 0, 0, time.UTC)},
+		{"-rw-r--r-- 1 root root 0 Dec 31 23:59 last year", "last year", "", 0644, 0, time.Date(2023, time.December, 31, 23, 59, 0, 0, time.UTC)},
+		{"-rw-r--r-- 1 root root 0 Mar  9 08:05   leading", "  leading", "", 0644, 0, time.Date(2024, time.March, 9, 8, 5, 0, 0, time.UTC)},
+		{"lrwxrwxrwx 1 root root 11 Mar  9 08:05 link -> /etc/passwd", "link", "/etc/passwd", os.ModeSymlink | 0777, 11, time.Date(2024, time.March, 9, 8, 5, 0, 0, time.UTC)},
+		{"lrwxrwxrwx 1 root root 6 Mar  9 08:05 a -> b -> target", "a -> b", "target", os.ModeSymlink | 0777, 6, time.Date(2024, time.March, 9, 8, 5, 0, 0, time.UTC)},
+		{"crw-rw-rw- 1 root root 1, 3 Mar  9 08:05 null", "null", "", os.ModeDevice | os.ModeCharDevice | 0666, 0, time.Date(2024, time.March, 9, 8, 5, 0, 0, time.UTC)},
+		{"drwxrwxrwt 9 root root 4096 Mar  9 08:05 tmp", "tmp", "", os.ModeDir | os.ModeSticky | 0777, 4096, time.Date(2024, time.March, 9, 8, 5, 0, 0, time.UTC)},
+	}
+	for _, tt := range tests {
+		fi, ok := parseLsLine(tt.line, now)
+		if !ok {
+			t.Errorf("parseLsLine(%q): not parsed", tt.line)
+			continue
+		}
+		if fi.name != tt.name || fi.link != tt.link || fi.mode != tt.mode || fi.size != tt.size || !fi.modTime.Equal(tt.modTime) {
+			t.Errorf("parseLsLine(%q): got name %q link %q mode %v size %d time %v", tt.line, fi.name, fi.link, fi.mode, fi.size, fi.modTime)
+		}
+	}
+	if fi, ok := parseLsLine("-rw-r--r-- 3 root root 1234 Mar  9 08:05 linked", now); !ok || fi.nlink != 3 {
+		t.Errorf("nlink: got %+v", fi)
+	}
+
+	for _, line := range []string{"", "total 12", "?rw-r--r-- 1 root root 0 Mar  9 08:05 x", "-rw-r--r-- 1 root root big Mar  9 08:05 x"} {
+		if _, ok := parseLsLine(line, now); ok {
+			t.Errorf("parseLsLine(%q): expected not parsed", line)
+		}
+	}
+}
+
+func TestParseSCPHeader(t *testing.T) {
+	mtime := time.Unix(1700000000, 0)
+	info, err := parseSCPHeader('C', "0640 12 name with spaces", mtime)
+	if err != nil || info.name != "name with spaces" || info.size != 12 || info.mode != 0640 || !info.modTime.Equal(mtime) {
+		t.Errorf("file header: got %+v, %v", info, err)
+	}
+	info, err = parseSCPHeader('D', "0755 0 dir", time.Time{})
+	if err != nil || !info.IsDir() || info.mode.Perm() != 0755 {
+		t.Errorf("dir header: got %+v, %v", info, err)
+	}
+	for _, line := range []string{"0644 12", "0644 -1 x", "0999 1 x", "0644 1 ..", "0644 1 a/b", `0644 1 a\b`, "0644 1 "} {
+		if _, err := parseSCPHeader('C', line, time.Time{}); err == nil {
+			t.Errorf("parseSCPHeader(%q): expected error", line)
+		}
+	}
+}
+
+func TestSCPFlags(t *testing.T) {
+	tests := []struct {
+		mode      string
+		recursive bool
+		attrs     TransferAttrOptions
+		want      string
+	}{
+		{"t", false, TransferAttrOptions{}, "-t"},
+		{"t", true, TransferAttrOptions{PreserveMtime: true}, "-tr"},
+		{"t", false, TransferAttrOptions{PreserveMode: true}, "-tp"},
+		{"f", false, TransferAttrOptions{PreserveMtime: true}, "-fp"},
+		{"f", true, TransferAttrOptions{}, "-fr"},
+	}
+	for _, tt := range tests {
+		if got := scpFlags(tt.mode, tt.recursive, tt.attrs); got != tt.want {
+			t.Errorf("scpFlags(%q, %v, %+v): got %q, want %q", tt.mode, tt.recursive, tt.attrs, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,468 @@
+package services
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ilaziness/vexo/internal/system"
+	"github.com/ilaziness/vexo/internal/utils"
+	"github.com/pkg/sftp"
+	"github.com/wailsapp/wails/v3/pkg/application"
+	"go.uber.org/zap"
+)
+
+// 远程文件搜索：优先通过 exec 通道执行远程 find，不可用时回退到 SFTP 遍历，匹配结果分批通过事件推送
+
+const (
+	EventSftpSearch = "eventSftpSearch"
+
+	SearchMethodFind = "find"
+	SearchMethodSftp = "sftp"
+
+	defaultSearchMaxResults = 10000
+	searchFlushInterval     = 200 * time.Millisecond
+	searchFlushSize         = 100
+
+	// findEndMarker 远程 find 结束标记，后接 find 的退出码
+	findEndMarker = "vexo-find-end:"
+)
+
+func init() {
+	application.RegisterEvent[SftpSearchEvent](EventSftpSearch)
+}
+
+var remoteSearches = new(sync.Map) // map[searchID]*remoteSearch
+
+// SftpSearchOptions 远程搜索条件，数值条件为 0 表示不限制
+type SftpSearchOptions struct {
+	Root           string `json:"root"`
+	Pattern        string `json:"pattern"`        // 文件名匹配，为空匹配所有
+	Regex          bool   `json:"regex"`          // Pattern 为正则表达式，否则为通配符（*.log）
+	IgnoreCase     bool   `json:"ignoreCase"`     // 忽略大小写
+	Type           string `json:"type"`           // file/dir，为空不限
+	MinSize        int64  `json:"minSize"`        // 最小字节数
+	MaxSize        int64  `json:"maxSize"`        // 最大字节数
+	ModifiedAfter  int64  `json:"modifiedAfter"`  // 修改时间不早于，unix 秒
+	ModifiedBefore int64  `json:"modifiedBefore"` // 修改时间不晚于，unix 秒
+	MaxDepth       int    `json:"maxDepth"`       // 最大深度，1 表示只搜索 Root 下的直接子项
+	MaxResults     int    `json:"maxResults"`     // 最多返回的结果数，默认 10000
+}
+
+// SftpSearchMatch 一个匹配结果
+type SftpSearchMatch struct {
+	Path string   `json:"path"`
+	Info FileInfo `json:"info"`
+}
+
+// SftpSearchEvent 搜索进度事件，Done 为 true 时搜索结束
+type SftpSearchEvent struct {
+	SearchID  string            `json:"searchID"`
+	SessionID string            `json:"sessionID"`
+	Method    string            `json:"method"` // find 或 sftp
+	Matches   []SftpSearchMatch `json:"matches"`
+	Count     int               `json:"count"` // 已匹配总数
+	Truncated bool              `json:"truncated"`
+	Done      bool              `json:"done"`
+	Cancelled bool              `json:"cancelled"`
+	Error     string            `json:"error"`
+}
+
+// searchMatcher 编译后的搜索条件
+type searchMatcher struct {
+	opts    SftpSearchOptions
+	pattern *regexp.Regexp
+	glob    string
+}
+
+func newSearchMatcher(opts SftpSearchOptions) (*searchMatcher, error) {
+	m := &searchMatcher{opts: opts}
+	switch opts.Type {
+	case "", "file", "dir":
+	default:
+		return nil, fmt.Errorf("无效的文件类型: %s", opts.Type)
+	}
+	if opts.Pattern == "" {
+		return m, nil
+	}
+	if opts.Regex {
+		expr := opts.Pattern
+		if opts.IgnoreCase {
+			expr = "(?i)" + expr
+		}
+		re, err := regexp.Compile(expr)
+		if err != nil {
+			return nil, fmt.Errorf("无效的正则表达式: %w", err)
+		}
+		m.pattern = re
+		return m, nil
+	}
+	m.glob = opts.Pattern
+	if opts.IgnoreCase {
+		m.glob = strings.ToLower(m.glob)
+	}
+	if _, err := path.Match(m.glob, ""); err != nil {
+		return nil, fmt.Errorf("无效的通配符: %s", opts.Pattern)
+	}
+	return m, nil
+}
+
+func (m *searchMatcher) match(info FileInfo) bool {
+	opts := m.opts
+	switch opts.Type {
+	case "file":
+		if info.IsDir {
+			return false
+		}
+	case "dir":
+		if !info.IsDir {
+			return false
+		}
+	}
+	if m.pattern != nil && !m.pattern.MatchString(info.Name) {
+		return false
+	}
+	if m.glob != "" {
+		name := info.Name
+		if opts.IgnoreCase {
+			name = strings.ToLower(name)
+		}
+		if ok, _ := path.Match(m.glob, name); !ok {
+			return false
+		}
+	}
+	if !info.IsDir {
+		if opts.MinSize > 0 && info.Size < opts.MinSize {
+			return false
+		}
+		if opts.MaxSize > 0 && info.Size > opts.MaxSize {
+			return false
+		}
+	}
+	if opts.ModifiedAfter > 0 || opts.ModifiedBefore > 0 {
+		modTime, err := time.Parse(time.RFC3339, info.ModTime)
+		if err != nil {
+			return false
+		}
+		if opts.ModifiedAfter > 0 && modTime.Unix() < opts.ModifiedAfter {
+			return false
+		}
+		if opts.ModifiedBefore > 0 && modTime.Unix() > opts.ModifiedBefore {
+			return false
+		}
+	}
+	return true
+}
+
+// remoteSearch 一次搜索的状态
+type remoteSearch struct {
+	id         string
+	sessionID  string
+	method     string
+	matcher    *searchMatcher
+	names      *remoteIDNames
+	maxResults int
+	batch      []SftpSearchMatch
+	count      int
+	truncated  bool
+	lastFlush  time.Time
+	cancel     context.CancelFunc
+}
+
+// add 记录匹配结果，达到数量上限时返回 false
+func (s *remoteSearch) add(fullPath string, info FileInfo) bool {
+	if !s.matcher.match(info) {
+		return true
+	}
+	if s.count >= s.maxResults {
+		s.truncated = true
+		return false
+	}
+	info.Owner = s.names.users[info.UID]
+	info.Group = s.names.groups[info.GID]
+	s.batch = append(s.batch, SftpSearchMatch{Path: fullPath, Info: info})
+	s.count++
+	if len(s.batch) >= searchFlushSize || time.Since(s.lastFlush) >= searchFlushInterval {
+		s.flush()
+	}
+	return true
+}
+
+func (s *remoteSearch) flush() {
+	s.lastFlush = time.Now()
+	if len(s.batch) == 0 {
+		return
+	}
+	s.emit(SftpSearchEvent{Matches: s.batch})
+	s.batch = nil
+}
+
+func (s *remoteSearch) emit(event SftpSearchEvent) {
+	event.SearchID = s.id
+	event.SessionID = s.sessionID
+	event.Method = s.method
+	event.Count = s.count
+	event.Truncated = s.truncated
+	if event.Matches == nil {
+		event.Matches = []SftpSearchMatch{}
+	}
+	app.Event.Emit(EventSftpSearch, event)
+}
+
+// buildFindCommand 构造远程 find 命令，文件名通配符和类型交给 find 过滤，
+// 其余条件在本地判断。使用 GNU find 的 -printf 一次输出所需的元数据，以 NUL 分隔。
+// 以 - 开头的相对路径会被 find 当作表达式，加上 ./ 前缀
+func buildFindCommand(opts SftpSearchOptions) string {
+	root := opts.Root
+	if strings.HasPrefix(root, "-") {
+		root = "./" + root
+	}
+	args := []string{"LC_ALL=C", "find", shellQuote(root), "-mindepth", "1"}
+	if opts.MaxDepth > 0 {
+		args = append(args, "-maxdepth", strconv.Itoa(opts.MaxDepth))
+	}
+	switch opts.Type {
+	case "file":
+		args = append(args, "!", "-type", "d")
+	case "dir":
+		args = append(args, "-type", "d")
+	}
+	if opts.Pattern != "" && !opts.Regex {
+		if opts.IgnoreCase {
+			args = append(args, "-iname", shellQuote(opts.Pattern))
+		} else {
+			args = append(args, "-name", shellQuote(opts.Pattern))
+		}
+	}
+	args = append(args, "-printf", shellQuote(`%y\t%s\t%T@\t%m\t%U\t%G\t%p\0`))
+	return strings.Join(args, " ")
+}
+
+// parseFindRecord 解析 -printf 输出的一条记录
+func parseFindRecord(record string) (string, FileInfo, bool) {
+	fields := strings.SplitN(record, "\t", 7)
+	if len(fields) != 7 {
+		return "", FileInfo{}, false
+	}
+	size, err1 := strconv.ParseInt(fields[1], 10, 64)
+	mtime, err2 := strconv.ParseFloat(fields[2], 64)
+	perm, err3 := strconv.ParseUint(fields[3], 8, 32)
+	uid, err4 := strconv.ParseUint(fields[4], 10, 32)
+	gid, err5 := strconv.ParseUint(fields[5], 10, 32)
+	if err1 != nil || err2 != nil || err3 != nil || err4 != nil || err5 != nil {
+		return "", FileInfo{}, false
+	}
+	mode := toFileMode(uint32(perm))
+	switch fields[0] {
+	case "d":
+		mode |= os.ModeDir
+	case "l":
+		mode |= os.ModeSymlink
+	case "p":
+		mode |= os.ModeNamedPipe
+	case "s":
+		mode |= os.ModeSocket
+	case "c":
+		mode |= os.ModeDevice | os.ModeCharDevice
+	case "b":
+		mode |= os.ModeDevice
+	}
+	// 去掉 buildFindCommand 为 - 开头的路径加上的 ./ 前缀
+	fullPath := path.Clean(fields[6])
+	return fullPath, FileInfo{
+		Name:    path.Base(fullPath),
+		Size:    size,
+		Mode:    mode.String(),
+		Perm:    uint32(perm),
+		ModTime: time.Unix(int64(mtime), 0).Format(time.RFC3339),
+		IsDir:   fields[0] == "d",
+		UID:     uint32(uid),
+		GID:     uint32(gid),
+		IsLink:  fields[0] == "l",
+	}, true
+}
+
+// scanNUL 按 NUL 分隔记录
+func scanNUL(data []byte, atEOF bool) (int, []byte, error) {
+	if i := bytes.IndexByte(data, 0); i >= 0 {
+		return i + 1, data[:i], nil
+	}
+	if atEOF && len(data) > 0 {
+		return len(data), data, nil
+	}
+	return 0, nil, nil
+}
+
+// searchWithFind 通过远程 find 搜索，返回是否已经由 find 完成搜索。
+// 命令末尾输出带退出码的结束标记，用于识别只允许 SFTP 的服务器（命令被替换为 sftp-server，没有任何输出）；
+// 没有输出结果就失败时（不允许 exec、find 不支持 -printf 等）由调用方回退到 SFTP 遍历
+func (sft *SftpService) searchWithFind(ctx context.Context, s *remoteSearch, opts SftpSearchOptions) (bool, error) {
+	client, err := sft.getSSHClient(s.sessionID)
+	if err != nil {
+		return false, err
+	}
+	findCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	command := buildFindCommand(opts) + "; printf '" + findEndMarker + "%s\\0' \"$?\""
+	rc, err := startRemoteCommand(findCtx, client, command)
+	if err != nil {
+		return false, err
+	}
+	scanner := bufio.NewScanner(rc.Stdout)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	scanner.Split(scanNUL)
+	parsed := false
+	exitCode := ""
+	for scanner.Scan() {
+		record := scanner.Text()
+		if code, ok := strings.CutPrefix(record, findEndMarker); ok {
+			exitCode = code
+			continue
+		}
+		fullPath, info, ok := parseFindRecord(record)
+		if !ok {
+			continue
+		}
+		parsed = true
+		if !s.add(fullPath, info) {
+			cancel()
+			break
+		}
+	}
+	err = rc.Wait()
+	switch {
+	case ctx.Err() != nil || s.truncated:
+		return true, nil
+	case exitCode == "0":
+		return true, nil
+	case parsed:
+		// find 遇到无权限读取的目录时退出码为 1，已经输出的结果仍然有效
+		Logger.Debug("remote find finished with error", zap.String("searchID", s.id), zap.String("exitCode", exitCode), zap.Error(err))
+		return true, nil
+	case exitCode != "":
+		return false, fmt.Errorf("find exit status %s", exitCode)
+	}
+	return false, err
+}
+
+// searchWithSftp 通过 SFTP 遍历搜索，不跟随符号链接
+func searchWithSftp(ctx context.Context, ftpClient *sftp.Client, s *remoteSearch, opts SftpSearchOptions) error {
+	prefix := strings.TrimSuffix(opts.Root, "/") + "/"
+	walker := ftpClient.Walk(opts.Root)
+	for walker.Step() {
+		if ctx.Err() != nil {
+			return nil
+		}
+		if err := walker.Err(); err != nil {
+			// 跳过无权限读取的目录
+			Logger.Debug("search walk error", zap.String("path", walker.Path()), zap.Error(err))
+			continue
+		}
+		fullPath := walker.Path()
+		if fullPath == opts.Root {
+			continue
+		}
+		stat := walker.Stat()
+		depth := strings.Count(strings.TrimPrefix(fullPath, prefix), "/") + 1
+		if opts.MaxDepth > 0 && depth >= opts.MaxDepth && stat.IsDir() {
+			walker.SkipDir()
+		}
+		if !s.add(fullPath, convertFileInfo(stat)) {
+			return nil
+		}
+	}
+	return nil
+}
+
+// StartSearch 开始搜索远程目录，返回搜索 ID。匹配结果通过 EventSftpSearch 分批推送，
+// 最后一个事件的 Done 为 true。支持 exec 的服务器使用远程 find，否则使用 SFTP 遍历
+func (sft *SftpService) StartSearch(sessionID string, opts SftpSearchOptions) (string, error) {
+	Logger.Debug("StartSearch", zap.String("sessionID", sessionID), zap.Any("opts", opts))
+	ftpClient, err := sft.getSftpClient(sessionID)
+	if err != nil {
+		return "", err
+	}
+	if opts.Root == "" {
+		return "", fmt.Errorf("搜索目录不能为空")
+	}
+	opts.Root = path.Clean(opts.Root)
+	matcher, err := newSearchMatcher(opts)
+	if err != nil {
+		return "", err
+	}
+	if info, err := ftpClient.Stat(opts.Root); err != nil {
+		return "", err
+	} else if !info.IsDir() {
+		return "", fmt.Errorf("%s 不是目录", opts.Root)
+	}
+	maxResults := opts.MaxResults
+	if maxResults <= 0 {
+		maxResults = defaultSearchMaxResults
+	}
+
+	s := &remoteSearch{
+		id:         utils.GenerateRandomID(),
+		sessionID:  sessionID,
+		method:     SearchMethodFind,
+		matcher:    matcher,
+		names:      loadRemoteIDNames(sessionID, ftpClient),
+		maxResults: maxResults,
+		lastFlush:  time.Now(),
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	s.cancel = cancel
+	remoteSearches.Store(s.id, s)
+
+	system.SafeGo(func() {
+		defer func() {
+			remoteSearches.Delete(s.id)
+			cancel()
+		}()
+		started, err := sft.searchWithFind(ctx, s, opts)
+		if !started && ctx.Err() == nil {
+			Logger.Debug("remote find unavailable, fallback to sftp walk", zap.String("searchID", s.id), zap.Error(err))
+			s.method = SearchMethodSftp
+			// find 执行期间会话可能已经重连或关闭，重新获取 SFTP 客户端
+			var ftpClient *sftp.Client
+			if ftpClient, err = sft.getSftpClient(sessionID); err == nil {
+				err = searchWithSftp(ctx, ftpClient, s, opts)
+			}
+		}
+		s.flush()
+		event := SftpSearchEvent{Done: true, Cancelled: ctx.Err() != nil && !s.truncated}
+		if err != nil && s.method == SearchMethodSftp {
+			event.Error = err.Error()
+		}
+		s.emit(event)
+	})
+	return s.id, nil
+}
+
+// CancelSearch 取消正在进行的搜索
+func (sft *SftpService) CancelSearch(searchID string) error {
+	value, ok := remoteSearches.Load(searchID)
+	if !ok {
+		return fmt.Errorf("search with ID %s not found", searchID)
+	}
+	value.(*remoteSearch).cancel()
+	return nil
+}
+
+// cancelSearchesBySession 会话关闭时取消该会话的所有搜索
+func cancelSearchesBySession(sessionID string) {
+	remoteSearches.Range(func(_, value any) bool {
+		s := value.(*remoteSearch)
+		if s.sessionID == sessionID {
+			s.cancel()
+		}
+		return true
+	})
+}
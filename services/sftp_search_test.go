@@ -0,0 +1,67 @@
+package services
+
+import (
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseFindRecord(t *testing.T) {
+	mtime := time.Unix(1700000000, 0).Format(time.RFC3339)
+	tests := []struct {
+		record string
+		ok     bool
+		path   string
+		want   FileInfo
+	}{
+		{"f\t1234\t1700000000.5\t644\t1000\t100\t/home/u/a.log", true, "/home/u/a.log",
+			FileInfo{Name: "a.log", Size: 1234, Mode: os.FileMode(0644).String(), Perm: 0644, ModTime: mtime, UID: 1000, GID: 100}},
+		{"d\t4096\t1700000000\t755\t0\t0\t/home/u/dir", true, "/home/u/dir",
+			FileInfo{Name: "dir", Size: 4096, Mode: (os.ModeDir | 0755).String(), Perm: 0755, ModTime: mtime, IsDir: true}},
+		{"l\t7\t1700000000\t777\t0\t0\t/home/u/link", true, "/home/u/link",
+			FileInfo{Name: "link", Size: 7, Mode: (os.ModeSymlink | 0777).String(), Perm: 0777, ModTime: mtime, IsLink: true}},
+		// 文件名中的制表符保留在路径中
+		{"f\t1\t1700000000\t600\t0\t0\t/tmp/a\tb", true, "/tmp/a\tb",
+			FileInfo{Name: "a\tb", Size: 1, Mode: os.FileMode(0600).String(), Perm: 0600, ModTime: mtime}},
+		{"f\t1\t1700000000\t600\t0\t0\t./-dir/x", true, "-dir/x",
+			FileInfo{Name: "x", Size: 1, Mode: os.FileMode(0600).String(), Perm: 0600, ModTime: mtime}},
+		{"f\tx\t1700000000\t644\t0\t0\t/a", false, "", FileInfo{}},
+		{"f\t1\t1700000000\t999\t0\t0\t/a", false, "", FileInfo{}},
+		{"f\t1\t1700000000", false, "", FileInfo{}},
+		{"", false, "", FileInfo{}},
+	}
+	for _, tt := range tests {
+		p, info, ok := parseFindRecord(tt.record)
+		if ok != tt.ok {
+			t.Errorf("parseFindRecord(%q): ok %v, want %v", tt.record, ok, tt.ok)
+			continue
+		}
+		if !ok {
+			continue
+		}
+		if p != tt.path {
+			t.Errorf("parseFindRecord(%q): path %q, want %q", tt.record, p, tt.path)
+		}
+		if info != tt.want {
+			t.Errorf("parseFindRecord(%q): got %+v, want %+v", tt.record, info, tt.want)
+		}
+	}
+}
+
+func TestBuildFindCommandRoot(t *testing.T) {
+	tests := []struct {
+		root string
+		want string
+	}{
+		{"/var/log", "find '/var/log' -mindepth"},
+		{"-delete", "find './-delete' -mindepth"},
+		{"a b", "find 'a b' -mindepth"},
+	}
+	for _, tt := range tests {
+		cmd := buildFindCommand(SftpSearchOptions{Root: tt.root})
+		if !strings.Contains(cmd, tt.want) {
+			t.Errorf("buildFindCommand(%q): got %q", tt.root, cmd)
+		}
+	}
+}
@@ -7,6 +7,7 @@ import (
 	"os"
 	"path"
 	"path/filepath"
+	"strings"
 	"sync"
 	"time"
 
@@ -23,22 +24,48 @@ var sftpClient = new(sync.Map)
 
 // FileInfo represents file information for SFTP operations
 type FileInfo struct {
-	Name    string `json:"name"`
-	Size    int64  `json:"size"`
-	Mode    string `json:"mode"`
-	ModTime string `json:"modTime"`
-	IsDir   bool   `json:"isDir"`
+	Name       string `json:"name"`
+	Size       int64  `json:"size"`
+	Mode       string `json:"mode"`
+	Perm       uint32 `json:"perm"` // 权限位，包含 setuid/setgid/sticky，例如 0755
+	ModTime    string `json:"modTime"`
+	IsDir      bool   `json:"isDir"` // 指向目录的符号链接也为 true，便于进入目录
+	UID        uint32 `json:"uid"`
+	GID        uint32 `json:"gid"`
+	Owner      string `json:"owner"` // 远程用户名，无法解析时为空
+	Group      string `json:"group"` // 远程组名，无法解析时为空
+	IsLink     bool   `json:"isLink"`
+	LinkTarget string `json:"linkTarget"` // 符号链接的目标路径（未解析的原始值）
+	LinkIsDir  bool   `json:"linkIsDir"`  // 符号链接是否指向目录
+	LinkBroken bool   `json:"linkBroken"` // 符号链接目标不存在
 }
 
 // Convert os.FileInfo to our custom FileInfo
 func convertFileInfo(osInfo os.FileInfo) FileInfo {
-	return FileInfo{
+	info := FileInfo{
 		Name:    osInfo.Name(),
 		Size:    osInfo.Size(),
 		Mode:    osInfo.Mode().String(),
+		Perm:    uint32(osInfo.Mode().Perm()),
 		ModTime: osInfo.ModTime().Format(time.RFC3339),
 		IsDir:   osInfo.IsDir(),
+		IsLink:  osInfo.Mode()&os.ModeSymlink != 0,
 	}
+	mode := osInfo.Mode()
+	if mode&os.ModeSetuid != 0 {
+		info.Perm |= 04000
+	}
+	if mode&os.ModeSetgid != 0 {
+		info.Perm |= 02000
+	}
+	if mode&os.ModeSticky != 0 {
+		info.Perm |= 01000
+	}
+	if stat, ok := osInfo.Sys().(*sftp.FileStat); ok {
+		info.UID = stat.UID
+		info.GID = stat.GID
+	}
+	return info
 }
 
 // Convert []os.FileInfo to []FileInfo
@@ -51,7 +78,11 @@ func convertFileInfos(osInfos []os.FileInfo) []FileInfo {
 }
 
 type SftpService struct {
-	ftpClient *sftp.Client
+	ftpClient   *sftp.Client
+	sshClient   *ssh.Client  // SFTP 所在的 SSH 连接，用于执行远程命令
+	sshConnect  *SSHConnect  // 所属的终端会话，用于记录书签等信息
+	sudoSession *ssh.Session // 通过 sudo 启动的 sftp-server 所在的通道，未使用 sudo 时为 nil
+	scpOnly     bool         // 服务器没有 SFTP 子系统，通过 scp 传输文件，ftpClient 为 nil
 }
 
 func NewSftpService() *SftpService {
@@ -72,31 +103,29 @@ func (sft *SftpService) getSftpClient(sessionID string) (*sftp.Client, error) {
 		return nil, fmt.Errorf("SSH session with ID %s not found", sessionID)
 	}
 	conn := connVal.(*SftpService)
+	if conn.ftpClient == nil {
+		return nil, errSftpUnavailable
+	}
 	return conn.ftpClient, nil
 }
 
 // Connect connects to SFTP using an SSH session ID
 func (sft *SftpService) Connect(sshClient *ssh.Client) error {
-	// Add SFTP client options for better performance over high latency networks
-	// - MaxPacket: Use 32KB packet size (max allowed by protocol)
-	// - UseConcurrentWrites: Enable concurrent writes for upload
-	// - UseConcurrentReads: Enable concurrent reads for download
-	ftpClient, err := sftp.NewClient(
-		sshClient,
-		sftp.MaxPacket(32768),
-		sftp.UseConcurrentWrites(true),
-		sftp.UseConcurrentReads(true),
-	)
+	ftpClient, err := sftp.NewClient(sshClient, sftpClientOptions()...)
 	if err != nil {
 		return err
 	}
 	sft.ftpClient = ftpClient
+	sft.sshClient = sshClient
 	return nil
 }
 
 // ListFiles lists files and directories in the specified path
 func (sft *SftpService) ListFiles(sessionID string, path string, showHidden bool) ([]FileInfo, error) {
 	Logger.Debug("ListFiles", zap.String("sessionID", sessionID), zap.String("path", path), zap.Bool("showHidden", showHidden))
+	if client, ok := scpClient(sessionID); ok {
+		return scpListFiles(client, path, showHidden)
+	}
 	ftpClient, err := sft.getSftpClient(sessionID)
 	if err != nil {
 		return nil, err
@@ -123,7 +152,9 @@ func (sft *SftpService) ListFiles(sessionID string, path string, showHidden bool
 		entries = filteredEntries
 	}
 
-	return convertFileInfos(entries), nil
+	infos := convertFileInfos(entries)
+	sft.resolveFileInfos(sessionID, ftpClient, path, infos)
+	return infos, nil
 }
 
 // GetFileInfo returns information about a file or directory
@@ -134,12 +165,14 @@ func (sft *SftpService) GetFileInfo(sessionID string, path string) (FileInfo, er
 		return FileInfo{}, err
 	}
 
-	info, err := ftpClient.Stat(path)
+	info, err := ftpClient.Lstat(path)
 	if err != nil {
 		return FileInfo{}, err
 	}
 
-	return convertFileInfo(info), nil
+	fileInfo := convertFileInfo(info)
+	sft.resolveFileInfo(sessionID, ftpClient, path, &fileInfo)
+	return fileInfo, nil
 }
 
 // uploadFile uploads a local file to the specified remote path.
@@ -147,6 +180,12 @@ func (sft *SftpService) GetFileInfo(sessionID string, path string) (FileInfo, er
 // remoteDir is remote directory without file name.
 func (sft *SftpService) uploadFile(sessionID string, localPathFile, remoteDir string, tracker *transferTracker) error {
 	Logger.Debug("uploadFile", zap.String("sessionID", sessionID), zap.String("localPathFile", localPathFile), zap.String("remoteDir", remoteDir))
+	if tracker == nil {
+		return fmt.Errorf(ErrTrackerRequired)
+	}
+	if client, ok := scpClient(sessionID); ok {
+		return sft.scpUploadFile(client, sessionID, localPathFile, remoteDir, tracker)
+	}
 	ftpClient, err := sft.getSftpClient(sessionID)
 	if err != nil {
 		return err
@@ -158,6 +197,10 @@ func (sft *SftpService) uploadFile(sessionID string, localPathFile, remoteDir st
 		return err
 	}
 	defer localFile.Close()
+	localInfo, err := localFile.Stat()
+	if err != nil {
+		return err
+	}
 	_, err = ftpClient.Stat(remoteDir)
 	if err != nil && os.IsNotExist(err) {
 		if err = ftpClient.MkdirAll(remoteDir); err != nil {
@@ -165,27 +208,52 @@ func (sft *SftpService) uploadFile(sessionID string, localPathFile, remoteDir st
 		}
 	}
 
-	// Create the remote file for writing
+	// Create the remote file for writing, or reopen the partial file when resuming
 	remoteFilePath := joinRemotePath(remoteDir, filepath.Base(localPathFile))
+	conflict, err := tracker.checkConflict(localPathFile, localInfo, remoteFilePath, remoteConflictTarget(ftpClient.Stat))
+	if err != nil || conflict.skip {
+		return err
+	}
+	remoteFilePath = conflict.target
 	Logger.Debug("uploadFile Create File", zap.String("file", remoteFilePath))
-	remoteFile, err := ftpClient.Create(remoteFilePath)
+	remoteFile, offset, err := openUploadTarget(ftpClient, remoteFilePath, localFile, localInfo.Size(), tracker, conflict.overwrite)
 	if err != nil {
 		return err
 	}
 	defer remoteFile.Close()
 
-	if tracker == nil {
-		return fmt.Errorf(ErrTrackerRequired)
+	verifyHash, err := tracker.newVerifyHash(localFile, offset)
+	if err != nil {
+		return err
+	}
+	if offset > 0 {
+		tracker.skip(offset)
+		if offset == localInfo.Size() {
+			Logger.Debug("uploadFile skip completed file", zap.String("file", remoteFilePath))
+			if err := sft.verifyRemoteFile(sessionID, ftpClient, remoteFilePath, verifyHash, tracker); err != nil {
+				return err
+			}
+			return applyRemoteAttrs(ftpClient, remoteFilePath, localInfo, tracker.spec.attrs())
+		}
+		if _, err := localFile.Seek(offset, io.SeekStart); err != nil {
+			return err
+		}
 	}
 
-	progressReader := &progressReader{reader: localFile, tracker: tracker}
+	progressReader := &progressReader{reader: localFile, tracker: tracker, hash: verifyHash}
 
 	// Copy the local file content to the remote file using io.Copy to leverage sftp.File.ReadFrom concurrent writes
-	_, err = io.Copy(remoteFile, progressReader)
-	return err
+	if _, err = io.Copy(remoteFile, progressReader); err != nil {
+		return err
+	}
+	if err := sft.verifyRemoteFile(sessionID, ftpClient, remoteFilePath, verifyHash, tracker); err != nil {
+		return err
+	}
+	return applyRemoteAttrs(ftpClient, remoteFilePath, localInfo, tracker.spec.attrs())
 }
 
-// UploadFileDialog opens a file dialog to select a file to upload
+// UploadFileDialog opens a file dialog to select a file to upload.
+// The upload runs in the transfer queue; the call returns when it finishes
 func (sft *SftpService) UploadFileDialog(sessionID string, remotePath string) error {
 	Logger.Debug("UploadFileDialog", zap.String("sessionID", sessionID), zap.String("remotePath", remotePath))
 	localPath, err := app.Dialog.OpenFile().SetTitle("选择文件").PromptForSingleSelection()
@@ -204,18 +272,14 @@ func (sft *SftpService) uploadFileWithTracker(sessionID, localPath, remotePath s
 	if err != nil {
 		return err
 	}
-	tracker := newTransferTracker(sessionID, TransferTypeUpload, localPath, joinRemotePath(remotePath, filepath.Base(localPath)), info.Size())
-	err = sft.uploadFile(sessionID, localPath, remotePath, tracker)
-	tracker.stopProgress(err)
-	return err
+	spec := transferSpec{sessionID: sessionID, transferType: TransferTypeUpload, localPath: localPath, remotePath: remotePath}
+	return transferQueue.enqueueWait(spec, info.Size())
 }
 
+// startUploadFileAsync 将文件上传加入传输队列
 func (sft *SftpService) startUploadFileAsync(sessionID, localPath, remotePath string, size int64) {
-	go func() {
-		tracker := newTransferTracker(sessionID, TransferTypeUpload, localPath, joinRemotePath(remotePath, filepath.Base(localPath)), size)
-		err := sft.uploadFile(sessionID, localPath, remotePath, tracker)
-		tracker.stopProgress(err)
-	}()
+	spec := transferSpec{sessionID: sessionID, transferType: TransferTypeUpload, localPath: localPath, remotePath: remotePath}
+	transferQueue.enqueue(spec, size)
 }
 
 // downloadFile downloads a remote file to the specified local path
@@ -223,9 +287,8 @@ func (sft *SftpService) startUploadFileAsync(sessionID, localPath, remotePath st
 // remotePathFile remote file path (full path including filename)
 func (sft *SftpService) downloadFile(sessionID string, localPathFile, remotePathFile string, tracker *transferTracker) error {
 	Logger.Debug("downloadFile", zap.String("sessionID", sessionID), zap.String("localPath", localPathFile), zap.String("remotePath", remotePathFile))
-	ftpClient, err := sft.getSftpClient(sessionID)
-	if err != nil {
-		return err
+	if tracker == nil {
+		return fmt.Errorf(ErrTrackerRequired)
 	}
 
 	// Ensure local directory exists
@@ -234,25 +297,58 @@ func (sft *SftpService) downloadFile(sessionID string, localPathFile, remotePath
 		return err
 	}
 
+	if client, ok := scpClient(sessionID); ok {
+		return sft.scpDownload(client, sessionID, localPathFile, remotePathFile, false, tracker)
+	}
+	ftpClient, err := sft.getSftpClient(sessionID)
+	if err != nil {
+		return err
+	}
+
 	// Open the remote file for reading
 	remoteFile, err := ftpClient.Open(remotePathFile)
 	if err != nil {
 		return err
 	}
 	defer remoteFile.Close()
+	remoteInfo, err := remoteFile.Stat()
+	if err != nil {
+		return err
+	}
+
+	conflict, err := tracker.checkConflict(remotePathFile, remoteInfo, localPathFile, localConflictTarget)
+	if err != nil || conflict.skip {
+		return err
+	}
+	localPathFile = conflict.target
 
-	// Create the local file for writing
-	localFile, err := os.Create(localPathFile)
+	// Create the local file for writing, or reopen the partial file when resuming
+	localFile, offset, err := openDownloadTarget(localPathFile, remoteFile, remoteInfo.Size(), tracker, conflict.overwrite)
 	if err != nil {
 		return err
 	}
 	defer localFile.Close()
 
-	if tracker == nil {
-		return fmt.Errorf(ErrTrackerRequired)
+	verifyHash, err := tracker.newVerifyHash(localFile, offset)
+	if err != nil {
+		return err
+	}
+	if offset > 0 {
+		tracker.skip(offset)
+		if offset == remoteInfo.Size() {
+			Logger.Debug("downloadFile skip completed file", zap.String("file", localPathFile))
+			if err := sft.verifyRemoteFile(sessionID, ftpClient, remotePathFile, verifyHash, tracker); err != nil {
+				return err
+			}
+			localFile.Close()
+			return applyLocalAttrs(localPathFile, remoteInfo, tracker.spec.attrs())
+		}
+		if _, err := remoteFile.Seek(offset, io.SeekStart); err != nil {
+			return err
+		}
 	}
 
-	progressWriter := &progressWriter{writer: localFile, tracker: tracker}
+	progressWriter := &progressWriter{writer: localFile, tracker: tracker, hash: verifyHash}
 
 	// Copy the remote file content to the local file using io.Copy to leverage sftp.File.WriteTo concurrent reads
 	_, err = io.Copy(progressWriter, remoteFile)
@@ -260,10 +356,18 @@ func (sft *SftpService) downloadFile(sessionID string, localPathFile, remotePath
 		return err
 	}
 
-	return nil
+	if err := sft.verifyRemoteFile(sessionID, ftpClient, remotePathFile, verifyHash, tracker); err != nil {
+		return err
+	}
+	// 关闭后再设置修改时间，避免关闭文件时被系统更新
+	if err := localFile.Close(); err != nil {
+		return err
+	}
+	return applyLocalAttrs(localPathFile, remoteInfo, tracker.spec.attrs())
 }
 
-// DownloadFileDialog opens a save dialog to select where to download a remote file
+// DownloadFileDialog opens a save dialog to select where to download a remote file.
+// The download runs in the transfer queue; the call returns when it finishes
 func (sft *SftpService) DownloadFileDialog(sessionID string, remotePathFile string) error {
 	Logger.Debug("DownloadFileDialog", zap.String("sessionID", sessionID), zap.String("remotePath", remotePathFile))
 	filename := filepath.Base(remotePathFile)
@@ -276,7 +380,10 @@ func (sft *SftpService) DownloadFileDialog(sessionID string, remotePathFile stri
 	if err != nil {
 		return err
 	}
-	// Get remote file info and create tracker
+	if localPathFile == "" {
+		return nil
+	}
+	// Get remote file info and enqueue
 	ftpClient, err := sft.getSftpClient(sessionID)
 	if err != nil {
 		return err
@@ -285,13 +392,12 @@ func (sft *SftpService) DownloadFileDialog(sessionID string, remotePathFile stri
 	if err != nil {
 		return err
 	}
-	tracker := newTransferTracker(sessionID, TransferTypeDownload, localPathFile, remotePathFile, info.Size())
-	err = sft.downloadFile(sessionID, localPathFile, remotePathFile, tracker)
-	tracker.stopProgress(err)
-	return err
+	spec := transferSpec{sessionID: sessionID, transferType: TransferTypeDownload, localPath: localPathFile, remotePath: remotePathFile}
+	return transferQueue.enqueueWait(spec, info.Size())
 }
 
-// UploadDirectoryDialog select local directory upload to remote directory
+// UploadDirectoryDialog select local directory upload to remote directory.
+// The upload runs in the transfer queue; the call returns when it finishes
 func (sft *SftpService) UploadDirectoryDialog(sessionID, remotePath string) error {
 	localPath, err := app.Dialog.OpenFile().SetTitle("选择目录").
 		CanChooseDirectories(true).
@@ -307,25 +413,21 @@ func (sft *SftpService) UploadDirectoryDialog(sessionID, remotePath string) erro
 }
 
 func (sft *SftpService) uploadDirectoryWithTracker(sessionID, localPath, remotePath string) error {
-	total, err := sft.calcLocalDirSize(localPath)
+	total, err := sft.calcLocalDirSize(localPath, defaultSymlinkPolicy())
 	if err != nil {
 		return err
 	}
-	tracker := newTransferTracker(sessionID, TransferTypeUpload, localPath, joinRemotePath(remotePath, filepath.Base(localPath)), total)
-	err = sft.uploadDirectory(sessionID, localPath, remotePath, tracker)
-	tracker.stopProgress(err)
-	return err
+	spec := transferSpec{sessionID: sessionID, transferType: TransferTypeUpload, isDir: true, localPath: localPath, remotePath: remotePath}
+	return transferQueue.enqueueWait(spec, total)
 }
 
+// startUploadDirectoryAsync 将目录上传加入传输队列
 func (sft *SftpService) startUploadDirectoryAsync(sessionID, localPath, remotePath string, total int64) {
-	go func() {
-		tracker := newTransferTracker(sessionID, TransferTypeUpload, localPath, joinRemotePath(remotePath, filepath.Base(localPath)), total)
-		err := sft.uploadDirectory(sessionID, localPath, remotePath, tracker)
-		tracker.stopProgress(err)
-	}()
+	spec := transferSpec{sessionID: sessionID, transferType: TransferTypeUpload, isDir: true, localPath: localPath, remotePath: remotePath}
+	transferQueue.enqueue(spec, total)
 }
 
-// UploadPaths uploads local files or directories to the remote path in parallel.
+// UploadPaths adds local files or directories to the transfer queue for upload to the remote path.
 func (sft *SftpService) UploadPaths(sessionID, remotePath string, localPaths []string) error {
 	if sessionID == "" || remotePath == "" || len(localPaths) == 0 {
 		return fmt.Errorf("invalid upload parameters")
@@ -339,7 +441,7 @@ func (sft *SftpService) UploadPaths(sessionID, remotePath string, localPaths []s
 			return fmt.Errorf("local path %s: %w", p, err)
 		}
 		if info.IsDir() {
-			total, err := sft.calcLocalDirSize(p)
+			total, err := sft.calcLocalDirSize(p, defaultSymlinkPolicy())
 			if err != nil {
 				return fmt.Errorf("local path %s: %w", p, err)
 			}
@@ -351,37 +453,40 @@ func (sft *SftpService) UploadPaths(sessionID, remotePath string, localPaths []s
 	return nil
 }
 
-// uploadDirectory recursively uploads a local directory to the specified remote path
+// uploadDirectory recursively uploads a local directory to the specified remote path.
+// Symlinks are copied as links (default), followed or skipped according to the transfer options
 func (sft *SftpService) uploadDirectory(sessionID string, localPath, remotePath string, tracker *transferTracker) error {
 	Logger.Debug("uploadDirectory", zap.String("sessionID", sessionID), zap.String("localPath", localPath), zap.String("remotePath", remotePath))
 
-	// Validate inputs and get clients
-	ftpClient, err := sft.getSftpClient(sessionID)
-	if err != nil {
-		return err
-	}
-
 	if tracker == nil {
 		return fmt.Errorf(ErrTrackerRequired)
 	}
-
-	// Validate local directory
-	info, err := os.Stat(localPath)
-	if err != nil {
-		return err
-	}
-	if !info.IsDir() {
-		return fmt.Errorf("path is not a directory")
+	if client, ok := scpClient(sessionID); ok {
+		return sft.scpUploadDirectory(client, sessionID, localPath, remotePath, tracker)
 	}
 
-	// Create remote directory
-	remoteDir := joinRemotePath(remotePath, filepath.Base(localPath))
-	if err := sft.ensureRemoteDirExists(ftpClient, remoteDir); err != nil {
+	// Validate inputs and get clients
+	ftpClient, err := sft.getSftpClient(sessionID)
+	if err != nil {
 		return err
 	}
 
-	// Process directory contents
-	return sft.processDirectoryEntries(sessionID, localPath, remoteDir, tracker)
+	attrs := tracker.spec.attrs()
+	remoteRoot := joinRemotePath(remotePath, filepath.Base(localPath))
+	return walkTree(localTreeFS, localPath, attrs.Symlinks, treeVisitor{
+		dir: func(_, rel string, _ os.FileInfo) error {
+			return sft.ensureRemoteDirExists(ftpClient, joinRemotePath(remoteRoot, rel))
+		},
+		dirDone: func(_, rel string, info os.FileInfo) error {
+			return applyRemoteAttrs(ftpClient, joinRemotePath(remoteRoot, rel), info, attrs)
+		},
+		file: func(src, rel string, _ os.FileInfo) error {
+			return sft.uploadFile(sessionID, src, path.Dir(joinRemotePath(remoteRoot, rel)), tracker)
+		},
+		symlink: func(src, rel string) error {
+			return copySymlinkToRemote(ftpClient, src, joinRemotePath(remoteRoot, rel))
+		},
+	})
 }
 
 // ensureRemoteDirExists creates the remote directory if it doesn't exist
@@ -396,33 +501,8 @@ func (sft *SftpService) ensureRemoteDirExists(ftpClient *sftp.Client, remoteDir
 	return nil
 }
 
-// processDirectoryEntries processes all entries in a directory
-func (sft *SftpService) processDirectoryEntries(sessionID, localPath, remoteDir string, tracker *transferTracker) error {
-	entries, err := os.ReadDir(localPath)
-	if err != nil {
-		return err
-	}
-
-	for _, entry := range entries {
-		localEntryPath := filepath.Join(localPath, entry.Name())
-
-		if entry.IsDir() {
-			// Recursively upload subdirectory
-			err = sft.uploadDirectory(sessionID, localEntryPath, remoteDir, tracker)
-			if err != nil {
-				return err
-			}
-		} else {
-			// Upload file
-			err = sft.uploadFile(sessionID, localEntryPath, remoteDir, tracker)
-			if err != nil {
-				return err
-			}
-		}
-	}
-	return nil
-}
-
+// DownloadDirectoryDialog select local directory to download the remote directory into.
+// The download runs in the transfer queue; the call returns when it finishes
 func (sft *SftpService) DownloadDirectoryDialog(sessionID, remotePath string) error {
 	localPath, err := app.Dialog.OpenFile().SetTitle("选择目录").
 		CanChooseDirectories(true).
@@ -431,48 +511,51 @@ func (sft *SftpService) DownloadDirectoryDialog(sessionID, remotePath string) er
 	if err != nil {
 		return err
 	}
-	// Calculate remote directory size and create tracker
-	total, err := sft.calcRemoteDirSize(sessionID, remotePath)
-	if err != nil {
-		return err
+	if localPath == "" {
+		return nil
 	}
-	tracker := newTransferTracker(sessionID, TransferTypeDownload, localPath, remotePath, total)
-	err = sft.downloadDirectory(sessionID, localPath, remotePath, tracker)
-	tracker.stopProgress(err)
-	return err
+	// 远程目录大小在任务开始执行时计算，避免大目录阻塞入队
+	spec := transferSpec{sessionID: sessionID, transferType: TransferTypeDownload, isDir: true, localPath: localPath, remotePath: remotePath}
+	return transferQueue.enqueueWait(spec, 0)
 }
 
-// downloadDirectory recursively downloads a remote directory to the specified local path
+// downloadDirectory recursively downloads a remote directory to the specified local path.
+// Symlinks are copied as links (default), followed or skipped according to the transfer options
 func (sft *SftpService) downloadDirectory(sessionID string, localPath, remotePath string, tracker *transferTracker) error {
 	Logger.Debug("downloadDirectory", zap.String("sessionID", sessionID), zap.String("localPath", localPath), zap.String("remotePath", remotePath))
 
-	// Validate inputs and get clients
-	ftpClient, err := sft.getSftpClient(sessionID)
-	if err != nil {
-		return err
-	}
-
 	if tracker == nil {
 		return fmt.Errorf(ErrTrackerRequired)
 	}
+	if client, ok := scpClient(sessionID); ok {
+		return sft.scpDownload(client, sessionID, localPath, remotePath, true, tracker)
+	}
 
-	// Validate remote directory
-	info, err := ftpClient.Stat(remotePath)
+	// Validate inputs and get clients
+	ftpClient, err := sft.getSftpClient(sessionID)
 	if err != nil {
 		return err
 	}
-	if !info.IsDir() {
-		return fmt.Errorf("path is not a directory")
-	}
 
-	// Create local directory
-	localDir := filepath.Join(localPath, filepath.Base(remotePath))
-	if err := sft.ensureLocalDirExists(localDir); err != nil {
-		return err
+	attrs := tracker.spec.attrs()
+	localRoot := filepath.Join(localPath, filepath.Base(remotePath))
+	localTarget := func(rel string) string {
+		return filepath.Join(localRoot, filepath.FromSlash(rel))
 	}
-
-	// Process directory contents
-	return sft.processRemoteDirectoryEntries(sessionID, localDir, remotePath, tracker)
+	return walkTree(remoteTreeFS(ftpClient), remotePath, attrs.Symlinks, treeVisitor{
+		dir: func(_, rel string, _ os.FileInfo) error {
+			return sft.ensureLocalDirExists(localTarget(rel))
+		},
+		dirDone: func(_, rel string, info os.FileInfo) error {
+			return applyLocalAttrs(localTarget(rel), info, attrs)
+		},
+		file: func(src, rel string, _ os.FileInfo) error {
+			return sft.downloadFile(sessionID, localTarget(rel), src, tracker)
+		},
+		symlink: func(src, rel string) error {
+			return copySymlinkToLocal(ftpClient, src, localTarget(rel))
+		},
+	})
 }
 
 // ensureLocalDirExists creates the local directory if it doesn't exist
@@ -480,39 +563,6 @@ func (sft *SftpService) ensureLocalDirExists(localDir string) error {
 	return os.MkdirAll(localDir, 0755)
 }
 
-// processRemoteDirectoryEntries processes all entries in a remote directory
-func (sft *SftpService) processRemoteDirectoryEntries(sessionID, localDir, remotePath string, tracker *transferTracker) error {
-	ftpClient, err := sft.getSftpClient(sessionID)
-	if err != nil {
-		return err
-	}
-
-	entries, err := ftpClient.ReadDir(remotePath)
-	if err != nil {
-		return err
-	}
-
-	for _, entry := range entries {
-		remoteEntryPath := joinRemotePath(remotePath, entry.Name())
-		localEntryPath := filepath.Join(localDir, entry.Name())
-
-		if entry.IsDir() {
-			// Recursively download subdirectory
-			err = sft.downloadDirectory(sessionID, localDir, remoteEntryPath, tracker)
-			if err != nil {
-				return err
-			}
-		} else {
-			// Download file
-			err = sft.downloadFile(sessionID, localEntryPath, remoteEntryPath, tracker)
-			if err != nil {
-				return err
-			}
-		}
-	}
-	return nil
-}
-
 // DeleteFile deletes a file or directory at the specified path
 func (sft *SftpService) DeleteFile(sessionID string, path string) error {
 	Logger.Debug("DeleteFile", zap.String("sessionID", sessionID), zap.String("path", path))
@@ -520,9 +570,10 @@ func (sft *SftpService) DeleteFile(sessionID string, path string) error {
 	if err != nil {
 		return err
 	}
+	defer invalidateListings(sessionID, path)
 
-	// Check if it's a directory
-	info, err := ftpClient.Stat(path)
+	// Check if it's a directory, symlinks are removed as links and never followed
+	info, err := ftpClient.Lstat(path)
 	if err != nil {
 		return err
 	}
@@ -546,6 +597,7 @@ func (sft *SftpService) RenameFile(sessionID string, oldPath, newPath string) er
 	if _, err := ftpClient.Stat(newPath); err == nil {
 		return fmt.Errorf("%s exists", newPath)
 	}
+	defer invalidateListings(sessionID, oldPath, newPath)
 
 	return ftpClient.Rename(oldPath, newPath)
 }
@@ -553,6 +605,12 @@ func (sft *SftpService) RenameFile(sessionID string, oldPath, newPath string) er
 // GetWd returns the current working directory
 func (sft *SftpService) GetWd(sessionID string) (string, error) {
 	Logger.Debug("GetWd", zap.String("sessionID", sessionID))
+	if client, ok := scpClient(sessionID); ok {
+		ctx, cancel := context.WithTimeout(context.Background(), scpListTimeout)
+		defer cancel()
+		out, err := runRemoteOutput(ctx, client, "pwd")
+		return strings.TrimSpace(string(out)), err
+	}
 	ftpClient, err := sft.getSftpClient(sessionID)
 	if err != nil {
 		return "", err
@@ -569,6 +627,9 @@ func (sft *SftpService) Close() {
 	if err != nil {
 		Logger.Warn("Error closing SFTP connection:", zap.Error(err))
 	}
+	if sft.sudoSession != nil {
+		_ = sft.sudoSession.Close()
+	}
 }
 
 // CreateFile creates a new file at the specified path
@@ -582,8 +643,12 @@ func (sft *SftpService) CreateFile(sessionID string, path string) error {
 	if _, err := ftpClient.Stat(path); err == nil {
 		return fmt.Errorf("file already exists")
 	}
-	_, err = ftpClient.Create(path)
-	return err
+	defer invalidateListings(sessionID, path)
+	file, err := ftpClient.Create(path)
+	if err != nil {
+		return err
+	}
+	return file.Close()
 }
 
 // CreateDirectory creates a new directory at the specified path
@@ -597,58 +662,40 @@ func (sft *SftpService) CreateDirectory(sessionID string, path string) error {
 	if _, err := ftpClient.Stat(path); err == nil {
 		return fmt.Errorf("directory already exists")
 	}
+	defer invalidateListings(sessionID, path)
 	return ftpClient.MkdirAll(path)
 }
 
-// CancelTransfer cancels an ongoing transfer by its ID
+// CancelTransfer cancels a queued, paused or ongoing transfer by its ID
 func (sft *SftpService) CancelTransfer(transferID string) error {
 	Logger.Debug("CancelTransfer", zap.String("transferID", transferID))
-	val, ok := activeTransfers.Load(transferID)
-	if !ok {
-		return fmt.Errorf("transfer with ID %s not found", transferID)
-	}
-	tracker := val.(*transferTracker)
-	tracker.cancelFunc()
-	return nil
+	return transferQueue.stop(transferID, TransferStatusCancelled)
 }
 
-func (sft *SftpService) calcLocalDirSize(path string) (int64, error) {
+// calcLocalDirSize 统计本地目录中文件的总大小，symlinks 为符号链接处理方式，跟随时计入链接指向的文件
+func (sft *SftpService) calcLocalDirSize(path string, symlinks string) (int64, error) {
 	var size int64
-	err := filepath.Walk(path, func(_ string, info os.FileInfo, err error) error {
-		if err != nil {
-			return err
-		}
-		if !info.IsDir() {
+	err := walkTree(localTreeFS, path, symlinks, treeVisitor{
+		file: func(_, _ string, info os.FileInfo) error {
 			size += info.Size()
-		}
-		return nil
+			return nil
+		},
 	})
 	return size, err
 }
 
-func (sft *SftpService) calcRemoteDirSize(sessionID, remotePath string) (int64, error) {
+// calcRemoteDirSize 统计远程目录中文件的总大小，规则同 calcLocalDirSize
+func (sft *SftpService) calcRemoteDirSize(sessionID, remotePath string, symlinks string) (int64, error) {
 	ftpClient, err := sft.getSftpClient(sessionID)
 	if err != nil {
 		return 0, err
 	}
 	var size int64
-	var walk func(string) error
-	walk = func(path string) error {
-		entries, err := ftpClient.ReadDir(path)
-		if err != nil {
-			return err
-		}
-		for _, entry := range entries {
-			if entry.IsDir() {
-				if err := walk(joinRemotePath(path, entry.Name())); err != nil {
-					return err
-				}
-			} else {
-				size += entry.Size()
-			}
-		}
-		return nil
-	}
-	err = walk(remotePath)
+	err = walkTree(remoteTreeFS(ftpClient), remotePath, symlinks, treeVisitor{
+		file: func(_, _ string, info os.FileInfo) error {
+			size += info.Size()
+			return nil
+		},
+	})
 	return size, err
 }
@@ -0,0 +1,287 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ilaziness/vexo/internal/utils"
+	"github.com/pkg/sftp"
+	"github.com/wailsapp/wails/v3/pkg/application"
+	"go.uber.org/zap"
+	"golang.org/x/crypto/ssh"
+)
+
+// 通过 sudo 启动 sftp-server，以 root 身份管理文件。服务器需要允许登录用户通过 sudo 执行 sftp-server，
+// 需要密码时通过事件询问前端，前端调用 SubmitSudoPassword 回复。远程命令只能以登录用户执行，
+// 此时搜索、监视等改用 SFTP 实现，压缩、解压等只能通过命令完成的操作返回错误
+
+const (
+	EventSudoPasswordPrompt = "eventSudoPasswordPrompt"
+
+	sudoPromptMarker     = "[vexo-sudo-password]"
+	sudoPasswordTimeout  = 2 * time.Minute
+	sudoPromptTimeout    = 5 * time.Second // 等待 sudo 提示输入密码的时间，超时认为不需要密码
+	sudoDetectTimeout    = 10 * time.Second
+	sudoStderrLimit      = 4096
+	defaultSftpServerCmd = "/usr/lib/openssh/sftp-server"
+)
+
+// sftpServerPaths 常见发行版中 sftp-server 的位置
+var sftpServerPaths = []string{
+	defaultSftpServerCmd,
+	"/usr/libexec/openssh/sftp-server",
+	"/usr/lib/ssh/sftp-server",
+	"/usr/libexec/sftp-server",
+	"/usr/lib/sftp-server",
+	"/usr/libexec/ssh/sftp-server",
+}
+
+var (
+	errSudoPasswordRequired = errors.New("sudo 需要密码")
+	errSudoExec             = errors.New("SFTP 通过 sudo 运行时不能执行远程命令（压缩、解压等），远程命令只能以登录用户执行")
+	pendingSudoPasswords    = new(sync.Map) // map[requestID]chan string
+)
+
+func init() {
+	application.RegisterEvent[SudoPasswordPrompt](EventSudoPasswordPrompt)
+}
+
+// SudoPasswordPrompt 询问 sudo 密码
+type SudoPasswordPrompt struct {
+	RequestID string `json:"requestID"`
+	SessionID string `json:"sessionID"`
+	User      string `json:"user"`
+	Host      string `json:"host"`
+}
+
+// sftpClientOptions 创建 SFTP 客户端的选项，适合高延迟网络：
+// 32KB 数据包（协议允许的最大值），上传和下载使用并发读写
+func sftpClientOptions() []sftp.ClientOption {
+	return []sftp.ClientOption{
+		sftp.MaxPacket(32768),
+		sftp.UseConcurrentWrites(true),
+		sftp.UseConcurrentReads(true),
+	}
+}
+
+// sudoStderr 收集 sudo 的错误输出。sudo 提示输入密码时关闭 prompted，
+// 密码错误时 sudo 会再次提示输入，此时调用 onRetry 结束会话
+type sudoStderr struct {
+	mu         sync.Mutex
+	buf        bytes.Buffer
+	onRetry    func()
+	once       sync.Once
+	prompted   chan struct{}
+	promptOnce sync.Once
+}
+
+func newSudoStderr(onRetry func()) *sudoStderr {
+	return &sudoStderr{onRetry: onRetry, prompted: make(chan struct{})}
+}
+
+func (w *sudoStderr) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	(&limitedBuffer{buf: &w.buf, limit: sudoStderrLimit}).Write(p)
+	prompts := strings.Count(w.buf.String(), sudoPromptMarker)
+	w.mu.Unlock()
+	if prompts > 0 {
+		w.promptOnce.Do(func() { close(w.prompted) })
+	}
+	if prompts > 1 && w.onRetry != nil {
+		w.once.Do(w.onRetry)
+	}
+	return len(p), nil
+}
+
+func (w *sudoStderr) String() string {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return strings.TrimSpace(strings.ReplaceAll(w.buf.String(), sudoPromptMarker, ""))
+}
+
+// sudoError 根据 sudo 的错误输出返回便于理解的错误
+func sudoError(stderr string, serverPath string, err error) error {
+	lower := strings.ToLower(stderr)
+	switch {
+	case strings.Contains(lower, "a password is required"):
+		return errSudoPasswordRequired
+	case strings.Contains(lower, "sorry, try again") || strings.Contains(lower, "incorrect password"):
+		return errors.New("sudo 密码错误")
+	case strings.Contains(lower, "not in the sudoers") || strings.Contains(lower, "not allowed to execute") ||
+		strings.Contains(lower, "may not run sudo"):
+		return fmt.Errorf("当前用户不允许通过 sudo 执行 %s", serverPath)
+	case strings.Contains(lower, "must have a tty"):
+		return errors.New("服务器的 sudo 要求终端（requiretty），无法用于 SFTP")
+	case strings.Contains(lower, "sudo: command not found") || strings.Contains(lower, "sudo: not found"):
+		return errors.New("远程主机没有安装 sudo")
+	case strings.Contains(lower, "command not found") || strings.Contains(lower, "no such file"):
+		return fmt.Errorf("远程主机上找不到 %s", serverPath)
+	case stderr != "":
+		return fmt.Errorf("通过 sudo 启动 SFTP 失败: %s", stderr)
+	}
+	return fmt.Errorf("通过 sudo 启动 SFTP 失败: %w", err)
+}
+
+// detectSftpServerPath 查找远程主机上的 sftp-server，找不到时返回 Debian 系的默认位置
+func detectSftpServerPath(client *ssh.Client) string {
+	quoted := make([]string, 0, len(sftpServerPaths))
+	for _, p := range sftpServerPaths {
+		quoted = append(quoted, shellQuote(p))
+	}
+	cmd := "for p in " + strings.Join(quoted, " ") + `; do if [ -x "$p" ]; then echo "$p"; exit 0; fi; done; exit 1`
+	ctx, cancel := context.WithTimeout(context.Background(), sudoDetectTimeout)
+	defer cancel()
+	out, err := runRemoteOutput(ctx, client, cmd)
+	if path := strings.TrimSpace(string(out)); err == nil && path != "" {
+		return path
+	}
+	return defaultSftpServerCmd
+}
+
+// connectSudo 在新的 exec 通道上通过 sudo 启动 sftp-server，password 为空时使用 sudo -n（不询问密码）
+func (sft *SftpService) connectSudo(client *ssh.Client, serverPath string, password string) error {
+	session, err := client.NewSession()
+	if err != nil {
+		return err
+	}
+	stdin, err := session.StdinPipe()
+	if err != nil {
+		session.Close()
+		return err
+	}
+	stdout, err := session.StdoutPipe()
+	if err != nil {
+		session.Close()
+		return err
+	}
+	stderr := newSudoStderr(func() { _ = session.Close() })
+	session.Stderr = stderr
+
+	cmd := "sudo -n -- " + shellQuote(serverPath)
+	if password != "" {
+		cmd = "sudo -S -p " + shellQuote(sudoPromptMarker) + " -- " + shellQuote(serverPath)
+	}
+	if err := session.Start(cmd); err != nil {
+		session.Close()
+		return err
+	}
+	if password != "" {
+		// 只在 sudo 提示后发送密码：sudo 仍有缓存的认证时不会提示，密码会被当作 SFTP 数据发给 sftp-server。
+		// 密码错误时 sudo 再次提示，stderr 检测到后关闭会话，NewClientPipe 随之返回错误
+		select {
+		case <-stderr.prompted:
+			if _, err := stdin.Write([]byte(password + "\n")); err != nil {
+				session.Close()
+				return sudoError(stderr.String(), serverPath, err)
+			}
+		case <-time.After(sudoPromptTimeout):
+			Logger.Debug("sudo did not prompt for password", zap.String("serverPath", serverPath))
+		}
+	}
+	ftpClient, err := sftp.NewClientPipe(stdout, stdin, sftpClientOptions()...)
+	if err != nil {
+		// 等待 stderr 读取完成后再判断原因
+		_ = stdin.Close()
+		_ = session.Wait()
+		session.Close()
+		return sudoError(stderr.String(), serverPath, err)
+	}
+	sft.ftpClient = ftpClient
+	sft.sshClient = client
+	sft.sudoSession = session
+	return nil
+}
+
+// askSudoPassword 推送密码询问事件并等待前端回复，取消或超时返回错误
+func askSudoPassword(sessionID string, client *ssh.Client) (string, error) {
+	if app == nil {
+		return "", errSudoPasswordRequired
+	}
+	id := utils.GenerateRandomID()
+	ch := make(chan string, 1)
+	pendingSudoPasswords.Store(id, ch)
+	defer pendingSudoPasswords.Delete(id)
+	app.Event.Emit(EventSudoPasswordPrompt, SudoPasswordPrompt{
+		RequestID: id,
+		SessionID: sessionID,
+		User:      client.User(),
+		Host:      client.RemoteAddr().String(),
+	})
+	select {
+	case password := <-ch:
+		if password == "" {
+			return "", errors.New("已取消 sudo 密码输入")
+		}
+		return password, nil
+	case <-time.After(sudoPasswordTimeout):
+		return "", errors.New("等待 sudo 密码超时")
+	}
+}
+
+// SubmitSudoPassword 回复 sudo 密码询问，password 为空表示取消
+func (s *SSHService) SubmitSudoPassword(requestID string, password string) error {
+	value, ok := pendingSudoPasswords.LoadAndDelete(requestID)
+	if !ok {
+		return fmt.Errorf("sudo password request %s not found", requestID)
+	}
+	value.(chan string) <- password
+	return nil
+}
+
+// SetSftpSudo 切换会话的 SFTP 身份：enabled 为 true 时通过 sudo 启动 sftp-server，否则使用登录用户的 SFTP 子系统。
+// serverPath 为空时自动查找 sftp-server。切换会关闭原有的 SFTP 连接，进行中的传输会中断
+func (s *SSHService) SetSftpSudo(ID string, enabled bool, serverPath string) error {
+	Logger.Debug("SetSftpSudo", zap.String("id", ID), zap.Bool("enabled", enabled), zap.String("serverPath", serverPath))
+	connAny, ok := s.SSHConnects.Load(ID)
+	if !ok {
+		return fmt.Errorf(ErrSSHConnectionNotFound, ID)
+	}
+	conn := connAny.(*SSHConnect)
+
+	sftpService := NewSftpService()
+	if enabled {
+		if serverPath == "" {
+			serverPath = detectSftpServerPath(conn.client)
+		}
+		err := sftpService.connectSudo(conn.client, serverPath, "")
+		if errors.Is(err, errSudoPasswordRequired) {
+			password, askErr := askSudoPassword(ID, conn.client)
+			if askErr != nil {
+				return askErr
+			}
+			err = sftpService.connectSudo(conn.client, serverPath, password)
+		}
+		if err != nil {
+			Logger.Warn("start sudo sftp failed", zap.String("id", ID), zap.Error(err))
+			return err
+		}
+	} else if err := sftpService.Connect(conn.client); err != nil {
+		return err
+	}
+	sftpService.sshConnect = conn
+
+	old := conn.sftpService
+	conn.sftpService = sftpService
+	sftpClient.Store(ID, sftpService)
+	dirListings.Delete(ID)
+	if old != nil {
+		old.Close()
+	}
+	Logger.Info("SFTP identity switched", zap.String("id", ID), zap.Bool("sudo", enabled))
+	return nil
+}
+
+// IsSftpSudo 返回会话的 SFTP 是否通过 sudo 运行
+func (s *SSHService) IsSftpSudo(ID string) bool {
+	connAny, ok := s.SSHConnects.Load(ID)
+	if !ok {
+		return false
+	}
+	sft := connAny.(*SSHConnect).sftpService
+	return sft != nil && sft.sudoSession != nil
+}
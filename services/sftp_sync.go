@@ -0,0 +1,600 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pkg/sftp"
+	"go.uber.org/zap"
+)
+
+// 目录同步：比较本地与远程目录，生成创建、更新、删除计划，只传输有差异的文件
+
+const (
+	DirSyncDirectionUpload   = "upload"   // 本地同步到远程
+	DirSyncDirectionDownload = "download" // 远程同步到本地
+	DirSyncDirectionBoth     = "both"     // 双向同步，较新的一端覆盖较旧的一端
+
+	DirSyncActionMkdir    = "mkdir"
+	DirSyncActionCreate   = "create"
+	DirSyncActionUpdate   = "update"
+	DirSyncActionDelete   = "delete"
+	DirSyncActionConflict = "conflict" // 双向同步时无法判断哪端较新，不做处理
+
+	DirSyncSideLocal  = "local"
+	DirSyncSideRemote = "remote"
+
+	// syncMtimeTolerance 修改时间比较容差，SFTP 只保留秒级精度，FAT 等文件系统为 2 秒
+	syncMtimeTolerance = 2 * time.Second
+)
+
+// DirSyncOptions 目录同步选项
+type DirSyncOptions struct {
+	Direction        string   `json:"direction"`        // upload/download/both
+	Checksum         bool     `json:"checksum"`         // 大小相同时比较 SHA-256，而不是修改时间
+	Excludes         []string `json:"excludes"`         // 排除规则，匹配相对路径或文件名，例如 .git、*.log、build/*
+	DeleteExtraneous bool     `json:"deleteExtraneous"` // 删除目标端多余的文件和目录，双向同步时无效
+}
+
+// DirSyncAction 同步计划中的一项操作
+type DirSyncAction struct {
+	Action string `json:"action"` // mkdir/create/update/delete/conflict
+	Side   string `json:"side"`   // 被修改的一端：local 或 remote
+	Path   string `json:"path"`   // 相对于同步根目录的路径，使用 / 分隔
+	IsDir  bool   `json:"isDir"`
+	Size   int64  `json:"size"` // 需要传输的字节数
+	Reason string `json:"reason"`
+}
+
+// DirSyncPlan 同步计划，操作按执行顺序排列（父目录在前）
+type DirSyncPlan struct {
+	LocalDir     string          `json:"localDir"`
+	RemoteDir    string          `json:"remoteDir"`
+	Options      DirSyncOptions  `json:"options"` // 生成计划使用的同步选项
+	Actions      []DirSyncAction `json:"actions"`
+	TransferSize int64           `json:"transferSize"`
+	Creates      int             `json:"creates"`
+	Updates      int             `json:"updates"`
+	Deletes      int             `json:"deletes"`
+	Conflicts    int             `json:"conflicts"`
+}
+
+// syncEntry 目录树中的一个文件或目录
+type syncEntry struct {
+	isDir   bool
+	size    int64
+	modTime time.Time
+}
+
+// syncExcludes 排除规则
+type syncExcludes []string
+
+func newSyncExcludes(patterns []string) (syncExcludes, error) {
+	var ex syncExcludes
+	for _, p := range patterns {
+		p = strings.Trim(strings.TrimSpace(filepath.ToSlash(p)), "/")
+		if p == "" {
+			continue
+		}
+		if _, err := path.Match(p, ""); err != nil {
+			return nil, fmt.Errorf("无效的排除规则: %s", p)
+		}
+		ex = append(ex, p)
+	}
+	return ex, nil
+}
+
+// match 判断相对路径是否被排除，规则同时匹配完整相对路径和文件名
+func (ex syncExcludes) match(rel string) bool {
+	base := path.Base(rel)
+	for _, p := range ex {
+		if ok, _ := path.Match(p, rel); ok {
+			return true
+		}
+		if ok, _ := path.Match(p, base); ok {
+			return true
+		}
+	}
+	return false
+}
+
+func validateSyncOptions(opts DirSyncOptions) error {
+	switch opts.Direction {
+	case DirSyncDirectionUpload, DirSyncDirectionDownload, DirSyncDirectionBoth:
+	default:
+		return fmt.Errorf("不支持的同步方向: %s", opts.Direction)
+	}
+	_, err := newSyncExcludes(opts.Excludes)
+	return err
+}
+
+// scanLocalTree 遍历本地目录，返回相对路径到条目的映射，根目录不存在时返回 nil。
+// 符号链接按目标处理，指向目录的链接不跟随，避免循环
+func scanLocalTree(ctx context.Context, root string, ex syncExcludes) (map[string]syncEntry, error) {
+	info, err := os.Stat(root)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return nil, fmt.Errorf("%s 不是目录", root)
+	}
+
+	entries := make(map[string]syncEntry)
+	err = filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if p == root {
+			return nil
+		}
+		rel, err := filepath.Rel(root, p)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		if ex.match(rel) {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if d.IsDir() {
+			entries[rel] = syncEntry{isDir: true}
+			return nil
+		}
+		info, err := os.Stat(p)
+		if err != nil || !info.Mode().IsRegular() {
+			Logger.Debug("sync skip local entry", zap.String("path", p), zap.Error(err))
+			return nil
+		}
+		entries[rel] = syncEntry{size: info.Size(), modTime: info.ModTime()}
+		return nil
+	})
+	return entries, err
+}
+
+// scanRemoteTree 遍历远程目录，规则同 scanLocalTree
+func scanRemoteTree(ctx context.Context, ftpClient *sftp.Client, root string, ex syncExcludes) (map[string]syncEntry, error) {
+	info, err := ftpClient.Stat(root)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return nil, fmt.Errorf("%s 不是目录", root)
+	}
+
+	prefix := strings.TrimSuffix(root, "/") + "/"
+	entries := make(map[string]syncEntry)
+	walker := ftpClient.Walk(root)
+	for walker.Step() {
+		if err := walker.Err(); err != nil {
+			return nil, err
+		}
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		p := walker.Path()
+		if p == root {
+			continue
+		}
+		rel := strings.TrimPrefix(p, prefix)
+		stat := walker.Stat()
+		if ex.match(rel) {
+			if stat.IsDir() {
+				walker.SkipDir()
+			}
+			continue
+		}
+		if stat.IsDir() {
+			entries[rel] = syncEntry{isDir: true}
+			continue
+		}
+		if stat.Mode()&os.ModeSymlink != 0 {
+			if stat, err = ftpClient.Stat(p); err != nil {
+				Logger.Debug("sync skip remote entry", zap.String("path", p), zap.Error(err))
+				continue
+			}
+		}
+		if !stat.Mode().IsRegular() {
+			continue
+		}
+		entries[rel] = syncEntry{size: stat.Size(), modTime: stat.ModTime()}
+	}
+	return entries, nil
+}
+
+// syncPlanner 比较两端目录树生成同步计划
+type syncPlanner struct {
+	opts      DirSyncOptions
+	localDir  string
+	remoteDir string
+	ftpClient *sftp.Client
+	plan      *DirSyncPlan
+	deleted   []string // 已计划删除的目录，其子项不再处理
+}
+
+func (sp *syncPlanner) add(action DirSyncAction) {
+	plan := sp.plan
+	plan.Actions = append(plan.Actions, action)
+	plan.TransferSize += action.Size
+	switch action.Action {
+	case DirSyncActionMkdir, DirSyncActionCreate:
+		plan.Creates++
+	case DirSyncActionUpdate:
+		plan.Updates++
+	case DirSyncActionDelete:
+		plan.Deletes++
+		if action.IsDir {
+			sp.deleted = append(sp.deleted, action.Path+"/")
+		}
+	case DirSyncActionConflict:
+		plan.Conflicts++
+	}
+}
+
+func (sp *syncPlanner) underDeleted(rel string) bool {
+	for _, prefix := range sp.deleted {
+		if strings.HasPrefix(rel, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// copyAction 将 entry 复制到 side 一端的操作
+func copyAction(action string, side string, rel string, entry syncEntry, reason string) DirSyncAction {
+	if entry.isDir {
+		return DirSyncAction{Action: DirSyncActionMkdir, Side: side, Path: rel, IsDir: true, Reason: reason}
+	}
+	return DirSyncAction{Action: action, Side: side, Path: rel, Size: entry.size, Reason: reason}
+}
+
+// sameContent 比较两端同名文件内容是否相同：大小不同即不同；
+// 开启校验和时比较 SHA-256，否则比较修改时间
+func (sp *syncPlanner) sameContent(rel string, local, remote syncEntry) (bool, string, error) {
+	if local.size != remote.size {
+		return false, "大小不同", nil
+	}
+	if !sp.opts.Checksum {
+		if mtimeEqual(local.modTime, remote.modTime) {
+			return true, "", nil
+		}
+		return false, "修改时间不同", nil
+	}
+	localHash, err := localFileSHA256(filepath.Join(sp.localDir, filepath.FromSlash(rel)))
+	if err != nil {
+		return false, "", err
+	}
+	remoteHash, err := remoteFileSHA256(sp.ftpClient, joinRemotePath(sp.remoteDir, rel))
+	if err != nil {
+		return false, "", err
+	}
+	if bytes.Equal(localHash, remoteHash) {
+		return true, "", nil
+	}
+	return false, "内容不同", nil
+}
+
+func mtimeEqual(a, b time.Time) bool {
+	d := a.Sub(b)
+	return d < syncMtimeTolerance && d > -syncMtimeTolerance
+}
+
+// planOneWay 单向同步：src 一端覆盖 dst 一端
+func (sp *syncPlanner) planOneWay(rel string, local, remote *syncEntry) error {
+	src, dst, side := local, remote, DirSyncSideRemote
+	if sp.opts.Direction == DirSyncDirectionDownload {
+		src, dst, side = remote, local, DirSyncSideLocal
+	}
+	switch {
+	case src == nil:
+		if sp.opts.DeleteExtraneous {
+			sp.add(DirSyncAction{Action: DirSyncActionDelete, Side: side, Path: rel, IsDir: dst.isDir, Reason: "源端不存在"})
+		}
+	case dst == nil:
+		sp.add(copyAction(DirSyncActionCreate, side, rel, *src, "目标端不存在"))
+	case src.isDir != dst.isDir:
+		sp.add(DirSyncAction{Action: DirSyncActionDelete, Side: side, Path: rel, IsDir: dst.isDir, Reason: "类型不同"})
+		sp.add(copyAction(DirSyncActionCreate, side, rel, *src, "类型不同"))
+	case !src.isDir:
+		same, reason, err := sp.sameContent(rel, *local, *remote)
+		if err != nil {
+			return err
+		}
+		if !same {
+			sp.add(DirSyncAction{Action: DirSyncActionUpdate, Side: side, Path: rel, Size: src.size, Reason: reason})
+		}
+	}
+	return nil
+}
+
+// planTwoWay 双向同步：只存在于一端的条目复制到另一端，两端都有时修改时间较新的一端覆盖另一端。
+// 无法区分“一端新增”和“另一端删除”，因此双向同步不删除任何文件
+func (sp *syncPlanner) planTwoWay(rel string, local, remote *syncEntry) error {
+	switch {
+	case remote == nil:
+		sp.add(copyAction(DirSyncActionCreate, DirSyncSideRemote, rel, *local, "远程不存在"))
+	case local == nil:
+		sp.add(copyAction(DirSyncActionCreate, DirSyncSideLocal, rel, *remote, "本地不存在"))
+	case local.isDir != remote.isDir:
+		sp.add(DirSyncAction{Action: DirSyncActionConflict, Path: rel, Reason: "两端类型不同"})
+	case !local.isDir:
+		same, reason, err := sp.sameContent(rel, *local, *remote)
+		if err != nil {
+			return err
+		}
+		if same {
+			return nil
+		}
+		switch {
+		case mtimeEqual(local.modTime, remote.modTime):
+			sp.add(DirSyncAction{Action: DirSyncActionConflict, Path: rel, Reason: reason + "，修改时间相同"})
+		case local.modTime.After(remote.modTime):
+			sp.add(DirSyncAction{Action: DirSyncActionUpdate, Side: DirSyncSideRemote, Path: rel, Size: local.size, Reason: "本地较新"})
+		default:
+			sp.add(DirSyncAction{Action: DirSyncActionUpdate, Side: DirSyncSideLocal, Path: rel, Size: remote.size, Reason: "远程较新"})
+		}
+	}
+	return nil
+}
+
+// planSync 比较本地与远程目录生成同步计划
+func (sft *SftpService) planSync(ctx context.Context, ftpClient *sftp.Client, localDir, remoteDir string, opts DirSyncOptions) (*DirSyncPlan, error) {
+	if err := validateSyncOptions(opts); err != nil {
+		return nil, err
+	}
+	ex, _ := newSyncExcludes(opts.Excludes)
+	localDir = filepath.Clean(localDir)
+	remoteDir = path.Clean(remoteDir)
+
+	localTree, err := scanLocalTree(ctx, localDir, ex)
+	if err != nil {
+		return nil, fmt.Errorf("读取本地目录失败: %w", err)
+	}
+	remoteTree, err := scanRemoteTree(ctx, ftpClient, remoteDir, ex)
+	if err != nil {
+		return nil, fmt.Errorf("读取远程目录失败: %w", err)
+	}
+	switch {
+	case opts.Direction == DirSyncDirectionUpload && localTree == nil:
+		return nil, fmt.Errorf("本地目录 %s 不存在", localDir)
+	case opts.Direction == DirSyncDirectionDownload && remoteTree == nil:
+		return nil, fmt.Errorf("远程目录 %s 不存在", remoteDir)
+	case localTree == nil && remoteTree == nil:
+		return nil, fmt.Errorf("本地和远程目录都不存在")
+	}
+
+	keys := make([]string, 0, len(localTree)+len(remoteTree))
+	for rel := range localTree {
+		keys = append(keys, rel)
+	}
+	for rel := range remoteTree {
+		if _, ok := localTree[rel]; !ok {
+			keys = append(keys, rel)
+		}
+	}
+	sort.Strings(keys)
+
+	sp := &syncPlanner{
+		opts:      opts,
+		localDir:  localDir,
+		remoteDir: remoteDir,
+		ftpClient: ftpClient,
+		plan:      &DirSyncPlan{LocalDir: localDir, RemoteDir: remoteDir, Options: opts, Actions: make([]DirSyncAction, 0)},
+	}
+	for _, rel := range keys {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		if sp.underDeleted(rel) {
+			continue
+		}
+		var local, remote *syncEntry
+		if e, ok := localTree[rel]; ok {
+			local = &e
+		}
+		if e, ok := remoteTree[rel]; ok {
+			remote = &e
+		}
+		if opts.Direction == DirSyncDirectionBoth {
+			err = sp.planTwoWay(rel, local, remote)
+		} else {
+			err = sp.planOneWay(rel, local, remote)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return sp.plan, nil
+}
+
+// applySync 按顺序执行同步计划，复制后将目标文件的修改时间设置为与源文件一致，
+// 下次比较时未变化的文件不会被再次传输
+func (sft *SftpService) applySync(sessionID string, ftpClient *sftp.Client, plan *DirSyncPlan, tracker *transferTracker) error {
+	for _, action := range plan.Actions {
+		if err := tracker.ctx.Err(); err != nil {
+			if errors.Is(err, context.Canceled) {
+				return errors.New("user cancelled")
+			}
+			return err
+		}
+		localPath := filepath.Join(plan.LocalDir, filepath.FromSlash(action.Path))
+		remotePath := joinRemotePath(plan.RemoteDir, action.Path)
+		var err error
+		switch {
+		case action.Action == DirSyncActionConflict:
+			Logger.Info("sync conflict skipped", zap.String("path", action.Path), zap.String("reason", action.Reason))
+		case action.Action == DirSyncActionMkdir && action.Side == DirSyncSideRemote:
+			err = ftpClient.MkdirAll(remotePath)
+		case action.Action == DirSyncActionMkdir:
+			err = os.MkdirAll(localPath, 0755)
+		case action.Action == DirSyncActionDelete && action.Side == DirSyncSideRemote:
+			if action.IsDir {
+				err = ftpClient.RemoveAll(remotePath)
+			} else {
+				err = ftpClient.Remove(remotePath)
+			}
+		case action.Action == DirSyncActionDelete:
+			err = os.RemoveAll(localPath)
+		case action.Side == DirSyncSideRemote:
+			err = sft.uploadFile(sessionID, localPath, path.Dir(remotePath), tracker)
+			if err == nil {
+				var info os.FileInfo
+				if info, err = os.Stat(localPath); err == nil {
+					err = ftpClient.Chtimes(remotePath, time.Now(), info.ModTime())
+				}
+			}
+		default:
+			err = sft.downloadFile(sessionID, localPath, remotePath, tracker)
+			if err == nil {
+				var info os.FileInfo
+				if info, err = ftpClient.Stat(remotePath); err == nil {
+					err = os.Chtimes(localPath, time.Now(), info.ModTime())
+				}
+			}
+		}
+		if err != nil {
+			return fmt.Errorf("%s %s: %w", action.Action, action.Path, err)
+		}
+	}
+	return nil
+}
+
+// syncActionKey 比较计划时使用的操作标识，不包括大小和原因
+type syncActionKey struct {
+	action string
+	side   string
+	path   string
+	isDir  bool
+}
+
+// checkPlanApproved 检查执行时重新生成的计划是否都在用户确认的计划中。
+// 暂停或失败后继续时已完成的操作不再出现，因此只要求是确认计划的子集；
+// 出现确认计划以外的操作时（例如预览后目标端新增了文件，会被删除）拒绝执行
+func checkPlanApproved(approved, current *DirSyncPlan) error {
+	allowed := make(map[syncActionKey]bool, len(approved.Actions))
+	for _, a := range approved.Actions {
+		allowed[syncActionKey{a.Action, a.Side, a.Path, a.IsDir}] = true
+	}
+	for _, a := range current.Actions {
+		if a.Action == DirSyncActionConflict {
+			continue
+		}
+		if !allowed[syncActionKey{a.Action, a.Side, a.Path, a.IsDir}] {
+			return fmt.Errorf("目录内容在预览后发生变化（%s %s），请重新预览后再同步", a.Action, a.Path)
+		}
+	}
+	return nil
+}
+
+// syncDirectories 执行同步任务：重新比较两端目录，只执行用户确认的计划中仍需执行的操作，
+// 有确认计划以外的操作时不做任何修改。
+// 暂停或失败后继续时，已完成的文件在比较时自动跳过，不使用断点续传，
+// 避免把目标端旧版本的同名文件当作未传完的部分文件
+func (sft *SftpService) syncDirectories(spec transferSpec, tracker *transferTracker) error {
+	opts, approved := spec.options.Sync, spec.options.SyncPlan
+	if opts == nil {
+		return fmt.Errorf("缺少同步选项")
+	}
+	if approved == nil {
+		return fmt.Errorf("缺少已确认的同步计划，请先预览")
+	}
+	ftpClient, err := sft.getSftpClient(spec.sessionID)
+	if err != nil {
+		return err
+	}
+	plan, err := sft.planSync(tracker.ctx, ftpClient, spec.localPath, spec.remotePath, *opts)
+	if err != nil {
+		return err
+	}
+	if err := checkPlanApproved(approved, plan); err != nil {
+		return err
+	}
+	Logger.Info("sync plan", zap.String("id", tracker.id), zap.Int("creates", plan.Creates), zap.Int("updates", plan.Updates),
+		zap.Int("deletes", plan.Deletes), zap.Int("conflicts", plan.Conflicts), zap.Int64("size", plan.TransferSize))
+	tracker.setTotal(plan.TransferSize)
+	tracker.resume = false
+	return sft.applySync(spec.sessionID, ftpClient, plan, tracker)
+}
+
+func localFileSHA256(p string) ([]byte, error) {
+	f, err := os.Open(p)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	return hashSection(f, 0, info.Size())
+}
+
+func remoteFileSHA256(ftpClient *sftp.Client, p string) ([]byte, error) {
+	f, err := ftpClient.Open(p)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	return hashSection(f, 0, info.Size())
+}
+
+// PlanDirSync 比较本地与远程目录，返回同步计划但不做任何修改（试运行）
+func (sft *SftpService) PlanDirSync(sessionID, localDir, remoteDir string, opts DirSyncOptions) (*DirSyncPlan, error) {
+	Logger.Debug("PlanDirSync", zap.String("sessionID", sessionID), zap.String("localDir", localDir),
+		zap.String("remoteDir", remoteDir), zap.Any("opts", opts))
+	ftpClient, err := sft.getSftpClient(sessionID)
+	if err != nil {
+		return nil, err
+	}
+	return sft.planSync(context.Background(), ftpClient, localDir, remoteDir, opts)
+}
+
+// StartDirSync 按 PlanDirSync 返回并经用户确认的计划执行目录同步，加入传输队列并返回传输 ID。
+// 执行时重新比较两端目录，预览后出现计划以外的操作（例如新增的多余文件会被删除）时不执行，
+// 需要重新预览；进度通过 EventProgress 推送
+func (sft *SftpService) StartDirSync(sessionID string, plan DirSyncPlan) (string, error) {
+	Logger.Debug("StartDirSync", zap.String("sessionID", sessionID), zap.String("localDir", plan.LocalDir),
+		zap.String("remoteDir", plan.RemoteDir), zap.Any("opts", plan.Options), zap.Int("actions", len(plan.Actions)))
+	if plan.LocalDir == "" || plan.RemoteDir == "" {
+		return "", fmt.Errorf("同步目录不能为空")
+	}
+	opts := plan.Options
+	if err := validateSyncOptions(opts); err != nil {
+		return "", err
+	}
+	if _, err := sft.getSftpClient(sessionID); err != nil {
+		return "", err
+	}
+	spec := transferSpec{
+		sessionID:    sessionID,
+		transferType: TransferTypeSync,
+		isDir:        true,
+		localPath:    filepath.Clean(plan.LocalDir),
+		remotePath:   path.Clean(plan.RemoteDir),
+		options:      transferOptions{Sync: &opts, SyncPlan: &plan},
+	}
+	return transferQueue.enqueue(spec, 0), nil
+}
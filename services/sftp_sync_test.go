@@ -0,0 +1,88 @@
+package services
+
+import (
+	"testing"
+	"time"
+)
+
+func TestPlanOneWay(t *testing.T) {
+	now := time.Now()
+	file := func(size int64, mod time.Time) *syncEntry { return &syncEntry{size: size, modTime: mod} }
+	dir := &syncEntry{isDir: true}
+	tests := []struct {
+		name      string
+		direction string
+		delete    bool
+		local     *syncEntry
+		remote    *syncEntry
+		want      []DirSyncAction
+	}{
+		{"create file", DirSyncDirectionUpload, false, file(10, now), nil,
+			[]DirSyncAction{{Action: DirSyncActionCreate, Side: DirSyncSideRemote, Path: "a", Size: 10}}},
+		{"create dir", DirSyncDirectionUpload, false, dir, nil,
+			[]DirSyncAction{{Action: DirSyncActionMkdir, Side: DirSyncSideRemote, Path: "a", IsDir: true}}},
+		{"same file", DirSyncDirectionUpload, false, file(10, now), file(10, now.Add(time.Second)), nil},
+		{"size differs", DirSyncDirectionUpload, false, file(10, now), file(11, now),
+			[]DirSyncAction{{Action: DirSyncActionUpdate, Side: DirSyncSideRemote, Path: "a", Size: 10}}},
+		{"mtime differs", DirSyncDirectionUpload, false, file(10, now), file(10, now.Add(-time.Hour)),
+			[]DirSyncAction{{Action: DirSyncActionUpdate, Side: DirSyncSideRemote, Path: "a", Size: 10}}},
+		{"extraneous kept", DirSyncDirectionUpload, false, nil, file(10, now), nil},
+		{"extraneous deleted", DirSyncDirectionUpload, true, nil, dir,
+			[]DirSyncAction{{Action: DirSyncActionDelete, Side: DirSyncSideRemote, Path: "a", IsDir: true}}},
+		{"type differs", DirSyncDirectionUpload, false, file(10, now), dir,
+			[]DirSyncAction{
+				{Action: DirSyncActionDelete, Side: DirSyncSideRemote, Path: "a", IsDir: true},
+				{Action: DirSyncActionCreate, Side: DirSyncSideRemote, Path: "a", Size: 10},
+			}},
+		{"download create", DirSyncDirectionDownload, false, nil, file(5, now),
+			[]DirSyncAction{{Action: DirSyncActionCreate, Side: DirSyncSideLocal, Path: "a", Size: 5}}},
+		{"download delete", DirSyncDirectionDownload, true, file(5, now), nil,
+			[]DirSyncAction{{Action: DirSyncActionDelete, Side: DirSyncSideLocal, Path: "a"}}},
+	}
+	for _, tt := range tests {
+		sp := &syncPlanner{
+			opts: DirSyncOptions{Direction: tt.direction, DeleteExtraneous: tt.delete},
+			plan: &DirSyncPlan{},
+		}
+		if err := sp.planOneWay("a", tt.local, tt.remote); err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if len(sp.plan.Actions) != len(tt.want) {
+			t.Errorf("%s: got %+v, want %+v", tt.name, sp.plan.Actions, tt.want)
+			continue
+		}
+		for i, got := range sp.plan.Actions {
+			got.Reason = ""
+			if got != tt.want[i] {
+				t.Errorf("%s: action %d got %+v, want %+v", tt.name, i, got, tt.want[i])
+			}
+		}
+	}
+}
+
+func TestCheckPlanApproved(t *testing.T) {
+	approved := &DirSyncPlan{Actions: []DirSyncAction{
+		{Action: DirSyncActionMkdir, Side: DirSyncSideRemote, Path: "d", IsDir: true},
+		{Action: DirSyncActionCreate, Side: DirSyncSideRemote, Path: "d/a", Size: 10},
+		{Action: DirSyncActionDelete, Side: DirSyncSideRemote, Path: "old"},
+	}}
+	tests := []struct {
+		name    string
+		actions []DirSyncAction
+		wantErr bool
+	}{
+		{"same plan", approved.Actions, false},
+		{"partially done", approved.Actions[1:2], false},
+		{"size changed", []DirSyncAction{{Action: DirSyncActionCreate, Side: DirSyncSideRemote, Path: "d/a", Size: 20}}, false},
+		{"conflict ignored", []DirSyncAction{{Action: DirSyncActionConflict, Path: "x"}}, false},
+		{"new delete", []DirSyncAction{{Action: DirSyncActionDelete, Side: DirSyncSideRemote, Path: "new"}}, true},
+		{"other side", []DirSyncAction{{Action: DirSyncActionDelete, Side: DirSyncSideLocal, Path: "old"}}, true},
+	}
+	for _, tt := range tests {
+		err := checkPlanApproved(approved, &DirSyncPlan{Actions: tt.actions})
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s: err %v, wantErr %v", tt.name, err, tt.wantErr)
+		}
+	}
+}
@@ -0,0 +1,389 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"strings"
+	"sync"
+
+	"github.com/pkg/sftp"
+	"go.uber.org/zap"
+	"golang.org/x/crypto/ssh"
+)
+
+// 传输后完整性校验：传输时计算本地数据的 SHA-256，完成后与远程计算的结果比对。
+// 远程优先执行 sha256sum，服务器不允许执行命令时使用 check-file SFTP 扩展
+
+const (
+	VerifyStatusPassed      = "passed"      // 全部文件校验一致
+	VerifyStatusFailed      = "failed"      // 存在校验不一致的文件
+	VerifyStatusUnavailable = "unavailable" // 服务器无法计算校验值，部分或全部文件未校验
+)
+
+// verifyBatchSize 每批校验的文件数，一批文件只在远程执行一次命令
+const verifyBatchSize = 64
+
+// transferVerifier 记录一次传输任务中各文件的校验结果。
+// 文件传输完成后先加入等待列表，凑满一批或任务结束时统一计算远程文件的 SHA-256
+type transferVerifier struct {
+	mu          sync.Mutex
+	noExec      bool // 远程没有 sha256sum 等命令或不执行 shell 命令，后续文件不再尝试
+	sessionID   string
+	ftpClient   *sftp.Client
+	pending     []pendingVerify
+	passed      int
+	unavailable int
+	mismatched  []string
+}
+
+// pendingVerify 等待校验的文件和传输时计算的 SHA-256
+type pendingVerify struct {
+	path string
+	sum  []byte
+}
+
+// status 汇总校验结果，没有校验过任何文件时返回空字符串
+func (v *transferVerifier) status() string {
+	if v == nil {
+		return ""
+	}
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	switch {
+	case len(v.mismatched) > 0:
+		return VerifyStatusFailed
+	case v.unavailable > 0:
+		return VerifyStatusUnavailable
+	case v.passed > 0:
+		return VerifyStatusPassed
+	}
+	return ""
+}
+
+// newVerifyHash 创建传输校验使用的哈希，未开启校验时返回 nil。
+// 续传时已存在的部分不经过 progressReader/progressWriter，先从本地文件读取 [0, offset) 计入哈希
+func (t *transferTracker) newVerifyHash(local io.ReaderAt, offset int64) (hash.Hash, error) {
+	if t.verifier == nil {
+		return nil, nil
+	}
+	h := sha256.New()
+	if offset > 0 {
+		if _, err := io.Copy(h, io.NewSectionReader(local, 0, offset)); err != nil {
+			return nil, err
+		}
+	}
+	return h, nil
+}
+
+// verifyRemoteFile 记录需要校验的文件，凑满一批时比对本地计算的 SHA-256 与远程文件的 SHA-256。
+// 服务器无法计算时只记录为未校验，不视为传输失败
+func (sft *SftpService) verifyRemoteFile(sessionID string, ftpClient *sftp.Client, remotePath string, h hash.Hash, tracker *transferTracker) error {
+	if h == nil {
+		return nil
+	}
+	v := tracker.verifier
+	v.mu.Lock()
+	v.sessionID = sessionID
+	if ftpClient != nil {
+		v.ftpClient = ftpClient
+	}
+	v.pending = append(v.pending, pendingVerify{path: remotePath, sum: h.Sum(nil)})
+	full := len(v.pending) >= verifyBatchSize
+	v.mu.Unlock()
+	if !full {
+		return nil
+	}
+	return sft.flushVerify(tracker)
+}
+
+// flushVerify 校验所有等待中的文件，传输任务结束前调用。有不一致的文件时返回错误
+func (sft *SftpService) flushVerify(tracker *transferTracker) error {
+	v := tracker.verifier
+	if v == nil {
+		return nil
+	}
+	v.mu.Lock()
+	batch := v.pending
+	v.pending = nil
+	v.mu.Unlock()
+	if len(batch) == 0 {
+		return nil
+	}
+	paths := make([]string, len(batch))
+	for i, item := range batch {
+		paths[i] = item.path
+	}
+	remoteSums := sft.remoteSHA256Batch(v, paths, tracker)
+	if tracker.ctx.Err() != nil {
+		return errors.New("user cancelled")
+	}
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	var mismatched []string
+	var firstErr error
+	for i, item := range batch {
+		remoteSum := remoteSums[i]
+		switch {
+		case remoteSum == nil:
+			Logger.Info("transfer verify unavailable", zap.String("id", tracker.id), zap.String("file", item.path))
+			v.unavailable++
+		case bytes.Equal(item.sum, remoteSum):
+			v.passed++
+		default:
+			mismatched = append(mismatched, item.path)
+			Logger.Warn("transfer verify mismatch", zap.String("id", tracker.id), zap.String("file", item.path),
+				zap.String("local", hex.EncodeToString(item.sum)), zap.String("remote", hex.EncodeToString(remoteSum)))
+			if firstErr == nil {
+				firstErr = fmt.Errorf("%s 校验失败：本地 SHA-256 %x 与远程 %x 不一致，请重新传输", item.path, item.sum, remoteSum)
+			}
+		}
+	}
+	v.mismatched = append(v.mismatched, mismatched...)
+	if len(mismatched) > 1 {
+		return fmt.Errorf("%w（共 %d 个文件不一致）", firstErr, len(mismatched))
+	}
+	return firstErr
+}
+
+// remoteSHA256Batch 计算一批远程文件的 SHA-256，无法计算的文件对应位置为 nil。
+// 优先执行 sha256sum，远程没有该命令时改用 check-file SFTP 扩展，单个文件读取失败不影响后续批次
+func (sft *SftpService) remoteSHA256Batch(v *transferVerifier, paths []string, tracker *transferTracker) [][]byte {
+	sums := make([][]byte, len(paths))
+	v.mu.Lock()
+	sessionID, ftpClient, noExec := v.sessionID, v.ftpClient, v.noExec
+	v.mu.Unlock()
+	client, err := sft.getSSHClient(sessionID)
+	if err != nil {
+		Logger.Debug("transfer verify exec unavailable", zap.String("id", tracker.id), zap.Error(err))
+		return sums
+	}
+	if !noExec {
+		result, err := execSHA256Batch(tracker.ctx, client, paths)
+		switch {
+		case err == nil:
+			sums = result
+		case tracker.ctx.Err() != nil:
+			return sums
+		case errors.Is(err, errSHA256Unavailable):
+			Logger.Debug("remote sha256sum unavailable", zap.String("id", tracker.id), zap.Error(err))
+			v.mu.Lock()
+			v.noExec = true
+			v.mu.Unlock()
+		default:
+			Logger.Debug("remote sha256sum failed", zap.String("id", tracker.id), zap.Error(err))
+		}
+	}
+
+	var missing []int
+	for i, sum := range sums {
+		if sum == nil {
+			missing = append(missing, i)
+		}
+	}
+	if len(missing) == 0 || ftpClient == nil {
+		return sums
+	}
+	if _, ok := ftpClient.HasExtension("check-file-name"); !ok {
+		return sums
+	}
+	missingPaths := make([]string, len(missing))
+	for i, idx := range missing {
+		missingPaths[i] = paths[idx]
+	}
+	checked, err := checkFileSHA256Batch(client, missingPaths)
+	if err != nil {
+		Logger.Debug("remote check-file failed", zap.String("id", tracker.id), zap.Error(err))
+	}
+	for i, sum := range checked {
+		sums[missing[i]] = sum
+	}
+	return sums
+}
+
+// errSHA256Unavailable 远程没有可用的 SHA-256 命令，或者不按 shell 执行命令（只允许 SFTP 的服务器）
+var errSHA256Unavailable = errors.New("远程无法执行 sha256sum")
+
+// sha256BatchCommand 构造计算多个文件 SHA-256 的命令，兼容 macOS/BSD 的 shasum 和 sha256。
+// 每个文件输出一行哈希，读取失败的文件输出 -；没有可用的命令时退出码为 127
+func sha256BatchCommand(paths []string) string {
+	quoted := make([]string, len(paths))
+	for i, p := range paths {
+		quoted[i] = shellQuote(p)
+	}
+	return "if command -v sha256sum >/dev/null 2>&1; then h='sha256sum -b --'; " +
+		"elif command -v shasum >/dev/null 2>&1; then h='shasum -a 256 -b --'; " +
+		"elif command -v sha256 >/dev/null 2>&1; then h='sha256 -q --'; else exit 127; fi; " +
+		"for f in " + strings.Join(quoted, " ") + "; do " +
+		`s=$($h "$f" 2>/dev/null) && printf '%s\n' "${s%% *}" || echo -; done`
+}
+
+// execSHA256Batch 在一个 exec 通道上计算多个远程文件的 SHA-256
+func execSHA256Batch(ctx context.Context, client *ssh.Client, paths []string) ([][]byte, error) {
+	out, err := runRemoteOutput(ctx, client, sha256BatchCommand(paths))
+	var exitErr *ssh.ExitError
+	if errors.As(err, &exitErr) && exitErr.ExitStatus() == 127 {
+		return nil, errSHA256Unavailable
+	}
+	if err != nil {
+		return nil, err
+	}
+	sums, ok := parseSHA256Lines(string(out), len(paths))
+	if !ok {
+		return nil, errSHA256Unavailable
+	}
+	return sums, nil
+}
+
+// parseSHA256Lines 解析 sha256BatchCommand 的输出，行数与文件数不一致时返回 false。
+// 文件名包含特殊字符时 sha256sum 在哈希前加 \，无法解析的行对应位置为 nil
+func parseSHA256Lines(out string, n int) ([][]byte, bool) {
+	lines := strings.Split(strings.TrimSuffix(out, "\n"), "\n")
+	if out == "" || len(lines) != n {
+		return nil, false
+	}
+	sums := make([][]byte, n)
+	for i, line := range lines {
+		sum, err := hex.DecodeString(strings.TrimPrefix(strings.TrimSpace(line), `\`))
+		if err == nil && len(sum) == sha256.Size {
+			sums[i] = sum
+		}
+	}
+	return sums, true
+}
+
+// SFTP 协议包类型，见 draft-ietf-secsh-filexfer
+const (
+	sshFxpInit          = 1
+	sshFxpVersion       = 2
+	sshFxpStatus        = 101
+	sshFxpExtended      = 200
+	sshFxpExtendedReply = 201
+
+	sftpMaxPacket = 256 * 1024
+)
+
+// checkFileSHA256Batch 通过 check-file-name 扩展计算多个远程文件的 SHA-256，服务器拒绝的文件对应位置为 nil。
+// pkg/sftp 不支持发送自定义扩展请求，这里在一个新的 sftp 子系统通道上依次收发协议包
+func checkFileSHA256Batch(client *ssh.Client, paths []string) ([][]byte, error) {
+	session, err := client.NewSession()
+	if err != nil {
+		return nil, err
+	}
+	defer session.Close()
+	w, err := session.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	r, err := session.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := session.RequestSubsystem("sftp"); err != nil {
+		return nil, err
+	}
+
+	if err := writeSftpPacket(w, sshFxpInit, binary.BigEndian.AppendUint32(nil, 3)); err != nil {
+		return nil, err
+	}
+	if typ, _, err := readSftpPacket(r); err != nil {
+		return nil, err
+	} else if typ != sshFxpVersion {
+		return nil, fmt.Errorf("unexpected sftp packet %d", typ)
+	}
+
+	sums := make([][]byte, len(paths))
+	for i, remotePath := range paths {
+		// uint32 id, string "check-file-name", string path, string 算法列表, uint64 起始偏移, uint64 长度（0 表示到文件末尾）, uint32 块大小（0 表示整个文件）
+		requestID := uint32(i + 1)
+		payload := binary.BigEndian.AppendUint32(nil, requestID)
+		payload = appendSftpString(payload, "check-file-name")
+		payload = appendSftpString(payload, remotePath)
+		payload = appendSftpString(payload, "sha256")
+		payload = binary.BigEndian.AppendUint64(payload, 0)
+		payload = binary.BigEndian.AppendUint64(payload, 0)
+		payload = binary.BigEndian.AppendUint32(payload, 0)
+		if err := writeSftpPacket(w, sshFxpExtended, payload); err != nil {
+			return sums, err
+		}
+		typ, data, err := readSftpPacket(r)
+		if err != nil {
+			return sums, err
+		}
+		switch typ {
+		case sshFxpExtendedReply:
+			if sum, err := parseCheckFileReply(data, requestID); err == nil {
+				sums[i] = sum
+			} else {
+				Logger.Debug("parse check-file reply failed", zap.String("file", remotePath), zap.Error(err))
+			}
+		case sshFxpStatus:
+			Logger.Debug("server rejected check-file request", zap.String("file", remotePath))
+		default:
+			return sums, fmt.Errorf("unexpected sftp packet %d", typ)
+		}
+	}
+	return sums, nil
+}
+
+// parseCheckFileReply 解析 check-file 回复：uint32 id, [string "check-file"], string 算法, byte[] 哈希
+func parseCheckFileReply(data []byte, requestID uint32) ([]byte, error) {
+	if len(data) < 4 || binary.BigEndian.Uint32(data) != requestID {
+		return nil, errors.New("invalid check-file reply")
+	}
+	algo, rest, ok := readSftpString(data[4:])
+	// 规范中回复以 "check-file" 开头，部分实现省略
+	if ok && algo == "check-file" {
+		algo, rest, ok = readSftpString(rest)
+	}
+	if !ok || algo != "sha256" || len(rest) != sha256.Size {
+		return nil, fmt.Errorf("不支持的 check-file 回复: %s", algo)
+	}
+	return rest, nil
+}
+
+func appendSftpString(b []byte, s string) []byte {
+	b = binary.BigEndian.AppendUint32(b, uint32(len(s)))
+	return append(b, s...)
+}
+
+func readSftpString(b []byte) (string, []byte, bool) {
+	if len(b) < 4 {
+		return "", nil, false
+	}
+	n := binary.BigEndian.Uint32(b)
+	if uint32(len(b)-4) < n {
+		return "", nil, false
+	}
+	return string(b[4 : 4+n]), b[4+n:], true
+}
+
+func writeSftpPacket(w io.Writer, typ byte, payload []byte) error {
+	packet := binary.BigEndian.AppendUint32(nil, uint32(len(payload)+1))
+	packet = append(packet, typ)
+	_, err := w.Write(append(packet, payload...))
+	return err
+}
+
+func readSftpPacket(r io.Reader) (byte, []byte, error) {
+	var header [4]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return 0, nil, err
+	}
+	n := binary.BigEndian.Uint32(header[:])
+	if n == 0 || n > sftpMaxPacket {
+		return 0, nil, fmt.Errorf("invalid sftp packet length %d", n)
+	}
+	data := make([]byte, n)
+	if _, err := io.ReadFull(r, data); err != nil {
+		return 0, nil, err
+	}
+	return data[0], data[1:], nil
+}
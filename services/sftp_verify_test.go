@@ -0,0 +1,71 @@
+package services
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"strings"
+	"testing"
+)
+
+func TestParseCheckFileReply(t *testing.T) {
+	sum := sha256.Sum256([]byte("hello"))
+	reply := func(id uint32, parts ...string) []byte {
+		b := binary.BigEndian.AppendUint32(nil, id)
+		for _, p := range parts {
+			b = appendSftpString(b, p)
+		}
+		return b
+	}
+	tests := []struct {
+		name string
+		data []byte
+		ok   bool
+	}{
+		{"with prefix", append(reply(7, "check-file", "sha256"), sum[:]...), true},
+		{"without prefix", append(reply(7, "sha256"), sum[:]...), true},
+		{"wrong id", append(reply(8, "sha256"), sum[:]...), false},
+		{"wrong algorithm", append(reply(7, "md5"), sum[:16]...), false},
+		{"short hash", append(reply(7, "sha256"), sum[:31]...), false},
+		{"truncated", []byte{0, 0}, false},
+	}
+	for _, tt := range tests {
+		got, err := parseCheckFileReply(tt.data, 7)
+		if tt.ok {
+			if err != nil || !bytes.Equal(got, sum[:]) {
+				t.Errorf("%s: got %x, %v", tt.name, got, err)
+			}
+		} else if err == nil {
+			t.Errorf("%s: expected error", tt.name)
+		}
+	}
+}
+
+func TestParseSHA256Lines(t *testing.T) {
+	a := sha256.Sum256([]byte("a"))
+	b := sha256.Sum256([]byte("b"))
+	out := hex.EncodeToString(a[:]) + "\n-\n\\" + hex.EncodeToString(b[:]) + "\n"
+	sums, ok := parseSHA256Lines(out, 3)
+	if !ok {
+		t.Fatalf("parseSHA256Lines: expected ok")
+	}
+	if !bytes.Equal(sums[0], a[:]) || sums[1] != nil || !bytes.Equal(sums[2], b[:]) {
+		t.Errorf("sums: got %x", sums)
+	}
+	if _, ok := parseSHA256Lines(out, 2); ok {
+		t.Errorf("line count mismatch: expected not ok")
+	}
+	if _, ok := parseSHA256Lines("", 1); ok {
+		t.Errorf("empty output: expected not ok")
+	}
+}
+
+func TestSHA256BatchCommand(t *testing.T) {
+	cmd := sha256BatchCommand([]string{"/tmp/a b", "/tmp/it's"})
+	for _, want := range []string{"'/tmp/a b'", `'/tmp/it'\''s'`, "exit 127"} {
+		if !strings.Contains(cmd, want) {
+			t.Errorf("command missing %q: %s", want, cmd)
+		}
+	}
+}
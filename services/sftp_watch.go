@@ -0,0 +1,337 @@
+package services
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ilaziness/vexo/internal/system"
+	"github.com/ilaziness/vexo/internal/utils"
+	"github.com/wailsapp/wails/v3/pkg/application"
+	"go.uber.org/zap"
+)
+
+// 远程目录监视：远程主机有 inotifywait 时由它通知目录变化，否则按间隔轮询。
+// 每次变化后重新读取目录并与上一次的内容比较，新增、删除和修改的条目通过 EventDirWatch 推送。
+// SFTP 的修改时间只精确到秒，inotify 模式下事件中出现的文件即使大小和时间不变也视为修改；
+// 轮询模式下同一秒内大小不变的修改无法发现
+
+const (
+	EventDirWatch = "eventDirWatch"
+
+	WatchModeInotify = "inotify"
+	WatchModePoll    = "poll"
+
+	watchDefaultInterval = 5 * time.Second
+	watchMinInterval     = time.Second
+	watchMaxInterval     = time.Hour
+	watchDebounce        = 300 * time.Millisecond // 合并短时间内连续的 inotify 事件
+	watchMinRelist       = 2 * time.Second        // inotify 模式下两次读取目录的最小间隔，避免频繁变化的目录反复读取
+	watchMaxBackoff      = time.Minute            // 读取目录失败后重试的最长间隔
+	watchProbeTimeout    = 10 * time.Second
+	inotifyEvents        = "create,delete,modify,attrib,close_write,moved_to,moved_from,delete_self,move_self"
+)
+
+func init() {
+	application.RegisterEvent[DirWatchEvent](EventDirWatch)
+}
+
+var dirWatches = new(sync.Map) // map[watchID]*dirWatch
+
+// DirWatchEvent 监视的目录发生变化，Done 为 true 表示监视已停止
+type DirWatchEvent struct {
+	WatchID   string     `json:"watchID"`
+	SessionID string     `json:"sessionID"`
+	Path      string     `json:"path"`
+	Mode      string     `json:"mode"` // inotify/poll
+	Added     []FileInfo `json:"added"`
+	Removed   []string   `json:"removed"` // 被删除的名称
+	Modified  []FileInfo `json:"modified"`
+	Done      bool       `json:"done"`
+	Error     string     `json:"error"` // Done 为 false 时表示读取失败，之后会自动重试
+}
+
+// dirWatch 一个正在监视的目录
+type dirWatch struct {
+	id        string
+	sessionID string
+	path      string
+	interval  time.Duration
+	mode      string
+	snapshot  map[string]FileInfo // 上一次读取的目录内容，以名称为键
+	cancel    context.CancelFunc
+
+	mu      sync.Mutex
+	touched map[string]bool // 上一次读取之后 inotify 事件涉及的名称
+}
+
+// touch 记录 inotify 事件涉及的名称
+func (watch *dirWatch) touch(name string) {
+	watch.mu.Lock()
+	defer watch.mu.Unlock()
+	if watch.touched == nil {
+		watch.touched = make(map[string]bool)
+	}
+	watch.touched[name] = true
+}
+
+// takeTouched 取出并清空记录的名称
+func (watch *dirWatch) takeTouched() map[string]bool {
+	watch.mu.Lock()
+	defer watch.mu.Unlock()
+	touched := watch.touched
+	watch.touched = nil
+	return touched
+}
+
+// watchInterval 返回轮询间隔，seconds 为 0 时使用配置的间隔
+func watchInterval(seconds int) (time.Duration, error) {
+	if seconds < 0 {
+		return 0, fmt.Errorf("轮询间隔不能为负数")
+	}
+	if seconds == 0 && ConfigSvc != nil && ConfigSvc.Config != nil {
+		seconds = ConfigSvc.Config.Transfer.WatchInterval
+	}
+	if seconds == 0 {
+		return watchDefaultInterval, nil
+	}
+	return min(max(time.Duration(seconds)*time.Second, watchMinInterval), watchMaxInterval), nil
+}
+
+// WatchDirectory 监视远程目录，目录内容变化时通过 EventDirWatch 推送新增、删除和修改的条目。
+// intervalSeconds 为轮询间隔，0 表示使用配置的间隔，远程主机有 inotifywait 时不轮询。
+// 返回监视 ID，用 StopWatchDirectory 停止，会话关闭或目录被删除时自动停止
+func (sft *SftpService) WatchDirectory(sessionID string, dir string, intervalSeconds int) (string, error) {
+	Logger.Debug("WatchDirectory", zap.String("sessionID", sessionID), zap.String("path", dir), zap.Int("interval", intervalSeconds))
+	interval, err := watchInterval(intervalSeconds)
+	if err != nil {
+		return "", err
+	}
+	if dir == "" {
+		return "", fmt.Errorf("路径不能为空")
+	}
+	dir = path.Clean(dir)
+	infos, err := sft.readDirInfos(sessionID, dir)
+	if err != nil {
+		return "", err
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	watch := &dirWatch{
+		id:        utils.GenerateRandomID(),
+		sessionID: sessionID,
+		path:      dir,
+		interval:  interval,
+		mode:      WatchModePoll,
+		snapshot:  watchSnapshot(infos),
+		cancel:    cancel,
+	}
+	dirWatches.Store(watch.id, watch)
+	system.SafeGo(func() {
+		sft.runWatch(ctx, watch)
+	})
+	return watch.id, nil
+}
+
+// StopWatchDirectory 停止监视目录
+func (sft *SftpService) StopWatchDirectory(watchID string) error {
+	value, ok := dirWatches.Load(watchID)
+	if !ok {
+		return fmt.Errorf("watch with ID %s not found", watchID)
+	}
+	value.(*dirWatch).cancel()
+	return nil
+}
+
+func watchSnapshot(infos []FileInfo) map[string]FileInfo {
+	snapshot := make(map[string]FileInfo, len(infos))
+	for _, info := range infos {
+		snapshot[info.Name] = info
+	}
+	return snapshot
+}
+
+func (sft *SftpService) runWatch(ctx context.Context, watch *dirWatch) {
+	defer dirWatches.Delete(watch.id)
+	var tick <-chan time.Time
+	var debounce <-chan time.Time
+	notify := sft.startInotify(ctx, watch)
+	if notify != nil {
+		watch.mode = WatchModeInotify
+		// 读取初始内容到 inotifywait 开始监视之间的变化
+		debounce = time.After(watchDebounce)
+	} else {
+		ticker := time.NewTicker(watch.interval)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+	Logger.Debug("watch directory started", zap.String("path", watch.path), zap.String("mode", watch.mode))
+
+	var retry <-chan time.Time
+	var lastPoll time.Time
+	failures := 0
+	for {
+		select {
+		case <-ctx.Done():
+			watch.emit(DirWatchEvent{Done: true})
+			return
+		case _, ok := <-notify:
+			if !ok {
+				// inotifywait 退出（例如权限不足或监视数达到上限），改为轮询
+				Logger.Debug("inotifywait exited, fallback to polling", zap.String("path", watch.path))
+				notify = nil
+				watch.mode = WatchModePoll
+				ticker := time.NewTicker(watch.interval)
+				defer ticker.Stop()
+				tick = ticker.C
+				debounce = time.After(watchDebounce)
+			} else if debounce == nil && retry == nil {
+				debounce = time.After(max(watchDebounce, watchMinRelist-time.Since(lastPoll)))
+			}
+			continue
+		case <-debounce:
+			debounce = nil
+			if retry != nil {
+				continue
+			}
+		case <-retry:
+			retry = nil
+		case <-tick:
+			if retry != nil {
+				continue
+			}
+		}
+		lastPoll = time.Now()
+		err := sft.pollWatch(watch)
+		if err == nil {
+			failures = 0
+			continue
+		}
+		// 目录被删除或没有权限时停止，其他错误（例如网络中断）按指数退避重试，会话关闭时由 stopDirWatchesBySession 停止
+		if errors.Is(err, os.ErrNotExist) || errors.Is(err, os.ErrPermission) {
+			Logger.Debug("watch directory stopped", zap.String("path", watch.path), zap.Error(err))
+			watch.emit(DirWatchEvent{Done: true, Error: err.Error()})
+			return
+		}
+		failures++
+		delay := min(time.Second<<min(failures-1, 6), watchMaxBackoff)
+		Logger.Debug("watch directory read failed, retry later", zap.String("path", watch.path), zap.Duration("delay", delay), zap.Error(err))
+		if failures == 1 {
+			watch.emit(DirWatchEvent{Error: err.Error()})
+		}
+		retry = time.After(delay)
+	}
+}
+
+// startInotify 在远程主机上启动 inotifywait，每输出一个事件向返回的通道发送一次通知，
+// inotifywait 退出时关闭通道；远程主机没有 inotifywait 时返回 nil
+func (sft *SftpService) startInotify(ctx context.Context, watch *dirWatch) <-chan struct{} {
+	client, err := sft.getSSHClient(watch.sessionID)
+	if err != nil {
+		return nil
+	}
+	probeCtx, cancel := context.WithTimeout(ctx, watchProbeTimeout)
+	defer cancel()
+	if _, err := runRemoteOutput(probeCtx, client, "command -v inotifywait"); err != nil {
+		return nil
+	}
+	command := "exec inotifywait -m -q -e " + inotifyEvents + " --format %f -- " + shellQuote(watch.path)
+	rc, err := startRemoteCommand(ctx, client, command)
+	if err != nil {
+		Logger.Debug("start inotifywait failed", zap.String("path", watch.path), zap.Error(err))
+		return nil
+	}
+	notify := make(chan struct{}, 1)
+	system.SafeGo(func() {
+		defer close(notify)
+		scanner := bufio.NewScanner(rc.Stdout)
+		for scanner.Scan() {
+			// 每行是事件涉及的名称，目录自身的事件为空行
+			if name := scanner.Text(); name != "" {
+				watch.touch(name)
+			}
+			select {
+			case notify <- struct{}{}:
+			default:
+			}
+		}
+		if err := rc.Wait(); err != nil && ctx.Err() == nil {
+			Logger.Debug("inotifywait failed", zap.String("path", watch.path), zap.Error(err))
+		}
+	})
+	return notify
+}
+
+// pollWatch 重新读取目录，与上一次的内容比较并推送变化
+func (sft *SftpService) pollWatch(watch *dirWatch) error {
+	touched := watch.takeTouched()
+	infos, err := sft.readDirInfos(watch.sessionID, watch.path)
+	if err != nil {
+		for name := range touched {
+			watch.touch(name)
+		}
+		return err
+	}
+	current := watchSnapshot(infos)
+	event := diffWatchSnapshot(watch.snapshot, current, touched)
+	watch.snapshot = current
+	if len(event.Added) == 0 && len(event.Removed) == 0 && len(event.Modified) == 0 {
+		return nil
+	}
+	invalidateListings(watch.sessionID, watch.path)
+	watch.emit(event)
+	return nil
+}
+
+// diffWatchSnapshot 比较两次读取的目录内容，touched 中的名称即使属性不变也视为修改
+func diffWatchSnapshot(previous, current map[string]FileInfo, touched map[string]bool) DirWatchEvent {
+	var event DirWatchEvent
+	for name, info := range current {
+		old, ok := previous[name]
+		switch {
+		case !ok:
+			event.Added = append(event.Added, info)
+		case old != info || touched[name]:
+			event.Modified = append(event.Modified, info)
+		}
+	}
+	for name := range previous {
+		if _, ok := current[name]; !ok {
+			event.Removed = append(event.Removed, name)
+		}
+	}
+	sortByName := func(a, b FileInfo) int { return strings.Compare(a.Name, b.Name) }
+	slices.SortFunc(event.Added, sortByName)
+	slices.SortFunc(event.Modified, sortByName)
+	sort.Strings(event.Removed)
+	return event
+}
+
+func (watch *dirWatch) emit(event DirWatchEvent) {
+	if app == nil {
+		return
+	}
+	event.WatchID = watch.id
+	event.SessionID = watch.sessionID
+	event.Path = watch.path
+	event.Mode = watch.mode
+	app.Event.Emit(EventDirWatch, event)
+}
+
+// stopDirWatchesBySession 会话关闭时停止该会话的所有目录监视
+func stopDirWatchesBySession(sessionID string) {
+	dirWatches.Range(func(_, value any) bool {
+		watch := value.(*dirWatch)
+		if watch.sessionID == sessionID {
+			watch.cancel()
+		}
+		return true
+	})
+}
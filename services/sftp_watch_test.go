@@ -0,0 +1,69 @@
+package services
+
+import (
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestDiffWatchSnapshot(t *testing.T) {
+	file := func(name string, size int64) FileInfo {
+		return FileInfo{Name: name, Size: size, ModTime: "2024-03-09T08:05:00Z"}
+	}
+	previous := watchSnapshot([]FileInfo{file("keep", 1), file("grow", 1), file("same-second", 1), file("gone", 1)})
+	current := watchSnapshot([]FileInfo{file("keep", 1), file("grow", 2), file("same-second", 1), file("new", 1)})
+
+	event := diffWatchSnapshot(previous, current, map[string]bool{"same-second": true, "new": true})
+	names := func(infos []FileInfo) []string {
+		var out []string
+		for _, info := range infos {
+			out = append(out, info.Name)
+		}
+		return out
+	}
+	if got := names(event.Added); !slices.Equal(got, []string{"new"}) {
+		t.Errorf("added: got %q", got)
+	}
+	if got := names(event.Modified); !slices.Equal(got, []string{"grow", "same-second"}) {
+		t.Errorf("modified: got %q", got)
+	}
+	if !slices.Equal(event.Removed, []string{"gone"}) {
+		t.Errorf("removed: got %q", event.Removed)
+	}
+
+	event = diffWatchSnapshot(current, current, nil)
+	if len(event.Added)+len(event.Modified)+len(event.Removed) != 0 {
+		t.Errorf("unchanged: got %+v", event)
+	}
+}
+
+func TestDirWatchTouched(t *testing.T) {
+	watch := &dirWatch{}
+	watch.touch("a")
+	watch.touch("b")
+	if got := watch.takeTouched(); len(got) != 2 || !got["a"] || !got["b"] {
+		t.Errorf("touched: got %v", got)
+	}
+	if got := watch.takeTouched(); len(got) != 0 {
+		t.Errorf("after take: got %v", got)
+	}
+}
+
+func TestWatchInterval(t *testing.T) {
+	tests := []struct {
+		seconds int
+		want    time.Duration
+	}{
+		{0, watchDefaultInterval},
+		{3, 3 * time.Second},
+		{100000, watchMaxInterval},
+	}
+	for _, tt := range tests {
+		if got, err := watchInterval(tt.seconds); err != nil || got != tt.want {
+			t.Errorf("watchInterval(%d): got %v, %v", tt.seconds, got, err)
+		}
+	}
+	if _, err := watchInterval(-1); err == nil {
+		t.Errorf("negative interval: expected error")
+	}
+}
@@ -8,6 +8,7 @@ import (
 	"net"
 	"os"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/ilaziness/vexo/internal/system"
@@ -22,11 +23,18 @@ const (
 type SSHConnect struct {
 	ID             string
 	clientKey      string
+	host           string // 连接的主机，经跳板机连接时为跳板机之后的目标主机
+	port           int
+	proxyJumpID    string // 经跳板机连接时跳板机书签的 ID
+	bookmarkID     string // 通过书签连接时的书签 ID
+	headless       bool   // 仅用于隧道的连接，没有终端
+	headlessDone   chan struct{}
+	createdAt      time.Time
 	client         *ssh.Client
 	sshService     *SSHService
 	session        *ssh.Session
 	sftpService    *SftpService
-	isClosed       bool
+	isClosed       atomic.Bool // 保证 Close 只执行一次，headlessDone 只被关闭一次
 	outputChan     chan []byte
 	outputBuffSize int
 	outputWg       sync.WaitGroup // 等待输出 goroutine 结束
@@ -205,6 +213,11 @@ func (s *SSHService) dialSSHWithDepth(host string, port int, user, password, key
 // Connect establishes an SSH connection to the specified host using the provided credentials.
 // return session ID if success
 func (s *SSHService) Connect(host string, port int, user, password, key, keyPassword, proxyJumpID string) (ID string, err error) {
+	return s.connect(host, port, user, password, key, keyPassword, proxyJumpID, nil)
+}
+
+// connect 建立连接，setup 在连接存入 SSHConnects（对其他 goroutine 可见）之前设置连接的字段
+func (s *SSHService) connect(host string, port int, user, password, key, keyPassword, proxyJumpID string, setup func(*SSHConnect)) (ID string, err error) {
 	Logger.Debug("Connecting to SSH server", zap.String("host", host), zap.Int("port", port))
 
 	var client *ssh.Client
@@ -227,6 +240,10 @@ func (s *SSHService) Connect(host string, port int, user, password, key, keyPass
 		Logger.Debug("ssh connect ok and stored in cache", zap.String("clientKey", clientKey))
 	}
 	connect := NewSSHConnect(s, clientKey, client)
+	connect.host, connect.port, connect.proxyJumpID = host, port, proxyJumpID
+	if setup != nil {
+		setup(connect)
+	}
 	s.SSHConnects.Store(connect.ID, connect)
 	Logger.Debug("set connect done")
 	return connect.ID, nil
@@ -276,8 +293,14 @@ func (s *SSHService) StartSftp(ID string) error {
 	sftpService := NewSftpService()
 	err := sftpService.Connect(conn.client)
 	if err != nil {
-		return err
+		// 没有 SFTP 子系统的服务器回退到 scp 传输
+		if scpErr := sftpService.connectSCP(conn.client); scpErr != nil {
+			Logger.Warn("SCP fallback unavailable", zap.String("id", ID), zap.Error(scpErr))
+			return err
+		}
+		Logger.Info("SFTP unavailable, using SCP fallback", zap.String("id", ID), zap.Error(err))
 	}
+	sftpService.sshConnect = conn
 	conn.sftpService = sftpService
 	sftpClient.Store(ID, sftpService)
 	Logger.Debug("SFTP service started successfully", zap.String("id", ID))
@@ -357,6 +380,10 @@ func (s *SSHService) GetActiveSessions() []map[string]any {
 	sessions := make([]map[string]any, 0)
 	s.SSHConnects.Range(func(key, value any) bool {
 		conn := value.(*SSHConnect)
+		// 隧道连接没有终端，不能接收命令
+		if conn.headless {
+			return true
+		}
 		sessions = append(sessions, map[string]any{
 			"id":        conn.ID,
 			"clientKey": conn.clientKey,
@@ -398,6 +425,7 @@ func NewSSHConnect(sshService *SSHService, clientKey string, client *ssh.Client)
 		clientKey:      clientKey,
 		client:         client,
 		ID:             generateConnectID(),
+		createdAt:      time.Now(),
 		outputChan:     make(chan []byte, 200),
 		outputBuffSize: 1024 * 10, // 10KB
 	}
@@ -507,14 +535,25 @@ func (sc *SSHConnect) startInput() error {
 // Close terminates the SSH connection and session.
 func (sc *SSHConnect) Close() error {
 	Logger.Debug("Closing SSH connection", zap.String("ID", sc.ID))
-	if sc.isClosed {
+	if !sc.isClosed.CompareAndSwap(false, true) {
 		return nil
 	}
-	sc.isClosed = true
+	if sc.headlessDone != nil {
+		close(sc.headlessDone)
+	}
 
 	// Close SSH tunnels (all types) for this session if exists
 	sshTunnelService.StopAllBySession(sc.ID)
 
+	// 结束该会话的远程文件编辑，上传未上传的修改并清理临时文件
+	closeRemoteEditsBySession(sc.ID, sc.sftpService)
+	stopFileFollowsBySession(sc.ID)
+	cancelSearchesBySession(sc.ID)
+	stopDirWatchesBySession(sc.ID)
+	remoteIDNamesCache.Delete(sc.ID)
+	dirListings.Delete(sc.ID)
+	sessionRateLimiters.Delete(sc.ID)
+
 	// Close SFTP service if exists
 	if sc.sftpService != nil {
 		sc.sftpService.Close()
@@ -4,13 +4,14 @@ import (
 	"context"
 	"errors"
 	"fmt"
-	"io"
 	"log"
 	"net"
 	"os"
+	"strconv"
 	"sync"
 	"time"
 
+	"github.com/ilaziness/vexo/internal/database"
 	"github.com/ilaziness/vexo/internal/system"
 	"github.com/ilaziness/vexo/internal/utils"
 	"github.com/things-go/go-socks5"
@@ -20,9 +21,10 @@ import (
 // ssh tunnel
 
 const (
-	tunnelTypeLocal   = "local"
-	tunnelTypeRemote  = "remote"
-	tunnelTypeDynamic = "dynamic"
+	tunnelTypeLocal         = "local"
+	tunnelTypeRemote        = "remote"
+	tunnelTypeDynamic       = "dynamic"
+	tunnelTypeRemoteDynamic = "remoteDynamic"
 )
 
 var (
@@ -37,15 +39,30 @@ type TunnelList struct {
 	Tunnels    []TunnelInfo `json:"tunnels"`
 }
 type TunnelInfo struct {
-	ID         string `json:"id"`
-	TunnelType string `json:"tunnelType"`
-	SessionID  string `json:"sessionID"`
-	LocalAddr  string `json:"localAddr"`
-	RemoteAddr string `json:"remoteAddr"`
+	ID           string `json:"id"`
+	TunnelType   string `json:"tunnelType"`
+	SessionID    string `json:"sessionID"`
+	LocalAddr    string `json:"localAddr"`
+	RemoteAddr   string `json:"remoteAddr"`
+	SavedID      string `json:"savedID"` // 来源的书签隧道定义 ID，临时隧道为空
+	Name         string `json:"name"`
+	BytesIn      int64  `json:"bytesIn"`  // 转发目标返回的字节数
+	BytesOut     int64  `json:"bytesOut"` // 发往转发目标的字节数
+	TotalConns   int64  `json:"totalConns"`
+	ActiveConns  int64  `json:"activeConns"`
+	DialFailures int64  `json:"dialFailures"`
+	LastActive   int64  `json:"lastActive"` // 最后活动时间，unix 毫秒，0 表示从未使用
 }
 
 type SSHTunnelService struct {
 	sshService *SSHService
+	db         *database.Database
+}
+
+// tunnelMeta 隧道附加信息，由保存的隧道定义启动时填充
+type tunnelMeta struct {
+	savedID string
+	name    string
 }
 
 type SSHTunnel struct {
@@ -54,20 +71,28 @@ type SSHTunnel struct {
 	sessionID  string
 	LocalAddr  string // 本地监听地址，格式: ip:port
 	RemoteAddr string // 远程地址，格式: ip:port
+	meta       tunnelMeta
 
 	listener net.Listener
 	exitCh   chan struct{}
 	wg       sync.WaitGroup
+	stats    tunnelStats
+	connLock sync.Mutex
+	conns    map[string]*tunnelConn // 活跃转发连接，key 是连接ID
 	// For dynamic tunnels
-	connLock    sync.Mutex
-	activeConns map[net.Conn]struct{}
 	socksServer *socks5.Server
+	policy      *proxyPolicy    // 认证与访问控制，未配置时为 nil
+	proxyDial   dialContextFunc // 代理出站拨号，带超时和失败统计
 }
 
-func NewSSHTunnelService(sshService *SSHService) *SSHTunnelService {
+type dialContextFunc func(ctx context.Context, network, address string) (net.Conn, error)
+
+func NewSSHTunnelService(sshService *SSHService, db *database.Database) *SSHTunnelService {
 	sshTunnelService = &SSHTunnelService{
 		sshService: sshService,
+		db:         db,
 	}
+	system.SafeGo(sshTunnelService.statsLoop)
 	return sshTunnelService
 }
 
@@ -78,14 +103,7 @@ func (t *SSHTunnelService) TunnelList() []TunnelList {
 	sshTunnels.Range(func(key, value any) bool {
 		tunnel, ok := value.(*SSHTunnel)
 		if ok {
-			tunnelInfo := TunnelInfo{
-				ID:         tunnel.ID,
-				TunnelType: tunnel.tunnelType,
-				SessionID:  tunnel.sessionID,
-				LocalAddr:  tunnel.LocalAddr,
-				RemoteAddr: tunnel.RemoteAddr,
-			}
-			tunnelsByType[tunnel.tunnelType] = append(tunnelsByType[tunnel.tunnelType], tunnelInfo)
+			tunnelsByType[tunnel.tunnelType] = append(tunnelsByType[tunnel.tunnelType], tunnel.info())
 		}
 		return true
 	})
@@ -106,6 +124,10 @@ func (t *SSHTunnelService) TunnelList() []TunnelList {
 // localAddr 格式: ip:port，例如 127.0.0.1:8080
 // remoteAddr 格式: host:port，例如 127.0.0.1:3306 或 example.com:443
 func (t *SSHTunnelService) StartLocal(sessionID string, localAddr string, remoteAddr string) (string, error) {
+	return t.startLocal(sessionID, localAddr, remoteAddr, tunnelMeta{})
+}
+
+func (t *SSHTunnelService) startLocal(sessionID string, localAddr string, remoteAddr string, meta tunnelMeta) (string, error) {
 	connAny, ok := t.sshService.SSHConnects.Load(sessionID)
 	if !ok {
 		return "", sshSessionNotFoundErr
@@ -123,98 +145,93 @@ func (t *SSHTunnelService) StartLocal(sessionID string, localAddr string, remote
 		sessionID:  sessionID,
 		LocalAddr:  localAddr,
 		RemoteAddr: remoteAddr,
+		meta:       meta,
 		listener:   ln,
 		exitCh:     make(chan struct{}),
+		conns:      make(map[string]*tunnelConn),
 	}
 	sshTunnels.Store(tunnel.ID, tunnel)
 
-	// accept loop
-	tunnel.wg.Add(1)
-	system.SafeGo(func() {
-		defer tunnel.wg.Done()
-		for {
-			localConn, err := ln.Accept()
-			if err != nil {
-				// listener closed or error
-				Logger.Debug("accept loop quit", zap.String("tunnelID", tunnel.ID), zap.Error(err))
-				return
-			}
-			// handle each connection
-			tunnel.wg.Add(1)
-			system.SafeGo(func() {
-				defer tunnel.wg.Done()
-				defer localConn.Close()
-
-				remoteConn, err := sc.client.Dial("tcp", tunnel.RemoteAddr)
-				if err != nil {
-					Logger.Debug("failed to dial remote", zap.String("tunnelID", tunnel.ID), zap.Error(err))
-					return
-				}
-				defer remoteConn.Close()
-
-				Logger.Debug("SSH tunnel local forwarding connection established")
-
-				// 创建退出信号通道和同步机制
-				connExitCh := make(chan struct{})
-				var closeOnce sync.Once
-				closeConnExitCh := func() {
-					closeOnce.Do(func() {
-						close(connExitCh)
-					})
-				}
-
-				// 启动双向数据复制
-				tunnel.wg.Add(2)
-				system.SafeGo(func() {
-					defer tunnel.wg.Done()
-					io.Copy(remoteConn, localConn)
-					closeConnExitCh()
-					Logger.Debug("SSH tunnel copy1 exit")
-				})
-				system.SafeGo(func() {
-					defer tunnel.wg.Done()
-					io.Copy(localConn, remoteConn)
-					closeConnExitCh()
-					Logger.Debug("SSH tunnel copy2 exit")
-				})
-
-				select {
-				case <-connExitCh:
-					// 连接正常结束
-					Logger.Debug("SSH tunnel connection closed normally")
-				case <-tunnel.exitCh:
-					// 隧道被停止，需要中断连接
-					Logger.Debug("SSH tunnel stopping, closing connections")
-					localConn.Close()
-					remoteConn.Close()
-					<-connExitCh
-				}
-
-				Logger.Debug("SSH tunnel local forwarding connection closed")
-			})
-		}
-	})
+	tunnel.serve(func() (net.Conn, error) {
+		return sc.client.Dial("tcp", tunnel.RemoteAddr)
+	}, tunnel.RemoteAddr)
 
 	return tunnel.ID, nil
 }
 
+// normalizeRemoteBindAddr 校验远端监听地址，host 为空时使用 127.0.0.1，端口允许为 0（由服务器分配）
+func normalizeRemoteBindAddr(addr string) (string, error) {
+	host, portStr, err := net.SplitHostPort(addr)
+	if err != nil {
+		return "", fmt.Errorf("远端监听地址无效: %w", err)
+	}
+	port, err := strconv.Atoi(portStr)
+	if err != nil || port < 0 || port > 65535 {
+		return "", fmt.Errorf("远端监听端口无效: %s", portStr)
+	}
+	if host == "" {
+		host = "127.0.0.1"
+	}
+	return net.JoinHostPort(host, strconv.Itoa(port)), nil
+}
+
 // StartRemote 远端端口转发（remote forwarding）。
 // 在远端（SSH 服务器）监听 127.0.0.1:remotePort，接受连接后转发到本地的 localAddr。
 // remotePort: 远端监听端口（远端地址固定 127.0.0.1）
 // localAddr 格式: ip:port，例如 127.0.0.1:3306
 func (t *SSHTunnelService) StartRemote(sessionID string, remotePort int, localAddr string) (string, error) {
+	return t.startRemote(sessionID, fmt.Sprintf("127.0.0.1:%d", remotePort), localAddr, tunnelMeta{})
+}
+
+// StartRemoteBind 远端端口转发，可指定远端监听地址。
+// remoteAddr 格式: ip:port，例如 0.0.0.0:8080；端口为 0 时由服务器分配，实际地址见返回隧道的 RemoteAddr。
+// 监听非回环地址需要服务器开启 GatewayPorts，否则服务器会退化为仅监听回环地址。
+// localAddr 格式: ip:port，例如 127.0.0.1:3306
+func (t *SSHTunnelService) StartRemoteBind(sessionID string, remoteAddr string, localAddr string) (TunnelInfo, error) {
+	tunnelID, err := t.startRemote(sessionID, remoteAddr, localAddr, tunnelMeta{})
+	if err != nil {
+		return TunnelInfo{}, err
+	}
+	return t.tunnelInfoByID(tunnelID)
+}
+
+// StartRemoteDynamic 远端动态转发（反向 SOCKS5，等同 ssh -R <port>）。
+// 在远端监听 remoteAddr，远端发起的 SOCKS5 请求由本机建立出站连接。
+// remoteAddr 格式: ip:port，例如 127.0.0.1:1080；端口为 0 时由服务器分配
+func (t *SSHTunnelService) StartRemoteDynamic(sessionID string, remoteAddr string) (TunnelInfo, error) {
+	tunnelID, err := t.startRemoteDynamic(sessionID, remoteAddr, DynamicOptions{}, tunnelMeta{})
+	if err != nil {
+		return TunnelInfo{}, err
+	}
+	return t.tunnelInfoByID(tunnelID)
+}
+
+func (t *SSHTunnelService) tunnelInfoByID(tunnelID string) (TunnelInfo, error) {
+	tunnelAny, ok := sshTunnels.Load(tunnelID)
+	if !ok {
+		return TunnelInfo{}, fmt.Errorf("tunnel not found")
+	}
+	return tunnelAny.(*SSHTunnel).info(), nil
+}
+
+func (t *SSHTunnelService) startRemote(sessionID string, remoteAddr string, localAddr string, meta tunnelMeta) (string, error) {
 	connAny, ok := t.sshService.SSHConnects.Load(sessionID)
 	if !ok {
 		return "", sshSessionNotFoundErr
 	}
 	sc := connAny.(*SSHConnect)
 
-	remoteAddr := fmt.Sprintf("127.0.0.1:%d", remotePort)
+	remoteAddr, err := normalizeRemoteBindAddr(remoteAddr)
+	if err != nil {
+		return "", err
+	}
 	// 在远端通过 ssh client 监听
 	ln, err := sc.client.Listen("tcp", remoteAddr)
 	if err != nil {
 		return "", err
 	}
+	// 端口为 0 时使用服务器实际分配的地址
+	remoteAddr = ln.Addr().String()
 
 	tunnel := &SSHTunnel{
 		ID:         utils.GenerateRandomID(),
@@ -222,68 +239,16 @@ func (t *SSHTunnelService) StartRemote(sessionID string, remotePort int, localAd
 		sessionID:  sessionID,
 		LocalAddr:  localAddr,
 		RemoteAddr: remoteAddr,
+		meta:       meta,
 		listener:   ln,
 		exitCh:     make(chan struct{}),
+		conns:      make(map[string]*tunnelConn),
 	}
 	sshTunnels.Store(tunnel.ID, tunnel)
 
-	tunnel.wg.Add(1)
-	system.SafeGo(func() {
-		defer tunnel.wg.Done()
-		for {
-			remoteConn, err := ln.Accept()
-			if err != nil {
-				Logger.Debug("remote accept loop quit", zap.String("tunnelID", tunnel.ID), zap.Error(err))
-				return
-			}
-			tunnel.wg.Add(1)
-			system.SafeGo(func() {
-				defer tunnel.wg.Done()
-				defer remoteConn.Close()
-
-				localConn, err := net.Dial("tcp", tunnel.LocalAddr)
-				if err != nil {
-					Logger.Debug("failed to dial local", zap.String("tunnelID", tunnel.ID), zap.Error(err))
-					return
-				}
-				defer localConn.Close()
-
-				Logger.Debug("SSH tunnel remote forwarding connection established")
-
-				connExitCh := make(chan struct{})
-				var closeOnce sync.Once
-				closeConnExitCh := func() {
-					closeOnce.Do(func() { close(connExitCh) })
-				}
-
-				tunnel.wg.Add(2)
-				system.SafeGo(func() {
-					defer tunnel.wg.Done()
-					io.Copy(localConn, remoteConn)
-					closeConnExitCh()
-					Logger.Debug("SSH tunnel copy1 exit")
-				})
-				system.SafeGo(func() {
-					defer tunnel.wg.Done()
-					io.Copy(remoteConn, localConn)
-					closeConnExitCh()
-					Logger.Debug("SSH tunnel copy2 exit")
-				})
-
-				select {
-				case <-connExitCh:
-					Logger.Debug("SSH tunnel connection closed normally")
-				case <-tunnel.exitCh:
-					Logger.Debug("SSH tunnel stopping, closing connections")
-					localConn.Close()
-					remoteConn.Close()
-					<-connExitCh
-				}
-
-				Logger.Debug("SSH tunnel remote forwarding connection closed")
-			})
-		}
-	})
+	tunnel.serve(func() (net.Conn, error) {
+		return net.Dial("tcp", tunnel.LocalAddr)
+	}, tunnel.LocalAddr)
 
 	return tunnel.ID, nil
 }
@@ -292,45 +257,140 @@ func (t *SSHTunnelService) StartRemote(sessionID string, remotePort int, localAd
 // 本地监听 SOCKS5 请求，并通过 SSH 客户端发起出站连接。
 // localAddr 格式: ip:port，例如 127.0.0.1:1080
 func (t *SSHTunnelService) StartDynamic(sessionID string, localAddr string) (string, error) {
+	return t.startDynamic(sessionID, localAddr, DynamicOptions{}, tunnelMeta{})
+}
+
+// StartDynamicWithOptions 动态端口转发，支持用户名密码认证、来源和目标访问控制，
+// 以及在同一端口提供 HTTP 代理。监听非回环地址时建议至少配置认证或来源限制。
+func (t *SSHTunnelService) StartDynamicWithOptions(sessionID string, localAddr string, opts DynamicOptions) (string, error) {
+	return t.startDynamic(sessionID, localAddr, opts, tunnelMeta{})
+}
+
+func (t *SSHTunnelService) startDynamic(sessionID string, localAddr string, opts DynamicOptions, meta tunnelMeta) (string, error) {
 	connAny, ok := t.sshService.SSHConnects.Load(sessionID)
 	if !ok {
 		return "", sshSessionNotFoundErr
 	}
 	sc := connAny.(*SSHConnect)
 
+	policy, err := newProxyPolicy(opts)
+	if err != nil {
+		return "", err
+	}
+
 	ln, err := net.Listen("tcp", localAddr)
 	if err != nil {
 		return "", err
 	}
 
 	tunnel := &SSHTunnel{
-		ID:          utils.GenerateRandomID(),
-		tunnelType:  tunnelTypeDynamic,
-		sessionID:   sessionID,
-		LocalAddr:   localAddr,
-		RemoteAddr:  "",
-		listener:    ln,
-		exitCh:      make(chan struct{}),
-		activeConns: make(map[net.Conn]struct{}),
+		ID:         utils.GenerateRandomID(),
+		tunnelType: tunnelTypeDynamic,
+		sessionID:  sessionID,
+		LocalAddr:  localAddr,
+		RemoteAddr: "",
+		meta:       meta,
+		policy:     policy,
+		listener:   ln,
+		exitCh:     make(chan struct{}),
+		conns:      make(map[string]*tunnelConn),
 	}
 	sshTunnels.Store(tunnel.ID, tunnel)
 
+	tunnel.socksServer = tunnel.newSocksServer(sc.client.DialContext)
+	tunnel.wg.Add(1)
+	system.SafeGo(func() {
+		defer tunnel.wg.Done()
+		t.handleDynamicConn(tunnel, ln)
+	})
+
+	return tunnel.ID, nil
+}
+
+// newSocksServer 创建 SOCKS5 服务，出站连接由 dialFn 建立，并统计流量和拨号失败次数
+func (tunnel *SSHTunnel) newSocksServer(dialFn dialContextFunc) *socks5.Server {
+	dial := func(ctx context.Context, network, address string) (net.Conn, error) {
+		to, cancel := context.WithTimeout(ctx, time.Second*20)
+		defer cancel()
+		defer func() {
+			if to.Err() != nil {
+				Logger.Debug(to.Err().Error(), zap.String("network", network), zap.String("address", address))
+			}
+		}()
+		conn, err := dialFn(to, network, address)
+		if err != nil {
+			tunnel.stats.dialFailures.Add(1)
+			return nil, err
+		}
+		return conn, nil
+	}
 	opts := []socks5.Option{
 		socks5.WithDial(func(ctx context.Context, network, address string) (net.Conn, error) {
-			to, cancel := context.WithTimeout(ctx, time.Second*20)
-			defer cancel()
-			defer func() {
-				if to.Err() != nil {
-					Logger.Debug(to.Err().Error(), zap.String("network", network), zap.String("address", address))
-				}
-			}()
-			return sc.client.DialContext(to, network, address)
+			conn, err := dial(ctx, network, address)
+			if err != nil {
+				return nil, err
+			}
+			return &trafficConn{Conn: conn, tunnel: tunnel}, nil
+		}),
+		// CONNECT 请求带有客户端地址，用于把出站流量归属到对应的转发连接
+		socks5.WithDialAndRequest(func(ctx context.Context, network, address string, req *socks5.Request) (net.Conn, error) {
+			conn, err := dial(ctx, network, address)
+			if err != nil {
+				return nil, err
+			}
+			tc := tunnel.findConnBySource(req.RemoteAddr)
+			if tc != nil {
+				tc.target.Store(address)
+			}
+			return &trafficConn{Conn: conn, tunnel: tunnel, conn: tc}, nil
 		}),
 	}
+	tunnel.proxyDial = dial
+	opts = append(opts, tunnel.policy.socksOptions()...)
 	if Mode != ModeRelease {
 		opts = append(opts, socks5.WithLogger(socks5.NewLogger(log.New(os.Stdout, "socks5: ", log.LstdFlags))))
 	}
-	tunnel.socksServer = socks5.NewServer(opts...)
+	return socks5.NewServer(opts...)
+}
+
+// startRemoteDynamic 在远端监听 SOCKS5 请求，出站连接由本机直接建立
+func (t *SSHTunnelService) startRemoteDynamic(sessionID string, remoteAddr string, opts DynamicOptions, meta tunnelMeta) (string, error) {
+	connAny, ok := t.sshService.SSHConnects.Load(sessionID)
+	if !ok {
+		return "", sshSessionNotFoundErr
+	}
+	sc := connAny.(*SSHConnect)
+
+	policy, err := newProxyPolicy(opts)
+	if err != nil {
+		return "", err
+	}
+
+	remoteAddr, err = normalizeRemoteBindAddr(remoteAddr)
+	if err != nil {
+		return "", err
+	}
+	ln, err := sc.client.Listen("tcp", remoteAddr)
+	if err != nil {
+		return "", err
+	}
+
+	tunnel := &SSHTunnel{
+		ID:         utils.GenerateRandomID(),
+		tunnelType: tunnelTypeRemoteDynamic,
+		sessionID:  sessionID,
+		LocalAddr:  "",
+		RemoteAddr: ln.Addr().String(),
+		meta:       meta,
+		policy:     policy,
+		listener:   ln,
+		exitCh:     make(chan struct{}),
+		conns:      make(map[string]*tunnelConn),
+	}
+	sshTunnels.Store(tunnel.ID, tunnel)
+
+	var dialer net.Dialer
+	tunnel.socksServer = tunnel.newSocksServer(dialer.DialContext)
 	tunnel.wg.Add(1)
 	system.SafeGo(func() {
 		defer tunnel.wg.Done()
@@ -340,22 +400,71 @@ func (t *SSHTunnelService) StartDynamic(sessionID string, localAddr string) (str
 	return tunnel.ID, nil
 }
 
+// serve 启动 accept 循环：每个接入连接通过 dial 建立到 target 的连接并双向转发
+func (tunnel *SSHTunnel) serve(dial func() (net.Conn, error), target string) {
+	tunnel.wg.Add(1)
+	system.SafeGo(func() {
+		defer tunnel.wg.Done()
+		for {
+			clientConn, err := tunnel.listener.Accept()
+			if err != nil {
+				// listener closed or error
+				Logger.Debug("accept loop quit", zap.String("tunnelID", tunnel.ID), zap.Error(err))
+				return
+			}
+			// handle each connection
+			tunnel.wg.Add(1)
+			system.SafeGo(func() {
+				defer tunnel.wg.Done()
+				defer clientConn.Close()
+
+				targetConn, err := dial()
+				if err != nil {
+					tunnel.stats.dialFailures.Add(1)
+					Logger.Debug("failed to dial target", zap.String("tunnelID", tunnel.ID), zap.String("target", target), zap.Error(err))
+					return
+				}
+				defer targetConn.Close()
+
+				tc := tunnel.trackConn(connSource(clientConn), target, func() {
+					clientConn.Close()
+					targetConn.Close()
+				})
+				defer tunnel.untrackConn(tc)
+
+				Logger.Debug("SSH tunnel forwarding connection established", zap.String("tunnelType", tunnel.tunnelType))
+				tunnel.forward(clientConn, targetConn, tc)
+				Logger.Debug("SSH tunnel forwarding connection closed", zap.String("tunnelType", tunnel.tunnelType))
+			})
+		}
+	})
+}
+
+// connSource 返回连接发起端地址，unix socket 连接通常没有对端地址
+func connSource(conn net.Conn) string {
+	if addr := conn.RemoteAddr(); addr != nil && addr.String() != "" {
+		return addr.String()
+	}
+	return conn.LocalAddr().Network()
+}
+
 // handleDynamicConn 处理动态转发的 SOCKS5 连接
 func (t *SSHTunnelService) handleDynamicConn(tunnel *SSHTunnel, ln net.Listener) {
 	for {
 		conn, err := ln.Accept()
 		if err != nil {
-			tunnel.connLock.Lock()
-			for actConn := range tunnel.activeConns {
-				_ = actConn.Close()
-			}
-			tunnel.connLock.Unlock()
+			tunnel.closeAllConns()
 			Logger.Debug("socks5 accept loop quit", zap.Error(err))
 			return
 		}
-		tunnel.connLock.Lock()
-		tunnel.activeConns[conn] = struct{}{}
-		tunnel.connLock.Unlock()
+		if !tunnel.policy.sourceAllowed(conn.RemoteAddr()) {
+			Logger.Debug("dynamic tunnel connection rejected by source rules", zap.String("source", conn.RemoteAddr().String()))
+			conn.Close()
+			continue
+		}
+		tc := tunnel.trackConn(conn.RemoteAddr().String(), "", func() {
+			conn.Close()
+		})
 
 		tunnel.wg.Add(1)
 		system.SafeGo(func() {
@@ -363,41 +472,50 @@ func (t *SSHTunnelService) handleDynamicConn(tunnel *SSHTunnel, ln net.Listener)
 			defer tunnel.wg.Done()
 			defer func() {
 				conn.Close()
-				tunnel.connLock.Lock()
-				delete(tunnel.activeConns, conn)
-				tunnel.connLock.Unlock()
+				tunnel.untrackConn(tc)
 			}()
 
-			_ = tunnel.socksServer.ServeConn(conn)
+			_ = tunnel.serveProxyConn(conn, tc)
 			Logger.Debug("socks5 conn stopped")
 		})
 	}
 }
 
+// findConnBySource 按发起端地址查找活跃连接
+func (tunnel *SSHTunnel) findConnBySource(addr net.Addr) *tunnelConn {
+	if addr == nil {
+		return nil
+	}
+	source := addr.String()
+	tunnel.connLock.Lock()
+	defer tunnel.connLock.Unlock()
+	for _, tc := range tunnel.conns {
+		if tc.source == source {
+			return tc
+		}
+	}
+	return nil
+}
+
 // StopByID 根据隧道 ID 停止隧道
 func (t *SSHTunnelService) StopByID(tunnelID string) error {
-	tunnelAny, ok := sshTunnels.Load(tunnelID)
+	tunnelAny, ok := sshTunnels.LoadAndDelete(tunnelID)
 	if !ok {
 		return fmt.Errorf("tunnel not found")
 	}
 	tunnel := tunnelAny.(*SSHTunnel)
-	_ = tunnel.listener.Close()
-	close(tunnel.exitCh)
-	tunnel.wg.Wait()
-	sshTunnels.Delete(tunnelID)
+	tunnel.stop()
 	Logger.Debug("SSH tunnel stopped", zap.String("remoteAddr", tunnel.RemoteAddr))
 	return nil
 }
 
 // StopAll 停止所有隧道（local/remote/dynamic）
 func (t *SSHTunnelService) StopAll() {
-	sshTunnels.Range(func(key, value any) bool {
-		tunnel, ok := value.(*SSHTunnel)
-		if ok {
-			_ = tunnel.listener.Close()
-			close(tunnel.exitCh)
-			tunnel.wg.Wait()
-			sshTunnels.Delete(key)
+	sshTunnels.Range(func(key, _ any) bool {
+		if value, loaded := sshTunnels.LoadAndDelete(key); loaded {
+			if tunnel, ok := value.(*SSHTunnel); ok {
+				tunnel.stop()
+			}
 		}
 		return true
 	})
@@ -408,13 +526,21 @@ func (t *SSHTunnelService) StopAll() {
 func (t *SSHTunnelService) StopAllBySession(sessionID string) {
 	sshTunnels.Range(func(key, value any) bool {
 		tunnel, ok := value.(*SSHTunnel)
-		if ok && tunnel.sessionID == sessionID {
-			_ = tunnel.listener.Close()
-			close(tunnel.exitCh)
-			tunnel.wg.Wait()
-			sshTunnels.Delete(key)
+		if !ok || tunnel.sessionID != sessionID {
+			return true
+		}
+		// 先从表中取出再关闭，并发停止同一隧道时只有取到的一方关闭 exitCh
+		if _, loaded := sshTunnels.LoadAndDelete(key); loaded {
+			tunnel.stop()
 		}
 		return true
 	})
 	Logger.Debug("SSH tunnels stopped for session", zap.String("sessionID", sessionID))
 }
+
+// stop 关闭监听并等待转发协程退出，调用方须先将隧道从 sshTunnels 中移除
+func (tunnel *SSHTunnel) stop() {
+	_ = tunnel.listener.Close()
+	close(tunnel.exitCh)
+	tunnel.wg.Wait()
+}
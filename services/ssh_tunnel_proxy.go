@@ -0,0 +1,411 @@
+package services
+
+import (
+	"bufio"
+	"context"
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/ilaziness/vexo/internal/system"
+	"github.com/things-go/go-socks5"
+	"github.com/things-go/go-socks5/statute"
+	"go.uber.org/zap"
+)
+
+// 动态转发的认证、访问控制与 HTTP 代理模式
+
+// proxyResolveTimeout HTTP 代理检查目标规则时解析域名的超时
+const proxyResolveTimeout = 10 * time.Second
+
+// DynamicOptions 动态转发选项
+type DynamicOptions struct {
+	Username          string   `json:"username"`          // 用户名，为空表示不认证
+	Password          string   `json:"password"`          // 密码
+	AllowSources      []string `json:"allowSources"`      // 允许接入的客户端 IP 或 CIDR，为空不限制
+	AllowDestinations []string `json:"allowDestinations"` // 允许访问的目标：IP、CIDR 或域名通配符（*.example.com），为空不限制
+	DenyDestinations  []string `json:"denyDestinations"`  // 禁止访问的目标，优先于允许规则
+	HTTPProxy         bool     `json:"httpProxy"`         // 同一端口同时提供 HTTP 代理（CONNECT 和普通 HTTP 请求）
+}
+
+// addrRules 目标地址规则
+type addrRules struct {
+	nets    []*net.IPNet
+	domains []string
+}
+
+// proxyPolicy 由 DynamicOptions 解析得到的访问策略
+type proxyPolicy struct {
+	username  string
+	password  string
+	sources   []*net.IPNet
+	allow     addrRules
+	deny      addrRules
+	httpProxy bool
+}
+
+// parseIPNet 解析 IP 或 CIDR，单个 IP 视为 /32 或 /128
+func parseIPNet(s string) (*net.IPNet, error) {
+	if strings.Contains(s, "/") {
+		_, ipNet, err := net.ParseCIDR(s)
+		return ipNet, err
+	}
+	ip := net.ParseIP(s)
+	if ip == nil {
+		return nil, fmt.Errorf("无效的 IP 地址: %s", s)
+	}
+	bits := 8 * net.IPv6len
+	if ip4 := ip.To4(); ip4 != nil {
+		ip = ip4
+		bits = 8 * net.IPv4len
+	}
+	return &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)}, nil
+}
+
+func parseAddrRules(items []string) (addrRules, error) {
+	var rules addrRules
+	for _, item := range items {
+		item = strings.ToLower(strings.TrimSpace(item))
+		if item == "" {
+			continue
+		}
+		if ipNet, err := parseIPNet(item); err == nil {
+			rules.nets = append(rules.nets, ipNet)
+			continue
+		}
+		if _, err := path.Match(item, ""); err != nil {
+			return rules, fmt.Errorf("无效的域名规则: %s", item)
+		}
+		rules.domains = append(rules.domains, item)
+	}
+	return rules, nil
+}
+
+// match 判断目标是否命中规则，host 为域名（可为空），ip 为目标 IP（可为 nil）
+func (r addrRules) match(host string, ip net.IP) bool {
+	if ip != nil {
+		for _, ipNet := range r.nets {
+			if ipNet.Contains(ip) {
+				return true
+			}
+		}
+	}
+	host = strings.TrimSuffix(strings.ToLower(host), ".")
+	if host != "" {
+		for _, pattern := range r.domains {
+			if ok, _ := path.Match(pattern, host); ok {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (r addrRules) empty() bool {
+	return len(r.nets) == 0 && len(r.domains) == 0
+}
+
+// newProxyPolicy 校验并解析动态转发选项，未设置任何限制时返回 nil
+func newProxyPolicy(opts DynamicOptions) (*proxyPolicy, error) {
+	if opts.Username == "" && opts.Password != "" {
+		return nil, fmt.Errorf("设置了密码但用户名为空")
+	}
+	policy := &proxyPolicy{
+		username:  opts.Username,
+		password:  opts.Password,
+		httpProxy: opts.HTTPProxy,
+	}
+	for _, s := range opts.AllowSources {
+		s = strings.TrimSpace(s)
+		if s == "" {
+			continue
+		}
+		ipNet, err := parseIPNet(s)
+		if err != nil {
+			return nil, fmt.Errorf("无效的来源地址规则: %s", s)
+		}
+		policy.sources = append(policy.sources, ipNet)
+	}
+	var err error
+	if policy.allow, err = parseAddrRules(opts.AllowDestinations); err != nil {
+		return nil, err
+	}
+	if policy.deny, err = parseAddrRules(opts.DenyDestinations); err != nil {
+		return nil, err
+	}
+	if policy.username == "" && len(policy.sources) == 0 && policy.allow.empty() && policy.deny.empty() && !policy.httpProxy {
+		return nil, nil
+	}
+	return policy, nil
+}
+
+// sourceAllowed 检查客户端地址是否在允许列表中
+func (p *proxyPolicy) sourceAllowed(addr net.Addr) bool {
+	if p == nil || len(p.sources) == 0 {
+		return true
+	}
+	tcpAddr, ok := addr.(*net.TCPAddr)
+	if !ok {
+		return false
+	}
+	for _, ipNet := range p.sources {
+		if ipNet.Contains(tcpAddr.IP) {
+			return true
+		}
+	}
+	return false
+}
+
+// destAllowed 检查目标是否允许访问，拒绝规则优先
+func (p *proxyPolicy) destAllowed(host string, ip net.IP) bool {
+	if p == nil {
+		return true
+	}
+	if ip == nil {
+		ip = net.ParseIP(host)
+	}
+	if p.deny.match(host, ip) {
+		return false
+	}
+	return p.allow.empty() || p.allow.match(host, ip)
+}
+
+// destAllowedIPs 检查域名目标及其解析得到的所有 IP：任一 IP 命中拒绝规则即拒绝；
+// 域名命中允许规则，或所有 IP 都命中允许规则时允许
+func (p *proxyPolicy) destAllowedIPs(host string, ips []net.IP) bool {
+	if p == nil {
+		return true
+	}
+	if p.deny.match(host, nil) {
+		return false
+	}
+	for _, ip := range ips {
+		if p.deny.match("", ip) {
+			return false
+		}
+	}
+	if p.allow.empty() || p.allow.match(host, nil) {
+		return true
+	}
+	if len(ips) == 0 {
+		return false
+	}
+	for _, ip := range ips {
+		if !p.allow.match("", ip) {
+			return false
+		}
+	}
+	return true
+}
+
+// checkHTTPDest 检查 HTTP 代理的目标，返回实际拨号使用的主机。规则中有网段时在本地解析域名，
+// 逐个检查解析得到的 IP，并返回检查过的 IP 用于拨号，避免远端重新解析得到其他地址绕过规则；
+// 域名无法解析时拒绝。没有网段规则时不解析，直接返回原主机
+func (p *proxyPolicy) checkHTTPDest(ctx context.Context, host string) (string, bool) {
+	if !p.hasDestRules() {
+		return host, true
+	}
+	if net.ParseIP(host) != nil || (len(p.allow.nets) == 0 && len(p.deny.nets) == 0) {
+		return host, p.destAllowed(host, nil)
+	}
+	ctx, cancel := context.WithTimeout(ctx, proxyResolveTimeout)
+	defer cancel()
+	addrs, err := net.DefaultResolver.LookupIPAddr(ctx, host)
+	if err != nil {
+		Logger.Debug("http proxy resolve failed", zap.String("host", host), zap.Error(err))
+		return "", false
+	}
+	ips := make([]net.IP, 0, len(addrs))
+	for _, addr := range addrs {
+		ips = append(ips, addr.IP)
+	}
+	if len(ips) == 0 || !p.destAllowedIPs(host, ips) {
+		return "", false
+	}
+	return ips[0].String(), true
+}
+
+// hasDestRules 是否配置了目标规则
+func (p *proxyPolicy) hasDestRules() bool {
+	return p != nil && (!p.allow.empty() || !p.deny.empty())
+}
+
+// socksOptions 返回策略对应的 SOCKS5 认证和规则选项
+func (p *proxyPolicy) socksOptions() []socks5.Option {
+	if p == nil {
+		return nil
+	}
+	var opts []socks5.Option
+	if p.username != "" {
+		opts = append(opts, socks5.WithCredential(socks5.StaticCredentials{p.username: p.password}))
+	}
+	if p.hasDestRules() {
+		opts = append(opts, socks5.WithRule(p))
+	}
+	return opts
+}
+
+// Allow 实现 socks5.RuleSet。配置了目标规则时只允许 CONNECT，UDP ASSOCIATE 的目标无法逐包检查
+func (p *proxyPolicy) Allow(ctx context.Context, req *socks5.Request) (context.Context, bool) {
+	if req.Command != statute.CommandConnect {
+		return ctx, false
+	}
+	dest := req.DestAddr
+	if dest == nil {
+		dest = req.RawDestAddr
+	}
+	allowed := p.destAllowed(dest.FQDN, dest.IP)
+	if !allowed {
+		Logger.Debug("socks5 request denied by rules", zap.String("dest", dest.String()))
+	}
+	return ctx, allowed
+}
+
+// checkProxyAuth 校验 HTTP 代理的 Proxy-Authorization 头
+func (p *proxyPolicy) checkProxyAuth(header http.Header) bool {
+	if p == nil || p.username == "" {
+		return true
+	}
+	auth := header.Get("Proxy-Authorization")
+	scheme, encoded, ok := strings.Cut(auth, " ")
+	if !ok || !strings.EqualFold(scheme, "Basic") {
+		return false
+	}
+	decoded, err := base64.StdEncoding.DecodeString(strings.TrimSpace(encoded))
+	if err != nil {
+		return false
+	}
+	user, pass, ok := strings.Cut(string(decoded), ":")
+	// 用户名和密码都比较完，避免通过响应时间猜测
+	userOK := subtle.ConstantTimeCompare([]byte(user), []byte(p.username))
+	passOK := subtle.ConstantTimeCompare([]byte(pass), []byte(p.password))
+	return ok && userOK&passOK == 1
+}
+
+// bufferedConn 预读过首字节的连接，后续读取先消费缓冲区
+type bufferedConn struct {
+	net.Conn
+	reader *bufio.Reader
+}
+
+func (c *bufferedConn) Read(p []byte) (int, error) {
+	return c.reader.Read(p)
+}
+
+// serveProxyConn 处理动态转发的一个接入连接：
+// 开启 HTTP 代理模式时根据首字节区分 SOCKS5（0x05）与 HTTP 请求
+func (tunnel *SSHTunnel) serveProxyConn(conn net.Conn, tc *tunnelConn) error {
+	if tunnel.policy == nil || !tunnel.policy.httpProxy {
+		return tunnel.socksServer.ServeConn(conn)
+	}
+	reader := bufio.NewReader(conn)
+	_ = conn.SetReadDeadline(time.Now().Add(30 * time.Second))
+	first, err := reader.Peek(1)
+	_ = conn.SetReadDeadline(time.Time{})
+	if err != nil {
+		return err
+	}
+	bc := &bufferedConn{Conn: conn, reader: reader}
+	if first[0] == statute.VersionSocks5 {
+		return tunnel.socksServer.ServeConn(bc)
+	}
+	return tunnel.serveHTTPProxy(bc, reader, tc)
+}
+
+// writeProxyError 向 HTTP 代理客户端返回错误响应
+func writeProxyError(w io.Writer, code int, extraHeader string) {
+	fmt.Fprintf(w, "HTTP/1.1 %d %s\r\n%sContent-Length: 0\r\nConnection: close\r\n\r\n", code, http.StatusText(code), extraHeader)
+}
+
+// serveHTTPProxy 处理 HTTP 代理请求。CONNECT 建立隧道后双向转发；
+// 普通 HTTP 请求改写为 origin-form 并要求目标关闭连接，每个连接只处理一个请求，
+// 避免同一连接上的后续请求被发往错误的主机
+func (tunnel *SSHTunnel) serveHTTPProxy(conn net.Conn, reader *bufio.Reader, tc *tunnelConn) error {
+	req, err := http.ReadRequest(reader)
+	if err != nil {
+		return err
+	}
+	policy := tunnel.policy
+	if !policy.checkProxyAuth(req.Header) {
+		writeProxyError(conn, http.StatusProxyAuthRequired, "Proxy-Authenticate: Basic realm=\"vexo\"\r\n")
+		return fmt.Errorf("http proxy authentication failed")
+	}
+
+	target := req.Host
+	if req.Method != http.MethodConnect {
+		if req.URL.Host == "" {
+			writeProxyError(conn, http.StatusBadRequest, "")
+			return fmt.Errorf("http proxy request without absolute url")
+		}
+		target = req.URL.Host
+	}
+	host, port, err := net.SplitHostPort(target)
+	if err != nil {
+		host = target
+		port = "80"
+		if req.URL != nil && req.URL.Scheme == "https" {
+			port = "443"
+		}
+		target = net.JoinHostPort(host, port)
+	}
+	dialHost, ok := policy.checkHTTPDest(context.Background(), host)
+	if !ok {
+		writeProxyError(conn, http.StatusForbidden, "")
+		return fmt.Errorf("http proxy request to %s denied by rules", target)
+	}
+
+	targetConn, err := tunnel.proxyDial(context.Background(), "tcp", net.JoinHostPort(dialHost, port))
+	if err != nil {
+		writeProxyError(conn, http.StatusBadGateway, "")
+		return err
+	}
+	defer targetConn.Close()
+	if tc != nil {
+		tc.target.Store(target)
+	}
+	counted := &trafficConn{Conn: targetConn, tunnel: tunnel, conn: tc}
+
+	if req.Method == http.MethodConnect {
+		if _, err := io.WriteString(conn, "HTTP/1.1 200 Connection established\r\n\r\n"); err != nil {
+			return err
+		}
+	} else {
+		req.Header.Del("Proxy-Authorization")
+		req.Header.Del("Proxy-Connection")
+		req.Close = true
+		if err := req.Write(counted); err != nil {
+			return err
+		}
+	}
+	tunnel.forwardRaw(conn, counted)
+	return nil
+}
+
+// forwardRaw 双向复制数据，流量已由 trafficConn 统计。复制的 goroutine 计入 tunnel.wg，停止隧道时等待其退出
+func (tunnel *SSHTunnel) forwardRaw(clientConn, targetConn net.Conn) {
+	done := make(chan struct{}, 2)
+	tunnel.wg.Add(2)
+	system.SafeGo(func() {
+		defer tunnel.wg.Done()
+		_, _ = io.Copy(targetConn, clientConn)
+		done <- struct{}{}
+	})
+	system.SafeGo(func() {
+		defer tunnel.wg.Done()
+		_, _ = io.Copy(clientConn, targetConn)
+		done <- struct{}{}
+	})
+	select {
+	case <-done:
+	case <-tunnel.exitCh:
+	}
+	clientConn.Close()
+	targetConn.Close()
+	<-done
+}
@@ -0,0 +1,151 @@
+package services
+
+import (
+	"context"
+	"encoding/base64"
+	"net"
+	"net/http"
+	"testing"
+)
+
+func TestParseAddrRules(t *testing.T) {
+	rules, err := parseAddrRules([]string{" 10.0.0.0/8 ", "192.168.1.1", "::1", "*.Example.com", ""})
+	if err != nil {
+		t.Fatalf("parseAddrRules: %v", err)
+	}
+	if len(rules.nets) != 3 {
+		t.Errorf("nets: got %d, want 3", len(rules.nets))
+	}
+	if len(rules.domains) != 1 || rules.domains[0] != "*.example.com" {
+		t.Errorf("domains: got %q", rules.domains)
+	}
+	if _, err := parseAddrRules([]string{"[bad"}); err == nil {
+		t.Errorf("invalid pattern: expected error")
+	}
+}
+
+func TestDestAllowed(t *testing.T) {
+	policy, err := newProxyPolicy(DynamicOptions{
+		AllowDestinations: []string{"10.0.0.0/8", "*.example.com"},
+		DenyDestinations:  []string{"10.0.0.1", "secret.example.com"},
+	})
+	if err != nil {
+		t.Fatalf("newProxyPolicy: %v", err)
+	}
+	tests := []struct {
+		host string
+		want bool
+	}{
+		{"10.1.2.3", true},
+		{"10.0.0.1", false},
+		{"11.0.0.1", false},
+		{"www.example.com", true},
+		{"WWW.Example.com.", true},
+		{"secret.example.com", false},
+		{"example.org", false},
+	}
+	for _, tt := range tests {
+		if got := policy.destAllowed(tt.host, nil); got != tt.want {
+			t.Errorf("destAllowed(%q): got %v, want %v", tt.host, got, tt.want)
+		}
+	}
+
+	var nilPolicy *proxyPolicy
+	if !nilPolicy.destAllowed("anything", nil) {
+		t.Errorf("nil policy: expected allowed")
+	}
+}
+
+func TestDestAllowedIPs(t *testing.T) {
+	policy, err := newProxyPolicy(DynamicOptions{
+		AllowDestinations: []string{"10.0.0.0/8", "*.example.com"},
+		DenyDestinations:  []string{"10.0.0.1"},
+	})
+	if err != nil {
+		t.Fatalf("newProxyPolicy: %v", err)
+	}
+	ips := func(s ...string) []net.IP {
+		var out []net.IP
+		for _, v := range s {
+			out = append(out, net.ParseIP(v))
+		}
+		return out
+	}
+	tests := []struct {
+		name string
+		host string
+		ips  []net.IP
+		want bool
+	}{
+		{"all ips allowed", "internal.lan", ips("10.1.1.1", "10.2.2.2"), true},
+		{"one ip outside allow", "internal.lan", ips("10.1.1.1", "8.8.8.8"), false},
+		{"resolves to denied ip", "www.example.com", ips("10.0.0.1"), false},
+		{"domain allowed", "www.example.com", ips("8.8.8.8"), true},
+		{"no ips", "internal.lan", nil, false},
+	}
+	for _, tt := range tests {
+		if got := policy.destAllowedIPs(tt.host, tt.ips); got != tt.want {
+			t.Errorf("%s: got %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestCheckHTTPDest(t *testing.T) {
+	var nilPolicy *proxyPolicy
+	if host, ok := nilPolicy.checkHTTPDest(context.Background(), "example.com"); !ok || host != "example.com" {
+		t.Errorf("no rules: got %q, %v", host, ok)
+	}
+
+	policy, err := newProxyPolicy(DynamicOptions{AllowDestinations: []string{"127.0.0.0/8", "::1"}})
+	if err != nil {
+		t.Fatalf("newProxyPolicy: %v", err)
+	}
+	// 解析后返回检查过的 IP，拨号时不再使用域名
+	host, ok := policy.checkHTTPDest(context.Background(), "localhost")
+	if ip := net.ParseIP(host); !ok || ip == nil || !ip.IsLoopback() {
+		t.Errorf("resolved host: got %q, %v", host, ok)
+	}
+	if host, ok := policy.checkHTTPDest(context.Background(), "127.0.0.1"); !ok || host != "127.0.0.1" {
+		t.Errorf("ip literal: got %q, %v", host, ok)
+	}
+	if _, ok := policy.checkHTTPDest(context.Background(), "10.0.0.1"); ok {
+		t.Errorf("ip outside allow: expected denied")
+	}
+
+	policy, err = newProxyPolicy(DynamicOptions{DenyDestinations: []string{"127.0.0.0/8", "::1"}})
+	if err != nil {
+		t.Fatalf("newProxyPolicy: %v", err)
+	}
+	if _, ok := policy.checkHTTPDest(context.Background(), "localhost"); ok {
+		t.Errorf("resolves to denied ip: expected denied")
+	}
+}
+
+func TestCheckProxyAuth(t *testing.T) {
+	policy := &proxyPolicy{username: "user", password: "pa:ss"}
+	basic := func(s string) string {
+		return "Basic " + base64.StdEncoding.EncodeToString([]byte(s))
+	}
+	tests := []struct {
+		auth string
+		want bool
+	}{
+		{basic("user:pa:ss"), true},
+		{"basic " + base64.StdEncoding.EncodeToString([]byte("user:pa:ss")), true},
+		{basic("user:wrong"), false},
+		{basic("other:pa:ss"), false},
+		{basic("user"), false},
+		{"Bearer token", false},
+		{"Basic !!!", false},
+		{"", false},
+	}
+	for _, tt := range tests {
+		header := http.Header{}
+		if tt.auth != "" {
+			header.Set("Proxy-Authorization", tt.auth)
+		}
+		if got := policy.checkProxyAuth(header); got != tt.want {
+			t.Errorf("checkProxyAuth(%q): got %v, want %v", tt.auth, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,351 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"path/filepath"
+	"time"
+
+	"github.com/ilaziness/vexo/internal/database"
+	"github.com/ilaziness/vexo/internal/utils"
+	"github.com/wailsapp/wails/v3/pkg/application"
+	"go.uber.org/zap"
+)
+
+// 书签隧道定义：持久化在 SQLite，随书签连接自动启动
+
+const (
+	EventTunnelAutoStartFailed = "eventTunnelAutoStartFailed"
+)
+
+func init() {
+	application.RegisterEvent[string](EventTunnelAutoStartFailed)
+}
+
+// SavedTunnel 书签下保存的隧道定义
+type SavedTunnel struct {
+	ID         string `json:"id"`
+	BookmarkID string `json:"bookmarkID"`
+	Name       string `json:"name"`
+	TunnelType string `json:"tunnelType"`
+	LocalAddr  string `json:"localAddr"`  // 本地地址，格式: ip:port；unix socket 转发时也可以是本地 socket 路径
+	RemoteAddr string `json:"remoteAddr"` // 远程地址，格式: host:port；远端转发时为远端监听地址；unix socket 转发时为远端 socket 路径
+	AutoStart  bool   `json:"autoStart"`  // 书签会话连接后自动启动
+	// Dynamic 动态转发选项，仅 dynamic 和 remoteDynamic 类型使用。
+	// 代理密码与书签密码一样加密保存，返回给前端时使用占位符，保存时传回占位符表示不修改
+	Dynamic *DynamicOptions `json:"dynamic,omitempty"`
+}
+
+// storedDynamicOptions 数据库中保存的动态转发选项，代理密码加密后保存在 PasswordEnc，Password 为空。
+// 旧版本以明文保存在 Password，读取时仍可使用，再次保存时加密
+type storedDynamicOptions struct {
+	DynamicOptions
+	PasswordEnc string `json:"passwordEnc,omitempty"`
+}
+
+func decodeDynamicOptions(t *database.BookmarkTunnelDB) *storedDynamicOptions {
+	if t.Options == "" {
+		return nil
+	}
+	var opts storedDynamicOptions
+	if err := json.Unmarshal([]byte(t.Options), &opts); err != nil {
+		Logger.Warn("unmarshal tunnel options failed", zap.String("id", t.ID), zap.Error(err))
+		return nil
+	}
+	return &opts
+}
+
+// savedTunnelFromDB 转换数据库中的隧道定义，代理密码使用占位符
+func savedTunnelFromDB(t *database.BookmarkTunnelDB) SavedTunnel {
+	st := SavedTunnel{
+		ID:         t.ID,
+		BookmarkID: t.BookmarkID,
+		Name:       t.Name,
+		TunnelType: t.TunnelType,
+		LocalAddr:  t.LocalAddr,
+		RemoteAddr: t.RemoteAddr,
+		AutoStart:  t.AutoStart,
+	}
+	if stored := decodeDynamicOptions(t); stored != nil {
+		opts := stored.DynamicOptions
+		if stored.PasswordEnc != "" || opts.Password != "" {
+			opts.Password = PasswordMask
+		}
+		st.Dynamic = &opts
+	}
+	return st
+}
+
+// decryptedSavedTunnel 转换数据库中的隧道定义并解密代理密码，用于启动隧道
+func (t *SSHTunnelService) decryptedSavedTunnel(dt *database.BookmarkTunnelDB) (SavedTunnel, error) {
+	st := savedTunnelFromDB(dt)
+	stored := decodeDynamicOptions(dt)
+	if stored == nil {
+		return st, nil
+	}
+	opts := stored.DynamicOptions
+	if stored.PasswordEnc != "" {
+		bs := t.sshService.bookmarkService
+		if bs == nil {
+			return st, fmt.Errorf("无法解密隧道 '%s' 的代理密码", dt.Name)
+		}
+		password, err := bs.decryptField(stored.PasswordEnc, "proxy password")
+		if err != nil {
+			return st, err
+		}
+		opts.Password = password
+	}
+	st.Dynamic = &opts
+	return st, nil
+}
+
+// encodeDynamicOptions 加密代理密码并序列化动态转发选项，Password 为占位符时沿用 existing 中的密码
+func (t *SSHTunnelService) encodeDynamicOptions(opts *DynamicOptions, existing *storedDynamicOptions) (string, error) {
+	if opts == nil {
+		return "", nil
+	}
+	stored := storedDynamicOptions{DynamicOptions: *opts}
+	stored.Password = ""
+	password := opts.Password
+	if password == PasswordMask {
+		password = ""
+		if existing != nil {
+			stored.PasswordEnc = existing.PasswordEnc
+			// 旧版本明文保存的密码在这里加密
+			password = existing.Password
+		}
+	}
+	if password != "" {
+		bs := t.sshService.bookmarkService
+		if bs == nil {
+			return "", fmt.Errorf("无法加密代理密码")
+		}
+		encrypted, err := bs.encryptField(password, "proxy password")
+		if err != nil {
+			return "", err
+		}
+		stored.PasswordEnc = encrypted
+	}
+	data, err := json.Marshal(stored)
+	if err != nil {
+		return "", fmt.Errorf("marshal tunnel options failed: %w", err)
+	}
+	return string(data), nil
+}
+
+// dynamicOptions 返回隧道定义的动态转发选项，未设置时为零值
+func (st SavedTunnel) dynamicOptions() DynamicOptions {
+	if st.Dynamic == nil {
+		return DynamicOptions{}
+	}
+	return *st.Dynamic
+}
+
+// validateSavedTunnel 校验隧道定义字段
+func validateSavedTunnel(st SavedTunnel) error {
+	if st.BookmarkID == "" {
+		return fmt.Errorf("隧道必须关联书签")
+	}
+	if st.Name == "" {
+		return fmt.Errorf("隧道名称不能为空")
+	}
+	if st.Dynamic != nil {
+		if _, err := newProxyPolicy(*st.Dynamic); err != nil {
+			return err
+		}
+	}
+	switch st.TunnelType {
+	case tunnelTypeRemoteDynamic:
+		// 远端动态转发没有本地地址
+	case tunnelTypeLocalUnix, tunnelTypeRemoteUnix:
+		if localNetwork(st.LocalAddr) == "unix" && !filepath.IsAbs(st.LocalAddr) {
+			return fmt.Errorf("本地地址无效: 需要 ip:port 或 socket 绝对路径")
+		}
+	default:
+		if _, _, err := net.SplitHostPort(st.LocalAddr); err != nil {
+			return fmt.Errorf("本地地址无效: %w", err)
+		}
+	}
+	switch st.TunnelType {
+	case tunnelTypeLocal:
+		if _, _, err := net.SplitHostPort(st.RemoteAddr); err != nil {
+			return fmt.Errorf("远程地址无效: %w", err)
+		}
+	case tunnelTypeRemote, tunnelTypeRemoteDynamic:
+		if _, err := normalizeRemoteBindAddr(st.RemoteAddr); err != nil {
+			return err
+		}
+	case tunnelTypeLocalUnix, tunnelTypeRemoteUnix:
+		if st.RemoteAddr == "" {
+			return fmt.Errorf("远端 socket 路径不能为空")
+		}
+	case tunnelTypeDynamic:
+	default:
+		return fmt.Errorf("未知的隧道类型: %s", st.TunnelType)
+	}
+	return nil
+}
+
+// ListSavedTunnels 列出书签下保存的隧道定义
+func (t *SSHTunnelService) ListSavedTunnels(bookmarkID string) ([]SavedTunnel, error) {
+	dbTunnels, err := t.db.TunnelRepo.GetTunnelsByBookmarkID(bookmarkID)
+	if err != nil {
+		return nil, err
+	}
+	result := make([]SavedTunnel, 0, len(dbTunnels))
+	for _, dt := range dbTunnels {
+		result = append(result, savedTunnelFromDB(dt))
+	}
+	return result, nil
+}
+
+// SaveTunnel 保存隧道定义，根据 ID 判断是新增还是更新，返回隧道定义 ID
+func (t *SSHTunnelService) SaveTunnel(st SavedTunnel) (string, error) {
+	if err := validateSavedTunnel(st); err != nil {
+		return "", err
+	}
+	if _, err := t.db.BookmarkRepo.GetBookmarkByID(st.BookmarkID); err != nil {
+		return "", fmt.Errorf("未找到 ID 为 '%s' 的书签", st.BookmarkID)
+	}
+	switch st.TunnelType {
+	case tunnelTypeDynamic:
+		st.RemoteAddr = ""
+	case tunnelTypeRemoteDynamic:
+		st.LocalAddr = ""
+	default:
+		st.Dynamic = nil
+	}
+	var existing *database.BookmarkTunnelDB
+	if st.ID != "" {
+		existing, _ = t.db.TunnelRepo.GetTunnelByID(st.ID)
+	}
+	var existingOpts *storedDynamicOptions
+	if existing != nil {
+		existingOpts = decodeDynamicOptions(existing)
+	}
+	options, err := t.encodeDynamicOptions(st.Dynamic, existingOpts)
+	if err != nil {
+		return "", err
+	}
+
+	now := time.Now()
+	dbTunnel := &database.BookmarkTunnelDB{
+		ID:         st.ID,
+		BookmarkID: st.BookmarkID,
+		Name:       st.Name,
+		TunnelType: st.TunnelType,
+		LocalAddr:  st.LocalAddr,
+		RemoteAddr: st.RemoteAddr,
+		AutoStart:  st.AutoStart,
+		Options:    options,
+		UpdatedAt:  now,
+	}
+	if existing != nil {
+		return st.ID, t.db.TunnelRepo.UpdateTunnel(dbTunnel)
+	}
+	dbTunnel.ID = utils.GenerateRandomID()
+	dbTunnel.CreatedAt = now
+	if err := t.db.TunnelRepo.InsertTunnel(dbTunnel); err != nil {
+		return "", err
+	}
+	return dbTunnel.ID, nil
+}
+
+// DeleteSavedTunnel 删除隧道定义，并停止由该定义启动的隧道
+func (t *SSHTunnelService) DeleteSavedTunnel(savedID string) error {
+	if err := t.db.TunnelRepo.DeleteTunnel(savedID); err != nil {
+		return err
+	}
+	t.stopBySavedID(savedID)
+	return nil
+}
+
+// StartSavedTunnel 在指定会话上启动保存的隧道定义，返回运行中的隧道 ID
+func (t *SSHTunnelService) StartSavedTunnel(sessionID string, savedID string) (string, error) {
+	dbTunnel, err := t.db.TunnelRepo.GetTunnelByID(savedID)
+	if err != nil {
+		return "", err
+	}
+	if running := t.findBySavedID(savedID); running != nil {
+		return "", fmt.Errorf("隧道 '%s' 已在运行", dbTunnel.Name)
+	}
+	st, err := t.decryptedSavedTunnel(dbTunnel)
+	if err != nil {
+		return "", err
+	}
+	return t.startSaved(sessionID, st)
+}
+
+func (t *SSHTunnelService) startSaved(sessionID string, st SavedTunnel) (string, error) {
+	meta := tunnelMeta{savedID: st.ID, name: st.Name}
+	switch st.TunnelType {
+	case tunnelTypeLocal:
+		return t.startLocal(sessionID, st.LocalAddr, st.RemoteAddr, meta)
+	case tunnelTypeRemote:
+		return t.startRemote(sessionID, st.RemoteAddr, st.LocalAddr, meta)
+	case tunnelTypeDynamic:
+		return t.startDynamic(sessionID, st.LocalAddr, st.dynamicOptions(), meta)
+	case tunnelTypeRemoteDynamic:
+		return t.startRemoteDynamic(sessionID, st.RemoteAddr, st.dynamicOptions(), meta)
+	case tunnelTypeLocalUnix:
+		return t.startLocalUnix(sessionID, st.LocalAddr, st.RemoteAddr, meta)
+	case tunnelTypeRemoteUnix:
+		return t.startRemoteUnix(sessionID, st.RemoteAddr, st.LocalAddr, meta)
+	}
+	return "", fmt.Errorf("未知的隧道类型: %s", st.TunnelType)
+}
+
+// startAutoTunnels 启动书签下所有自动启动的隧道，书签会话连接（含重连）后调用
+func (t *SSHTunnelService) startAutoTunnels(sessionID string, bookmarkID string) {
+	t.startBookmarkTunnels(sessionID, bookmarkID, true)
+}
+
+// startBookmarkTunnels 在会话上启动书签下的隧道定义，autoOnly 为 true 时只启动自动启动的定义
+func (t *SSHTunnelService) startBookmarkTunnels(sessionID string, bookmarkID string, autoOnly bool) {
+	dbTunnels, err := t.db.TunnelRepo.GetTunnelsByBookmarkID(bookmarkID)
+	if err != nil {
+		Logger.Warn("load bookmark tunnels failed", zap.String("bookmarkID", bookmarkID), zap.Error(err))
+		return
+	}
+	for _, dt := range dbTunnels {
+		if autoOnly && !dt.AutoStart {
+			continue
+		}
+		// 同一定义已由其他会话启动（例如同一书签打开了多个标签）时跳过
+		if t.findBySavedID(dt.ID) != nil {
+			continue
+		}
+		st, err := t.decryptedSavedTunnel(dt)
+		if err == nil {
+			_, err = t.startSaved(sessionID, st)
+		}
+		if err != nil {
+			Logger.Warn("start bookmark tunnel failed", zap.String("name", dt.Name), zap.Error(err))
+			app.Event.Emit(EventTunnelAutoStartFailed, fmt.Sprintf("隧道 '%s' 启动失败: %s", dt.Name, err.Error()))
+			continue
+		}
+		Logger.Debug("start bookmark tunnel", zap.String("name", dt.Name), zap.String("sessionID", sessionID))
+	}
+}
+
+// findBySavedID 查找由指定定义启动的运行中隧道
+func (t *SSHTunnelService) findBySavedID(savedID string) *SSHTunnel {
+	var found *SSHTunnel
+	sshTunnels.Range(func(_, value any) bool {
+		tunnel, ok := value.(*SSHTunnel)
+		if ok && tunnel.meta.savedID == savedID {
+			found = tunnel
+			return false
+		}
+		return true
+	})
+	return found
+}
+
+// stopBySavedID 停止由指定定义启动的隧道
+func (t *SSHTunnelService) stopBySavedID(savedID string) {
+	if tunnel := t.findBySavedID(savedID); tunnel != nil {
+		_ = t.StopByID(tunnel.ID)
+	}
+}
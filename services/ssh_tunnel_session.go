@@ -0,0 +1,140 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/ilaziness/vexo/internal/system"
+	"github.com/wailsapp/wails/v3/pkg/application"
+	"go.uber.org/zap"
+)
+
+// 隧道连接：不打开终端、只承载隧道的书签连接，不随终端标签关闭
+
+const (
+	// EventTunnelSessionClosed 隧道连接断开（保活失败）时通知前端，数据为会话 ID
+	EventTunnelSessionClosed = "eventTunnelSessionClosed"
+
+	tunnelSessionKeepAliveInterval = 30 * time.Second
+	tunnelSessionKeepAliveTimeout  = 15 * time.Second
+)
+
+func init() {
+	application.RegisterEvent[string](EventTunnelSessionClosed)
+}
+
+// TunnelSession 隧道连接信息，用于隧道管理视图
+type TunnelSession struct {
+	SessionID    string       `json:"sessionID"`
+	BookmarkID   string       `json:"bookmarkID"`
+	BookmarkName string       `json:"bookmarkName"`
+	ClientKey    string       `json:"clientKey"`
+	CreatedAt    int64        `json:"createdAt"` // unix 毫秒
+	Tunnels      []TunnelInfo `json:"tunnels"`
+}
+
+// ConnectBookmarkTunnels 以隧道连接方式连接书签：不创建终端，启动书签下所有隧道定义，返回会话 ID。
+// 隧道连接独立于终端标签，需要通过 CloseTunnelSession 关闭。
+func (bs *BookmarkService) ConnectBookmarkTunnels(bookmarkID string) (string, error) {
+	sessionID, err := bs.connectBookmark(bookmarkID, true)
+	if err != nil {
+		return "", err
+	}
+	connAny, ok := bs.sshService.SSHConnects.Load(sessionID)
+	if !ok {
+		return "", fmt.Errorf(ErrSSHConnectionNotFound, sessionID)
+	}
+	system.SafeGo(connAny.(*SSHConnect).keepAlive)
+
+	sshTunnelService.startBookmarkTunnels(sessionID, bookmarkID, false)
+	Logger.Debug("tunnel session connected", zap.String("sessionID", sessionID), zap.String("bookmarkID", bookmarkID))
+	return sessionID, nil
+}
+
+// keepAlive 定期发送 keepalive 请求保持隧道连接，失败时关闭连接并通知前端
+func (sc *SSHConnect) keepAlive() {
+	ticker := time.NewTicker(tunnelSessionKeepAliveInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-sc.headlessDone:
+			return
+		case <-ticker.C:
+		}
+
+		errCh := make(chan error, 1)
+		system.SafeGo(func() {
+			_, _, err := sc.client.SendRequest("keepalive@openssh.com", true, nil)
+			errCh <- err
+		})
+		var err error
+		select {
+		case <-sc.headlessDone:
+			return
+		case err = <-errCh:
+		case <-time.After(tunnelSessionKeepAliveTimeout):
+			err = errors.New("keepalive timeout")
+		}
+		if err == nil {
+			continue
+		}
+
+		Logger.Warn("tunnel session keepalive failed", zap.String("sessionID", sc.ID), zap.Error(err))
+		_ = sc.Close()
+		app.Event.Emit(EventTunnelSessionClosed, sc.ID)
+		return
+	}
+}
+
+// ListTunnelSessions 列出所有隧道连接及其运行中的隧道，按连接时间排序
+func (t *SSHTunnelService) ListTunnelSessions() []TunnelSession {
+	tunnelsBySession := make(map[string][]TunnelInfo)
+	sshTunnels.Range(func(_, value any) bool {
+		if tunnel, ok := value.(*SSHTunnel); ok {
+			tunnelsBySession[tunnel.sessionID] = append(tunnelsBySession[tunnel.sessionID], tunnel.info())
+		}
+		return true
+	})
+
+	sessions := make([]TunnelSession, 0)
+	t.sshService.SSHConnects.Range(func(_, value any) bool {
+		sc := value.(*SSHConnect)
+		if !sc.headless {
+			return true
+		}
+		ts := TunnelSession{
+			SessionID:  sc.ID,
+			BookmarkID: sc.bookmarkID,
+			ClientKey:  sc.clientKey,
+			CreatedAt:  sc.createdAt.UnixMilli(),
+			Tunnels:    tunnelsBySession[sc.ID],
+		}
+		if ts.Tunnels == nil {
+			ts.Tunnels = []TunnelInfo{}
+		}
+		if bookmark, err := t.db.BookmarkRepo.GetBookmarkByID(sc.bookmarkID); err == nil {
+			ts.BookmarkName = bookmark.Title
+		}
+		sessions = append(sessions, ts)
+		return true
+	})
+
+	sort.Slice(sessions, func(i, j int) bool {
+		return sessions[i].CreatedAt < sessions[j].CreatedAt
+	})
+	return sessions
+}
+
+// CloseTunnelSession 关闭隧道连接及其上的所有隧道
+func (t *SSHTunnelService) CloseTunnelSession(sessionID string) error {
+	connAny, ok := t.sshService.SSHConnects.Load(sessionID)
+	if !ok {
+		return fmt.Errorf(ErrSSHConnectionNotFound, sessionID)
+	}
+	if !connAny.(*SSHConnect).headless {
+		return fmt.Errorf("会话 %s 不是隧道连接", sessionID)
+	}
+	return t.sshService.CloseByID(sessionID)
+}
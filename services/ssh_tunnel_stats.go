@@ -0,0 +1,292 @@
+package services
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/ilaziness/vexo/internal/system"
+	"github.com/ilaziness/vexo/internal/utils"
+	"github.com/wailsapp/wails/v3/pkg/application"
+	"go.uber.org/zap"
+)
+
+// 隧道流量统计与活跃连接管理
+
+const (
+	EventTunnelStats = "eventTunnelStats"
+
+	tunnelStatsInterval = 2 * time.Second
+)
+
+func init() {
+	application.RegisterEvent[[]TunnelInfo](EventTunnelStats)
+}
+
+// tunnelStats 隧道流量统计，所有字段原子更新。
+// bytesOut 为发往转发目标的数据量，bytesIn 为目标返回的数据量。
+type tunnelStats struct {
+	bytesIn      atomic.Int64
+	bytesOut     atomic.Int64
+	totalConns   atomic.Int64
+	activeConns  atomic.Int64
+	dialFailures atomic.Int64
+	lastActive   atomic.Int64 // unix 毫秒
+}
+
+// tunnelConn 隧道中一条活跃的转发连接
+type tunnelConn struct {
+	id        string
+	source    string // 发起连接的一端地址
+	target    atomic.Value
+	startedAt time.Time
+	bytesIn   atomic.Int64
+	bytesOut  atomic.Int64
+	closeFn   func()
+}
+
+// TunnelConnInfo 活跃转发连接信息
+type TunnelConnInfo struct {
+	ID        string `json:"id"`
+	TunnelID  string `json:"tunnelID"`
+	Source    string `json:"source"`
+	Target    string `json:"target"`
+	StartedAt int64  `json:"startedAt"` // unix 毫秒
+	BytesIn   int64  `json:"bytesIn"`
+	BytesOut  int64  `json:"bytesOut"`
+}
+
+func (c *tunnelConn) getTarget() string {
+	target, _ := c.target.Load().(string)
+	return target
+}
+
+// trackConn 登记一条新的转发连接，closeFn 用于强制断开该连接
+func (tunnel *SSHTunnel) trackConn(source, target string, closeFn func()) *tunnelConn {
+	tc := &tunnelConn{
+		id:        utils.GenerateRandomID(),
+		source:    source,
+		startedAt: time.Now(),
+		closeFn:   closeFn,
+	}
+	tc.target.Store(target)
+	tunnel.stats.totalConns.Add(1)
+	tunnel.stats.activeConns.Add(1)
+	tunnel.stats.lastActive.Store(tc.startedAt.UnixMilli())
+
+	tunnel.connLock.Lock()
+	tunnel.conns[tc.id] = tc
+	tunnel.connLock.Unlock()
+	return tc
+}
+
+// untrackConn 移除已结束的转发连接
+func (tunnel *SSHTunnel) untrackConn(tc *tunnelConn) {
+	tunnel.connLock.Lock()
+	_, ok := tunnel.conns[tc.id]
+	delete(tunnel.conns, tc.id)
+	tunnel.connLock.Unlock()
+	if ok {
+		tunnel.stats.activeConns.Add(-1)
+	}
+}
+
+// closeAllConns 强制断开隧道中所有活跃连接
+func (tunnel *SSHTunnel) closeAllConns() {
+	tunnel.connLock.Lock()
+	conns := make([]*tunnelConn, 0, len(tunnel.conns))
+	for _, tc := range tunnel.conns {
+		conns = append(conns, tc)
+	}
+	tunnel.connLock.Unlock()
+	for _, tc := range conns {
+		tc.closeFn()
+	}
+}
+
+// addTraffic 累加流量，in 表示目标返回的数据
+func (tunnel *SSHTunnel) addTraffic(tc *tunnelConn, n int64, in bool) {
+	if in {
+		tunnel.stats.bytesIn.Add(n)
+		if tc != nil {
+			tc.bytesIn.Add(n)
+		}
+	} else {
+		tunnel.stats.bytesOut.Add(n)
+		if tc != nil {
+			tc.bytesOut.Add(n)
+		}
+	}
+	tunnel.stats.lastActive.Store(time.Now().UnixMilli())
+}
+
+// trafficWriter 统计写入字节数的 io.Writer
+type trafficWriter struct {
+	writer io.Writer
+	tunnel *SSHTunnel
+	conn   *tunnelConn
+	in     bool
+}
+
+func (tw *trafficWriter) Write(p []byte) (int, error) {
+	n, err := tw.writer.Write(p)
+	if n > 0 {
+		tw.tunnel.addTraffic(tw.conn, int64(n), tw.in)
+	}
+	return n, err
+}
+
+// trafficConn 统计读写字节数的 net.Conn，用于 SOCKS5 拨号得到的出站连接
+type trafficConn struct {
+	net.Conn
+	tunnel *SSHTunnel
+	conn   *tunnelConn
+}
+
+func (c *trafficConn) Read(p []byte) (int, error) {
+	n, err := c.Conn.Read(p)
+	if n > 0 {
+		c.tunnel.addTraffic(c.conn, int64(n), true)
+	}
+	return n, err
+}
+
+func (c *trafficConn) Write(p []byte) (int, error) {
+	n, err := c.Conn.Write(p)
+	if n > 0 {
+		c.tunnel.addTraffic(c.conn, int64(n), false)
+	}
+	return n, err
+}
+
+// forward 在 clientConn 与 targetConn 之间双向复制数据并统计流量，
+// 连接结束或隧道停止时返回
+func (tunnel *SSHTunnel) forward(clientConn, targetConn net.Conn, tc *tunnelConn) {
+	// 创建退出信号通道和同步机制
+	connExitCh := make(chan struct{})
+	var closeOnce sync.Once
+	closeConnExitCh := func() {
+		closeOnce.Do(func() {
+			close(connExitCh)
+		})
+	}
+
+	// 启动双向数据复制
+	tunnel.wg.Add(2)
+	system.SafeGo(func() {
+		defer tunnel.wg.Done()
+		io.Copy(&trafficWriter{writer: targetConn, tunnel: tunnel, conn: tc}, clientConn)
+		closeConnExitCh()
+		Logger.Debug("SSH tunnel copy1 exit")
+	})
+	system.SafeGo(func() {
+		defer tunnel.wg.Done()
+		io.Copy(&trafficWriter{writer: clientConn, tunnel: tunnel, conn: tc, in: true}, targetConn)
+		closeConnExitCh()
+		Logger.Debug("SSH tunnel copy2 exit")
+	})
+
+	select {
+	case <-connExitCh:
+		// 连接正常结束
+		Logger.Debug("SSH tunnel connection closed normally")
+	case <-tunnel.exitCh:
+		// 隧道被停止，需要中断连接
+		Logger.Debug("SSH tunnel stopping, closing connections")
+		clientConn.Close()
+		targetConn.Close()
+		<-connExitCh
+	}
+}
+
+// info 转换为前端展示的隧道信息
+func (tunnel *SSHTunnel) info() TunnelInfo {
+	return TunnelInfo{
+		ID:           tunnel.ID,
+		TunnelType:   tunnel.tunnelType,
+		SessionID:    tunnel.sessionID,
+		LocalAddr:    tunnel.LocalAddr,
+		RemoteAddr:   tunnel.RemoteAddr,
+		SavedID:      tunnel.meta.savedID,
+		Name:         tunnel.meta.name,
+		BytesIn:      tunnel.stats.bytesIn.Load(),
+		BytesOut:     tunnel.stats.bytesOut.Load(),
+		TotalConns:   tunnel.stats.totalConns.Load(),
+		ActiveConns:  tunnel.stats.activeConns.Load(),
+		DialFailures: tunnel.stats.dialFailures.Load(),
+		LastActive:   tunnel.stats.lastActive.Load(),
+	}
+}
+
+// TunnelConnections 列出隧道中的活跃转发连接，按建立时间排序
+func (t *SSHTunnelService) TunnelConnections(tunnelID string) ([]TunnelConnInfo, error) {
+	tunnelAny, ok := sshTunnels.Load(tunnelID)
+	if !ok {
+		return nil, fmt.Errorf("tunnel not found")
+	}
+	tunnel := tunnelAny.(*SSHTunnel)
+
+	tunnel.connLock.Lock()
+	result := make([]TunnelConnInfo, 0, len(tunnel.conns))
+	for _, tc := range tunnel.conns {
+		result = append(result, TunnelConnInfo{
+			ID:        tc.id,
+			TunnelID:  tunnel.ID,
+			Source:    tc.source,
+			Target:    tc.getTarget(),
+			StartedAt: tc.startedAt.UnixMilli(),
+			BytesIn:   tc.bytesIn.Load(),
+			BytesOut:  tc.bytesOut.Load(),
+		})
+	}
+	tunnel.connLock.Unlock()
+
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].StartedAt < result[j].StartedAt
+	})
+	return result, nil
+}
+
+// CloseTunnelConnection 强制断开隧道中的一条转发连接
+func (t *SSHTunnelService) CloseTunnelConnection(tunnelID string, connID string) error {
+	tunnelAny, ok := sshTunnels.Load(tunnelID)
+	if !ok {
+		return fmt.Errorf("tunnel not found")
+	}
+	tunnel := tunnelAny.(*SSHTunnel)
+
+	tunnel.connLock.Lock()
+	tc, ok := tunnel.conns[connID]
+	tunnel.connLock.Unlock()
+	if !ok {
+		return fmt.Errorf("connection not found")
+	}
+	tc.closeFn()
+	Logger.Debug("tunnel connection closed by user", zap.String("tunnelID", tunnelID), zap.String("source", tc.source))
+	return nil
+}
+
+// statsLoop 定期向前端推送隧道统计，隧道全部停止后推送一次空列表，之后不再推送
+func (t *SSHTunnelService) statsLoop() {
+	ticker := time.NewTicker(tunnelStatsInterval)
+	defer ticker.Stop()
+	idle := true
+	for range ticker.C {
+		infos := make([]TunnelInfo, 0)
+		sshTunnels.Range(func(_, value any) bool {
+			if tunnel, ok := value.(*SSHTunnel); ok {
+				infos = append(infos, tunnel.info())
+			}
+			return true
+		})
+		if app == nil || len(infos) == 0 && idle {
+			continue
+		}
+		idle = len(infos) == 0
+		app.Event.Emit(EventTunnelStats, infos)
+	}
+}
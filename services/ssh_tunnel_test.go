@@ -0,0 +1,31 @@
+package services
+
+import "testing"
+
+func TestNormalizeRemoteBindAddr(t *testing.T) {
+	tests := []struct {
+		addr    string
+		want    string
+		wantErr bool
+	}{
+		{"127.0.0.1:8080", "127.0.0.1:8080", false},
+		{":8080", "127.0.0.1:8080", false},
+		{"0.0.0.0:0", "0.0.0.0:0", false},
+		{"[::1]:22", "[::1]:22", false},
+		{"localhost:080", "localhost:80", false},
+		{"127.0.0.1", "", true},
+		{"127.0.0.1:-1", "", true},
+		{"127.0.0.1:65536", "", true},
+		{"127.0.0.1:http", "", true},
+	}
+	for _, tt := range tests {
+		got, err := normalizeRemoteBindAddr(tt.addr)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("normalizeRemoteBindAddr(%q): err %v, wantErr %v", tt.addr, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("normalizeRemoteBindAddr(%q): got %q, want %q", tt.addr, got, tt.want)
+		}
+	}
+}
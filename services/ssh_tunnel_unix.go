@@ -0,0 +1,214 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"runtime"
+	"syscall"
+	"time"
+
+	"github.com/ilaziness/vexo/internal/utils"
+	"go.uber.org/zap"
+)
+
+// unix domain socket 转发（OpenSSH streamlocal 扩展）
+
+const (
+	tunnelTypeLocalUnix  = "localUnix"
+	tunnelTypeRemoteUnix = "remoteUnix"
+
+	// localSocketFileMode 本地 socket 文件权限，仅当前用户可访问
+	localSocketFileMode = 0600
+)
+
+// localNetwork 判断本地地址类型：ip:port 为 tcp，其余视为 unix socket 路径。
+// 先判断绝对路径，避免 Windows 路径（C:\x.sock）被解析为 host:port
+func localNetwork(addr string) string {
+	if filepath.IsAbs(addr) {
+		return "unix"
+	}
+	if _, _, err := net.SplitHostPort(addr); err == nil {
+		return "tcp"
+	}
+	return "unix"
+}
+
+// listenLocalUnix 在本地 socket 路径上监听。
+// 已存在的 socket 文件连接被拒绝时视为残留并删除，仍在使用或无法确认时返回错误；
+// 非 Windows 系统先在 0700 的临时目录中创建 socket 并收紧权限，再移动到目标路径，
+// 避免 socket 在设置权限之前按 umask 的权限暴露
+func listenLocalUnix(socketPath string) (net.Listener, error) {
+	if !filepath.IsAbs(socketPath) {
+		return nil, fmt.Errorf("本地 socket 路径必须为绝对路径: %s", socketPath)
+	}
+	if info, err := os.Lstat(socketPath); err == nil {
+		if info.Mode()&os.ModeSocket == 0 {
+			return nil, fmt.Errorf("%s 已存在且不是 socket 文件", socketPath)
+		}
+		conn, err := net.DialTimeout("unix", socketPath, time.Second)
+		if err == nil {
+			conn.Close()
+			return nil, fmt.Errorf("%s 正在被其他程序使用", socketPath)
+		}
+		if !isConnRefused(err) {
+			return nil, fmt.Errorf("无法确认 %s 是否仍在使用: %w", socketPath, err)
+		}
+		if err := os.Remove(socketPath); err != nil {
+			return nil, fmt.Errorf("删除残留 socket 文件失败: %w", err)
+		}
+		Logger.Debug("removed stale socket file", zap.String("path", socketPath))
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+
+	dir := filepath.Dir(socketPath)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+	if runtime.GOOS == "windows" {
+		ln, err := net.Listen("unix", socketPath)
+		if err != nil {
+			return nil, err
+		}
+		ln.(*net.UnixListener).SetUnlinkOnClose(false)
+		return &unixSocketListener{Listener: ln, path: socketPath}, nil
+	}
+
+	// MkdirTemp 创建的目录权限为 0700，其他用户无法访问其中的 socket
+	privateDir, err := os.MkdirTemp(dir, ".vexo-sock-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(privateDir)
+	tmpPath := filepath.Join(privateDir, "s")
+	ln, err := net.Listen("unix", tmpPath)
+	if err != nil {
+		return nil, err
+	}
+	// socket 文件由 unixSocketListener 在关闭时删除
+	ln.(*net.UnixListener).SetUnlinkOnClose(false)
+	if err := os.Chmod(tmpPath, localSocketFileMode); err != nil {
+		ln.Close()
+		return nil, fmt.Errorf("设置 socket 文件权限失败: %w", err)
+	}
+	if err := os.Rename(tmpPath, socketPath); err != nil {
+		ln.Close()
+		return nil, fmt.Errorf("创建 socket 文件失败: %w", err)
+	}
+	return &unixSocketListener{Listener: ln, path: socketPath}, nil
+}
+
+// isConnRefused 判断连接 socket 的错误是否为连接被拒绝（无人监听），Windows 上为 WSAECONNREFUSED
+func isConnRefused(err error) bool {
+	return errors.Is(err, syscall.ECONNREFUSED) || errors.Is(err, syscall.Errno(10061))
+}
+
+// unixSocketListener 关闭时删除 socket 文件
+type unixSocketListener struct {
+	net.Listener
+	path string
+}
+
+func (l *unixSocketListener) Close() error {
+	err := l.Listener.Close()
+	if rmErr := os.Remove(l.path); rmErr != nil && !errors.Is(rmErr, os.ErrNotExist) {
+		Logger.Warn("remove socket file failed", zap.String("path", l.path), zap.Error(rmErr))
+	}
+	return err
+}
+
+// listenLocal 按地址类型在本地监听 tcp 端口或 unix socket
+func listenLocal(addr string) (net.Listener, error) {
+	if localNetwork(addr) == "unix" {
+		return listenLocalUnix(addr)
+	}
+	return net.Listen("tcp", addr)
+}
+
+// StartLocalUnix 本地转发到远端 unix socket（direct-streamlocal@openssh.com）。
+// localAddr 为本地监听地址，可以是 ip:port（例如 127.0.0.1:2375）或本地 socket 路径（例如 /tmp/docker.sock）
+// remoteSocket 为远端 socket 路径，例如 /var/run/docker.sock
+func (t *SSHTunnelService) StartLocalUnix(sessionID string, localAddr string, remoteSocket string) (string, error) {
+	return t.startLocalUnix(sessionID, localAddr, remoteSocket, tunnelMeta{})
+}
+
+func (t *SSHTunnelService) startLocalUnix(sessionID string, localAddr string, remoteSocket string, meta tunnelMeta) (string, error) {
+	connAny, ok := t.sshService.SSHConnects.Load(sessionID)
+	if !ok {
+		return "", sshSessionNotFoundErr
+	}
+	sc := connAny.(*SSHConnect)
+
+	if remoteSocket == "" {
+		return "", fmt.Errorf("远端 socket 路径不能为空")
+	}
+	ln, err := listenLocal(localAddr)
+	if err != nil {
+		return "", err
+	}
+
+	tunnel := &SSHTunnel{
+		ID:         utils.GenerateRandomID(),
+		tunnelType: tunnelTypeLocalUnix,
+		sessionID:  sessionID,
+		LocalAddr:  localAddr,
+		RemoteAddr: remoteSocket,
+		meta:       meta,
+		listener:   ln,
+		exitCh:     make(chan struct{}),
+		conns:      make(map[string]*tunnelConn),
+	}
+	sshTunnels.Store(tunnel.ID, tunnel)
+
+	tunnel.serve(func() (net.Conn, error) {
+		return sc.client.Dial("unix", tunnel.RemoteAddr)
+	}, tunnel.RemoteAddr)
+
+	return tunnel.ID, nil
+}
+
+// StartRemoteUnix 远端 unix socket 转发到本地（streamlocal-forward@openssh.com）。
+// remoteSocket 为远端监听的 socket 路径，服务器上已存在同名文件时需要开启 StreamLocalBindUnlink
+// localAddr 为本地转发目标，可以是 ip:port 或本地 socket 路径（例如 gpg-agent 的 S.gpg-agent.extra）
+func (t *SSHTunnelService) StartRemoteUnix(sessionID string, remoteSocket string, localAddr string) (string, error) {
+	return t.startRemoteUnix(sessionID, remoteSocket, localAddr, tunnelMeta{})
+}
+
+func (t *SSHTunnelService) startRemoteUnix(sessionID string, remoteSocket string, localAddr string, meta tunnelMeta) (string, error) {
+	connAny, ok := t.sshService.SSHConnects.Load(sessionID)
+	if !ok {
+		return "", sshSessionNotFoundErr
+	}
+	sc := connAny.(*SSHConnect)
+
+	if remoteSocket == "" {
+		return "", fmt.Errorf("远端 socket 路径不能为空")
+	}
+	ln, err := sc.client.ListenUnix(remoteSocket)
+	if err != nil {
+		return "", err
+	}
+
+	tunnel := &SSHTunnel{
+		ID:         utils.GenerateRandomID(),
+		tunnelType: tunnelTypeRemoteUnix,
+		sessionID:  sessionID,
+		LocalAddr:  localAddr,
+		RemoteAddr: remoteSocket,
+		meta:       meta,
+		listener:   ln,
+		exitCh:     make(chan struct{}),
+		conns:      make(map[string]*tunnelConn),
+	}
+	sshTunnels.Store(tunnel.ID, tunnel)
+
+	network := localNetwork(localAddr)
+	tunnel.serve(func() (net.Conn, error) {
+		return net.Dial(network, tunnel.LocalAddr)
+	}, tunnel.LocalAddr)
+
+	return tunnel.ID, nil
+}
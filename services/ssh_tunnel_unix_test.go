@@ -0,0 +1,70 @@
+package services
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+func TestListenLocalUnix(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("unix socket permissions are not used on windows")
+	}
+	socketPath := filepath.Join(t.TempDir(), "a.sock")
+	ln, err := listenLocalUnix(socketPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	info, err := os.Lstat(socketPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode()&os.ModeSocket == 0 || info.Mode().Perm() != localSocketFileMode {
+		t.Errorf("mode: got %v", info.Mode())
+	}
+	entries, _ := os.ReadDir(filepath.Dir(socketPath))
+	if len(entries) != 1 {
+		t.Errorf("private dir left behind: %d entries", len(entries))
+	}
+
+	if _, err := listenLocalUnix(socketPath); err == nil {
+		t.Error("expected error for socket in use")
+	}
+	if err := ln.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Lstat(socketPath); !os.IsNotExist(err) {
+		t.Errorf("socket not removed on close: %v", err)
+	}
+}
+
+func TestListenLocalUnixStaleSocket(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("unix socket permissions are not used on windows")
+	}
+	socketPath := filepath.Join(t.TempDir(), "stale.sock")
+	stale, err := net.Listen("unix", socketPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stale.(*net.UnixListener).SetUnlinkOnClose(false)
+	stale.Close()
+
+	ln, err := listenLocalUnix(socketPath)
+	if err != nil {
+		t.Fatalf("stale socket not replaced: %v", err)
+	}
+	ln.Close()
+}
+
+func TestListenLocalUnixRejectsRegularFile(t *testing.T) {
+	socketPath := filepath.Join(t.TempDir(), "file")
+	if err := os.WriteFile(socketPath, nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := listenLocalUnix(socketPath); err == nil {
+		t.Error("expected error for regular file")
+	}
+}
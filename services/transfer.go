@@ -3,8 +3,11 @@ package services
 import (
 	"context"
 	"errors"
+	"hash"
 	"io"
 	"math"
+	"path"
+	"path/filepath"
 	"sync"
 	"time"
 
@@ -18,6 +21,10 @@ const (
 
 	TransferTypeUpload   = "upload"
 	TransferTypeDownload = "download"
+	TransferTypeSync     = "sync"
+	TransferTypeRemote   = "remote"   // 服务器间直接传输
+	TransferTypeCompress = "compress" // 远程压缩
+	TransferTypeExtract  = "extract"  // 远程解压
 )
 
 func init() {
@@ -36,11 +43,58 @@ type ProgressData struct {
 	Rate         float64
 	Done         bool
 	Error        string
+	Resumable    bool    // 传输失败、取消或暂停后可以续传
+	Status       string  // 队列状态：queued/running/paused/done/failed/cancelled
+	Priority     int     // 队列优先级，越大越先执行
+	Transferred  int64   // 已传输字节数
+	Speed        float64 // 传输速度，字节/秒
+	ETA          int64   // 预计剩余秒数，-1 表示未知
+	Verify       string  // 传输后校验结果：passed/failed/unavailable，未校验时为空
+	RateLimit    int64   // 当前生效的限速，字节/秒，0 表示不限速
+}
+
+// transferSpec 描述一次传输任务，参数含义与对应的传输函数一致，用于失败后续传
+type transferSpec struct {
+	sessionID    string
+	transferType string
+	isDir        bool
+	// 上传：本地文件/目录；下载文件：本地保存的完整文件路径；下载目录：本地父目录；
+	// 服务器间传输：目标会话上的父目录
+	localPath string
+	// 上传：远程父目录；下载、服务器间传输：远程文件/目录
+	remotePath string
+	options    transferOptions
+}
+
+// transferOptions 传输任务的附加选项，以 JSON 保存在传输队列表中
+type transferOptions struct {
+	Sync     *DirSyncOptions      `json:"sync,omitempty"`     // 目录同步选项，同步任务的本地和远程路径均为同步根目录
+	SyncPlan *DirSyncPlan         `json:"syncPlan,omitempty"` // 用户确认的同步计划，执行时不会超出这个计划
+	Remote   *RemoteCopyOptions   `json:"remote,omitempty"`   // 服务器间传输选项
+	Archive  *ArchiveOptions      `json:"archive,omitempty"`  // 远程压缩、解压和 tar 流式下载选项
+	Conflict string               `json:"conflict,omitempty"` // 上传和下载的冲突处理方式，为空时覆盖
+	Attrs    *TransferAttrOptions `json:"attrs,omitempty"`    // 上传和下载的属性保留与符号链接处理选项
+}
+
+// trackerPaths 返回进度展示用的本地与远程路径
+func (s transferSpec) trackerPaths() (string, string) {
+	switch s.transferType {
+	case TransferTypeUpload:
+		return s.localPath, joinRemotePath(s.remotePath, filepath.Base(s.localPath))
+	case TransferTypeRemote:
+		return joinRemotePath(s.localPath, path.Base(s.remotePath)), s.remotePath
+	case TransferTypeExtract:
+		if s.options.Archive != nil {
+			return s.options.Archive.Target, s.remotePath
+		}
+	}
+	return s.localPath, s.remotePath
 }
 
 type progressReader struct {
 	reader  io.Reader
 	tracker *transferTracker
+	hash    hash.Hash // 开启传输校验时同时计算读取数据的哈希
 }
 
 func (pr *progressReader) Read(p []byte) (int, error) {
@@ -55,13 +109,21 @@ func (pr *progressReader) Read(p []byte) (int, error) {
 	n, err := pr.reader.Read(p)
 	if n > 0 {
 		pr.tracker.update(int64(n))
+		if pr.hash != nil {
+			pr.hash.Write(p[:n])
+		}
+		if throttleErr := pr.tracker.throttle(n); throttleErr != nil {
+			return n, throttleErr
+		}
 	}
 	return n, err
 }
 
 type progressWriter struct {
-	writer  io.Writer
-	tracker *transferTracker
+	writer     io.Writer
+	tracker    *transferTracker
+	hash       hash.Hash // 开启传输校验时同时计算写入数据的哈希
+	noThrottle bool      // 数据已在读取网络流时限速，这里只统计进度
 }
 
 func (pw *progressWriter) Write(p []byte) (int, error) {
@@ -73,14 +135,45 @@ func (pw *progressWriter) Write(p []byte) (int, error) {
 		return 0, pw.tracker.ctx.Err()
 	default:
 	}
+	if !pw.noThrottle {
+		if err := pw.tracker.throttle(len(p)); err != nil {
+			return 0, err
+		}
+	}
 	n, err := pw.writer.Write(p)
 	if n > 0 {
 		pw.tracker.update(int64(n))
+		if pw.hash != nil {
+			pw.hash.Write(p[:n])
+		}
+	}
+	return n, err
+}
+
+// throttledReader 按读取的字节数限速但不统计进度，用于进度按解压后大小计算的压缩数据流
+type throttledReader struct {
+	reader  io.Reader
+	tracker *transferTracker
+}
+
+func (tr *throttledReader) Read(p []byte) (int, error) {
+	n, err := tr.reader.Read(p)
+	if n > 0 {
+		if throttleErr := tr.tracker.throttle(n); throttleErr != nil {
+			return n, throttleErr
+		}
 	}
 	return n, err
 }
 
 type transferTracker struct {
+	spec         transferSpec
+	resume       bool              // 续传：已存在的部分文件从断点继续，已完成的文件跳过
+	verifyTail   bool              // 续传前校验已传输部分末尾的哈希
+	verifier     *transferVerifier // 传输后完整性校验，为 nil 时不校验
+	limiter      *rateLimiter      // 单个传输的限速
+	conflict     *conflictState    // 目标文件已存在时的处理，为 nil 时覆盖
+	priority     int
 	sessionID    string
 	id           string
 	transferType string
@@ -88,28 +181,41 @@ type transferTracker struct {
 	remoteFile   string
 	total        int64
 	transferred  int64
+	skipped      int64   // 续传跳过的字节数
+	speed        float64 // 平滑后的传输速度，字节/秒
+	lastBytes    int64   // 上次计算速度时的已传输字节数
+	lastTime     time.Time
 	mutex        sync.Mutex
 	ticker       *time.Ticker
 	done         chan struct{}
+	doneOnce     sync.Once
 	ctx          context.Context
 	cancelFunc   context.CancelFunc
 }
 
-func newTransferTracker(sessionID, transferType, localFile, remoteFile string, total int64) *transferTracker {
+func newTransferTracker(spec transferSpec, total int64) *transferTracker {
+	return newTransferTrackerWithID(utils.GenerateRandomID(), spec, total)
+}
+
+// newTransferTrackerWithID 使用指定 ID 创建传输进度，续传时沿用原传输 ID，前端列表中的条目随之更新
+func newTransferTrackerWithID(id string, spec transferSpec, total int64) *transferTracker {
 	ctx, cancelFunc := context.WithCancel(context.Background())
+	localFile, remoteFile := spec.trackerPaths()
 	tracker := &transferTracker{
-		sessionID:    sessionID,
-		id:           utils.GenerateRandomID(),
-		transferType: transferType,
+		spec:         spec,
+		sessionID:    spec.sessionID,
+		id:           id,
+		transferType: spec.transferType,
 		localFile:    localFile,
 		remoteFile:   remoteFile,
 		total:        total,
+		lastTime:     time.Now(),
 		done:         make(chan struct{}),
+		limiter:      newRateLimiter(),
 		ctx:          ctx,
 		cancelFunc:   cancelFunc,
 	}
 	activeTransfers.Store(tracker.id, tracker)
-	tracker.startProgress()
 	return tracker
 }
 
@@ -119,32 +225,117 @@ func (t *transferTracker) update(n int64) {
 	t.mutex.Unlock()
 }
 
+func (t *transferTracker) setPriority(priority int) {
+	t.mutex.Lock()
+	t.priority = priority
+	t.mutex.Unlock()
+}
+
+// skip 记录续传跳过的字节数，不计入传输速度
+func (t *transferTracker) skip(n int64) {
+	t.mutex.Lock()
+	t.transferred += n
+	t.lastBytes += n
+	t.skipped += n
+	t.mutex.Unlock()
+}
+
+// setTotal 设置总字节数，用于开始执行后才能确定总大小的任务
+func (t *transferTracker) setTotal(total int64) {
+	t.mutex.Lock()
+	t.total = total
+	t.mutex.Unlock()
+}
+
+func (t *transferTracker) getTotal() int64 {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	return t.total
+}
+
+// setTransferred 设置已传输字节数，用于由远程命令报告进度的传输
+func (t *transferTracker) setTransferred(n int64) {
+	t.mutex.Lock()
+	t.transferred = n
+	if t.lastBytes > n {
+		t.lastBytes = n
+	}
+	t.mutex.Unlock()
+}
+
+func (t *transferTracker) getTransferred() int64 {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	return t.transferred
+}
+
 func (t *transferTracker) getRate() float64 {
 	t.mutex.Lock()
 	defer t.mutex.Unlock()
-	if t.total == 0 {
+	return progressRate(t.transferred, t.total)
+}
+
+// progressRate 计算进度百分比，精确到 2 位小数
+func progressRate(transferred, total int64) float64 {
+	if total == 0 {
 		return 100.0
 	}
-	// 计算进度百分比
-	rate := float64(t.transferred) * 100.0 / float64(t.total)
+	rate := float64(transferred) * 100.0 / float64(total)
 	if rate > 100.0 {
 		rate = 100.0
 	}
-	// 精确到2位小数
 	return math.Round(rate*100) / 100
 }
 
-func (t *transferTracker) startProgress() {
-	// Emit initial progress with rate 0
-	app.Event.Emit(EventProgress, ProgressData{
+// sampleSpeed 根据距上次采样的增量更新平滑速度，返回速度和预计剩余秒数
+func (t *transferTracker) sampleSpeed() (float64, int64) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	now := time.Now()
+	if elapsed := now.Sub(t.lastTime).Seconds(); elapsed > 0 {
+		instant := float64(t.transferred-t.lastBytes) / elapsed
+		if t.speed == 0 {
+			t.speed = instant
+		} else {
+			t.speed = 0.7*t.speed + 0.3*instant
+		}
+	}
+	t.lastBytes = t.transferred
+	t.lastTime = now
+
+	eta := int64(-1)
+	if t.speed > 0 && t.total >= t.transferred {
+		eta = int64(math.Ceil(float64(t.total-t.transferred) / t.speed))
+	}
+	return t.speed, eta
+}
+
+// progress 组装当前进度数据
+func (t *transferTracker) progress(status string) ProgressData {
+	speed, eta := t.sampleSpeed()
+	t.mutex.Lock()
+	priority := t.priority
+	t.mutex.Unlock()
+	return ProgressData{
 		ID:           t.id,
 		SessionID:    t.sessionID,
 		TransferType: t.transferType,
 		LocalFile:    t.localFile,
 		RemoteFile:   t.remoteFile,
-		TotalSize:    t.total,
-		Rate:         0.0,
-	})
+		TotalSize:    t.getTotal(),
+		Rate:         t.getRate(),
+		Status:       status,
+		Priority:     priority,
+		Transferred:  t.getTransferred(),
+		Speed:        speed,
+		ETA:          eta,
+		RateLimit:    t.rateLimit(),
+	}
+}
+
+func (t *transferTracker) startProgress() {
+	// Emit initial progress with rate 0
+	app.Event.Emit(EventProgress, t.progress(TransferStatusRunning))
 
 	t.ticker = time.NewTicker(500 * time.Millisecond)
 	go func() {
@@ -152,20 +343,7 @@ func (t *transferTracker) startProgress() {
 		for {
 			select {
 			case <-t.ticker.C:
-				rate := t.getRate()
-				app.Event.Emit(EventProgress, ProgressData{
-					ID:           t.id,
-					SessionID:    t.sessionID,
-					TransferType: t.transferType,
-					LocalFile:    t.localFile,
-					RemoteFile:   t.remoteFile,
-					TotalSize:    t.total,
-					Rate:         rate,
-				})
-				if rate >= 100.0 {
-					close(t.done)
-					return
-				}
+				app.Event.Emit(EventProgress, t.progress(TransferStatusRunning))
 			case <-t.done:
 				return
 			}
@@ -173,31 +351,24 @@ func (t *transferTracker) startProgress() {
 	}()
 }
 
-func (t *transferTracker) stopProgress(err error) {
+// stopProgress 停止进度推送并发送最终状态
+func (t *transferTracker) stopProgress(status string, err error) {
 	if t.ticker != nil {
 		t.ticker.Stop()
 	}
-	select {
-	case <-t.done:
-		// already closed
-	default:
+	t.doneOnce.Do(func() {
 		close(t.done)
-	}
-	// Send final progress with Done: true
-	rate := t.getRate()
-	progressData := ProgressData{
-		ID:           t.id,
-		SessionID:    t.sessionID,
-		TransferType: t.transferType,
-		LocalFile:    t.localFile,
-		RemoteFile:   t.remoteFile,
-		TotalSize:    t.total,
-		Rate:         rate,
-		Done:         true,
-	}
-	if err != nil {
+	})
+	progressData := t.progress(status)
+	progressData.Speed = 0
+	progressData.ETA = -1
+	// 暂停的任务仍在队列中，不视为结束
+	progressData.Done = status != TransferStatusPaused
+	if err != nil && status != TransferStatusPaused {
 		progressData.Error = err.Error()
 	}
+	progressData.Verify = t.verifier.status()
+	progressData.Resumable = status == TransferStatusFailed || status == TransferStatusCancelled || status == TransferStatusPaused
 	app.Event.Emit(EventProgress, progressData)
 	activeTransfers.Delete(t.id)
 }
@@ -0,0 +1,294 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/ilaziness/vexo/internal/utils"
+	"github.com/wailsapp/wails/v3/pkg/application"
+	"go.uber.org/zap"
+)
+
+// 上传和下载的目标文件已存在时的处理策略。ask 模式通过事件询问前端，
+// 前端调用 ResolveTransferConflict 回复，可将选择应用到同一任务中剩余的冲突
+
+const (
+	EventTransferConflict = "eventTransferConflict"
+
+	ConflictOverwrite       = "overwrite"       // 覆盖（默认）
+	ConflictSkip            = "skip"            // 跳过
+	ConflictOverwriteNewer  = "overwrite-newer" // 源文件较新时覆盖，否则跳过
+	ConflictOverwriteSize   = "overwrite-size"  // 大小不同时覆盖，否则跳过
+	ConflictRename          = "rename"          // 保留已有文件，以 name (1).ext 的形式保存
+	ConflictAsk             = "ask"             // 询问
+	conflictRenameMaxSuffix = 1000
+)
+
+func init() {
+	application.RegisterEvent[TransferConflictEvent](EventTransferConflict)
+}
+
+var pendingConflicts = new(sync.Map) // map[conflictID]chan conflictAnswer
+
+// TransferConflictEvent 询问目标文件已存在时如何处理
+type TransferConflictEvent struct {
+	ConflictID    string `json:"conflictID"`
+	TransferID    string `json:"transferID"`
+	SessionID     string `json:"sessionID"`
+	TransferType  string `json:"transferType"`
+	Source        string `json:"source"`
+	Target        string `json:"target"`
+	SourceSize    int64  `json:"sourceSize"`
+	SourceModTime int64  `json:"sourceModTime"` // unix 秒
+	TargetSize    int64  `json:"targetSize"`
+	TargetModTime int64  `json:"targetModTime"` // unix 秒
+}
+
+type conflictAnswer struct {
+	action     string
+	applyToAll bool
+}
+
+// conflictState 任务的冲突处理状态，暂停后继续时沿用
+type conflictState struct {
+	mu     sync.Mutex
+	policy string
+	owned  map[string]bool // 本任务创建的目标文件，续传时不视为冲突，随任务持久化
+}
+
+// newConflictState 创建冲突处理状态，owned 为重启前保存的本任务创建的目标文件
+func newConflictState(policy string, owned []string) *conflictState {
+	c := &conflictState{policy: policy, owned: make(map[string]bool, len(owned))}
+	for _, target := range owned {
+		c.owned[target] = true
+	}
+	return c
+}
+
+func (c *conflictState) getPolicy() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.policy
+}
+
+func (c *conflictState) setPolicy(policy string) {
+	c.mu.Lock()
+	c.policy = policy
+	c.mu.Unlock()
+}
+
+func (c *conflictState) isOwned(target string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.owned[target]
+}
+
+func (c *conflictState) own(target string) {
+	c.mu.Lock()
+	c.owned[target] = true
+	c.mu.Unlock()
+}
+
+// ownedTargets 返回本任务创建的目标文件，按路径排序
+func (c *conflictState) ownedTargets() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	targets := make([]string, 0, len(c.owned))
+	for target := range c.owned {
+		targets = append(targets, target)
+	}
+	sort.Strings(targets)
+	return targets
+}
+
+// validConflictPolicy 检查冲突策略，空字符串表示覆盖
+func validConflictPolicy(policy string, allowAsk bool) error {
+	switch policy {
+	case "", ConflictOverwrite, ConflictSkip, ConflictOverwriteNewer, ConflictOverwriteSize, ConflictRename:
+		return nil
+	case ConflictAsk:
+		if allowAsk {
+			return nil
+		}
+	}
+	return fmt.Errorf("无效的冲突处理方式: %s", policy)
+}
+
+// defaultConflictPolicy 新建上传和下载任务使用的冲突策略
+func defaultConflictPolicy() string {
+	if ConfigSvc != nil && ConfigSvc.Config != nil {
+		return ConfigSvc.Config.Transfer.ConflictPolicy
+	}
+	return ""
+}
+
+// conflictResult 冲突处理结果
+type conflictResult struct {
+	target    string // 实际写入的目标路径，rename 时为新路径
+	skip      bool
+	overwrite bool // 覆盖已有文件，续传时也需要从头写入
+}
+
+// conflictTarget 抽象本地与远程文件系统的差异
+type conflictTarget struct {
+	stat func(string) (os.FileInfo, error)
+	dir  func(string) string
+	base func(string) string
+	join func(...string) string
+}
+
+var localConflictTarget = conflictTarget{stat: os.Stat, dir: filepath.Dir, base: filepath.Base, join: filepath.Join}
+
+func remoteConflictTarget(stat func(string) (os.FileInfo, error)) conflictTarget {
+	return conflictTarget{stat: stat, dir: path.Dir, base: path.Base, join: joinRemotePath}
+}
+
+// checkConflict 检查目标文件是否已存在并按策略处理。覆盖策略不做检查，与之前的行为一致；
+// 本任务写入过的目标文件不视为冲突，续传时从断点继续。其他已存在的文件即使小于源文件也按策略处理，
+// 不能当作上次未完成的部分文件续传
+func (t *transferTracker) checkConflict(source string, srcInfo os.FileInfo, target string, fs conflictTarget) (conflictResult, error) {
+	result := conflictResult{target: target}
+	c := t.conflict
+	if c == nil {
+		return result, nil
+	}
+	policy := c.getPolicy()
+	if policy == "" || policy == ConflictOverwrite || c.isOwned(target) {
+		return result, nil
+	}
+	dstInfo, err := fs.stat(target)
+	if err != nil {
+		if os.IsNotExist(err) {
+			c.own(target)
+			return result, nil
+		}
+		return result, err
+	}
+	if dstInfo.IsDir() {
+		return result, fmt.Errorf("%s 是已存在的目录", target)
+	}
+	if policy == ConflictAsk {
+		answer, err := t.askConflict(source, srcInfo, target, dstInfo)
+		if err != nil {
+			return result, err
+		}
+		policy = answer.action
+		if answer.applyToAll {
+			c.setPolicy(policy)
+		}
+	}
+
+	switch policy {
+	case ConflictSkip:
+		result.skip = true
+	case ConflictOverwriteNewer:
+		result.skip = !srcInfo.ModTime().After(dstInfo.ModTime()) || mtimeEqual(srcInfo.ModTime(), dstInfo.ModTime())
+	case ConflictOverwriteSize:
+		result.skip = srcInfo.Size() == dstInfo.Size()
+	case ConflictRename:
+		renamed, err := renameTarget(target, fs)
+		if err != nil {
+			return result, err
+		}
+		result.target = renamed
+	}
+	if result.skip {
+		Logger.Debug("transfer conflict skip", zap.String("id", t.id), zap.String("target", target), zap.String("policy", policy))
+		t.skip(srcInfo.Size())
+		return result, nil
+	}
+	result.overwrite = result.target == target
+	c.own(result.target)
+	return result, nil
+}
+
+// renameTarget 查找不存在的文件名：name (1).ext、name (2).ext……
+func renameTarget(target string, fs conflictTarget) (string, error) {
+	dir := fs.dir(target)
+	stem, ext := splitExt(fs.base(target))
+	for i := 1; i <= conflictRenameMaxSuffix; i++ {
+		candidate := fs.join(dir, fmt.Sprintf("%s (%d)%s", stem, i, ext))
+		if _, err := fs.stat(candidate); err != nil {
+			if os.IsNotExist(err) {
+				return candidate, nil
+			}
+			return "", err
+		}
+	}
+	return "", fmt.Errorf("%s: 找不到可用的文件名", target)
+}
+
+// splitExt 拆分文件名和扩展名，.tar.gz 等视为一个扩展名
+func splitExt(name string) (string, string) {
+	ext := path.Ext(name)
+	if ext == "" || ext == name {
+		return name, ""
+	}
+	stem := strings.TrimSuffix(name, ext)
+	if tarExt := path.Ext(stem); strings.EqualFold(tarExt, ".tar") && tarExt != stem {
+		return strings.TrimSuffix(stem, tarExt), tarExt + ext
+	}
+	return stem, ext
+}
+
+// askConflict 推送冲突事件并等待前端回复，任务取消或暂停时返回错误
+func (t *transferTracker) askConflict(source string, srcInfo os.FileInfo, target string, dstInfo os.FileInfo) (conflictAnswer, error) {
+	if app == nil {
+		return conflictAnswer{action: ConflictSkip}, nil
+	}
+	id := utils.GenerateRandomID()
+	ch := make(chan conflictAnswer, 1)
+	pendingConflicts.Store(id, ch)
+	defer pendingConflicts.Delete(id)
+	app.Event.Emit(EventTransferConflict, TransferConflictEvent{
+		ConflictID:    id,
+		TransferID:    t.id,
+		SessionID:     t.sessionID,
+		TransferType:  t.transferType,
+		Source:        source,
+		Target:        target,
+		SourceSize:    srcInfo.Size(),
+		SourceModTime: srcInfo.ModTime().Unix(),
+		TargetSize:    dstInfo.Size(),
+		TargetModTime: dstInfo.ModTime().Unix(),
+	})
+	select {
+	case answer := <-ch:
+		return answer, nil
+	case <-t.ctx.Done():
+		return conflictAnswer{}, errors.New("user cancelled")
+	}
+}
+
+// ResolveTransferConflict 回复冲突询问，action 为 overwrite/skip/overwrite-newer/overwrite-size/rename，
+// applyToAll 为 true 时同一任务剩余的冲突使用相同的处理方式
+func (sft *SftpService) ResolveTransferConflict(conflictID string, action string, applyToAll bool) error {
+	Logger.Debug("ResolveTransferConflict", zap.String("conflictID", conflictID), zap.String("action", action), zap.Bool("applyToAll", applyToAll))
+	if action == "" {
+		return fmt.Errorf("请选择冲突处理方式")
+	}
+	if err := validConflictPolicy(action, false); err != nil {
+		return err
+	}
+	value, ok := pendingConflicts.LoadAndDelete(conflictID)
+	if !ok {
+		return fmt.Errorf("conflict with ID %s not found", conflictID)
+	}
+	value.(chan conflictAnswer) <- conflictAnswer{action: action, applyToAll: applyToAll}
+	return nil
+}
+
+// SetTransferConflictPolicy 修改上传或下载任务的冲突处理方式，进行中的目录任务对剩余文件生效
+func (sft *SftpService) SetTransferConflictPolicy(transferID string, policy string) error {
+	Logger.Debug("SetTransferConflictPolicy", zap.String("transferID", transferID), zap.String("policy", policy))
+	if err := validConflictPolicy(policy, true); err != nil {
+		return err
+	}
+	return transferQueue.setConflictPolicy(transferID, policy)
+}
@@ -0,0 +1,122 @@
+package services
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestSplitExt(t *testing.T) {
+	tests := []struct {
+		name, stem, ext string
+	}{
+		{"a.txt", "a", ".txt"},
+		{"backup.tar.gz", "backup", ".tar.gz"},
+		{"backup.TAR.xz", "backup", ".TAR.xz"},
+		{".bashrc", ".bashrc", ""},
+		{".tar.gz", ".tar", ".gz"},
+		{"Makefile", "Makefile", ""},
+	}
+	for _, tt := range tests {
+		if stem, ext := splitExt(tt.name); stem != tt.stem || ext != tt.ext {
+			t.Errorf("splitExt(%q): got %q %q, want %q %q", tt.name, stem, ext, tt.stem, tt.ext)
+		}
+	}
+}
+
+func TestRenameTarget(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"a.tar.gz", "a (1).tar.gz"} {
+		if err := os.WriteFile(filepath.Join(dir, name), nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	got, err := renameTarget(filepath.Join(dir, "a.tar.gz"), localConflictTarget)
+	if err != nil || got != filepath.Join(dir, "a (2).tar.gz") {
+		t.Errorf("renameTarget: got %q, %v", got, err)
+	}
+}
+
+func TestCheckConflict(t *testing.T) {
+	dir := t.TempDir()
+	now := time.Now()
+	write := func(name string, size int, mtime time.Time) (string, os.FileInfo) {
+		p := filepath.Join(dir, name)
+		if err := os.WriteFile(p, make([]byte, size), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(p, mtime, mtime); err != nil {
+			t.Fatal(err)
+		}
+		info, err := os.Stat(p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return p, info
+	}
+	src, srcInfo := write("src.txt", 10, now)
+	older, _ := write("older.txt", 10, now.Add(-time.Hour))
+	newer, _ := write("newer.txt", 5, now.Add(time.Hour))
+	partial, _ := write("partial.txt", 4, now)
+	missing := filepath.Join(dir, "missing.txt")
+
+	tests := []struct {
+		name      string
+		policy    string
+		resume    bool
+		target    string
+		skip      bool
+		overwrite bool
+		renamed   bool
+	}{
+		{"default overwrites", "", false, older, false, false, false},
+		{"missing target", ConflictSkip, false, missing, false, false, false},
+		{"skip", ConflictSkip, false, older, true, false, false},
+		{"newer source", ConflictOverwriteNewer, false, older, false, true, false},
+		{"older source", ConflictOverwriteNewer, false, newer, true, false, false},
+		{"same size", ConflictOverwriteSize, false, older, true, false, false},
+		{"different size", ConflictOverwriteSize, false, newer, false, true, false},
+		{"rename", ConflictRename, false, older, false, false, true},
+		{"resume existing smaller file", ConflictSkip, true, partial, true, false, false},
+		{"ask without frontend", ConflictAsk, false, older, true, false, false},
+	}
+	for _, tt := range tests {
+		tracker := newTransferTracker(transferSpec{}, 0)
+		tracker.conflict = newConflictState(tt.policy, nil)
+		tracker.resume = tt.resume
+		result, err := tracker.checkConflict(src, srcInfo, tt.target, localConflictTarget)
+		activeTransfers.Delete(tracker.id)
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if result.skip != tt.skip || result.overwrite != tt.overwrite || (result.target != tt.target) != tt.renamed {
+			t.Errorf("%s: got %+v", tt.name, result)
+		}
+	}
+
+	tracker := newTransferTracker(transferSpec{}, 0)
+	defer activeTransfers.Delete(tracker.id)
+	tracker.conflict = newConflictState(ConflictSkip, nil)
+	if _, err := tracker.checkConflict(src, srcInfo, dir, localConflictTarget); err == nil {
+		t.Errorf("directory target: expected error")
+	}
+	// 本任务写入过的目标不再视为冲突
+	tracker.conflict.own(older)
+	if result, err := tracker.checkConflict(src, srcInfo, older, localConflictTarget); err != nil || result.skip {
+		t.Errorf("owned target: got %+v, %v", result, err)
+	}
+
+	// 重启后恢复的任务：保存的目标文件按部分文件续传
+	resumed := newTransferTracker(transferSpec{}, 0)
+	defer activeTransfers.Delete(resumed.id)
+	resumed.conflict = newConflictState(ConflictSkip, tracker.conflict.ownedTargets())
+	resumed.resume = true
+	if result, err := resumed.checkConflict(src, srcInfo, older, localConflictTarget); err != nil || result.skip || result.overwrite {
+		t.Errorf("restored owned target: got %+v, %v", result, err)
+	}
+	if result, err := resumed.checkConflict(src, srcInfo, partial, localConflictTarget); err != nil || !result.skip {
+		t.Errorf("target not owned: got %+v, %v", result, err)
+	}
+}
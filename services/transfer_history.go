@@ -0,0 +1,254 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"time"
+
+	"github.com/ilaziness/vexo/internal/database"
+	"go.uber.org/zap"
+)
+
+// 传输历史：每个结束（完成、失败、取消）的传输保存到 SQLite，支持查询、清理和重新执行
+
+// TransferHistoryEntry 一条传输历史
+type TransferHistoryEntry struct {
+	ID           int     `json:"id"`
+	TransferID   string  `json:"transferID"`
+	SessionID    string  `json:"sessionID"`
+	BookmarkID   string  `json:"bookmarkID"` // 通过书签连接时的书签 ID
+	Host         string  `json:"host"`       // user@host:port
+	TransferType string  `json:"transferType"`
+	IsDir        bool    `json:"isDir"`
+	LocalFile    string  `json:"localFile"`
+	RemoteFile   string  `json:"remoteFile"`
+	TotalSize    int64   `json:"totalSize"`
+	Transferred  int64   `json:"transferred"`
+	DurationMs   int64   `json:"durationMs"`
+	AvgSpeed     float64 `json:"avgSpeed"` // 字节/秒，不包含续传跳过的部分
+	Status       string  `json:"status"`   // done/failed/cancelled
+	Error        string  `json:"error"`
+	Verify       string  `json:"verify"`
+	StartedAt    int64   `json:"startedAt"`  // unix 毫秒
+	FinishedAt   int64   `json:"finishedAt"` // unix 毫秒
+}
+
+// TransferHistoryQuery 传输历史查询条件，字段为空或 0 时不限制
+type TransferHistoryQuery struct {
+	Keyword      string `json:"keyword"` // 匹配本地路径、远程路径、主机和错误信息
+	Status       string `json:"status"`
+	TransferType string `json:"transferType"`
+	BookmarkID   string `json:"bookmarkID"`
+	Since        int64  `json:"since"` // 结束时间不早于，unix 毫秒
+	Until        int64  `json:"until"` // 结束时间早于，unix 毫秒
+	Limit        int    `json:"limit"` // 默认 100
+	Offset       int    `json:"offset"`
+}
+
+// TransferHistoryPage 传输历史查询结果
+type TransferHistoryPage struct {
+	Items []TransferHistoryEntry `json:"items"`
+	Total int                    `json:"total"` // 符合条件的总数
+}
+
+// maxTransferHistory 传输历史最多保留的条数，超出时删除最早结束的记录
+const maxTransferHistory = 10000
+
+// defaultHistoryDays 未配置时传输历史保留的天数
+const defaultHistoryDays = 90
+
+// sessionOrigin 返回会话对应的书签 ID 和 user@host:port，会话已关闭时返回空字符串。
+// 主机使用连接时指定的目标主机，经跳板机连接时不是跳板机的地址
+func sessionOrigin(sessionID string) (string, string) {
+	connVal, ok := sftpClient.Load(sessionID)
+	if !ok {
+		return "", ""
+	}
+	sft := connVal.(*SftpService)
+	var bookmarkID, host string
+	if sft.sshConnect != nil {
+		bookmarkID = sft.sshConnect.bookmarkID
+	}
+	if sft.sshClient != nil {
+		addr := sft.sshClient.RemoteAddr().String()
+		if sft.sshConnect != nil && sft.sshConnect.host != "" {
+			addr = net.JoinHostPort(sft.sshConnect.host, strconv.Itoa(sft.sshConnect.port))
+		}
+		host = sft.sshClient.User() + "@" + addr
+	}
+	return bookmarkID, host
+}
+
+// historyRecord 生成结束的传输对应的历史记录，调用方需持有锁
+func (q *TransferQueue) historyRecord(job *transferJob, skipped int64) *database.TransferHistoryDB {
+	finishedAt := time.Now()
+	startedAt := job.startedAt
+	if startedAt.IsZero() {
+		startedAt = finishedAt
+	}
+	duration := finishedAt.Sub(startedAt)
+	var avgSpeed float64
+	if seconds := duration.Seconds(); seconds > 0 {
+		avgSpeed = float64(max(job.transferred-skipped, 0)) / seconds
+	}
+	// 同步计划只对当次执行有效，重新同步需要重新预览，不保存到历史
+	historyOptions := job.spec.options
+	historyOptions.SyncPlan = nil
+	var options string
+	if historyOptions != (transferOptions{}) {
+		if data, err := json.Marshal(historyOptions); err == nil {
+			options = string(data)
+		}
+	}
+	bookmarkID, host := sessionOrigin(job.spec.sessionID)
+	if host == "" {
+		host = job.host
+	}
+	return &database.TransferHistoryDB{
+		JobID:        job.id,
+		SessionID:    job.spec.sessionID,
+		BookmarkID:   bookmarkID,
+		Host:         host,
+		TransferType: job.spec.transferType,
+		IsDir:        job.spec.isDir,
+		LocalPath:    job.spec.localPath,
+		RemotePath:   job.spec.remotePath,
+		TotalSize:    job.total,
+		Transferred:  job.transferred,
+		DurationMs:   duration.Milliseconds(),
+		AvgSpeed:     avgSpeed,
+		Status:       job.status,
+		Error:        job.err,
+		Verify:       job.verify,
+		Options:      options,
+		StartedAt:    startedAt,
+		FinishedAt:   finishedAt,
+	}
+}
+
+// saveHistory 保存传输历史并删除超出保留期限和条数的记录，不能在持有队列锁时调用
+func (q *TransferQueue) saveHistory(record *database.TransferHistoryDB) {
+	if _, err := q.repo.InsertHistory(record); err != nil {
+		Logger.Warn("insert transfer history failed", zap.String("id", record.JobID), zap.Error(err))
+		return
+	}
+	days := defaultHistoryDays
+	if ConfigSvc != nil && ConfigSvc.Config != nil && ConfigSvc.Config.Transfer.HistoryDays > 0 {
+		days = ConfigSvc.Config.Transfer.HistoryDays
+	}
+	if err := q.repo.PruneHistory(time.Now().AddDate(0, 0, -days), maxTransferHistory); err != nil {
+		Logger.Warn("prune transfer history failed", zap.Error(err))
+	}
+}
+
+// historySpec 根据历史记录还原传输任务
+func historySpec(h *database.TransferHistoryDB) transferSpec {
+	var options transferOptions
+	if h.Options != "" {
+		if err := json.Unmarshal([]byte(h.Options), &options); err != nil {
+			Logger.Warn("parse transfer history options failed", zap.Int("id", h.ID), zap.Error(err))
+		}
+	}
+	return transferSpec{
+		sessionID:    h.SessionID,
+		transferType: h.TransferType,
+		isDir:        h.IsDir,
+		localPath:    h.LocalPath,
+		remotePath:   h.RemotePath,
+		options:      options,
+	}
+}
+
+// ListTransferHistory 按结束时间倒序查询传输历史
+func (sft *SftpService) ListTransferHistory(query TransferHistoryQuery) (TransferHistoryPage, error) {
+	filter := database.TransferHistoryFilter{
+		Keyword:      query.Keyword,
+		Status:       query.Status,
+		TransferType: query.TransferType,
+		BookmarkID:   query.BookmarkID,
+		Limit:        query.Limit,
+		Offset:       query.Offset,
+	}
+	if query.Since > 0 {
+		filter.Since = time.UnixMilli(query.Since)
+	}
+	if query.Until > 0 {
+		filter.Until = time.UnixMilli(query.Until)
+	}
+	rows, total, err := transferQueue.repo.ListHistory(filter)
+	if err != nil {
+		return TransferHistoryPage{}, err
+	}
+	items := make([]TransferHistoryEntry, 0, len(rows))
+	for _, h := range rows {
+		localFile, remoteFile := historySpec(h).trackerPaths()
+		items = append(items, TransferHistoryEntry{
+			ID:           h.ID,
+			TransferID:   h.JobID,
+			SessionID:    h.SessionID,
+			BookmarkID:   h.BookmarkID,
+			Host:         h.Host,
+			TransferType: h.TransferType,
+			IsDir:        h.IsDir,
+			LocalFile:    localFile,
+			RemoteFile:   remoteFile,
+			TotalSize:    h.TotalSize,
+			Transferred:  h.Transferred,
+			DurationMs:   h.DurationMs,
+			AvgSpeed:     h.AvgSpeed,
+			Status:       h.Status,
+			Error:        h.Error,
+			Verify:       h.Verify,
+			StartedAt:    h.StartedAt.UnixMilli(),
+			FinishedAt:   h.FinishedAt.UnixMilli(),
+		})
+	}
+	return TransferHistoryPage{Items: items, Total: total}, nil
+}
+
+// DeleteTransferHistory 删除一条传输历史
+func (sft *SftpService) DeleteTransferHistory(id int) error {
+	Logger.Debug("DeleteTransferHistory", zap.Int("id", id))
+	return transferQueue.repo.DeleteHistory(id)
+}
+
+// ClearTransferHistory 清理 before（unix 毫秒）之前结束的传输历史，before 为 0 时清空全部
+func (sft *SftpService) ClearTransferHistory(before int64) error {
+	Logger.Debug("ClearTransferHistory", zap.Int64("before", before))
+	var t time.Time
+	if before > 0 {
+		t = time.UnixMilli(before)
+	}
+	return transferQueue.repo.ClearHistory(t)
+}
+
+// RerunTransfer 按历史记录重新执行相同的传输，返回新的传输 ID。
+// sessionID 为空时使用原会话，原会话已关闭时需要指定同一主机的新会话；目录同步需要重新预览，不能重新执行
+func (sft *SftpService) RerunTransfer(historyID int, sessionID string) (string, error) {
+	Logger.Debug("RerunTransfer", zap.Int("historyID", historyID), zap.String("sessionID", sessionID))
+	h, err := transferQueue.repo.GetHistory(historyID)
+	if err != nil {
+		return "", err
+	}
+	spec := historySpec(h)
+	if spec.transferType == TransferTypeSync {
+		// 同步会删除多余的文件，必须按当前的目录内容重新预览并确认
+		return "", errors.New("目录同步不能直接重新执行，请重新预览同步计划后再同步")
+	}
+	if sessionID != "" {
+		spec.sessionID = sessionID
+	}
+	if _, err := sft.getSftpClient(spec.sessionID); err != nil {
+		return "", errors.New("传输所属的会话已关闭，请指定新的会话")
+	}
+	if _, host := sessionOrigin(spec.sessionID); h.Host != "" && host != h.Host {
+		return "", fmt.Errorf("会话连接的主机 %s 与传输记录的主机 %s 不一致", host, h.Host)
+	}
+	if spec.transferType == TransferTypeRemote && spec.options.Remote == nil {
+		return "", fmt.Errorf("缺少服务器间传输选项")
+	}
+	return transferQueue.enqueue(spec, 0), nil
+}
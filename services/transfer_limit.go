@@ -0,0 +1,176 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// 传输限速：令牌桶分为全局、会话和单个传输三级，数据需要同时通过三级限速，限速值可在传输过程中修改
+
+const (
+	rateLimitMinBurst  = 32 << 10 // 令牌桶最小容量
+	rateLimitMaxSleep  = 100 * time.Millisecond
+	rateLimitBurstTime = 250 * time.Millisecond // 令牌桶容量对应的时间
+)
+
+var (
+	globalRateLimiter   = newRateLimiter()
+	sessionRateLimiters = new(sync.Map) // map[sessionID]*rateLimiter
+)
+
+// rateLimiter 令牌桶限速器，rate 为 0 表示不限速。
+// 先取令牌再等待欠额补足，多个传输共享同一个桶时总速度不超过限速
+type rateLimiter struct {
+	mu     sync.Mutex
+	rate   float64 // 字节/秒
+	tokens float64
+	last   time.Time
+}
+
+func newRateLimiter() *rateLimiter {
+	return &rateLimiter{last: time.Now()}
+}
+
+// setRate 修改限速，bytesPerSec 为 0 表示不限速，正在等待的传输按新的速度继续
+func (l *rateLimiter) setRate(bytesPerSec int64) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.refill()
+	l.rate = float64(bytesPerSec)
+	if l.rate <= 0 || l.tokens > l.burst() {
+		l.tokens = 0
+	}
+}
+
+func (l *rateLimiter) getRate() int64 {
+	if l == nil {
+		return 0
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return int64(l.rate)
+}
+
+func (l *rateLimiter) burst() float64 {
+	return max(l.rate*rateLimitBurstTime.Seconds(), rateLimitMinBurst)
+}
+
+// refill 按经过的时间补充令牌，调用方需持有锁
+func (l *rateLimiter) refill() {
+	now := time.Now()
+	if l.rate > 0 {
+		l.tokens = min(l.tokens+now.Sub(l.last).Seconds()*l.rate, l.burst())
+	}
+	l.last = now
+}
+
+// deficit 返回补足欠额还需要等待的时间
+func (l *rateLimiter) deficit() time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.refill()
+	if l.rate <= 0 {
+		l.tokens = 0
+		return 0
+	}
+	if l.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-l.tokens / l.rate * float64(time.Second))
+}
+
+// wait 取出 n 个令牌，令牌不足时等待，ctx 取消时返回错误
+func (l *rateLimiter) wait(ctx context.Context, n int) error {
+	if l == nil || n <= 0 {
+		return nil
+	}
+	l.mu.Lock()
+	l.refill()
+	if l.rate <= 0 {
+		l.mu.Unlock()
+		return nil
+	}
+	l.tokens -= float64(n)
+	l.mu.Unlock()
+
+	// 分段等待，限速修改后尽快按新的速度继续
+	for {
+		d := l.deficit()
+		if d <= 0 {
+			return nil
+		}
+		timer := time.NewTimer(min(d, rateLimitMaxSleep))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// sessionRateLimiter 获取会话的限速器，未设置时返回 nil
+func sessionRateLimiter(sessionID string) *rateLimiter {
+	if value, ok := sessionRateLimiters.Load(sessionID); ok {
+		return value.(*rateLimiter)
+	}
+	return nil
+}
+
+// throttle 依次通过传输、会话和全局限速
+func (t *transferTracker) throttle(n int) error {
+	for _, l := range []*rateLimiter{t.limiter, sessionRateLimiter(t.sessionID), globalRateLimiter} {
+		if err := l.wait(t.ctx, n); err != nil {
+			if errors.Is(err, context.Canceled) {
+				return errors.New("user cancelled")
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+// rateLimit 返回当前生效的限速，即三级限速中的最小值，0 表示不限速
+func (t *transferTracker) rateLimit() int64 {
+	var limit int64
+	for _, rate := range []int64{t.limiter.getRate(), sessionRateLimiter(t.sessionID).getRate(), globalRateLimiter.getRate()} {
+		if rate > 0 && (limit == 0 || rate < limit) {
+			limit = rate
+		}
+	}
+	return limit
+}
+
+// SetSessionRateLimit 设置会话所有传输的总限速（字节/秒），0 表示不限速，立即对进行中的传输生效
+func (sft *SftpService) SetSessionRateLimit(sessionID string, bytesPerSec int64) error {
+	Logger.Debug("SetSessionRateLimit", zap.String("sessionID", sessionID), zap.Int64("bytesPerSec", bytesPerSec))
+	if bytesPerSec < 0 {
+		return fmt.Errorf("限速不能为负数")
+	}
+	if _, err := sft.getSftpClient(sessionID); err != nil {
+		return err
+	}
+	value, _ := sessionRateLimiters.LoadOrStore(sessionID, newRateLimiter())
+	value.(*rateLimiter).setRate(bytesPerSec)
+	return nil
+}
+
+// GetSessionRateLimit 返回会话的限速（字节/秒），0 表示不限速
+func (sft *SftpService) GetSessionRateLimit(sessionID string) int64 {
+	return sessionRateLimiter(sessionID).getRate()
+}
+
+// SetTransferRateLimit 设置单个传输的限速（字节/秒），0 表示不限速，
+// 可用于等待中和进行中的传输，续传和重试时沿用
+func (sft *SftpService) SetTransferRateLimit(transferID string, bytesPerSec int64) error {
+	Logger.Debug("SetTransferRateLimit", zap.String("transferID", transferID), zap.Int64("bytesPerSec", bytesPerSec))
+	if bytesPerSec < 0 {
+		return fmt.Errorf("限速不能为负数")
+	}
+	return transferQueue.setRateLimit(transferID, bytesPerSec)
+}
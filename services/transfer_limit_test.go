@@ -0,0 +1,82 @@
+package services
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestRateLimiterWait(t *testing.T) {
+	var nilLimiter *rateLimiter
+	if err := nilLimiter.wait(context.Background(), 1<<20); err != nil || nilLimiter.getRate() != 0 {
+		t.Errorf("nil limiter: got %v, rate %d", err, nilLimiter.getRate())
+	}
+
+	l := newRateLimiter()
+	start := time.Now()
+	if err := l.wait(context.Background(), 1<<30); err != nil || time.Since(start) > 50*time.Millisecond {
+		t.Errorf("unlimited: got %v after %v", err, time.Since(start))
+	}
+
+	// 100KB/s 取 10KB 令牌需要等待约 100ms
+	l.setRate(100 << 10)
+	start = time.Now()
+	if err := l.wait(context.Background(), 10<<10); err != nil {
+		t.Fatalf("wait: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed < 80*time.Millisecond {
+		t.Errorf("limited: waited %v, want about 100ms", elapsed)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := l.wait(ctx, 100<<10); err == nil {
+		t.Errorf("cancelled: expected error")
+	}
+}
+
+func TestRateLimiterSetRate(t *testing.T) {
+	l := newRateLimiter()
+	l.setRate(1 << 10)
+	done := make(chan error, 1)
+	go func() { done <- l.wait(context.Background(), 1<<20) }()
+	time.Sleep(20 * time.Millisecond)
+	l.setRate(0)
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("wait: %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("waiting transfer not released after removing limit")
+	}
+
+	// 长时间空闲后令牌不超过桶容量
+	l.setRate(1 << 20)
+	l.mu.Lock()
+	l.last = time.Now().Add(-time.Hour)
+	l.refill()
+	tokens, burst := l.tokens, l.burst()
+	l.mu.Unlock()
+	if tokens != burst {
+		t.Errorf("tokens: got %v, want %v", tokens, burst)
+	}
+}
+
+func TestTrackerRateLimit(t *testing.T) {
+	tracker := newTransferTracker(transferSpec{sessionID: "rate-limit-test"}, 0)
+	t.Cleanup(func() {
+		activeTransfers.Delete(tracker.id)
+		sessionRateLimiters.Delete("rate-limit-test")
+	})
+	if got := tracker.rateLimit(); got != 0 {
+		t.Errorf("no limit: got %d", got)
+	}
+	tracker.limiter.setRate(300)
+	session := newRateLimiter()
+	session.setRate(200)
+	sessionRateLimiters.Store("rate-limit-test", session)
+	if got := tracker.rateLimit(); got != 200 {
+		t.Errorf("min limit: got %d, want 200", got)
+	}
+}
@@ -0,0 +1,300 @@
+package services
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+
+	"github.com/pkg/sftp"
+	"go.uber.org/zap"
+)
+
+// 目录传输的属性保留和符号链接处理：可选保留权限位和修改时间，符号链接按链接复制（默认）、跟随或跳过，
+// 跟随符号链接时每个目录只遍历一次，避免循环和重复传输
+
+const (
+	SymlinkFollow = "follow" // 跟随符号链接，传输指向的文件或目录，可能指向目录之外
+	SymlinkCopy   = "copy"   // 在目标端创建相同的符号链接（默认）
+	SymlinkSkip   = "skip"   // 跳过符号链接
+)
+
+// preserveModeBits 保留权限时复制的模式位
+const preserveModeBits = os.ModePerm | os.ModeSetuid | os.ModeSetgid | os.ModeSticky
+
+// TransferAttrOptions 上传和下载的属性保留与符号链接处理选项
+type TransferAttrOptions struct {
+	PreserveMode  bool   `json:"preserveMode"`  // 保留权限位，从 Windows 上传时忽略
+	PreserveMtime bool   `json:"preserveMtime"` // 保留修改时间
+	Symlinks      string `json:"symlinks"`      // 目录中符号链接的处理方式：follow/copy/skip，为空时按链接复制
+}
+
+// validSymlinkPolicy 检查符号链接处理方式，空字符串表示按链接复制
+func validSymlinkPolicy(policy string) error {
+	switch policy {
+	case "", SymlinkFollow, SymlinkCopy, SymlinkSkip:
+		return nil
+	}
+	return fmt.Errorf("无效的符号链接处理方式: %s", policy)
+}
+
+// defaultTransferAttrs 新建上传和下载任务使用的属性选项，未配置时返回 nil
+func defaultTransferAttrs() *TransferAttrOptions {
+	if ConfigSvc == nil || ConfigSvc.Config == nil {
+		return nil
+	}
+	cfg := ConfigSvc.Config.Transfer
+	attrs := TransferAttrOptions{PreserveMode: cfg.PreserveMode, PreserveMtime: cfg.PreserveMtime, Symlinks: cfg.Symlinks}
+	if attrs == (TransferAttrOptions{}) {
+		return nil
+	}
+	return &attrs
+}
+
+// defaultSymlinkPolicy 新建任务的符号链接处理方式，用于入队时统计目录大小
+func defaultSymlinkPolicy() string {
+	if attrs := defaultTransferAttrs(); attrs != nil {
+		return attrs.Symlinks
+	}
+	return ""
+}
+
+// attrs 返回传输的属性选项
+func (spec transferSpec) attrs() TransferAttrOptions {
+	if spec.options.Attrs != nil {
+		return *spec.options.Attrs
+	}
+	return TransferAttrOptions{}
+}
+
+// treeFS 抽象本地与远程文件系统的目录遍历
+type treeFS struct {
+	readDir  func(string) ([]os.FileInfo, error) // 不跟随符号链接
+	stat     func(string) (os.FileInfo, error)   // 跟随符号链接
+	realPath func(string) (string, error)
+	join     func(...string) string
+	sameFile func(a, b os.FileInfo) bool // 按设备号和 inode 判断是否为同一文件，远程不支持时为 nil
+}
+
+var localTreeFS = treeFS{
+	readDir: func(dir string) ([]os.FileInfo, error) {
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			return nil, err
+		}
+		infos := make([]os.FileInfo, 0, len(entries))
+		for _, entry := range entries {
+			info, err := entry.Info()
+			if err != nil {
+				if os.IsNotExist(err) {
+					continue
+				}
+				return nil, err
+			}
+			infos = append(infos, info)
+		}
+		return infos, nil
+	},
+	stat:     os.Stat,
+	realPath: filepath.EvalSymlinks,
+	join:     filepath.Join,
+	sameFile: os.SameFile,
+}
+
+func remoteTreeFS(ftpClient *sftp.Client) treeFS {
+	return treeFS{readDir: ftpClient.ReadDir, stat: ftpClient.Stat, realPath: ftpClient.RealPath, join: joinRemotePath}
+}
+
+// treeVisitor 目录遍历回调，rel 为相对根目录的路径（以 / 分隔，根目录为空字符串）
+type treeVisitor struct {
+	dir     func(src, rel string, info os.FileInfo) error // 处理目录内容之前
+	dirDone func(src, rel string, info os.FileInfo) error // 目录内容处理完成之后
+	file    func(src, rel string, info os.FileInfo) error
+	symlink func(src, rel string) error // 符号链接处理方式为 copy 时调用
+}
+
+// walkTree 深度优先遍历目录 root，回调为 nil 时忽略对应的条目。符号链接默认按链接复制，不会访问目录之外的文件。
+// 跟随符号链接时记录已遍历目录的真实路径，本地还按设备号和 inode 比较当前路径上的目录，
+// 指向已遍历目录（包括上级目录）的链接跳过，指向不存在的目标的链接同样跳过
+func walkTree(fs treeFS, root string, symlinks string, v treeVisitor) error {
+	info, err := fs.stat(root)
+	if err != nil {
+		return err
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("path is not a directory")
+	}
+	realDir, err := fs.realPath(root)
+	if err != nil {
+		return err
+	}
+	w := &treeWalk{fs: fs, symlinks: symlinks, visitor: v, visited: make(map[string]bool)}
+	return w.walkDir(root, realDir, "", info)
+}
+
+type treeWalk struct {
+	fs        treeFS
+	symlinks  string
+	visitor   treeVisitor
+	visited   map[string]bool // 已遍历目录的真实路径
+	ancestors []os.FileInfo   // 当前路径上的目录
+}
+
+// seen 判断目录是否已经遍历过或者是当前路径上的目录
+func (w *treeWalk) seen(realDir string, info os.FileInfo) bool {
+	if w.visited[realDir] {
+		return true
+	}
+	if w.fs.sameFile != nil {
+		for _, ancestor := range w.ancestors {
+			if w.fs.sameFile(ancestor, info) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (w *treeWalk) walkDir(dir, realDir, rel string, info os.FileInfo) error {
+	if w.seen(realDir, info) {
+		Logger.Warn("skip visited directory", zap.String("path", dir), zap.String("target", realDir))
+		return nil
+	}
+	w.visited[realDir] = true
+	w.ancestors = append(w.ancestors, info)
+	defer func() { w.ancestors = w.ancestors[:len(w.ancestors)-1] }()
+
+	if w.visitor.dir != nil {
+		if err := w.visitor.dir(dir, rel, info); err != nil {
+			return err
+		}
+	}
+	entries, err := w.fs.readDir(dir)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		src := w.fs.join(dir, entry.Name())
+		entryRel := entry.Name()
+		if rel != "" {
+			entryRel = rel + "/" + entry.Name()
+		}
+		entryReal := w.fs.join(realDir, entry.Name())
+		if entry.Mode()&os.ModeSymlink != 0 {
+			switch w.symlinks {
+			case SymlinkSkip:
+				Logger.Debug("skip symlink", zap.String("path", src))
+				continue
+			case SymlinkFollow:
+			default:
+				if w.visitor.symlink != nil {
+					if err := w.visitor.symlink(src, entryRel); err != nil {
+						return err
+					}
+				}
+				continue
+			}
+			if entry, err = w.fs.stat(src); err != nil {
+				if os.IsNotExist(err) {
+					Logger.Warn("skip broken symlink", zap.String("path", src))
+					continue
+				}
+				return err
+			}
+			if entry.IsDir() {
+				if entryReal, err = w.fs.realPath(src); err != nil {
+					return err
+				}
+			}
+		}
+		switch {
+		case entry.IsDir():
+			err = w.walkDir(src, entryReal, entryRel, entry)
+		case entry.Mode().IsRegular() && w.visitor.file != nil:
+			err = w.visitor.file(src, entryRel, entry)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	if w.visitor.dirDone != nil {
+		return w.visitor.dirDone(dir, rel, info)
+	}
+	return nil
+}
+
+// applyRemoteAttrs 按选项设置远程文件或目录的权限位和修改时间，info 为本地源文件信息
+func applyRemoteAttrs(ftpClient *sftp.Client, remotePath string, info os.FileInfo, attrs TransferAttrOptions) error {
+	// Windows 没有 Unix 权限位，保留权限会把远程文件改为 0666/0777
+	if attrs.PreserveMode && runtime.GOOS != "windows" {
+		if err := ftpClient.Chmod(remotePath, info.Mode()&preserveModeBits); err != nil {
+			return fmt.Errorf("设置 %s 的权限失败: %w", remotePath, err)
+		}
+	}
+	if attrs.PreserveMtime {
+		if err := ftpClient.Chtimes(remotePath, info.ModTime(), info.ModTime()); err != nil {
+			return fmt.Errorf("设置 %s 的修改时间失败: %w", remotePath, err)
+		}
+	}
+	return nil
+}
+
+// applyLocalAttrs 按选项设置本地文件或目录的权限位和修改时间，info 为远程源文件信息
+func applyLocalAttrs(localPath string, info os.FileInfo, attrs TransferAttrOptions) error {
+	if attrs.PreserveMode {
+		if err := os.Chmod(localPath, info.Mode()&preserveModeBits); err != nil {
+			return fmt.Errorf("设置 %s 的权限失败: %w", localPath, err)
+		}
+	}
+	if attrs.PreserveMtime {
+		if err := os.Chtimes(localPath, info.ModTime(), info.ModTime()); err != nil {
+			return fmt.Errorf("设置 %s 的修改时间失败: %w", localPath, err)
+		}
+	}
+	return nil
+}
+
+// copySymlinkToRemote 在远程创建与本地相同的符号链接，已存在的符号链接会被替换
+func copySymlinkToRemote(ftpClient *sftp.Client, localPath, remotePath string) error {
+	target, err := os.Readlink(localPath)
+	if err != nil {
+		return err
+	}
+	if info, err := ftpClient.Lstat(remotePath); err == nil {
+		if info.Mode()&os.ModeSymlink == 0 {
+			return fmt.Errorf("%s 已存在且不是符号链接", remotePath)
+		}
+		if err := ftpClient.Remove(remotePath); err != nil {
+			return err
+		}
+	}
+	Logger.Debug("upload symlink", zap.String("path", remotePath), zap.String("target", target))
+	return ftpClient.Symlink(filepath.ToSlash(target), remotePath)
+}
+
+// copySymlinkToLocal 在本地创建与远程相同的符号链接，已存在的符号链接会被替换
+func copySymlinkToLocal(ftpClient *sftp.Client, remotePath, localPath string) error {
+	target, err := ftpClient.ReadLink(remotePath)
+	if err != nil {
+		return err
+	}
+	if info, err := os.Lstat(localPath); err == nil {
+		if info.Mode()&os.ModeSymlink == 0 {
+			return fmt.Errorf("%s 已存在且不是符号链接", localPath)
+		}
+		if err := os.Remove(localPath); err != nil {
+			return err
+		}
+	}
+	Logger.Debug("download symlink", zap.String("path", localPath), zap.String("target", target))
+	return os.Symlink(filepath.FromSlash(target), localPath)
+}
+
+// SetTransferAttrOptions 修改等待中或暂停的上传、下载任务的属性保留和符号链接处理选项
+func (sft *SftpService) SetTransferAttrOptions(transferID string, attrs TransferAttrOptions) error {
+	Logger.Debug("SetTransferAttrOptions", zap.String("transferID", transferID), zap.Any("attrs", attrs))
+	if err := validSymlinkPolicy(attrs.Symlinks); err != nil {
+		return err
+	}
+	return transferQueue.setAttrOptions(transferID, attrs)
+}
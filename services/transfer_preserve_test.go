@@ -0,0 +1,68 @@
+package services
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestWalkTreeSymlinks(t *testing.T) {
+	base := t.TempDir()
+	root := filepath.Join(base, "root")
+	outside := filepath.Join(base, "outside")
+	for _, dir := range []string{filepath.Join(root, "sub"), outside} {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, file := range []string{filepath.Join(root, "a.txt"), filepath.Join(root, "sub", "b.txt"), filepath.Join(outside, "c.txt")} {
+		if err := os.WriteFile(file, []byte("x"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	links := map[string]string{
+		"loop":   root,
+		"dup":    filepath.Join(root, "sub"),
+		"out":    outside,
+		"broken": filepath.Join(base, "missing"),
+	}
+	for name, target := range links {
+		if err := os.Symlink(target, filepath.Join(root, name)); err != nil {
+			t.Skipf("symlink not supported: %v", err)
+		}
+	}
+
+	walk := func(policy string) (files, symlinks []string) {
+		err := walkTree(localTreeFS, root, policy, treeVisitor{
+			file: func(_, rel string, _ os.FileInfo) error {
+				files = append(files, rel)
+				return nil
+			},
+			symlink: func(_, rel string) error {
+				symlinks = append(symlinks, rel)
+				return nil
+			},
+		})
+		if err != nil {
+			t.Fatalf("walkTree(%q): %v", policy, err)
+		}
+		slices.Sort(files)
+		slices.Sort(symlinks)
+		return files, symlinks
+	}
+
+	files, symlinks := walk("")
+	if !slices.Equal(files, []string{"a.txt", "sub/b.txt"}) || !slices.Equal(symlinks, []string{"broken", "dup", "loop", "out"}) {
+		t.Errorf("default: got files %q, symlinks %q", files, symlinks)
+	}
+	files, symlinks = walk(SymlinkSkip)
+	if !slices.Equal(files, []string{"a.txt", "sub/b.txt"}) || len(symlinks) != 0 {
+		t.Errorf("skip: got files %q, symlinks %q", files, symlinks)
+	}
+	// 跟随时 sub 与 dup 是同一个目录，只遍历一次；指向根目录的链接跳过
+	files, symlinks = walk(SymlinkFollow)
+	if !slices.Equal(files, []string{"a.txt", "dup/b.txt", "out/c.txt"}) || len(symlinks) != 0 {
+		t.Errorf("follow: got files %q, symlinks %q", files, symlinks)
+	}
+}
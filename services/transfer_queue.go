@@ -0,0 +1,765 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/ilaziness/vexo/internal/database"
+	"github.com/ilaziness/vexo/internal/system"
+	"github.com/ilaziness/vexo/internal/utils"
+	"go.uber.org/zap"
+)
+
+// 传输队列：限制全局和单会话并发，支持暂停、续传、重试、取消和优先级，队列状态持久化到 SQLite
+
+const (
+	TransferStatusQueued    = "queued"
+	TransferStatusRunning   = "running"
+	TransferStatusPaused    = "paused"
+	TransferStatusDone      = "done"
+	TransferStatusFailed    = "failed"
+	TransferStatusCancelled = "cancelled"
+
+	defaultTransferConcurrency        = 4
+	defaultSessionTransferConcurrency = 2
+	// maxCancelledTransfers 内存中保留的已取消任务数量，超出时移除最早取消的任务；
+	// 已完成的任务记录到传输历史后立即移除
+	maxCancelledTransfers = 100
+)
+
+var transferQueue *TransferQueue
+
+// TransferQueue 传输队列
+type TransferQueue struct {
+	mu            sync.Mutex
+	sft           *SftpService
+	repo          *database.TransferRepository
+	jobs          map[string]*transferJob
+	seq           int64
+	maxGlobal     int
+	maxPerSession int
+}
+
+// transferJob 队列中的一个传输任务
+type transferJob struct {
+	id          string
+	spec        transferSpec
+	host        string // 入队时会话的 user@host:port，换会话继续时要求是同一主机
+	priority    int
+	seq         int64 // 入队顺序，同优先级先入先出
+	status      string
+	resume      bool // 下次执行时从断点续传
+	verifyTail  bool
+	total       int64
+	transferred int64
+	err         string
+	verify      string // 传输后校验结果
+	rateLimit   int64  // 单个传输的限速，字节/秒
+	conflict    *conflictState
+	stopStatus  string // 运行中被暂停或取消时的目标状态
+	tracker     *transferTracker
+	waiters     []chan error // 等待本次执行结束的调用方
+	createdAt   time.Time
+	startedAt   time.Time // 本次开始执行的时间
+	stoppedAt   time.Time // 取消的时间，用于移除最早取消的任务
+}
+
+// TransferJobInfo 传输任务信息，用于前端传输列表
+type TransferJobInfo struct {
+	ID           string `json:"id"`
+	SessionID    string `json:"sessionID"`
+	TransferType string `json:"transferType"`
+	IsDir        bool   `json:"isDir"`
+	LocalFile    string `json:"localFile"`
+	RemoteFile   string `json:"remoteFile"`
+	Status       string `json:"status"`
+	Priority     int    `json:"priority"`
+	TotalSize    int64  `json:"totalSize"`
+	Transferred  int64  `json:"transferred"`
+	Error        string `json:"error"`
+	Verify       string `json:"verify"`    // 传输后校验结果：passed/failed/unavailable，未校验时为空
+	RateLimit    int64  `json:"rateLimit"` // 单个传输的限速，字节/秒，0 表示不限速
+	Conflict     string `json:"conflict"`  // 冲突处理方式，为空时覆盖
+	CreatedAt    int64  `json:"createdAt"` // unix 毫秒
+}
+
+// initTransferQueue 创建传输队列并恢复上次未完成的任务。
+// 会话在重启后已失效，恢复的任务统一置为暂停，由用户指定会话后继续
+func initTransferQueue(sft *SftpService, db *database.Database, cfg TransferConfig) {
+	q := &TransferQueue{
+		sft:  sft,
+		repo: db.TransferRepo,
+		jobs: make(map[string]*transferJob),
+	}
+	q.applyLimits(cfg)
+
+	dbJobs, err := q.repo.GetAllJobs()
+	if err != nil {
+		Logger.Warn("load transfer jobs failed", zap.Error(err))
+	}
+	for _, dj := range dbJobs {
+		var options transferOptions
+		if dj.Options != "" {
+			if err := json.Unmarshal([]byte(dj.Options), &options); err != nil {
+				Logger.Warn("parse transfer job options failed", zap.String("id", dj.ID), zap.Error(err))
+			}
+		}
+		var owned []string
+		if dj.Owned != "" {
+			if err := json.Unmarshal([]byte(dj.Owned), &owned); err != nil {
+				Logger.Warn("parse transfer job owned targets failed", zap.String("id", dj.ID), zap.Error(err))
+			}
+		}
+		job := &transferJob{
+			id: dj.ID,
+			spec: transferSpec{
+				sessionID:    dj.SessionID,
+				transferType: dj.TransferType,
+				isDir:        dj.IsDir,
+				localPath:    dj.LocalPath,
+				remotePath:   dj.RemotePath,
+				options:      options,
+			},
+			host:        dj.Host,
+			priority:    dj.Priority,
+			rateLimit:   dj.RateLimit,
+			seq:         q.nextSeq(),
+			status:      dj.Status,
+			resume:      true,
+			total:       dj.TotalSize,
+			transferred: dj.Transferred,
+			err:         dj.Error,
+			verify:      dj.Verify,
+			conflict:    newConflictState(options.Conflict, owned),
+			createdAt:   dj.CreatedAt,
+		}
+		if job.status == TransferStatusQueued || job.status == TransferStatusRunning {
+			job.status = TransferStatusPaused
+			q.persist(job)
+		}
+		q.jobs[job.id] = job
+	}
+	transferQueue = q
+}
+
+func (q *TransferQueue) nextSeq() int64 {
+	q.seq++
+	return q.seq
+}
+
+func (q *TransferQueue) applyLimits(cfg TransferConfig) {
+	q.maxGlobal = cfg.MaxConcurrent
+	if q.maxGlobal <= 0 {
+		q.maxGlobal = defaultTransferConcurrency
+	}
+	q.maxPerSession = cfg.MaxPerSession
+	if q.maxPerSession <= 0 {
+		q.maxPerSession = defaultSessionTransferConcurrency
+	}
+	globalRateLimiter.setRate(cfg.RateLimit)
+}
+
+// setLimits 修改并发限制和全局限速，调高后立即调度等待中的任务
+func (q *TransferQueue) setLimits(cfg TransferConfig) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.applyLimits(cfg)
+	q.schedule()
+}
+
+// enqueue 添加传输任务，total 为已知的总大小（未知时为 0，开始执行时计算）
+func (q *TransferQueue) enqueue(spec transferSpec, total int64) string {
+	return q.add(spec, total, nil)
+}
+
+// enqueueWait 添加传输任务并等待本次执行结束，返回传输的错误，暂停和取消也作为错误返回
+func (q *TransferQueue) enqueueWait(spec transferSpec, total int64) error {
+	done := make(chan error, 1)
+	q.add(spec, total, done)
+	return <-done
+}
+
+// add 添加传输任务，done 非空时在本次执行结束后收到结果
+func (q *TransferQueue) add(spec transferSpec, total int64, done chan error) string {
+	if (spec.transferType == TransferTypeUpload || spec.transferType == TransferTypeDownload) && spec.options.Archive == nil {
+		if spec.options.Conflict == "" {
+			spec.options.Conflict = defaultConflictPolicy()
+		}
+		if spec.options.Attrs == nil {
+			spec.options.Attrs = defaultTransferAttrs()
+		}
+	}
+	_, host := sessionOrigin(spec.sessionID)
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	job := &transferJob{
+		id:        utils.GenerateRandomID(),
+		spec:      spec,
+		host:      host,
+		seq:       q.nextSeq(),
+		status:    TransferStatusQueued,
+		total:     total,
+		conflict:  newConflictState(spec.options.Conflict, nil),
+		createdAt: time.Now(),
+	}
+	if done != nil {
+		job.waiters = append(job.waiters, done)
+	}
+	q.jobs[job.id] = job
+	if err := q.repo.InsertJob(q.toDB(job)); err != nil {
+		Logger.Warn("insert transfer job failed", zap.Error(err))
+	}
+	q.emit(job)
+	q.schedule()
+	return job.id
+}
+
+// schedule 按优先级启动等待中的任务，调用方需持有锁
+func (q *TransferQueue) schedule() {
+	running := 0
+	perSession := make(map[string]int)
+	waiting := make([]*transferJob, 0)
+	for _, job := range q.jobs {
+		switch job.status {
+		case TransferStatusRunning:
+			running++
+			perSession[job.spec.sessionID]++
+		case TransferStatusQueued:
+			waiting = append(waiting, job)
+		}
+	}
+	sort.Slice(waiting, func(i, j int) bool {
+		if waiting[i].priority != waiting[j].priority {
+			return waiting[i].priority > waiting[j].priority
+		}
+		return waiting[i].seq < waiting[j].seq
+	})
+	for _, job := range waiting {
+		if running >= q.maxGlobal {
+			return
+		}
+		if perSession[job.spec.sessionID] >= q.maxPerSession {
+			continue
+		}
+		running++
+		perSession[job.spec.sessionID]++
+		q.start(job)
+	}
+}
+
+// start 启动任务，调用方需持有锁
+func (q *TransferQueue) start(job *transferJob) {
+	job.status = TransferStatusRunning
+	job.stopStatus = ""
+	job.err = ""
+	q.persist(job)
+	system.SafeGo(func() {
+		q.run(job)
+	})
+}
+
+// run 执行任务，结束后根据结果更新状态并继续调度
+func (q *TransferQueue) run(job *transferJob) {
+	q.mu.Lock()
+	job.startedAt = time.Now()
+	q.mu.Unlock()
+	total, err := q.sft.transferTotal(job.spec)
+	if err != nil {
+		q.finish(job, nil, err)
+		return
+	}
+
+	q.mu.Lock()
+	tracker := newTransferTrackerWithID(job.id, job.spec, total)
+	tracker.resume = job.resume
+	tracker.verifyTail = job.verifyTail
+	tracker.priority = job.priority
+	tracker.limiter.setRate(job.rateLimit)
+	tracker.conflict = job.conflict
+	if ConfigSvc != nil && ConfigSvc.Config != nil && ConfigSvc.Config.Transfer.Verify {
+		tracker.verifier = &transferVerifier{}
+	}
+	job.total = total
+	job.tracker = tracker
+	// 启动前已被暂停或取消
+	if job.stopStatus != "" {
+		tracker.cancelFunc()
+	}
+	q.mu.Unlock()
+
+	tracker.startProgress()
+	err = q.sft.executeTransfer(job.spec, tracker)
+	if err == nil {
+		// 校验最后一批未凑满的文件
+		err = q.sft.flushVerify(tracker)
+	}
+	invalidateTransferListings(job.spec)
+	q.finish(job, tracker, err)
+}
+
+// finish 记录任务的结果并调度下一个任务，传输历史在释放锁后写入
+func (q *TransferQueue) finish(job *transferJob, tracker *transferTracker, err error) {
+	if record := q.complete(job, tracker, err); record != nil {
+		q.saveHistory(record)
+	}
+}
+
+// complete 更新结束的任务，返回需要保存的传输历史，暂停的任务返回 nil
+func (q *TransferQueue) complete(job *transferJob, tracker *transferTracker, err error) *database.TransferHistoryDB {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	status := TransferStatusDone
+	switch {
+	case job.stopStatus != "":
+		status = job.stopStatus
+	case err != nil:
+		status = TransferStatusFailed
+	}
+	job.status = status
+	job.tracker = nil
+	// 失败、暂停或取消后再次执行时从断点续传
+	job.resume = status != TransferStatusDone
+	job.err = ""
+	if err != nil && status == TransferStatusFailed {
+		job.err = err.Error()
+		Logger.Warn("transfer failed", zap.String("id", job.id), zap.Error(err))
+	}
+	var skipped int64
+	if tracker != nil {
+		tracker.mutex.Lock()
+		skipped = tracker.skipped
+		tracker.mutex.Unlock()
+		job.total = tracker.getTotal()
+		job.transferred = tracker.getTransferred()
+		job.verify = tracker.verifier.status()
+		tracker.stopProgress(status, err)
+	} else {
+		q.emit(job)
+	}
+
+	var record *database.TransferHistoryDB
+	if status != TransferStatusPaused {
+		record = q.historyRecord(job, skipped)
+	}
+
+	// 已完成和取消的任务不再保留在持久化队列中
+	if status == TransferStatusDone || status == TransferStatusCancelled {
+		if err := q.repo.DeleteJob(job.id); err != nil {
+			Logger.Warn("delete transfer job failed", zap.Error(err))
+		}
+	} else {
+		q.persist(job)
+	}
+	job.notifyWaiters()
+	q.evict(job)
+	q.schedule()
+	return record
+}
+
+// notifyWaiters 把本次执行的结果发送给等待的调用方，调用方需持有锁
+func (job *transferJob) notifyWaiters() {
+	if len(job.waiters) == 0 {
+		return
+	}
+	var err error
+	switch job.status {
+	case TransferStatusFailed:
+		err = errors.New(job.err)
+	case TransferStatusCancelled:
+		err = errors.New("传输已取消")
+	case TransferStatusPaused:
+		err = errors.New("传输已暂停，可在传输列表中继续")
+	}
+	for _, ch := range job.waiters {
+		ch <- err
+	}
+	job.waiters = nil
+}
+
+// evict 从内存中移除已结束的任务，调用方需持有锁。已完成的任务已记录到传输历史，直接移除；
+// 已取消的任务仍可继续，只保留最近 maxCancelledTransfers 个
+func (q *TransferQueue) evict(job *transferJob) {
+	switch job.status {
+	case TransferStatusDone:
+		delete(q.jobs, job.id)
+		return
+	case TransferStatusCancelled:
+		job.stoppedAt = time.Now()
+	default:
+		return
+	}
+	cancelled := make([]*transferJob, 0)
+	for _, j := range q.jobs {
+		if j.status == TransferStatusCancelled {
+			cancelled = append(cancelled, j)
+		}
+	}
+	if len(cancelled) <= maxCancelledTransfers {
+		return
+	}
+	sort.Slice(cancelled, func(i, j int) bool {
+		return cancelled[i].stoppedAt.Before(cancelled[j].stoppedAt)
+	})
+	for _, j := range cancelled[:len(cancelled)-maxCancelledTransfers] {
+		delete(q.jobs, j.id)
+	}
+}
+
+// stop 暂停或取消任务
+func (q *TransferQueue) stop(jobID string, status string) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	job, ok := q.jobs[jobID]
+	if !ok {
+		return fmt.Errorf("transfer with ID %s not found", jobID)
+	}
+	switch job.status {
+	case TransferStatusRunning:
+		job.stopStatus = status
+		if job.tracker != nil {
+			job.tracker.cancelFunc()
+		}
+		return nil
+	case TransferStatusQueued, TransferStatusPaused, TransferStatusFailed:
+		if status == TransferStatusPaused && job.status != TransferStatusQueued {
+			return fmt.Errorf("只能暂停等待中或进行中的传输")
+		}
+		job.status = status
+		job.resume = true
+		if status == TransferStatusCancelled {
+			if err := q.repo.DeleteJob(job.id); err != nil {
+				Logger.Warn("delete transfer job failed", zap.Error(err))
+			}
+		} else {
+			q.persist(job)
+		}
+		q.emit(job)
+		job.notifyWaiters()
+		q.evict(job)
+		return nil
+	}
+	return fmt.Errorf("传输已结束")
+}
+
+// requeue 将暂停、失败或取消的任务重新放回队列。
+// resume 为 false 时从头传输；sessionID 非空时改用该会话（重启后恢复的任务需要指定新会话）
+func (q *TransferQueue) requeue(jobID string, sessionID string, resume bool, verifyTail bool) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	job, ok := q.jobs[jobID]
+	if !ok {
+		return fmt.Errorf("transfer with ID %s not found", jobID)
+	}
+	switch job.status {
+	case TransferStatusPaused, TransferStatusFailed, TransferStatusCancelled:
+	default:
+		return fmt.Errorf("传输正在进行或已完成")
+	}
+	if sessionID != "" {
+		if _, err := q.sft.getSftpClient(sessionID); err != nil {
+			return err
+		}
+		// 换会话时要求连接同一主机，避免把文件传到其他服务器或用其他服务器上的文件续传
+		_, host := sessionOrigin(sessionID)
+		if job.host != "" && host != job.host {
+			return fmt.Errorf("会话连接的主机 %s 与传输任务的主机 %s 不一致", host, job.host)
+		}
+		job.spec.sessionID = sessionID
+		job.host = host
+	}
+	if _, err := q.sft.getSftpClient(job.spec.sessionID); err != nil {
+		return errors.New("传输所属的会话已关闭，请指定新的会话")
+	}
+	wasCancelled := job.status == TransferStatusCancelled
+	job.status = TransferStatusQueued
+	job.resume = resume
+	job.verifyTail = verifyTail
+	job.seq = q.nextSeq()
+	job.err = ""
+	job.verify = ""
+	if wasCancelled {
+		if err := q.repo.InsertJob(q.toDB(job)); err != nil {
+			Logger.Warn("insert transfer job failed", zap.Error(err))
+		}
+	} else {
+		q.persist(job)
+	}
+	q.emit(job)
+	q.schedule()
+	return nil
+}
+
+// setPriority 修改任务优先级并重新调度
+func (q *TransferQueue) setPriority(jobID string, priority int) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	job, ok := q.jobs[jobID]
+	if !ok {
+		return fmt.Errorf("transfer with ID %s not found", jobID)
+	}
+	job.priority = priority
+	if job.tracker != nil {
+		job.tracker.setPriority(priority)
+	}
+	q.persist(job)
+	q.emit(job)
+	q.schedule()
+	return nil
+}
+
+// setRateLimit 修改任务的限速，进行中的任务立即生效
+func (q *TransferQueue) setRateLimit(jobID string, bytesPerSec int64) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	job, ok := q.jobs[jobID]
+	if !ok {
+		return fmt.Errorf("transfer with ID %s not found", jobID)
+	}
+	job.rateLimit = bytesPerSec
+	q.persist(job)
+	if job.tracker != nil {
+		job.tracker.limiter.setRate(bytesPerSec)
+		return nil
+	}
+	q.emit(job)
+	return nil
+}
+
+// setConflictPolicy 修改上传或下载任务的冲突处理方式，进行中的任务对之后的文件生效
+func (q *TransferQueue) setConflictPolicy(jobID string, policy string) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	job, ok := q.jobs[jobID]
+	if !ok {
+		return fmt.Errorf("transfer with ID %s not found", jobID)
+	}
+	if (job.spec.transferType != TransferTypeUpload && job.spec.transferType != TransferTypeDownload) || job.spec.options.Archive != nil {
+		return fmt.Errorf("只有上传和下载任务可以设置冲突处理方式")
+	}
+	job.spec.options.Conflict = policy
+	job.conflict.setPolicy(policy)
+	q.persist(job)
+	if job.tracker == nil {
+		q.emit(job)
+	}
+	return nil
+}
+
+// setAttrOptions 修改上传或下载任务的属性选项，进行中的任务需要暂停后修改
+func (q *TransferQueue) setAttrOptions(jobID string, attrs TransferAttrOptions) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	job, ok := q.jobs[jobID]
+	if !ok {
+		return fmt.Errorf("transfer with ID %s not found", jobID)
+	}
+	if (job.spec.transferType != TransferTypeUpload && job.spec.transferType != TransferTypeDownload) || job.spec.options.Archive != nil {
+		return fmt.Errorf("只有上传和下载任务可以设置属性选项")
+	}
+	if job.status == TransferStatusRunning {
+		return fmt.Errorf("传输进行中，请暂停后修改")
+	}
+	job.spec.options.Attrs = &attrs
+	if attrs == (TransferAttrOptions{}) {
+		job.spec.options.Attrs = nil
+	}
+	q.persist(job)
+	return nil
+}
+
+// remove 从列表中移除已结束的任务
+func (q *TransferQueue) remove(jobID string) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	job, ok := q.jobs[jobID]
+	if !ok {
+		return fmt.Errorf("transfer with ID %s not found", jobID)
+	}
+	if job.status == TransferStatusRunning || job.status == TransferStatusQueued {
+		return fmt.Errorf("请先取消传输")
+	}
+	delete(q.jobs, jobID)
+	return q.repo.DeleteJob(jobID)
+}
+
+// clearFinished 移除所有已完成和已取消的任务，已完成的任务通常在结束时已移除
+func (q *TransferQueue) clearFinished() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for id, job := range q.jobs {
+		if job.status == TransferStatusDone || job.status == TransferStatusCancelled {
+			delete(q.jobs, id)
+		}
+	}
+}
+
+// list 返回所有任务，按优先级和入队顺序排列
+func (q *TransferQueue) list() []TransferJobInfo {
+	q.mu.Lock()
+	jobs := make([]*transferJob, 0, len(q.jobs))
+	for _, job := range q.jobs {
+		jobs = append(jobs, job)
+	}
+	sort.Slice(jobs, func(i, j int) bool {
+		if jobs[i].priority != jobs[j].priority {
+			return jobs[i].priority > jobs[j].priority
+		}
+		return jobs[i].seq < jobs[j].seq
+	})
+	result := make([]TransferJobInfo, 0, len(jobs))
+	for _, job := range jobs {
+		result = append(result, job.info())
+	}
+	q.mu.Unlock()
+	return result
+}
+
+func (job *transferJob) info() TransferJobInfo {
+	localFile, remoteFile := job.spec.trackerPaths()
+	transferred := job.transferred
+	if job.tracker != nil {
+		transferred = job.tracker.getTransferred()
+	}
+	return TransferJobInfo{
+		ID:           job.id,
+		SessionID:    job.spec.sessionID,
+		TransferType: job.spec.transferType,
+		IsDir:        job.spec.isDir,
+		LocalFile:    localFile,
+		RemoteFile:   remoteFile,
+		Status:       job.status,
+		Priority:     job.priority,
+		TotalSize:    job.total,
+		Transferred:  transferred,
+		Error:        job.err,
+		Verify:       job.verify,
+		RateLimit:    job.rateLimit,
+		Conflict:     job.spec.options.Conflict,
+		CreatedAt:    job.createdAt.UnixMilli(),
+	}
+}
+
+// emit 推送没有运行中进度的任务状态（等待、暂停、失败等）
+func (q *TransferQueue) emit(job *transferJob) {
+	if app == nil {
+		return
+	}
+	localFile, remoteFile := job.spec.trackerPaths()
+	status := job.status
+	app.Event.Emit(EventProgress, ProgressData{
+		ID:           job.id,
+		SessionID:    job.spec.sessionID,
+		TransferType: job.spec.transferType,
+		LocalFile:    localFile,
+		RemoteFile:   remoteFile,
+		TotalSize:    job.total,
+		Rate:         progressRate(job.transferred, job.total),
+		Done:         status == TransferStatusDone || status == TransferStatusFailed || status == TransferStatusCancelled,
+		Error:        job.err,
+		Resumable:    status == TransferStatusFailed || status == TransferStatusCancelled || status == TransferStatusPaused,
+		Status:       status,
+		Priority:     job.priority,
+		Transferred:  job.transferred,
+		ETA:          -1,
+		Verify:       job.verify,
+		RateLimit:    job.rateLimit,
+	})
+}
+
+func (q *TransferQueue) toDB(job *transferJob) *database.TransferJobDB {
+	var options string
+	if job.spec.options != (transferOptions{}) {
+		data, err := json.Marshal(job.spec.options)
+		if err != nil {
+			Logger.Warn("marshal transfer job options failed", zap.Error(err))
+		}
+		options = string(data)
+	}
+	// 本任务创建的目标文件，重启后续传时只有这些文件按部分文件续传；
+	// 在状态变化时保存，运行中程序退出时最近创建的文件未保存，续传时按冲突策略处理
+	var owned string
+	if targets := job.conflict.ownedTargets(); len(targets) > 0 {
+		data, err := json.Marshal(targets)
+		if err != nil {
+			Logger.Warn("marshal transfer job owned targets failed", zap.Error(err))
+		}
+		owned = string(data)
+	}
+	return &database.TransferJobDB{
+		ID:           job.id,
+		SessionID:    job.spec.sessionID,
+		Host:         job.host,
+		TransferType: job.spec.transferType,
+		IsDir:        job.spec.isDir,
+		LocalPath:    job.spec.localPath,
+		RemotePath:   job.spec.remotePath,
+		Status:       job.status,
+		Priority:     job.priority,
+		RateLimit:    job.rateLimit,
+		TotalSize:    job.total,
+		Transferred:  job.transferred,
+		Error:        job.err,
+		Options:      options,
+		Owned:        owned,
+		Verify:       job.verify,
+		CreatedAt:    job.createdAt,
+		UpdatedAt:    time.Now(),
+	}
+}
+
+func (q *TransferQueue) persist(job *transferJob) {
+	if err := q.repo.UpdateJob(q.toDB(job)); err != nil {
+		Logger.Warn("update transfer job failed", zap.String("id", job.id), zap.Error(err))
+	}
+}
+
+// ListTransfers 列出传输队列中的任务，包括重启前未完成的任务
+func (sft *SftpService) ListTransfers() []TransferJobInfo {
+	return transferQueue.list()
+}
+
+// PauseTransfer 暂停等待中或进行中的传输，已传输的部分保留，继续时从断点续传
+func (sft *SftpService) PauseTransfer(transferID string) error {
+	Logger.Debug("PauseTransfer", zap.String("transferID", transferID))
+	return transferQueue.stop(transferID, TransferStatusPaused)
+}
+
+// ResumeTransfer 继续暂停、失败或取消的传输，沿用原传输 ID。
+// 已存在的部分文件从断点继续，目录传输中已完成的文件直接跳过；
+// verifyTail 为 true 时先比对已传输部分末尾 1MB 的 SHA-256，不一致则该文件从头传输。
+func (sft *SftpService) ResumeTransfer(transferID string, verifyTail bool) error {
+	Logger.Debug("ResumeTransfer", zap.String("transferID", transferID), zap.Bool("verifyTail", verifyTail))
+	return transferQueue.requeue(transferID, "", true, verifyTail)
+}
+
+// RetryTransfer 从头重新执行传输。sessionID 为空时使用原会话，
+// 重启后恢复的任务原会话已失效，需要指定同一主机的新会话
+func (sft *SftpService) RetryTransfer(transferID string, sessionID string) error {
+	Logger.Debug("RetryTransfer", zap.String("transferID", transferID), zap.String("sessionID", sessionID))
+	return transferQueue.requeue(transferID, sessionID, false, false)
+}
+
+// ResumeTransferInSession 在指定会话上断点续传，用于重启后恢复的任务
+func (sft *SftpService) ResumeTransferInSession(transferID string, sessionID string, verifyTail bool) error {
+	return transferQueue.requeue(transferID, sessionID, true, verifyTail)
+}
+
+// SetTransferPriority 设置传输优先级，数值越大越先执行
+func (sft *SftpService) SetTransferPriority(transferID string, priority int) error {
+	return transferQueue.setPriority(transferID, priority)
+}
+
+// RemoveTransfer 从传输列表移除已结束、暂停或失败的任务
+func (sft *SftpService) RemoveTransfer(transferID string) error {
+	return transferQueue.remove(transferID)
+}
+
+// ClearFinishedTransfers 清除已完成和已取消的任务
+func (sft *SftpService) ClearFinishedTransfers() {
+	transferQueue.clearFinished()
+}